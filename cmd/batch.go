@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"service_fraud/interfaces"
+	"service_fraud/models"
+	"service_fraud/render"
+	"service_fraud/utils"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BatchOptions holds the settings of a batch execution.
+type BatchOptions struct {
+	// Format is the output format of each line, 'ndjson' or 'csv'.
+	Format string
+	// Workers is the number of IPs traced concurrently.
+	Workers int
+}
+
+// batchItem holds an IP read from the input and the outcome of tracing it.
+type batchItem struct {
+	index  int
+	ip     string
+	result models.TraceResult
+	err    error
+}
+
+// RunBatch traces every IP read from in, one per line, using a bounded pool of workers
+// and writes one result per line to out preserving the input order. Empty lines and
+// lines starting with '#' are ignored. Once the context is canceled the remaining IPs
+// fail without being traced.
+func RunBatch(ctx context.Context, process interfaces.GetInformation, in io.Reader, out io.Writer, opts BatchOptions) (models.BatchSummary, error) {
+	since := time.Now()
+	summary := models.BatchSummary{FailuresByCode: make(map[int]int)}
+	writer, err := render.NewBatchWriter(out, opts.Format)
+	if err != nil {
+		return summary, err
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = utils.BATCH_DEFAULT_WORKERS
+	}
+	workers = min(workers, utils.BATCH_MAX_WORKERS)
+
+	jobs := make(chan batchItem, workers)
+	results := make(chan batchItem, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range jobs {
+				item.result, item.err = traceBatchItem(ctx, process, item.ip)
+				results <- item
+			}
+		}()
+	}
+
+	var readErr error
+	go func() {
+		defer close(jobs)
+		scanner := bufio.NewScanner(in)
+		index := 0
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			jobs <- batchItem{index: index, ip: line}
+			index++
+		}
+		readErr = scanner.Err()
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// The results arrive in any order, so they are kept until all the previous ones are written.
+	var writeErr error
+	pending := make(map[int]batchItem)
+	next := 0
+	for item := range results {
+		pending[item.index] = item
+		for {
+			current, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			summary.Add(current.err)
+			if writeErr == nil {
+				writeErr = writer.WriteResult(current.ip, current.result, current.err)
+			}
+		}
+	}
+
+	if writeErr == nil {
+		writeErr = writer.Flush()
+	}
+	summary.Elapsed = time.Since(since)
+	return summary, errors.Join(readErr, writeErr)
+}
+
+// traceBatchItem validates the IP and retrieves its information.
+func traceBatchItem(ctx context.Context, process interfaces.GetInformation, ipStr string) (models.TraceResult, error) {
+	ip, err := CanonicalIp(ipStr)
+	if err != nil {
+		return models.TraceResult{}, err
+	}
+	return process.GetAllProducts(ctx, ip)
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"service_fraud/models"
+	"service_fraud/render"
+	"service_fraud/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBatchMock() *MockGetInformation {
+	mockService := new(MockGetInformation)
+	// The first IP takes longer so the results arrive out of order.
+	mockService.On("GetAllProducts", "1.1.1.1").After(50*time.Millisecond).Return(models.TraceResult{Ip: "1.1.1.1", Country: "Australia"}, nil)
+	mockService.On("GetAllProducts", "8.8.8.8").Return(models.TraceResult{Ip: "8.8.8.8", Country: "United States"}, nil)
+	mockService.On("GetAllProducts", "2800:810:400::1").Return(models.TraceResult{Ip: "2800:810:400::1", Country: "Argentina"}, nil)
+	mockService.On("GetAllProducts", "10.0.0.1").Return(models.TraceResult{},
+		models.NewNonRoutableIpError(utils.ERR_CODE_NON_ROUTABLE_IP, "non routable", utils.IP_CATEGORY_PRIVATE))
+	return mockService
+}
+
+const batchInput = `# incident 42
+1.1.1.1
+8.8.8.8
+
+invalid_ip
+2800:0810:0400::1
+10.0.0.1
+`
+
+func TestRunBatch_NDJSON(t *testing.T) {
+	var out bytes.Buffer
+	summary, err := RunBatch(context.Background(), newBatchMock(), strings.NewReader(batchInput), &out, BatchOptions{Workers: 3})
+	require.NoError(t, err)
+
+	var ips []string
+	var codes []int
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var line struct {
+			Ip    string `json:"ip"`
+			Error struct {
+				Code int `json:"code"`
+			} `json:"error"`
+		}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		ips = append(ips, line.Ip)
+		codes = append(codes, line.Error.Code)
+	}
+
+	assert.Equal(t, []string{"1.1.1.1", "8.8.8.8", "invalid_ip", "2800:810:400::1", "10.0.0.1"}, ips)
+	assert.Equal(t, []int{0, 0, utils.ERR_CODE_INVALID_IP, 0, utils.ERR_CODE_NON_ROUTABLE_IP}, codes)
+
+	assert.Equal(t, 5, summary.Total)
+	assert.Equal(t, 3, summary.Succeeded)
+	assert.Equal(t, 2, summary.Failed)
+	assert.Equal(t, map[int]int{utils.ERR_CODE_INVALID_IP: 1, utils.ERR_CODE_NON_ROUTABLE_IP: 1}, summary.FailuresByCode)
+	assert.Greater(t, summary.Elapsed, time.Duration(0))
+}
+
+func TestRunBatch_CSV(t *testing.T) {
+	var out bytes.Buffer
+	_, err := RunBatch(context.Background(), newBatchMock(), strings.NewReader(batchInput), &out, BatchOptions{Format: "csv", Workers: 2})
+	require.NoError(t, err)
+
+	rows, err := csv.NewReader(&out).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 6)
+	assert.Equal(t, render.BatchCSVHeader, rows[0])
+	assert.Equal(t, "1.1.1.1", rows[1][0])
+	assert.Equal(t, "Australia", rows[1][2])
+	assert.Equal(t, "invalid_ip", rows[3][0])
+	assert.Equal(t, "102", rows[3][len(rows[3])-2])
+	assert.Equal(t, "2800:810:400::1", rows[4][0])
+}
+
+func TestRunBatch_InvalidFormat(t *testing.T) {
+	_, err := RunBatch(context.Background(), newBatchMock(), strings.NewReader(batchInput), &bytes.Buffer{}, BatchOptions{Format: "xml"})
+
+	assert.Error(t, err)
+}
@@ -0,0 +1,535 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"service_fraud/models"
+	"service_fraud/render"
+	"service_fraud/server"
+	"service_fraud/services"
+	"service_fraud/utils"
+	"strings"
+)
+
+// Usage is the help text of the command line interface.
+var Usage = `Uso: service_fraud <comando> [flags] [argumentos]
+
+Comandos:
+  trace <ip>   consulta la informacion de una ip IPv4 o IPv6, con '--at AAAA-MM-DD'
+               usa las cotizaciones historicas de esa fecha y con '--amount <monto>'
+               y '--currency <moneda>' convierte el monto de la operacion
+  convert <monto> <moneda> [to <moneda>]
+               convierte un monto con las cotizaciones en uso, por defecto a la
+               moneda de destino configurada
+  stats        muestra el resumen y detalle de los registros realizados
+  batch        consulta una lista de ips leida de un archivo o de la entrada estandar
+  serve        inicia la API HTTP JSON
+  rates        muestra las cotizaciones en uso y su antiguedad
+  refresh-countries <archivo>
+               actualiza el snapshot de paises a partir de un JSON descargado de
+               https://restcountries.com/v3.1/all
+  repl         inicia la consola interactiva (comando por defecto)
+  help         muestra esta ayuda
+
+Use 'service_fraud <comando> --help' para ver los flags de cada comando.
+
+Codigos de salida:
+  0     ejecucion exitosa
+  1     error inesperado
+  2     uso incorrecto del comando
+  3     el proceso batch finalizo con ips fallidas
+  101   opcion invalida
+  102   ip invalida
+  103   error en el servicio de ip
+  104   error en el servicio de paises
+  105   error en el servicio de monedas
+  106   error al obtener los secretos
+  107   la ip no devuelve informacion
+  108   se alcanzo el limite del servicio
+  109   formato de salida invalido
+  110   la ip pertenece a un rango no enrutable
+  111   rango de tiempo de las estadisticas invalido
+  112   la consulta supero el tiempo maximo
+  113   la consulta fue cancelada
+  114   la clave de acceso de un servicio externo no es valida
+  115   un servicio externo recibio demasiadas consultas
+  116   fecha de las cotizaciones invalida
+  117   no hay cotizaciones historicas para la fecha
+  118   monto invalido
+  119   no hay cotizacion para la moneda del monto
+`
+
+// Run executes the command given in args and returns the process exit code.
+// Without a command it starts the interactive console. The services are set up by the commands
+// that use them, so 'help' and the usage errors have no side effects.
+func Run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		return runRepl(stdin, stdout, stderr)
+	}
+
+	switch args[0] {
+	case "trace":
+		return runTrace(args[1:], stdout, stderr)
+	case "stats":
+		return runStats(args[1:], stdout, stderr)
+	case "batch":
+		return runBatch(args[1:], stdin, stdout, stderr)
+	case "serve":
+		return runServe(args[1:], stderr)
+	case "rates":
+		return runRates(args[1:], stdout, stderr)
+	case "convert":
+		return runConvert(args[1:], stdout, stderr)
+	case "refresh-countries":
+		return runRefreshCountries(args[1:], stdout, stderr)
+	case "repl":
+		return runRepl(stdin, stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, Usage)
+		return utils.EXIT_CODE_OK
+	default:
+		fmt.Fprintf(stderr, "Comando desconocido: %s\n\n%s", args[0], Usage)
+		return utils.EXIT_CODE_USAGE
+	}
+}
+
+// ConfigureLogging sets the default logger with the format, level and destination of the
+// configuration, falling back to the text format on stderr when they are not valid. It returns
+// a function that closes the destination file.
+func ConfigureLogging(stdout, stderr io.Writer) func() {
+	out, closeOutput, err := openLogOutput(configuration.Log.Output, stdout, stderr)
+	if err == nil {
+		var logger *slog.Logger
+		logger, err = utils.NewLogger(out, configuration.Log.Format, configuration.Log.Level)
+		if err == nil {
+			slog.SetDefault(logger)
+			return closeOutput
+		}
+		closeOutput()
+	}
+	logger, _ := utils.NewLogger(stderr, utils.LOG_FORMAT_TEXT, utils.LOG_LEVEL_INFO)
+	slog.SetDefault(logger)
+	slog.Warn(utils.ERR_MESSAGE_LOG_CONFIG, "error", err)
+	return func() {}
+}
+
+// openLogOutput returns the destination of the log, 'stdout', 'stderr' or the file the log is
+// appended to, along with a function that closes it.
+func openLogOutput(output string, stdout, stderr io.Writer) (io.Writer, func(), error) {
+	switch output {
+	case utils.LOG_OUTPUT_STDOUT:
+		return stdout, func() {}, nil
+	case utils.LOG_OUTPUT_STDERR:
+		return stderr, func() {}, nil
+	case "":
+		output = utils.LOG_DEFAULT_OUTPUT
+	}
+	file, err := os.OpenFile(output, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, func() { file.Close() }, nil
+}
+
+// ExitCode maps an error to the process exit code. The application errors use their
+// ERR_CODE_* value so scripts can tell the failures apart.
+func ExitCode(err error) int {
+	if err == nil {
+		return utils.EXIT_CODE_OK
+	}
+	code, _ := models.ErrorDetails(err)
+	if code == 0 {
+		return utils.EXIT_CODE_ERROR
+	}
+	return code
+}
+
+// runTrace retrieves and renders the information of the IP given as argument, converting the
+// currencies with the historical rates of the day given by the '-at' flag, if any, and the
+// amount of the operation given by the '-amount' and '-currency' flags.
+func runTrace(args []string, stdout, stderr io.Writer) int {
+	flags := newFlagSet("trace", "trace <ip> [flags]", stderr)
+	format := flags.String("format", configuration.Format, "output format: text, json, yaml, csv or table")
+	at := flags.String("at", "", "day of the historical rates, YYYY-MM-DD")
+	amount := flags.String("amount", "", "amount of the operation, for example 1500.50")
+	currency := flags.String("currency", "", "currency of the amount, the target currency when it is not set")
+	positional, code, ok := parseCommandFlags(flags, args)
+	if !ok {
+		return code
+	}
+	if len(positional) != 1 {
+		flags.Usage()
+		return utils.EXIT_CODE_USAGE
+	}
+	setup(configuration)
+
+	ip, err := CanonicalIp(positional[0])
+	if err != nil {
+		HandleError(stderr, err)
+		return ExitCode(err)
+	}
+	renderer, err := render.New(*format)
+	if err != nil {
+		HandleError(stderr, err)
+		return ExitCode(err)
+	}
+	ctx, stop := interruptContext()
+	defer stop()
+	ctx, err = services.WithRatesDateValue(ctx, *at)
+	if err == nil {
+		ctx, err = services.WithTransactionValue(ctx, *amount, *currency)
+	}
+	if err != nil {
+		HandleError(stderr, err)
+		return ExitCode(err)
+	}
+	result, err := getInformationService.GetAllProducts(ctx, ip)
+	if err == nil {
+		err = renderer.RenderTrace(stdout, result)
+	}
+	if err != nil {
+		HandleError(stderr, err)
+	}
+	return ExitCode(err)
+}
+
+// runStats renders the statistics of the recorded requests, or of the time range given by the
+// '-since' or '-from' and '-to' flags.
+func runStats(args []string, stdout, stderr io.Writer) int {
+	flags := newFlagSet("stats", "stats [flags]", stderr)
+	format := flags.String("format", configuration.Format, "output format: text, json, yaml, csv or table")
+	since := flags.String("since", "", "duration before now of the requests to include, for example 1h")
+	from := flags.String("from", "", "start of the time range, for example 2024-05-01T10:00")
+	to := flags.String("to", "", "end of the time range, now when it is not set")
+	positional, code, ok := parseCommandFlags(flags, args)
+	if !ok {
+		return code
+	}
+	if len(positional) != 0 {
+		flags.Usage()
+		return utils.EXIT_CODE_USAGE
+	}
+	setup(configuration)
+
+	renderer, err := render.New(*format)
+	var summary models.StatsSummary
+	if err == nil {
+		summary, err = services.GetStatsRange(getInformationService.GetStatsService(), *since, *from, *to)
+	}
+	if err == nil {
+		err = renderer.RenderStats(stdout, summary)
+	}
+	if err != nil {
+		HandleError(stderr, err)
+	}
+	return ExitCode(err)
+}
+
+// runBatch traces the IPs read from the '-input' file or stdin, writing one result per line
+// to the '-output' file or stdout and the summary to stderr.
+func runBatch(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := newFlagSet("batch", "batch [flags]", stderr)
+	input := flags.String("input", "-", "file with one IP per line, '-' reads from stdin")
+	output := flags.String("output", "-", "file where the results are written, '-' writes to stdout")
+	format := flags.String("format", utils.FORMAT_NDJSON, "output format: ndjson or csv")
+	workers := flags.Int("workers", utils.BATCH_DEFAULT_WORKERS, "number of IPs traced concurrently")
+	positional, code, ok := parseCommandFlags(flags, args)
+	if !ok {
+		return code
+	}
+	if len(positional) != 0 {
+		flags.Usage()
+		return utils.EXIT_CODE_USAGE
+	}
+	setup(configuration)
+
+	in := stdin
+	if *input != "-" {
+		file, err := os.Open(*input)
+		if err != nil {
+			fmt.Fprintf(stderr, utils.ERR_MESSAGE_BATCH_FILE+"\n", err)
+			return utils.EXIT_CODE_USAGE
+		}
+		defer file.Close()
+		in = file
+	}
+
+	out := stdout
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(stderr, utils.ERR_MESSAGE_BATCH_FILE+"\n", err)
+			return utils.EXIT_CODE_USAGE
+		}
+		defer file.Close()
+		out = file
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+	summary, err := RunBatch(ctx, getInformationService, in, out, BatchOptions{Format: *format, Workers: *workers})
+	if err != nil {
+		HandleError(stderr, err)
+		return ExitCode(err)
+	}
+	render.RenderBatchSummary(stderr, summary)
+	if summary.Failed > 0 {
+		return utils.EXIT_CODE_BATCH_FAILURES
+	}
+	return utils.EXIT_CODE_OK
+}
+
+// runRates renders the snapshot of the exchange rates used by the traces, retrieving it when
+// there is none or it expired.
+func runRates(args []string, stdout, stderr io.Writer) int {
+	flags := newFlagSet("rates", "rates", stderr)
+	positional, code, ok := parseCommandFlags(flags, args)
+	if !ok {
+		return code
+	}
+	if len(positional) != 0 {
+		flags.Usage()
+		return utils.EXIT_CODE_USAGE
+	}
+	setup(configuration)
+
+	ctx, stop := interruptContext()
+	defer stop()
+	snapshot, err := getInformationService.GetRates(ctx)
+	if err == nil {
+		err = render.RenderRates(stdout, snapshot)
+	}
+	if err != nil {
+		HandleError(stderr, err)
+	}
+	return ExitCode(err)
+}
+
+// runConvert converts the amount given as argument to the currency given after 'to', the target
+// currency of the traces when it is not given, with the rates the traces use or the historical
+// ones of the day given by the '-at' flag.
+func runConvert(args []string, stdout, stderr io.Writer) int {
+	flags := newFlagSet("convert", "convert <monto> <moneda> [to <moneda>] [flags]", stderr)
+	at := flags.String("at", "", "day of the historical rates, YYYY-MM-DD")
+	positional, code, ok := parseCommandFlags(flags, args)
+	if !ok {
+		return code
+	}
+	target := ""
+	switch {
+	case len(positional) == 2:
+	case len(positional) == 4 && strings.EqualFold(positional[2], "to"):
+		target = strings.ToUpper(positional[3])
+	default:
+		flags.Usage()
+		return utils.EXIT_CODE_USAGE
+	}
+	setup(configuration)
+
+	ctx, stop := interruptContext()
+	defer stop()
+	conversion, err := convertAmount(ctx, positional[0], positional[1], target, *at)
+	if err == nil {
+		err = render.RenderConversion(stdout, conversion)
+	}
+	if err != nil {
+		HandleError(stderr, err)
+	}
+	return ExitCode(err)
+}
+
+// convertAmount parses the amount and the currencies and converts the amount with the rates of
+// the day, the current ones when it is empty.
+func convertAmount(ctx context.Context, amount, currency, target, at string) (models.Conversion, error) {
+	money, err := models.ParseMoney(amount, currency)
+	if err == nil && target != "" {
+		err = models.ValidateCurrencyCode(target)
+	}
+	if err != nil {
+		return models.Conversion{}, models.NewOptionInvalidError(utils.ERR_CODE_INVALID_AMOUNT, fmt.Sprintf(utils.ERR_USER_MESSAGE_INVALID_AMOUNT, err))
+	}
+	ctx, err = services.WithRatesDateValue(ctx, at)
+	if err != nil {
+		return models.Conversion{}, err
+	}
+	return getInformationService.Convert(ctx, money, target)
+}
+
+// runServe starts the HTTP JSON API on the address given by the '-addr' flag, along with the
+// background refreshes of the services, which are stopped when it returns.
+func runServe(args []string, stderr io.Writer) int {
+	flags := newFlagSet("serve", "serve [flags]", stderr)
+	addr := flags.String("addr", utils.SERVER_DEFAULT_ADDR, "address where the HTTP server listens")
+	positional, code, ok := parseCommandFlags(flags, args)
+	if !ok {
+		return code
+	}
+	if len(positional) != 0 {
+		flags.Usage()
+		return utils.EXIT_CODE_USAGE
+	}
+	setup(configuration)
+	stopWatchers := startWatchers()
+	defer stopWatchers()
+
+	srv := server.NewServer(getInformationService)
+	if err := srv.ListenAndServe(*addr); err != nil {
+		fmt.Fprintln(stderr, err)
+		return utils.EXIT_CODE_ERROR
+	}
+	return utils.EXIT_CODE_OK
+}
+
+// runRefreshCountries rewrites the country snapshot from a restcountries v3.1 dataset. By
+// default it writes the snapshot configured in 'snapshot_path' or, when none is set, the one
+// embedded in the binary, which is used after building it again.
+func runRefreshCountries(args []string, stdout, stderr io.Writer) int {
+	defaultOutput := configuration.Countries.SnapshotPath
+	if defaultOutput == "" {
+		defaultOutput = utils.COUNTRY_SNAPSHOT_SOURCE_PATH
+	}
+	flags := newFlagSet("refresh-countries", "refresh-countries <archivo> [flags]", stderr)
+	output := flags.String("output", defaultOutput, "file where the snapshot is written")
+	positional, code, ok := parseCommandFlags(flags, args)
+	if !ok {
+		return code
+	}
+	if len(positional) != 1 {
+		flags.Usage()
+		return utils.EXIT_CODE_USAGE
+	}
+
+	file, err := os.Open(positional[0])
+	if err != nil {
+		fmt.Fprintf(stderr, utils.ERR_MESSAGE_COUNTRY_REFRESH+"\n", err)
+		return utils.EXIT_CODE_USAGE
+	}
+	defer file.Close()
+
+	// The snapshot is kept in memory so an invalid dataset never replaces the current one.
+	var snapshot bytes.Buffer
+	count, err := services.RefreshCountrySnapshot(file, &snapshot)
+	if err == nil {
+		err = os.WriteFile(*output, snapshot.Bytes(), 0644)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, utils.ERR_MESSAGE_COUNTRY_REFRESH+"\n", err)
+		return utils.EXIT_CODE_ERROR
+	}
+	fmt.Fprintf(stdout, utils.INFO_USER_MESSAGE_COUNTRY_REFRESH+"\n", count, *output)
+	return utils.EXIT_CODE_OK
+}
+
+// runRepl displays a welcome message and continuously processes the user input
+// until "exit" is entered or the input ends, writing the results to stdout and the errors to
+// stderr. The background refreshes of the services run while the console is open.
+func runRepl(stdin io.Reader, stdout, stderr io.Writer) int {
+	setup(configuration)
+	stopWatchers := startWatchers()
+	defer stopWatchers()
+	fmt.Fprintln(stdout, Logo)
+	fmt.Fprintln(stdout, utils.INFO_USER_MESSAGE_SELECT_OPTION)
+
+	reader := bufio.NewReader(stdin)
+	for {
+		input, err := reader.ReadString('\n')
+		input = strings.TrimSpace(input)
+		if input == "exit" || (err != nil && input == "") {
+			return utils.EXIT_CODE_OK
+		}
+
+		// Ctrl-C cancels the option in progress and returns to the prompt.
+		ctx, stop := interruptContext()
+		if err := Start(ctx, stdout, input); err != nil {
+			HandleError(stderr, err)
+		}
+		stop()
+		fmt.Fprintln(stdout, "\n"+utils.INFO_USER_MESSAGE_SELECT_OPTION)
+	}
+}
+
+// interruptContext returns a context that is canceled when the user presses Ctrl-C, which
+// stops the traces in flight instead of exiting, until stop is called.
+func interruptContext() (ctx context.Context, stop context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt)
+}
+
+// newFlagSet creates a flag set that reports its errors and help text to stderr
+// instead of exiting the process.
+func newFlagSet(name string, usage string, stderr io.Writer) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Uso: service_fraud %s\n\nFlags:\n", usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseCommandFlags parses the flags found before and after the positional arguments and
+// returns the positional ones. When parsing stops it reports false along with the exit
+// code, 0 for '--help' and EXIT_CODE_USAGE for invalid flags.
+func parseCommandFlags(flags *flag.FlagSet, args []string) ([]string, int, bool) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, utils.EXIT_CODE_OK, false
+			}
+			return nil, utils.EXIT_CODE_USAGE, false
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional, 0, true
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// HandleError processes the provided error and writes an appropriate message
+// based on the type of error encountered, such as IpApiError, CountryApiError,
+// or CurrencyApiError, providing specific feedback to the user. The requests
+// rejected by a provider also name the external API that rejected them.
+func HandleError(w io.Writer, err error) {
+	optionError := &models.OptionInvalidError{}
+	apiError := &models.IpApiError{}
+	countryError := &models.CountryApiError{}
+	currencyError := &models.CurrencyApiError{}
+	nonRoutableError := &models.NonRoutableIpError{}
+	canceledError := &models.TraceCanceledError{}
+	providerError := &models.ProviderApiError{}
+
+	switch {
+	case errors.As(err, &optionError) && optionError.Code == utils.ERR_CODE_INVALID_FORMAT:
+		fmt.Fprintln(w, utils.ERR_USER_MESSAGE_INVALID_FORMAT)
+	case errors.As(err, &optionError) && optionError.Code == utils.ERR_CODE_INVALID_IP:
+		fmt.Fprintln(w, utils.ERR_USER_MESSAGE_INVALID_IP)
+	case errors.As(err, &optionError) && (optionError.Code == utils.ERR_CODE_INVALID_RANGE || optionError.Code == utils.ERR_CODE_INVALID_DATE):
+		fmt.Fprintln(w, optionError.Message)
+	case errors.As(err, &optionError) && (optionError.Code == utils.ERR_CODE_INVALID_AMOUNT || optionError.Code == utils.ERR_CODE_CURRENCY_RATE):
+		fmt.Fprintln(w, optionError.Message)
+	case errors.As(err, &providerError):
+		fmt.Fprintf(w, "%s (%s)\n", providerError.Error(), providerError.Provider)
+	case errors.As(err, &apiError):
+		fmt.Fprintln(w, apiError.Error())
+	case errors.As(err, &countryError):
+		fmt.Fprintln(w, countryError.Error())
+	case errors.As(err, &currencyError):
+		fmt.Fprintln(w, currencyError.Error())
+	case errors.As(err, &nonRoutableError):
+		fmt.Fprintln(w, nonRoutableError.Error())
+	case errors.As(err, &canceledError):
+		fmt.Fprintln(w, canceledError.Message)
+	default:
+		fmt.Fprintln(w, utils.ERR_USER_MESSAGE_INVALID_OPTION)
+	}
+}
@@ -0,0 +1,371 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"service_fraud/config"
+	"service_fraud/models"
+	"service_fraud/services"
+	"service_fraud/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// useInformationService replaces the information service for the duration of the test.
+func useInformationService(t *testing.T, service *MockGetInformation) {
+	previous := getInformationService
+	getInformationService = service
+	t.Cleanup(func() { getInformationService = previous })
+}
+
+func TestRun_Help(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	code := Run([]string{"--help"}, strings.NewReader(""), &stdout, &stderr)
+
+	assert.Equal(t, utils.EXIT_CODE_OK, code)
+	assert.Contains(t, stdout.String(), "trace <ip>")
+	assert.Contains(t, stdout.String(), "Codigos de salida")
+}
+
+func TestRun_Help_NoSetup(t *testing.T) {
+	previous := getInformationService
+	getInformationService = nil
+	t.Cleanup(func() { getInformationService = previous })
+	var stdout, stderr bytes.Buffer
+
+	assert.Equal(t, utils.EXIT_CODE_OK, Run([]string{"help"}, strings.NewReader(""), &stdout, &stderr))
+	assert.Equal(t, utils.EXIT_CODE_USAGE, Run([]string{"trace"}, strings.NewReader(""), &stdout, &stderr))
+	assert.Nil(t, getInformationService)
+}
+
+func TestRun_Repl(t *testing.T) {
+	mockService := new(MockGetInformation)
+	mockService.On("GetRates").Return(models.RatesSnapshot{Source: "ecb", Base: "EUR", Rates: map[string]float64{"USD": 1.1}}, nil)
+	useInformationService(t, mockService)
+	var stdout, stderr bytes.Buffer
+
+	code := Run([]string{"repl"}, strings.NewReader("rates\ntraceip invalid_ip\nexit\n"), &stdout, &stderr)
+
+	assert.Equal(t, utils.EXIT_CODE_OK, code)
+	assert.Contains(t, stdout.String(), "RESPUESTA ANTI FRAUDES")
+	assert.Contains(t, stdout.String(), "Cotizaciones de ecb (base EUR)")
+	assert.Equal(t, 3, strings.Count(stdout.String(), utils.INFO_USER_MESSAGE_SELECT_OPTION))
+	assert.Equal(t, utils.ERR_USER_MESSAGE_INVALID_IP+"\n", stderr.String())
+}
+
+func TestRun_Repl_HistoricalRates(t *testing.T) {
+	mockService := new(MockGetInformation)
+	mockService.On("GetAllProducts", "1.1.1.1").Return(models.TraceResult{Ip: "1.1.1.1", Country: "Australia"}, nil)
+	mockService.On("Convert", "100.00 USD", "EUR").Return(models.Conversion{Amount: "100.00", Currency: "USD", Converted: "91.00", Target: "EUR"}, nil)
+	useInformationService(t, mockService)
+	var stdout, stderr bytes.Buffer
+
+	code := Run([]string{"repl"}, strings.NewReader("traceip 1.1.1.1 --at 2024-04-20\nconvert 100 USD to EUR --at 2024-04-20\ntraceip 1.1.1.1 --at 20/04/2024\nexit\n"), &stdout, &stderr)
+
+	assert.Equal(t, utils.EXIT_CODE_OK, code)
+	date, ok := mockService.ratesDates.Load("1.1.1.1")
+	require.True(t, ok)
+	assert.Equal(t, time.Date(2024, 4, 20, 0, 0, 0, 0, time.UTC), date)
+	mockService.AssertNumberOfCalls(t, "GetAllProducts", 1)
+	mockService.AssertNumberOfCalls(t, "Convert", 1)
+	assert.Contains(t, stderr.String(), "20/04/2024")
+}
+
+func TestRun_Repl_Watchers(t *testing.T) {
+	useInformationService(t, new(MockGetInformation))
+	previous := watchers
+	t.Cleanup(func() { watchers = previous })
+	var started, stopped int
+	watchers = []func() func(){func() func() {
+		started++
+		return func() { stopped++ }
+	}}
+
+	// The one-shot commands do not start the background refreshes.
+	Run([]string{"trace"}, strings.NewReader(""), &bytes.Buffer{}, &bytes.Buffer{})
+	assert.Equal(t, 0, started)
+
+	code := Run([]string{"repl"}, strings.NewReader("exit\n"), &bytes.Buffer{}, &bytes.Buffer{})
+
+	assert.Equal(t, utils.EXIT_CODE_OK, code)
+	assert.Equal(t, 1, started)
+	assert.Equal(t, 1, stopped)
+}
+
+func TestRun_UnknownCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	code := Run([]string{"lookup"}, strings.NewReader(""), &stdout, &stderr)
+
+	assert.Equal(t, utils.EXIT_CODE_USAGE, code)
+	assert.Contains(t, stderr.String(), "Comando desconocido: lookup")
+}
+
+func TestRun_Trace(t *testing.T) {
+	mockService := new(MockGetInformation)
+	mockService.On("GetAllProducts", "1.1.1.1").Return(models.TraceResult{Ip: "1.1.1.1", Country: "Australia"}, nil)
+	mockService.On("GetAllProducts", "8.8.8.8").Return(models.TraceResult{},
+		models.NewErrorIpApiError(utils.ERR_CODE_IP_SERVICE, utils.ERR_USER_MESSAGE_IP_SERVICE))
+	mockService.On("GetAllProducts", "9.9.9.9").Return(models.TraceResult{},
+		models.NewTraceCanceledError(utils.ERR_CODE_TRACE_TIMEOUT, utils.ERR_USER_MESSAGE_TRACE_TIMEOUT, context.DeadlineExceeded))
+	useInformationService(t, mockService)
+
+	tests := []struct {
+		name   string
+		args   []string
+		code   int
+		stdout string
+	}{
+		{"success with flag after ip", []string{"trace", "1.1.1.1", "--format", "json"}, utils.EXIT_CODE_OK, `"country":"Australia"`},
+		{"success with flag before ip", []string{"trace", "-format=csv", "1.1.1.1"}, utils.EXIT_CODE_OK, "1.1.1.1,"},
+		{"invalid ip", []string{"trace", "invalid_ip"}, utils.ERR_CODE_INVALID_IP, ""},
+		{"invalid format", []string{"trace", "1.1.1.1", "--format", "xml"}, utils.ERR_CODE_INVALID_FORMAT, ""},
+		{"historical rates", []string{"trace", "1.1.1.1", "--at", "2024-04-20", "--format", "json"}, utils.EXIT_CODE_OK, `"country":"Australia"`},
+		{"invalid date", []string{"trace", "1.1.1.1", "--at", "20/04/2024"}, utils.ERR_CODE_INVALID_DATE, ""},
+		{"transaction amount", []string{"trace", "1.1.1.1", "--amount", "1500.50", "--currency", "ARS", "--format", "json"}, utils.EXIT_CODE_OK, `"country":"Australia"`},
+		{"invalid amount", []string{"trace", "1.1.1.1", "--amount", "1,500"}, utils.ERR_CODE_INVALID_AMOUNT, ""},
+		{"currency without amount", []string{"trace", "1.1.1.1", "--currency", "ARS"}, utils.ERR_CODE_INVALID_AMOUNT, ""},
+		{"upstream error", []string{"trace", "8.8.8.8"}, utils.ERR_CODE_IP_SERVICE, ""},
+		{"timeout", []string{"trace", "9.9.9.9"}, utils.ERR_CODE_TRACE_TIMEOUT, ""},
+		{"missing ip", []string{"trace"}, utils.EXIT_CODE_USAGE, ""},
+		{"unknown flag", []string{"trace", "1.1.1.1", "--color", "red"}, utils.EXIT_CODE_USAGE, ""},
+		{"help", []string{"trace", "--help"}, utils.EXIT_CODE_OK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+
+			code := Run(tt.args, strings.NewReader(""), &stdout, &stderr)
+
+			assert.Equal(t, tt.code, code)
+			assert.Contains(t, stdout.String(), tt.stdout)
+		})
+	}
+}
+
+func TestRun_Stats(t *testing.T) {
+	mockService := new(MockGetInformation)
+	mockStatsService := new(MockStatsService)
+	mockStatsService.On("GetStats").Return(models.StatsSummary{TotalInvokes: 4})
+	mockService.On("GetStatsService").Return(mockStatsService)
+	useInformationService(t, mockService)
+	var stdout, stderr bytes.Buffer
+
+	code := Run([]string{"stats", "--format", "json"}, strings.NewReader(""), &stdout, &stderr)
+
+	assert.Equal(t, utils.EXIT_CODE_OK, code)
+	assert.Contains(t, stdout.String(), `"total_invokes":4`)
+}
+
+func TestRun_Stats_Range(t *testing.T) {
+	mockService := new(MockGetInformation)
+	mockStatsService := new(MockStatsService)
+	from := time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local)
+	to := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	mockStatsService.On("GetStatsWindow", from, to).Return(models.StatsSummary{TotalInvokes: 2}, nil)
+	mockStatsService.On("GetStatsWindow", mock.Anything, mock.Anything).Return(models.StatsSummary{}, errors.New("the stats are kept for 24h"))
+	mockService.On("GetStatsService").Return(mockStatsService)
+	useInformationService(t, mockService)
+
+	tests := []struct {
+		name   string
+		args   []string
+		code   int
+		stdout string
+	}{
+		{"from and to", []string{"stats", "--from", "2024-05-01T10:00", "--to", "2024-05-01T12:00", "--format", "json"}, utils.EXIT_CODE_OK, `"total_invokes":2`},
+		{"beyond the retention", []string{"stats", "--since", "48h"}, utils.ERR_CODE_INVALID_RANGE, ""},
+		{"invalid duration", []string{"stats", "--since", "yesterday"}, utils.ERR_CODE_INVALID_RANGE, ""},
+		{"since with from", []string{"stats", "--since", "1h", "--from", "2024-05-01"}, utils.ERR_CODE_INVALID_RANGE, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+
+			code := Run(tt.args, strings.NewReader(""), &stdout, &stderr)
+
+			assert.Equal(t, tt.code, code)
+			assert.Contains(t, stdout.String(), tt.stdout)
+		})
+	}
+}
+
+func TestRun_Batch(t *testing.T) {
+	useInformationService(t, newBatchMock())
+	var stdout, stderr bytes.Buffer
+
+	code := Run([]string{"batch", "--format", "csv"}, strings.NewReader("1.1.1.1\n8.8.8.8\n"), &stdout, &stderr)
+	assert.Equal(t, utils.EXIT_CODE_OK, code)
+	assert.Equal(t, 3, strings.Count(stdout.String(), "\n"))
+	assert.Contains(t, stderr.String(), "Exitosas: 2")
+
+	code = Run([]string{"batch"}, strings.NewReader("1.1.1.1\ninvalid_ip\n"), &stdout, &stderr)
+	assert.Equal(t, utils.EXIT_CODE_BATCH_FAILURES, code)
+
+	code = Run([]string{"batch", "-input", "missing_file.txt"}, strings.NewReader(""), &stdout, &stderr)
+	assert.Equal(t, utils.EXIT_CODE_USAGE, code)
+}
+
+func TestRun_Rates(t *testing.T) {
+	mockService := new(MockGetInformation)
+	mockService.On("GetRates").Return(models.RatesSnapshot{Source: "fixer", Base: "EUR", Rates: map[string]float64{"ARS": 1050}}, nil).Once()
+	mockService.On("GetRates").Return(models.RatesSnapshot{},
+		models.NewCurrencyApiError(utils.ERR_CODE_CURRENCY_SERVICE, utils.ERR_USER_MESSAGE_CURRENCY_SERVICE)).Once()
+	useInformationService(t, mockService)
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, utils.EXIT_CODE_OK, Run([]string{"rates"}, strings.NewReader(""), &stdout, &stderr))
+	assert.Contains(t, stdout.String(), "Cotizaciones de fixer (base EUR)")
+	assert.Contains(t, stdout.String(), "ARS: 1050.000000")
+
+	assert.Equal(t, utils.ERR_CODE_CURRENCY_SERVICE, Run([]string{"rates"}, strings.NewReader(""), &stdout, &stderr))
+	assert.Equal(t, utils.EXIT_CODE_USAGE, Run([]string{"rates", "extra"}, strings.NewReader(""), &stdout, &stderr))
+}
+
+func TestRun_Convert(t *testing.T) {
+	mockService := new(MockGetInformation)
+	mockService.On("Convert", "1500.50 ARS", "").Return(models.Conversion{Amount: "1500.50", Currency: "ARS", Converted: "1.57", Target: "USD", Rate: "0.001048"}, nil)
+	mockService.On("Convert", "100.00 USD", "EUR").Return(models.Conversion{Amount: "100.00", Currency: "USD", Converted: "90.91", Target: "EUR", Rate: "0.909091"}, nil)
+	mockService.On("Convert", "10.00 XXX", "").Return(models.Conversion{},
+		models.NewOptionInvalidError(utils.ERR_CODE_CURRENCY_RATE, fmt.Sprintf(utils.ERR_USER_MESSAGE_CURRENCY_RATE, "the rates do not include XXX")))
+	useInformationService(t, mockService)
+
+	tests := []struct {
+		name   string
+		args   []string
+		code   int
+		stdout string
+		stderr string
+	}{
+		{"target currency", []string{"convert", "1500.50", "ars"}, utils.EXIT_CODE_OK, "1500.50 ARS = 1.57 U$S", ""},
+		{"given currency", []string{"convert", "100", "USD", "to", "eur"}, utils.EXIT_CODE_OK, "100.00 USD = 90.91 EUR", ""},
+		{"invalid amount", []string{"convert", "0", "USD"}, utils.ERR_CODE_INVALID_AMOUNT, "", "El monto no es valido"},
+		{"invalid target", []string{"convert", "100", "USD", "to", "euro"}, utils.ERR_CODE_INVALID_AMOUNT, "", "El monto no es valido"},
+		{"unknown currency", []string{"convert", "10", "XXX"}, utils.ERR_CODE_CURRENCY_RATE, "", "No hay cotizacion para convertir el monto"},
+		{"invalid date", []string{"convert", "10", "USD", "--at", "yesterday"}, utils.ERR_CODE_INVALID_DATE, "", ""},
+		{"missing currency", []string{"convert", "100"}, utils.EXIT_CODE_USAGE, "", ""},
+		{"missing to", []string{"convert", "100", "USD", "EUR"}, utils.EXIT_CODE_USAGE, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+
+			code := Run(tt.args, strings.NewReader(""), &stdout, &stderr)
+
+			assert.Equal(t, tt.code, code)
+			assert.Contains(t, stdout.String(), tt.stdout)
+			assert.Contains(t, stderr.String(), tt.stderr)
+		})
+	}
+}
+
+func TestRun_RefreshCountries(t *testing.T) {
+	dir := t.TempDir()
+	dataset := filepath.Join(dir, "all.json")
+	output := filepath.Join(dir, "countries.json")
+	require.NoError(t, os.WriteFile(dataset, []byte(`[{"name": {"common": "Colombia", "official": "Republic of Colombia"},
+		"cca2": "CO", "currencies": {"COP": {"name": "Colombian peso", "symbol": "$"}}}]`), 0644))
+	var stdout, stderr bytes.Buffer
+
+	code := Run([]string{"refresh-countries", dataset, "--output", output}, strings.NewReader(""), &stdout, &stderr)
+
+	assert.Equal(t, utils.EXIT_CODE_OK, code)
+	assert.Contains(t, stdout.String(), "1 paises")
+	snapshot, err := services.LoadCountrySnapshot(output)
+	require.NoError(t, err)
+	assert.Equal(t, 1, snapshot.Len())
+
+	require.NoError(t, os.WriteFile(dataset, []byte(`[]`), 0644))
+	code = Run([]string{"refresh-countries", dataset, "--output", output}, strings.NewReader(""), &stdout, &stderr)
+	assert.Equal(t, utils.EXIT_CODE_ERROR, code)
+	snapshot, err = services.LoadCountrySnapshot(output)
+	require.NoError(t, err)
+	assert.Equal(t, 1, snapshot.Len())
+}
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, utils.EXIT_CODE_OK, ExitCode(nil))
+	assert.Equal(t, utils.EXIT_CODE_ERROR, ExitCode(errors.New("unexpected")))
+	assert.Equal(t, utils.ERR_CODE_INVALID_IP, ExitCode(models.NewOptionInvalidError(utils.ERR_CODE_INVALID_IP, "invalid")))
+	assert.Equal(t, utils.ERR_CODE_LIMIT_REACHED, ExitCode(models.NewCurrencyApiError(utils.ERR_CODE_LIMIT_REACHED, "limit")))
+	assert.Equal(t, utils.ERR_CODE_NON_ROUTABLE_IP, ExitCode(models.NewNonRoutableIpError(utils.ERR_CODE_NON_ROUTABLE_IP, "private", "private")))
+	assert.Equal(t, utils.ERR_CODE_INVALID_RANGE, ExitCode(models.NewOptionInvalidError(utils.ERR_CODE_INVALID_RANGE, "range")))
+}
+
+func TestHandleError_ProviderError(t *testing.T) {
+	var buf bytes.Buffer
+	rejected := models.NewProviderApiError(utils.METRICS_UPSTREAM_FIXER, models.ProviderError{Code: 104, Type: "usage_limit_reached"},
+		utils.ERR_CODE_CURRENCY_SERVICE, utils.ERR_USER_MESSAGE_CURRENCY_SERVICE)
+
+	HandleError(&buf, &models.CurrencyApiError{Code: rejected.Code, Message: rejected.Message, Err: rejected})
+
+	assert.Contains(t, buf.String(), utils.ERR_USER_MESSAGE_LIMIT_REACHED)
+	assert.Contains(t, buf.String(), "(fixer)")
+}
+
+// useLogConfig replaces the log configuration and the default logger for the duration of the test.
+func useLogConfig(t *testing.T, cfg config.Log) {
+	previous, previousLogger := configuration.Log, slog.Default()
+	configuration.Log = cfg
+	t.Cleanup(func() {
+		configuration.Log = previous
+		slog.SetDefault(previousLogger)
+	})
+}
+
+func TestConfigureLogging(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "service.log")
+	useLogConfig(t, config.Log{Format: utils.LOG_FORMAT_JSON, Level: "warn", Output: path})
+	var stdout, stderr bytes.Buffer
+
+	closeLog := ConfigureLogging(&stdout, &stderr)
+	slog.Info("discarded")
+	slog.Warn("kept")
+	closeLog()
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(data), "\n"))
+	assert.Contains(t, string(data), `"msg":"kept"`)
+	assert.Empty(t, stdout.String())
+	assert.Empty(t, stderr.String())
+}
+
+func TestConfigureLogging_Stdout(t *testing.T) {
+	useLogConfig(t, config.Log{Format: utils.LOG_FORMAT_TEXT, Level: utils.LOG_LEVEL_INFO, Output: utils.LOG_OUTPUT_STDOUT})
+	var stdout, stderr bytes.Buffer
+
+	ConfigureLogging(&stdout, &stderr)()
+	slog.Info("to stdout")
+
+	assert.Contains(t, stdout.String(), `msg="to stdout"`)
+	assert.Empty(t, stderr.String())
+}
+
+func TestConfigureLogging_Invalid(t *testing.T) {
+	useLogConfig(t, config.Log{Format: "xml", Level: utils.LOG_LEVEL_INFO, Output: utils.LOG_OUTPUT_STDOUT})
+	var stdout, stderr bytes.Buffer
+
+	ConfigureLogging(&stdout, &stderr)()
+	slog.Info("to stderr")
+
+	// The invalid configuration is reported and the log falls back to the text format on stderr.
+	assert.Empty(t, stdout.String())
+	assert.Contains(t, stderr.String(), utils.ERR_MESSAGE_LOG_CONFIG)
+	assert.Contains(t, stderr.String(), `msg="to stderr"`)
+}
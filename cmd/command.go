@@ -1,120 +1,555 @@
-package cmd
-
-import (
-	"fmt"
-	"log"
-	"net"
-	"service_fraud/interfaces"
-	"service_fraud/models"
-	"service_fraud/services"
-	"service_fraud/utils"
-	"strings"
-	"time"
-)
-
-// Logo is the ASCII art logo displayed in the application.
-var Logo = `	
-__   _   ___   __  _   _   _   ___   __  _   _   __     __                       
-|  \ | | | __| |  \| | | \ / | | __| |  \| | | | | _\   /__\                      
-| -< | | | _|  | | ' |  \ V /  | _|  | | ' | | | | v | | \/ |                     
-|__/ |_|_|___| |_|\__|_  \_/   |___| |_|\__| |_|_|__/___\__/  _   _    ___   __   
-| _,\ | _ \ | || | | __| |  \  /  \   |_   _| | __|  / _/ |  \| | | |  / _/  /  \  
-| v_/ | v / | \/ | | _|  | -< | /\ |    | |   | _|  | \__ | | ' | | | | \__ | /\ | 
-|_| __|_|_\_ \__/  |___| |__/ |_||_|    |_|   |___|  \__/ |_|\__| |_|  \__/ |_||_| 
-|  V  | | __| | |   | |                                                           
-| \_/ | | _|  | |_  | |                                                           
-|_| |_| |___| |___| |_| 
-
-RESPUESTA ANTI FRAUDES
-
-Para el funcionamiento del proceso por favor escriba alguna de las siguientes 
-opciones
-
-- 'traceip <IP a consultar>' para iniciar el proceso de busqueda. Ejemplo:
- traceip 1.4.193.15
-
-- 'record' para mostrar el resumen y detalle de los registros realizados
-
-- 'exit' salir del programa`
-
-var getInformationService interfaces.GetInformation
-var countryRequestDataStore interfaces.DataStore[string, models.CountryResponse]
-var currencyRequestDataStore interfaces.DataStore[string, models.CurrencyResponse]
-
-// init initializes the data stores and information service used in the application.
-func init() {
-	countryRequestDataStore = services.NewRequestDataStore[string, models.CountryResponse]()
-	currencyRequestDataStore = services.NewRequestDataStore[string, models.CurrencyResponse]()
-	getInformationService = services.NewInformationService(services.NewAwsSecrets(), countryRequestDataStore, currencyRequestDataStore)
-}
-
-// Start processes the user option, validates it, and either retrieves information
-// about an IP address or provides statistics based on the selected flow.
-func Start(option string) error {
-	flow, ip, err := isValidOption(option)
-	if err != nil {
-		log.Println("Error", err.Error())
-		return err
-	}
-	log.Printf(utils.LOG_MESSAGE_VALID_PARAMETER, option)
-	if flow == 2 {
-		since := time.Now()
-		fmt.Print(getInformationService.GetStatsService().GetStats())
-		log.Printf(utils.LOG_MESSAGE_ELAPSED_TIME, option, time.Since(since).Seconds())
-	} else if flow == 1 {
-		since := time.Now()
-		err := GetInformation(getInformationService, ip)
-		log.Printf(utils.LOG_MESSAGE_ELAPSED_TIME, option, time.Since(since).Seconds())
-		return err
-	}
-	return nil
-}
-
-// isValidOption validates the user input option and returns the flow type, IP address
-// (if applicable), and any errors encountered during validation.
-func isValidOption(option string) (int, string, error) {
-	santizeStr := strings.TrimSpace(option)
-	if len(santizeStr) == 0 {
-		return 0, "", models.NewOptionInvalidError(utils.ERR_CODE_INVALID_OPTION, fmt.Sprintf(utils.ERR_MESSAGE_INVALID_OPTION, option))
-	}
-
-	arr := strings.Split(santizeStr, " ")
-	switch num := len(arr); {
-	case num == 2:
-		if arr[0] == "traceip" {
-			err := IsValidIp(arr[1])
-			if err != nil {
-				return 0, "", err
-			}
-			return 1, arr[1], nil
-		} else {
-			return 0, arr[1], models.NewOptionInvalidError(utils.ERR_CODE_INVALID_OPTION, fmt.Sprintf(utils.ERR_MESSAGE_INVALID_OPTION, option))
-		}
-	case num == 1:
-		if arr[0] == "record" {
-			return 2, "", nil
-		} else {
-			return 0, "", models.NewOptionInvalidError(utils.ERR_CODE_INVALID_OPTION, fmt.Sprintf(utils.ERR_MESSAGE_INVALID_OPTION, option))
-		}
-	default:
-		return 0, "", models.NewOptionInvalidError(utils.ERR_CODE_INVALID_OPTION, fmt.Sprintf(utils.ERR_MESSAGE_INVALID_OPTION, option))
-	}
-}
-
-// IsValidIp checks if the provided string is a valid IPv4 address.
-// Returns an error if the IP is invalid.
-func IsValidIp(ipStr string) error {
-	ip := net.ParseIP(ipStr)
-	res := ip != nil && ip.To4() != nil
-	if !res {
-		return models.NewOptionInvalidError(utils.ERR_CODE_INVALID_IP, fmt.Sprintf(utils.ERR_MESSAGE_INVALID_IP, ipStr))
-	}
-	return nil
-}
-
-// GetInformation retrieves all product information for the specified IP address
-// using the provided process interface.
-func GetInformation(process interfaces.GetInformation, ip string) error {
-	err := process.GetAllProducts(ip)
-	return err
-}
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"service_fraud/config"
+	"service_fraud/interfaces"
+	"service_fraud/models"
+	"service_fraud/render"
+	"service_fraud/services"
+	"service_fraud/utils"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Logo is the ASCII art logo displayed in the application.
+var Logo = `	
+__   _   ___   __  _   _   _   ___   __  _   _   __     __                       
+|  \ | | | __| |  \| | | \ / | | __| |  \| | | | | _\   /__\                      
+| -< | | | _|  | | ' |  \ V /  | _|  | | ' | | | | v | | \/ |                     
+|__/ |_|_|___| |_|\__|_  \_/   |___| |_|\__| |_|_|__/___\__/  _   _    ___   __   
+| _,\ | _ \ | || | | __| |  \  /  \   |_   _| | __|  / _/ |  \| | | |  / _/  /  \  
+| v_/ | v / | \/ | | _|  | -< | /\ |    | |   | _|  | \__ | | ' | | | | \__ | /\ | 
+|_| __|_|_\_ \__/  |___| |__/ |_||_|    |_|   |___|  \__/ |_|\__| |_|  \__/ |_||_| 
+|  V  | | __| | |   | |                                                           
+| \_/ | | _|  | |_  | |                                                           
+|_| |_| |___| |___| |_| 
+
+RESPUESTA ANTI FRAUDES
+
+Para el funcionamiento del proceso por favor escriba alguna de las siguientes 
+opciones
+
+- 'traceip <IP a consultar>' para iniciar el proceso de busqueda, acepta
+ direcciones IPv4 e IPv6. Ejemplo:
+ traceip 1.4.193.15
+ traceip 2800:810:400::1
+ Acepta '--amount <monto>' y '--currency <moneda>' para convertir el monto de la
+ operacion y evaluar las reglas de riesgo por monto. Ejemplo:
+ traceip 1.4.193.15 --amount 1500.50 --currency ARS
+ Con '--at <AAAA-MM-DD>' usa las cotizaciones historicas de esa fecha. Ejemplo:
+ traceip 1.4.193.15 --at 2026-09-01
+
+- 'record' para mostrar el resumen y detalle de los registros realizados. Acepta
+ '--since <duracion>' o '--from <fecha> --to <fecha>' para limitarlo a un rango de
+ tiempo. Ejemplo: record --since 1h
+
+- 'batch <archivo>' para consultar las ips del archivo (una por linea). Acepta
+ '--format <ndjson|csv>', '--output <archivo>' y '--workers <cantidad>'
+
+- 'health' para mostrar el estado de los servicios externos (circuit breakers)
+
+- 'rates' para mostrar las cotizaciones en uso, su antiguedad y si estan desactualizadas
+
+- 'convert <monto> <moneda> [to <moneda>]' para convertir un monto con las cotizaciones
+ en uso, por defecto a la moneda de destino configurada. Acepta '--at <AAAA-MM-DD>' para usar
+ las cotizaciones historicas de esa fecha. Ejemplo: convert 1500.50 ARS to EUR --at 2026-09-01
+
+Las opciones 'traceip' y 'record' aceptan '--format <text|json|yaml|csv|table>' para elegir el
+formato de la salida. Ejemplo: traceip 1.4.193.15 --format json
+
+- 'exit' salir del programa`
+
+var getInformationService interfaces.GetInformation
+var ipRequestDataStore interfaces.DataStore[string, models.IpApiResponse]
+var countryRequestDataStore interfaces.DataStore[string, models.CountryResponse]
+
+// watchers holds the functions that start the background refreshes of the services, which only
+// the long running commands use. Each one returns the function that stops its refresh.
+var watchers []func() (stop func())
+
+// configuration holds the settings of the application, the default ones until LoadConfiguration
+// reads the configuration file.
+var configuration = config.Default()
+
+// allowedFlags defines the flags accepted by each flow.
+var allowedFlags = map[int][]string{
+	1: {"format", "at", "amount", "currency"},
+	2: {"format", "since", "from", "to"},
+	3: {"format", "output", "workers"},
+	4: {},
+	5: {},
+	6: {"at"},
+}
+
+// userOption holds the flow selected by the user along with its arguments and flags.
+type userOption struct {
+	flow     int
+	ip       string
+	file     string
+	amount   string
+	currency string
+	target   string
+	flags    map[string]string
+}
+
+// LoadConfiguration reads the configuration file. When it cannot be read the default values are
+// kept and the error is returned, so it is logged once the log is configured.
+func LoadConfiguration() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	configuration = cfg
+	return nil
+}
+
+// setup creates the data stores and the information service used by the commands from the
+// configuration. Run calls it after the log is configured and only for the commands that use the
+// services. It does nothing when the services are already set up.
+func setup(cfg *config.Config) {
+	if getInformationService != nil {
+		return
+	}
+	ipStore := services.NewRequestDataStore[string, models.IpApiResponse]()
+	ipStore.SetMetrics(utils.METRICS_CACHE_IP, services.DefaultMetrics())
+	countryStore := services.NewRequestDataStore[string, models.CountryResponse]()
+	countryStore.SetMetrics(utils.METRICS_CACHE_COUNTRY, services.DefaultMetrics())
+	ipRequestDataStore, countryRequestDataStore = ipStore, countryStore
+	informationService := services.NewInformationService(services.NewAwsSecrets(), ipRequestDataStore, countryRequestDataStore)
+	informationService.SetGeolocators(newGeolocators(cfg.Geolocation, informationService)...)
+	informationService.SetCountryProviders(newCountryProviders(cfg.Countries, informationService)...)
+	informationService.SetTraceTimeout(time.Duration(cfg.Trace.TimeoutSeconds) * time.Second)
+	upstreams := newUpstreams(cfg.Upstreams)
+	informationService.SetUpstreams(upstreams)
+	if err := cfg.Risk.Validate(); err != nil {
+		slog.Warn(utils.ERR_MESSAGE_RISK_POLICY, "error", err)
+		cfg.Risk = models.DefaultRiskPolicy()
+	}
+	informationService.SetRiskEvaluator(services.NewRiskService(cfg.Risk))
+	if len(cfg.Lists.Files) > 0 {
+		lists := newListService(cfg.Lists)
+		informationService.SetListMatcher(lists)
+		if cfg.Lists.ReloadSeconds > 0 {
+			interval := time.Duration(cfg.Lists.ReloadSeconds) * time.Second
+			watchers = append(watchers, func() func() { return lists.Watch(interval) })
+		}
+	}
+	if err := models.ValidateReferenceLocations(cfg.References.Locations); err != nil {
+		slog.Warn(utils.ERR_MESSAGE_REFERENCES, "error", err)
+		cfg.References.Locations = models.DefaultReferenceLocations()
+	}
+	informationService.SetReferences(cfg.References.Locations, cfg.References.Distances == utils.REFERENCE_DISTANCES_NEAREST)
+	cfg.Currency.Target = strings.ToUpper(cfg.Currency.Target)
+	if err := models.ValidateCurrencyCode(cfg.Currency.Target); err != nil {
+		slog.Warn(utils.ERR_MESSAGE_CURRENCY_TARGET, "error", err)
+		cfg.Currency.Target = utils.CURRENCY_DEFAULT_TARGET
+	}
+	informationService.SetTargetCurrency(cfg.Currency.Target)
+	rates := newRatesManager(cfg.Currency, newRatesProviders(cfg.Currency, informationService, upstreams)...)
+	informationService.SetRatesManager(rates)
+	if cfg.Currency.RefreshSeconds > 0 {
+		interval := time.Duration(cfg.Currency.RefreshSeconds) * time.Second
+		watchers = append(watchers, func() func() { return rates.Watch(interval) })
+	}
+	if statsService, ok := informationService.StatsService.(*services.StatsService); ok {
+		// The references are set first so the persisted stats are measured from them.
+		statsService.SetReferences(cfg.References.Locations)
+		if err := models.ValidateHistogramBuckets(cfg.Stats.HistogramBuckets); err != nil {
+			slog.Warn(utils.ERR_MESSAGE_HISTOGRAM_BUCKETS, "error", err)
+			cfg.Stats.HistogramBuckets = models.DefaultHistogramBuckets()
+		}
+		statsService.SetHistogramBuckets(cfg.Stats.HistogramBuckets)
+		if cfg.Stats.RetentionHours <= 0 {
+			cfg.Stats.RetentionHours = utils.STATS_DEFAULT_RETENTION_HOURS
+		}
+		retention := time.Duration(cfg.Stats.RetentionHours) * time.Hour
+		windows, err := models.ParseStatsWindows(cfg.Stats.Windows, retention)
+		if err != nil {
+			slog.Warn(utils.ERR_MESSAGE_STATS_WINDOWS, "error", err)
+			windows = nil
+		}
+		statsService.SetWindows(time.Duration(cfg.Stats.BucketSeconds)*time.Second, retention, windows)
+		if cfg.Stats.Path != "" {
+			store := services.NewFileStatsStore(cfg.Stats.Path, cfg.Stats.CompactAfter)
+			store.SetRetention(retention)
+			if err := statsService.SetStore(store); err != nil {
+				slog.Warn(utils.ERR_MESSAGE_STATS_LOAD, "error", err)
+			}
+		}
+	}
+	getInformationService = informationService
+}
+
+// newGeolocators creates the geolocation providers listed in the configuration, in order.
+// The providers that cannot be created are logged and skipped.
+func newGeolocators(cfg config.Geolocation, ipapi interfaces.IpInformation) []interfaces.IpInformation {
+	var geolocators []interfaces.IpInformation
+	for _, provider := range cfg.Providers {
+		switch provider {
+		case utils.GEO_PROVIDER_IPAPI:
+			geolocators = append(geolocators, ipapi)
+		case utils.GEO_PROVIDER_MMDB:
+			mmdb, err := services.NewMMDBGeolocation(cfg.MMDBPath)
+			if err != nil {
+				slog.Warn(utils.ERR_MESSAGE_MMDB_OPEN, "error", err)
+				continue
+			}
+			geolocators = append(geolocators, mmdb)
+		default:
+			slog.Warn(utils.ERR_MESSAGE_GEO_PROVIDER, "provider", provider)
+		}
+	}
+	return geolocators
+}
+
+// newCountryProviders creates the country information providers listed in the configuration,
+// in order. The providers that cannot be created are logged and skipped.
+func newCountryProviders(cfg config.Countries, restcountries interfaces.CountryInformation) []interfaces.CountryInformation {
+	var providers []interfaces.CountryInformation
+	for _, provider := range cfg.Providers {
+		switch provider {
+		case utils.COUNTRY_PROVIDER_RESTCOUNTRIES:
+			providers = append(providers, restcountries)
+		case utils.COUNTRY_PROVIDER_SNAPSHOT:
+			snapshot, err := newCountrySnapshot(cfg.SnapshotPath)
+			if err != nil {
+				slog.Warn(utils.ERR_MESSAGE_COUNTRY_SNAPSHOT, "error", err)
+				continue
+			}
+			providers = append(providers, snapshot)
+		default:
+			slog.Warn(utils.ERR_MESSAGE_COUNTRY_PROVIDER, "provider", provider)
+		}
+	}
+	return providers
+}
+
+// newCountrySnapshot loads the snapshot from the given path or, when it is empty, the
+// snapshot embedded in the binary.
+func newCountrySnapshot(path string) (*services.CountrySnapshot, error) {
+	if path == "" {
+		return services.NewEmbeddedCountrySnapshot()
+	}
+	return services.LoadCountrySnapshot(path)
+}
+
+// newUpstreams creates the retries and circuit breakers of the calls to the external APIs.
+func newUpstreams(cfg config.Upstreams) *services.Upstreams {
+	retry := services.RetryPolicy{
+		MaxAttempts:    cfg.MaxAttempts,
+		BaseDelay:      time.Duration(cfg.BaseDelayMs) * time.Millisecond,
+		MaxDelay:       time.Duration(cfg.MaxDelayMs) * time.Millisecond,
+		AttemptTimeout: time.Duration(cfg.TimeoutSeconds) * time.Second,
+	}
+	breaker := services.BreakerPolicy{
+		FailureThreshold: cfg.FailureThreshold,
+		OpenDuration:     time.Duration(cfg.OpenSeconds) * time.Second,
+	}
+	return services.NewUpstreams(retry, breaker)
+}
+
+// newRatesProviders creates the exchange rates providers listed in the configuration, in order,
+// sharing the retries and circuit breakers of fixer. The providers that cannot be created are
+// logged and skipped, fixer is used when none is left.
+func newRatesProviders(cfg config.Currency, fixer interfaces.CurrencyInformation, upstreams *services.Upstreams) []interfaces.CurrencyInformation {
+	var providers []interfaces.CurrencyInformation
+	for _, provider := range cfg.Providers {
+		switch provider {
+		case utils.RATES_PROVIDER_FIXER:
+			providers = append(providers, fixer)
+		case utils.RATES_PROVIDER_ECB:
+			ecb := services.NewECBRates(cfg.ECBURL)
+			ecb.SetHistoryURL(cfg.ECBHistoryURL)
+			ecb.SetUpstreams(upstreams)
+			providers = append(providers, ecb)
+		case utils.RATES_PROVIDER_JSON:
+			format := services.JSONRatesFormat{
+				RatesField:     cfg.JSON.RatesField,
+				BaseField:      cfg.JSON.BaseField,
+				TimestampField: cfg.JSON.TimestampField,
+				Base:           strings.ToUpper(cfg.JSON.Base),
+			}
+			json, err := services.NewJSONRates(cfg.JSON.Name, cfg.JSON.URL, format)
+			if err != nil {
+				slog.Warn(utils.ERR_MESSAGE_RATES_JSON, "error", err)
+				continue
+			}
+			json.SetHistoryURL(cfg.JSON.HistoryURL)
+			json.SetUpstreams(upstreams)
+			providers = append(providers, json)
+		default:
+			slog.Warn(utils.ERR_MESSAGE_RATES_PROVIDER, "provider", provider)
+		}
+	}
+	if len(providers) == 0 {
+		providers = append(providers, fixer)
+	}
+	return providers
+}
+
+// newRatesManager creates the manager of the exchange rates retrieved from the providers, which
+// keeps the historical rates in the configured directory.
+func newRatesManager(cfg config.Currency, providers ...interfaces.CurrencyInformation) *services.RatesManager {
+	policy := services.RatesPolicy{
+		TTL:      time.Duration(cfg.TTLSeconds) * time.Second,
+		MaxStale: time.Duration(cfg.MaxStaleSeconds) * time.Second,
+	}
+	rates := services.NewRatesManager(policy, providers...)
+	rates.SetHistory(services.NewRatesHistory(cfg.HistoryPath))
+	return rates
+}
+
+// startWatchers starts the background refreshes of the services set up and returns the function
+// that stops them, waiting for the refreshes in progress to finish.
+func startWatchers() (stop func()) {
+	stops := make([]func(), 0, len(watchers))
+	for _, watch := range watchers {
+		stops = append(stops, watch())
+	}
+	return func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}
+}
+
+// newListService loads the allowlists and blocklists, logging the lists that cannot be loaded,
+// which start empty.
+func newListService(cfg config.Lists) *services.ListService {
+	lists, err := services.NewListService(cfg.Files)
+	if err != nil {
+		slog.Warn(utils.ERR_MESSAGE_LISTS, "error", err)
+	}
+	return lists
+}
+
+// Start processes the user option, validates it, and either retrieves information
+// about an IP address, provides statistics, traces a file of IPs, shows the state of the
+// external APIs, shows the exchange rates or converts an amount based on the selected flow.
+// The results are written to w. Canceling the context stops the traces in flight.
+func Start(ctx context.Context, w io.Writer, option string) error {
+	opt, err := isValidOption(option)
+	if err != nil {
+		slog.Warn(utils.ERR_MESSAGE_OPTION_FAILED, "option", option, "error", err)
+		return err
+	}
+	slog.Info(utils.LOG_MESSAGE_VALID_PARAMETER, "option", option)
+	since := time.Now()
+	defer func() {
+		slog.Info(utils.LOG_MESSAGE_ELAPSED_TIME, "option", option, "elapsed_seconds", time.Since(since).Seconds())
+	}()
+
+	switch opt.flow {
+	case 1:
+		renderer, err := getRenderer(opt)
+		if err != nil {
+			return err
+		}
+		ctx, err = services.WithRatesDateValue(ctx, opt.flags["at"])
+		if err == nil {
+			ctx, err = services.WithTransactionValue(ctx, opt.flags["amount"], opt.flags["currency"])
+		}
+		if err != nil {
+			return err
+		}
+		return GetInformation(ctx, w, getInformationService, renderer, opt.ip)
+	case 2:
+		renderer, err := getRenderer(opt)
+		if err != nil {
+			return err
+		}
+		summary, err := services.GetStatsRange(getInformationService.GetStatsService(), opt.flags["since"], opt.flags["from"], opt.flags["to"])
+		if err != nil {
+			return err
+		}
+		return renderer.RenderStats(w, summary)
+	case 3:
+		return runBatchOption(ctx, w, opt)
+	case 4:
+		return render.RenderHealth(w, getInformationService.GetHealth())
+	case 5:
+		snapshot, err := getInformationService.GetRates(ctx)
+		if err != nil {
+			return err
+		}
+		return render.RenderRates(w, snapshot)
+	case 6:
+		conversion, err := convertAmount(ctx, opt.amount, opt.currency, opt.target, opt.flags["at"])
+		if err != nil {
+			return err
+		}
+		return render.RenderConversion(w, conversion)
+	}
+	return nil
+}
+
+// runBatchOption traces the IPs of the file given to the 'batch' option, writing the
+// results to the file given by the 'output' flag or to w, along with the summary.
+func runBatchOption(ctx context.Context, w io.Writer, opt userOption) error {
+	batchOpts := BatchOptions{Format: opt.flags["format"]}
+	if value, ok := opt.flags["workers"]; ok {
+		workers, err := strconv.Atoi(value)
+		if err != nil || workers <= 0 {
+			return models.NewOptionInvalidError(utils.ERR_CODE_INVALID_OPTION, fmt.Sprintf(utils.ERR_MESSAGE_INVALID_OPTION, "--workers "+value))
+		}
+		batchOpts.Workers = workers
+	}
+
+	in, err := os.Open(opt.file)
+	if err != nil {
+		slog.Error(utils.ERR_MESSAGE_OPTION_FAILED, "file", opt.file, "error", err)
+		return models.NewOptionInvalidError(utils.ERR_CODE_INVALID_OPTION, fmt.Sprintf(utils.ERR_MESSAGE_BATCH_FILE, err))
+	}
+	defer in.Close()
+
+	out := w
+	if path, ok := opt.flags["output"]; ok {
+		file, err := os.Create(path)
+		if err != nil {
+			slog.Error(utils.ERR_MESSAGE_OPTION_FAILED, "output", path, "error", err)
+			return models.NewOptionInvalidError(utils.ERR_CODE_INVALID_OPTION, fmt.Sprintf(utils.ERR_MESSAGE_BATCH_FILE, err))
+		}
+		defer file.Close()
+		out = file
+	}
+
+	summary, err := RunBatch(ctx, getInformationService, in, out, batchOpts)
+	if err != nil {
+		return err
+	}
+	return render.RenderBatchSummary(w, summary)
+}
+
+// getRenderer returns the renderer for the format requested with the 'format' flag,
+// falling back to the format defined in the configuration.
+func getRenderer(opt userOption) (interfaces.Renderer, error) {
+	format := configuration.Format
+	if value, ok := opt.flags["format"]; ok {
+		format = value
+	}
+	return render.New(format)
+}
+
+// isValidOption validates the user input option and returns the flow type, IP address
+// or file (if applicable), flags, and any errors encountered during validation.
+func isValidOption(option string) (userOption, error) {
+	invalidOption := models.NewOptionInvalidError(utils.ERR_CODE_INVALID_OPTION, fmt.Sprintf(utils.ERR_MESSAGE_INVALID_OPTION, option))
+	santizeStr := strings.TrimSpace(option)
+	if len(santizeStr) == 0 {
+		return userOption{}, invalidOption
+	}
+
+	arr, flags, ok := parseFlags(strings.Fields(santizeStr))
+	if !ok {
+		return userOption{}, invalidOption
+	}
+
+	opt := userOption{flags: flags}
+	switch num := len(arr); {
+	case (num == 3 || (num == 5 && strings.EqualFold(arr[3], "to"))) && arr[0] == "convert":
+		opt.flow = 6
+		opt.amount = arr[1]
+		opt.currency = arr[2]
+		if num == 5 {
+			opt.target = strings.ToUpper(arr[4])
+		}
+	case num == 2:
+		if arr[0] == "traceip" {
+			ip, err := CanonicalIp(arr[1])
+			if err != nil {
+				return userOption{}, err
+			}
+			opt.flow = 1
+			opt.ip = ip
+		} else if arr[0] == "batch" {
+			opt.flow = 3
+			opt.file = arr[1]
+		} else {
+			return userOption{}, invalidOption
+		}
+	case num == 1:
+		if arr[0] == "record" {
+			opt.flow = 2
+		} else if arr[0] == "health" {
+			opt.flow = 4
+		} else if arr[0] == "rates" {
+			opt.flow = 5
+		} else {
+			return userOption{}, invalidOption
+		}
+	default:
+		return userOption{}, invalidOption
+	}
+
+	for name := range flags {
+		if !slices.Contains(allowedFlags[opt.flow], name) {
+			return userOption{}, invalidOption
+		}
+	}
+	return opt, nil
+}
+
+// parseFlags separates the '--name value' and '--name=value' flags from the positional
+// arguments. It reports false when a flag has no value.
+func parseFlags(fields []string) ([]string, map[string]string, bool) {
+	args := make([]string, 0, len(fields))
+	flags := make(map[string]string)
+	for i := 0; i < len(fields); i++ {
+		if !strings.HasPrefix(fields[i], "--") {
+			args = append(args, fields[i])
+			continue
+		}
+		name, value, found := strings.Cut(strings.TrimPrefix(fields[i], "--"), "=")
+		if !found {
+			if i+1 >= len(fields) {
+				return nil, nil, false
+			}
+			i++
+			value = fields[i]
+		}
+		if name == "" || value == "" {
+			return nil, nil, false
+		}
+		flags[name] = value
+	}
+	return args, flags, true
+}
+
+// IsValidIp checks if the provided string is a valid IPv4 or IPv6 address.
+// Returns an error if the IP is invalid.
+func IsValidIp(ipStr string) error {
+	_, err := CanonicalIp(ipStr)
+	return err
+}
+
+// CanonicalIp validates the provided IPv4 or IPv6 address and returns it in its
+// canonical notation. Returns an error if the IP is invalid.
+func CanonicalIp(ipStr string) (string, error) {
+	ip, ok := utils.CanonicalIp(ipStr)
+	if !ok {
+		return "", models.NewOptionInvalidError(utils.ERR_CODE_INVALID_IP, fmt.Sprintf(utils.ERR_MESSAGE_INVALID_IP, ipStr))
+	}
+	return ip, nil
+}
+
+// GetInformation retrieves all product information for the specified IP address
+// using the provided process interface and renders it to w with the given renderer.
+func GetInformation(ctx context.Context, w io.Writer, process interfaces.GetInformation, renderer interfaces.Renderer, ip string) error {
+	result, err := process.GetAllProducts(ctx, ip)
+	if err != nil {
+		return err
+	}
+	return renderer.RenderTrace(w, result)
+}
+
+// GetInformationService returns the information service shared by the application flows.
+func GetInformationService() interfaces.GetInformation {
+	return getInformationService
+}
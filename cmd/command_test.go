@@ -1,124 +1,278 @@
-package cmd
-
-import (
-	"errors"
-	"testing"
-
-	"service_fraud/interfaces"
-	"service_fraud/models"
-
-	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/mock"
-)
-
-type MockGetInformation struct {
-	mock.Mock
-}
-
-func (m *MockGetInformation) Geolocation(ip string) models.IpApiResponse {
-	args := m.Called(ip)
-	return args.Get(0).(models.IpApiResponse)
-}
-
-func (m *MockGetInformation) GetCountryInformation(country string) models.CountryResponse {
-	args := m.Called(country)
-	return args.Get(0).(models.CountryResponse)
-}
-
-func (m *MockGetInformation) GetCurrencyInformation() models.CurrencyResponse {
-	args := m.Called()
-	return args.Get(0).(models.CurrencyResponse)
-}
-
-func (m *MockGetInformation) GetAllProducts(ip string) error {
-	args := m.Called(ip)
-	return args.Error(0)
-}
-
-func (m *MockGetInformation) GetStatsService() interfaces.StatsInformation {
-	args := m.Called()
-	return args.Get(0).(interfaces.StatsInformation)
-}
-
-type MockStatsService struct {
-	mock.Mock
-}
-
-func (m *MockStatsService) GetStats() string {
-	args := m.Called()
-	return args.String(0)
-}
-
-func (m *MockStatsService) Combine(req models.StatsRequest) {
-	m.Called(req)
-}
-
-// Pruebas unitarias
-func TestIsValidIp(t *testing.T) {
-	tests := []struct {
-		ip       string
-		expected bool
-	}{
-		{"1.1.1.1", true},
-		{"256.256.256.256", false},
-		{"invalid_ip", false},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.ip, func(t *testing.T) {
-			err := IsValidIp(tt.ip)
-
-			if tt.expected {
-				assert.NoError(t, err)
-			} else {
-				assert.Error(t, err)
-			}
-		})
-	}
-}
-
-func TestGetInformation(t *testing.T) {
-	mockService := new(MockGetInformation)
-
-	// Simula un retorno exitoso para GetAllProducts
-	mockService.On("GetAllProducts", "1.1.1.1").Return(nil)
-
-	err := GetInformation(mockService, "1.1.1.1")
-	assert.NoError(t, err)
-
-	// Simula un retorno con error para GetAllProducts
-	mockService.On("GetAllProducts", "2.2.2.2").Return(errors.New("some error"))
-	err = GetInformation(mockService, "2.2.2.2")
-	assert.Error(t, err)
-	assert.Equal(t, "some error", err.Error())
-}
-
-func TestStart(t *testing.T) {
-	mockGetInformation := new(MockGetInformation)
-	mockStatsService := new(MockStatsService)
-
-	// Mockear el comportamiento del servicio de estadísticas
-	mockStatsService.On("GetStats").Return("Statistics Data")
-	mockGetInformation.On("GetStatsService").Return(mockStatsService)
-
-	getInformationService = mockGetInformation // Asigna el mock al servicio
-
-	t.Run("valid traceip option", func(t *testing.T) {
-		mockGetInformation.On("GetAllProducts", "1.1.1.1").Return(nil)
-
-		err := Start("traceip 1.1.1.1")
-		assert.NoError(t, err)
-
-	})
-
-	t.Run("valid record option", func(t *testing.T) {
-		err := Start("record")
-		assert.NoError(t, err)
-		mockStatsService.AssertExpectations(t)
-	})
-
-	t.Run("invalid option", func(t *testing.T) {
-		err := Start("invalid option")
-		assert.Error(t, err)
-	})
-}
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"service_fraud/interfaces"
+	"service_fraud/models"
+	"service_fraud/render"
+	"service_fraud/services"
+	"service_fraud/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockGetInformation struct {
+	mock.Mock
+	// ratesDates holds the day of the historical rates each IP was traced with.
+	ratesDates sync.Map
+}
+
+func (m *MockGetInformation) Geolocation(ctx context.Context, ip string) models.IpApiResponse {
+	args := m.Called(ip)
+	return args.Get(0).(models.IpApiResponse)
+}
+
+func (m *MockGetInformation) GetCountryInformation(ctx context.Context, country string) models.CountryResponse {
+	args := m.Called(country)
+	return args.Get(0).(models.CountryResponse)
+}
+
+func (m *MockGetInformation) GetCurrencyInformation(ctx context.Context) models.CurrencyResponse {
+	args := m.Called()
+	return args.Get(0).(models.CurrencyResponse)
+}
+
+func (m *MockGetInformation) GetAllProducts(ctx context.Context, ip string) (models.TraceResult, error) {
+	if date, ok := services.RatesDate(ctx); ok {
+		m.ratesDates.Store(ip, date)
+	}
+	args := m.Called(ip)
+	return args.Get(0).(models.TraceResult), args.Error(1)
+}
+
+func (m *MockGetInformation) GetStatsService() interfaces.StatsInformation {
+	args := m.Called()
+	return args.Get(0).(interfaces.StatsInformation)
+}
+
+func (m *MockGetInformation) GetHealth() models.HealthReport {
+	args := m.Called()
+	return args.Get(0).(models.HealthReport)
+}
+
+func (m *MockGetInformation) GetRates(ctx context.Context) (models.RatesSnapshot, error) {
+	args := m.Called()
+	return args.Get(0).(models.RatesSnapshot), args.Error(1)
+}
+
+func (m *MockGetInformation) Convert(ctx context.Context, money models.Money, target string) (models.Conversion, error) {
+	args := m.Called(money.String(), target)
+	return args.Get(0).(models.Conversion), args.Error(1)
+}
+
+type MockStatsService struct {
+	mock.Mock
+}
+
+func (m *MockStatsService) GetStats() models.StatsSummary {
+	args := m.Called()
+	return args.Get(0).(models.StatsSummary)
+}
+
+func (m *MockStatsService) Combine(req models.StatsRequest) {
+	m.Called(req)
+}
+
+func (m *MockStatsService) GetStatsWindow(from, to time.Time) (models.StatsSummary, error) {
+	args := m.Called(from, to)
+	return args.Get(0).(models.StatsSummary), args.Error(1)
+}
+
+// Pruebas unitarias
+func TestIsValidIp(t *testing.T) {
+	tests := []struct {
+		ip       string
+		expected bool
+	}{
+		{"1.1.1.1", true},
+		{"2800:810:400::1", true},
+		{"::ffff:1.1.1.1", true},
+		{"256.256.256.256", false},
+		{"2800:810:400::1::1", false},
+		{"invalid_ip", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			err := IsValidIp(tt.ip)
+
+			if tt.expected {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestCanonicalIp(t *testing.T) {
+	ip, err := CanonicalIp("2800:0810:0400:0000:0000:0000:0000:0001")
+	assert.NoError(t, err)
+	assert.Equal(t, "2800:810:400::1", ip)
+
+	_, err = CanonicalIp("invalid_ip")
+	assert.Error(t, err)
+}
+
+func TestGetInformation(t *testing.T) {
+	mockService := new(MockGetInformation)
+
+	// Simula un retorno exitoso para GetAllProducts
+	mockService.On("GetAllProducts", "1.1.1.1").Return(models.TraceResult{}, nil)
+
+	err := GetInformation(context.Background(), io.Discard, mockService, render.NewTextRenderer(), "1.1.1.1")
+	assert.NoError(t, err)
+
+	// Simula un retorno con error para GetAllProducts
+	mockService.On("GetAllProducts", "2.2.2.2").Return(models.TraceResult{}, errors.New("some error"))
+	err = GetInformation(context.Background(), io.Discard, mockService, render.NewTextRenderer(), "2.2.2.2")
+	assert.Error(t, err)
+	assert.Equal(t, "some error", err.Error())
+}
+
+func TestStart(t *testing.T) {
+	mockGetInformation := new(MockGetInformation)
+	mockStatsService := new(MockStatsService)
+
+	// Mockear el comportamiento del servicio de estadísticas
+	mockStatsService.On("GetStats").Return(models.StatsSummary{})
+	mockGetInformation.On("GetStatsService").Return(mockStatsService)
+
+	getInformationService = mockGetInformation // Asigna el mock al servicio
+
+	t.Run("valid traceip option", func(t *testing.T) {
+		mockGetInformation.On("GetAllProducts", "1.1.1.1").Return(models.TraceResult{}, nil)
+
+		err := Start(context.Background(), io.Discard, "traceip 1.1.1.1")
+		assert.NoError(t, err)
+
+	})
+
+	t.Run("valid traceip option with IPv6 in another notation", func(t *testing.T) {
+		mockGetInformation.On("GetAllProducts", "2800:810:400::1").Return(models.TraceResult{}, nil)
+
+		err := Start(context.Background(), io.Discard, "traceip 2800:0810:0400:0:0:0:0:1")
+		assert.NoError(t, err)
+		mockGetInformation.AssertCalled(t, "GetAllProducts", "2800:810:400::1")
+	})
+
+	t.Run("valid record option", func(t *testing.T) {
+		err := Start(context.Background(), io.Discard, "record")
+		assert.NoError(t, err)
+		mockStatsService.AssertExpectations(t)
+	})
+
+	t.Run("valid record option with time range", func(t *testing.T) {
+		mockStatsService.On("GetStatsWindow", mock.Anything, mock.Anything).Return(models.StatsSummary{}, nil)
+
+		assert.NoError(t, Start(context.Background(), io.Discard, "record --since 1h"))
+		assert.NoError(t, Start(context.Background(), io.Discard, "record --from 2024-05-01T10:00 --to 2024-05-01T12:00 --format table"))
+		mockStatsService.AssertNumberOfCalls(t, "GetStatsWindow", 2)
+
+		var optionError *models.OptionInvalidError
+		assert.ErrorAs(t, Start(context.Background(), io.Discard, "record --to 2024-05-01"), &optionError)
+		assert.Equal(t, utils.ERR_CODE_INVALID_RANGE, optionError.Code)
+		assert.Error(t, Start(context.Background(), io.Discard, "traceip 1.1.1.1 --since 1h"))
+	})
+
+	t.Run("invalid option", func(t *testing.T) {
+		err := Start(context.Background(), io.Discard, "invalid option")
+		assert.Error(t, err)
+	})
+
+	t.Run("valid health option", func(t *testing.T) {
+		mockGetInformation.On("GetHealth").Return(models.NewHealthReport(models.UpstreamHealth{Name: utils.METRICS_UPSTREAM_IPAPI, State: utils.CIRCUIT_STATE_CLOSED}))
+
+		assert.NoError(t, Start(context.Background(), io.Discard, "health"))
+		assert.Error(t, Start(context.Background(), io.Discard, "health --format json"))
+		mockGetInformation.AssertNumberOfCalls(t, "GetHealth", 1)
+	})
+
+	t.Run("valid rates option", func(t *testing.T) {
+		mockGetInformation.On("GetRates").Return(models.RatesSnapshot{Base: "EUR", Rates: map[string]float64{"USD": 1.1}}, nil)
+
+		assert.NoError(t, Start(context.Background(), io.Discard, "rates"))
+		assert.Error(t, Start(context.Background(), io.Discard, "rates --format json"))
+		mockGetInformation.AssertNumberOfCalls(t, "GetRates", 1)
+	})
+
+	t.Run("valid traceip option with amount", func(t *testing.T) {
+		assert.NoError(t, Start(context.Background(), io.Discard, "traceip 1.1.1.1 --amount 1500.50 --currency ARS"))
+
+		var optionError *models.OptionInvalidError
+		assert.ErrorAs(t, Start(context.Background(), io.Discard, "traceip 1.1.1.1 --amount 1500,50"), &optionError)
+		assert.Equal(t, utils.ERR_CODE_INVALID_AMOUNT, optionError.Code)
+		assert.Error(t, Start(context.Background(), io.Discard, "record --amount 10"))
+	})
+
+	t.Run("valid convert option", func(t *testing.T) {
+		mockGetInformation.On("Convert", "1500.50 ARS", "").Return(models.Conversion{Amount: "1500.50", Currency: "ARS", Converted: "1.57", Target: "USD"}, nil)
+		mockGetInformation.On("Convert", "1500.50 ARS", "EUR").Return(models.Conversion{Amount: "1500.50", Currency: "ARS", Converted: "1.48", Target: "EUR"}, nil)
+
+		assert.NoError(t, Start(context.Background(), io.Discard, "convert 1500.50 ars"))
+		assert.NoError(t, Start(context.Background(), io.Discard, "convert 1500.50 ARS to EUR"))
+		mockGetInformation.AssertNumberOfCalls(t, "Convert", 2)
+		assert.Error(t, Start(context.Background(), io.Discard, "convert 1500.50 ARS EUR"))
+		assert.Error(t, Start(context.Background(), io.Discard, "convert 1500.50 ARS --format json"))
+		assert.Error(t, Start(context.Background(), io.Discard, "convert ten ARS"))
+	})
+
+	t.Run("valid format flag", func(t *testing.T) {
+		assert.NoError(t, Start(context.Background(), io.Discard, "traceip 1.1.1.1 --format json"))
+		assert.NoError(t, Start(context.Background(), io.Discard, "record --format=csv"))
+	})
+
+	t.Run("invalid format flag", func(t *testing.T) {
+		err := Start(context.Background(), io.Discard, "traceip 1.1.1.1 --format xml")
+
+		var optionError *models.OptionInvalidError
+		assert.ErrorAs(t, err, &optionError)
+		assert.Equal(t, utils.ERR_CODE_INVALID_FORMAT, optionError.Code)
+	})
+
+	t.Run("valid batch option", func(t *testing.T) {
+		dir := t.TempDir()
+		input := filepath.Join(dir, "ips.txt")
+		output := filepath.Join(dir, "results.csv")
+		require.NoError(t, os.WriteFile(input, []byte("1.1.1.1\n"), 0644))
+
+		err := Start(context.Background(), io.Discard, "batch "+input+" --format csv --output "+output+" --workers 2")
+		assert.NoError(t, err)
+
+		content, err := os.ReadFile(output)
+		require.NoError(t, err)
+		assert.Equal(t, 2, strings.Count(string(content), "\n"))
+	})
+
+	t.Run("invalid batch option", func(t *testing.T) {
+		assert.Error(t, Start(context.Background(), io.Discard, "batch missing_file.txt"))
+		assert.Error(t, Start(context.Background(), io.Discard, "batch ips.txt --workers none"))
+	})
+
+	t.Run("unknown or incomplete flag", func(t *testing.T) {
+		assert.Error(t, Start(context.Background(), io.Discard, "traceip 1.1.1.1 --color red"))
+		assert.Error(t, Start(context.Background(), io.Discard, "record --format"))
+	})
+}
+
+func TestParseFlags(t *testing.T) {
+	args, flags, ok := parseFlags([]string{"traceip", "--format", "json", "1.1.1.1"})
+
+	assert.True(t, ok)
+	assert.Equal(t, []string{"traceip", "1.1.1.1"}, args)
+	assert.Equal(t, map[string]string{"format": "json"}, flags)
+
+	_, _, ok = parseFlags([]string{"record", "--format="})
+	assert.False(t, ok)
+}
@@ -0,0 +1,251 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"service_fraud/models"
+	"service_fraud/utils"
+)
+
+// Config holds the settings of the application that can be changed without recompiling.
+type Config struct {
+	// Format is the default output format used by the 'traceip' and 'record' options.
+	Format string `json:"format"`
+	// Geolocation selects the providers used to geolocate the IPs.
+	Geolocation Geolocation `json:"geolocation"`
+	// Countries selects the providers used to retrieve the country information.
+	Countries Countries `json:"countries"`
+	// Risk holds the rules used to score the traces.
+	Risk models.RiskPolicy `json:"risk"`
+	// Lists holds the allowlists and blocklists checked before calling the upstreams.
+	Lists Lists `json:"lists"`
+	// References holds the locations the distances are measured from.
+	References References `json:"references"`
+	// Stats holds the persistence of the recorded requests.
+	Stats Stats `json:"stats"`
+	// Log holds the format, level and destination of the log.
+	Log Log `json:"log"`
+	// Trace holds the limits of a trace.
+	Trace Trace `json:"trace"`
+	// Upstreams holds the retries and circuit breakers of the calls to the external APIs.
+	Upstreams Upstreams `json:"upstreams"`
+	// Currency holds the currency the rates of the traces are shown in and how long the rates
+	// are used.
+	Currency Currency `json:"currency"`
+}
+
+// Currency holds the settings of the exchange rates.
+type Currency struct {
+	// Target is the ISO 4217 code of the currency the currencies of the countries are converted to.
+	Target string `json:"target"`
+	// TTLSeconds is how long the rates are used before they are retrieved again.
+	TTLSeconds int `json:"ttl_seconds"`
+	// MaxStaleSeconds is how long after their expiry the rates are still used when the currency
+	// provider fails, 0 uses them until the provider answers again.
+	MaxStaleSeconds int `json:"max_stale_seconds"`
+	// RefreshSeconds is how often the rates about to expire are retrieved in the background,
+	// 0 disables the background refresh.
+	RefreshSeconds int `json:"refresh_seconds"`
+	// Providers are tried in order until one of them answers, 'fixer', 'ecb' or 'json'.
+	Providers []string `json:"providers"`
+	// ECBURL is the eurofxref XML feed used by the 'ecb' provider and ECBHistoryURL the one with
+	// the rates of several days its historical rates are retrieved from.
+	ECBURL        string `json:"ecb_url"`
+	ECBHistoryURL string `json:"ecb_history_url"`
+	// HistoryPath is the directory the historical rates are saved in, by day, so they are
+	// retrieved once. An empty path keeps them only in memory.
+	HistoryPath string `json:"history_path"`
+	// JSON holds the API used by the 'json' provider.
+	JSON JSONRates `json:"json"`
+}
+
+// JSONRates holds the settings of the generic JSON rates provider.
+type JSONRates struct {
+	// Name identifies the provider in the traces, the log and the metrics, 'json' when empty.
+	Name string `json:"name"`
+	// URL is the address the rates are retrieved from, including its key if it needs one.
+	URL string `json:"url"`
+	// HistoryURL is the address the historical rates are retrieved from, with a %s replaced by
+	// the day as YYYY-MM-DD. Without it the provider has no historical rates.
+	HistoryURL string `json:"history_url"`
+	// RatesField, BaseField and TimestampField are the keys of the response holding the rates,
+	// the base currency and the time of the rates, nested keys separated by dots.
+	RatesField     string `json:"rates_field"`
+	BaseField      string `json:"base_field"`
+	TimestampField string `json:"timestamp_field"`
+	// Base is the base currency when the response does not include it.
+	Base string `json:"base"`
+}
+
+// Upstreams holds the settings of the calls to the external APIs.
+type Upstreams struct {
+	// MaxAttempts is the number of calls made before giving up, 1 disables the retries.
+	MaxAttempts int `json:"max_attempts"`
+	// BaseDelayMs is the wait in milliseconds before the first retry, doubled on each of the
+	// next ones.
+	BaseDelayMs int `json:"base_delay_ms"`
+	// MaxDelayMs caps the wait in milliseconds between two calls, including the one asked by a
+	// Retry-After header.
+	MaxDelayMs int `json:"max_delay_ms"`
+	// TimeoutSeconds is how long each call can take.
+	TimeoutSeconds int `json:"timeout_seconds"`
+	// FailureThreshold is the number of consecutive failed calls that opens the circuit breaker
+	// of an upstream, 0 disables it.
+	FailureThreshold int `json:"failure_threshold"`
+	// OpenSeconds is how long an open circuit breaker rejects the calls.
+	OpenSeconds int `json:"open_seconds"`
+}
+
+// Trace holds the settings of the traces.
+type Trace struct {
+	// TimeoutSeconds is how long a trace can take, including the calls to the external APIs.
+	TimeoutSeconds int `json:"timeout_seconds"`
+}
+
+// Log holds the settings of the structured log.
+type Log struct {
+	// Format is 'text' for key=value lines or 'json' for one JSON object per line.
+	Format string `json:"format"`
+	// Level is the minimum level logged, 'debug', 'info', 'warn' or 'error'.
+	Level string `json:"level"`
+	// Output is 'stdout', 'stderr' or the path of the file the log is appended to.
+	Output string `json:"output"`
+}
+
+// References holds the settings of the reference locations.
+type References struct {
+	// Locations are the named points the distances are measured from.
+	Locations []models.ReferenceLocation `json:"locations"`
+	// Distances is 'all' to show the distance to each location in the traces or 'nearest'
+	// to show only the distance to the nearest one.
+	Distances string `json:"distances"`
+}
+
+// Stats holds the settings of the stats store.
+type Stats struct {
+	// Path is the file where the stats are persisted, empty keeps them only in memory.
+	Path string `json:"path"`
+	// CompactAfter is the number of lines appended to the file before it is rewritten with
+	// one line per country.
+	CompactAfter int `json:"compact_after"`
+	// HistogramBuckets are the upper limits, in kms, of the buckets of the distance histogram.
+	HistogramBuckets []float64 `json:"histogram_buckets"`
+	// BucketSeconds is the size of the time buckets the requests are counted in.
+	BucketSeconds int `json:"bucket_seconds"`
+	// RetentionHours is how long the time buckets are kept, the time ranges of the stats
+	// cannot start before.
+	RetentionHours int `json:"retention_hours"`
+	// Windows are the rolling windows shown with the stats, for example '1h'.
+	Windows []string `json:"windows"`
+}
+
+// Lists holds the settings of the allowlists and blocklists.
+type Lists struct {
+	// Files are the lists, the first one of each type that matches an IP is applied.
+	Files []models.ListDefinition `json:"files"`
+	// ReloadSeconds is how often the files are checked for changes, 0 disables the reload.
+	ReloadSeconds int `json:"reload_seconds"`
+}
+
+// Countries holds the settings of the country information providers.
+type Countries struct {
+	// Providers are tried in order until one of them answers, 'restcountries' or 'snapshot'.
+	Providers []string `json:"providers"`
+	// SnapshotPath is a snapshot used instead of the one embedded in the binary.
+	SnapshotPath string `json:"snapshot_path"`
+}
+
+// Geolocation holds the settings of the geolocation providers.
+type Geolocation struct {
+	// Providers are tried in order until one of them locates the IP, 'ipapi' or 'mmdb'.
+	Providers []string `json:"providers"`
+	// MMDBPath is the GeoLite2-City database used by the 'mmdb' provider.
+	MMDBPath string `json:"mmdb_path"`
+}
+
+// Default returns the configuration used when no configuration file is available.
+func Default() *Config {
+	return &Config{
+		Format: utils.FORMAT_TEXT,
+		Geolocation: Geolocation{
+			Providers: []string{utils.GEO_PROVIDER_IPAPI},
+		},
+		Countries: Countries{
+			Providers: []string{utils.COUNTRY_PROVIDER_RESTCOUNTRIES, utils.COUNTRY_PROVIDER_SNAPSHOT},
+		},
+		Risk: models.DefaultRiskPolicy(),
+		Lists: Lists{
+			ReloadSeconds: utils.LIST_DEFAULT_RELOAD_SECONDS,
+		},
+		References: References{
+			Locations: models.DefaultReferenceLocations(),
+			Distances: utils.REFERENCE_DISTANCES_ALL,
+		},
+		Stats: Stats{
+			Path:             utils.STATS_DEFAULT_PATH,
+			CompactAfter:     utils.STATS_DEFAULT_COMPACT_AFTER,
+			HistogramBuckets: models.DefaultHistogramBuckets(),
+			BucketSeconds:    utils.STATS_DEFAULT_BUCKET_SECONDS,
+			RetentionHours:   utils.STATS_DEFAULT_RETENTION_HOURS,
+			Windows:          models.DefaultStatsWindows(),
+		},
+		Log: Log{
+			Format: utils.LOG_FORMAT_TEXT,
+			Level:  utils.LOG_LEVEL_INFO,
+			Output: utils.LOG_DEFAULT_OUTPUT,
+		},
+		Trace: Trace{
+			TimeoutSeconds: utils.TRACE_DEFAULT_TIMEOUT_SECONDS,
+		},
+		Upstreams: Upstreams{
+			MaxAttempts:      utils.UPSTREAM_DEFAULT_MAX_ATTEMPTS,
+			BaseDelayMs:      utils.UPSTREAM_DEFAULT_BASE_DELAY_MS,
+			MaxDelayMs:       utils.UPSTREAM_DEFAULT_MAX_DELAY_MS,
+			TimeoutSeconds:   utils.UPSTREAM_DEFAULT_TIMEOUT_SECONDS,
+			FailureThreshold: utils.UPSTREAM_DEFAULT_FAILURE_THRESHOLD,
+			OpenSeconds:      utils.UPSTREAM_DEFAULT_OPEN_SECONDS,
+		},
+		Currency: Currency{
+			Target:          utils.CURRENCY_DEFAULT_TARGET,
+			TTLSeconds:      utils.RATES_DEFAULT_TTL_SECONDS,
+			MaxStaleSeconds: utils.RATES_DEFAULT_MAX_STALE_SECONDS,
+			RefreshSeconds:  utils.RATES_DEFAULT_REFRESH_SECONDS,
+			Providers:       []string{utils.RATES_PROVIDER_FIXER},
+			ECBURL:          utils.API_ECB_URL,
+			ECBHistoryURL:   utils.API_ECB_HISTORY_URL,
+			HistoryPath:     utils.RATES_HISTORY_DEFAULT_PATH,
+		},
+	}
+}
+
+// Load reads the configuration from the file given by the SERVICE_FRAUD_CONFIG
+// environment variable or, when it is not set, from the default configuration file.
+// A missing file results in the default configuration.
+func Load() (*Config, error) {
+	path := os.Getenv(utils.CONFIG_PATH_ENV)
+	if path == "" {
+		path = utils.CONFIG_DEFAULT_PATH
+	}
+	cfg, err := LoadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Default(), nil
+	}
+	return cfg, err
+}
+
+// LoadFile reads the configuration from the given JSON file. The values that are not
+// present in the file keep their defaults.
+func LoadFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
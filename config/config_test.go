@@ -0,0 +1,104 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"service_fraud/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"format": "json"}`), 0644))
+
+	cfg, err := LoadFile(path)
+
+	require.NoError(t, err)
+	assert.Equal(t, utils.FORMAT_JSON, cfg.Format)
+}
+
+func TestLoadFile_Geolocation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"geolocation": {"providers": ["mmdb"], "mmdb_path": "GeoLite2-City.mmdb"}}`), 0644))
+
+	cfg, err := LoadFile(path)
+
+	require.NoError(t, err)
+	assert.Equal(t, utils.FORMAT_TEXT, cfg.Format)
+	assert.Equal(t, []string{utils.GEO_PROVIDER_MMDB}, cfg.Geolocation.Providers)
+	assert.Equal(t, "GeoLite2-City.mmdb", cfg.Geolocation.MMDBPath)
+}
+
+func TestLoadFile_Log(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"log": {"format": "json", "output": "stderr"}}`), 0644))
+
+	cfg, err := LoadFile(path)
+
+	require.NoError(t, err)
+	assert.Equal(t, Log{Format: utils.LOG_FORMAT_JSON, Level: utils.LOG_LEVEL_INFO, Output: utils.LOG_OUTPUT_STDERR}, cfg.Log)
+}
+
+func TestLoadFile_Upstreams(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"upstreams": {"max_attempts": 1, "failure_threshold": 0}}`), 0644))
+
+	cfg, err := LoadFile(path)
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, cfg.Upstreams.MaxAttempts)
+	assert.Zero(t, cfg.Upstreams.FailureThreshold)
+	assert.Equal(t, utils.UPSTREAM_DEFAULT_OPEN_SECONDS, cfg.Upstreams.OpenSeconds)
+}
+
+func TestLoadFile_Currency(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"currency": {"target": "ARS", "refresh_seconds": 0}}`), 0644))
+
+	cfg, err := LoadFile(path)
+
+	require.NoError(t, err)
+	assert.Equal(t, "ARS", cfg.Currency.Target)
+	assert.Zero(t, cfg.Currency.RefreshSeconds)
+	assert.Equal(t, utils.RATES_DEFAULT_TTL_SECONDS, cfg.Currency.TTLSeconds)
+	assert.Equal(t, utils.CURRENCY_DEFAULT_TARGET, Default().Currency.Target)
+}
+
+func TestLoadFile_CurrencyProviders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"currency": {"providers": ["json", "ecb"],
+		"json": {"name": "openrates", "url": "http://localhost/latest", "rates_field": "data.rates"}}}`), 0644))
+
+	cfg, err := LoadFile(path)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{utils.RATES_PROVIDER_JSON, utils.RATES_PROVIDER_ECB}, cfg.Currency.Providers)
+	assert.Equal(t, "openrates", cfg.Currency.JSON.Name)
+	assert.Equal(t, "data.rates", cfg.Currency.JSON.RatesField)
+	assert.Equal(t, utils.API_ECB_URL, cfg.Currency.ECBURL)
+	assert.Equal(t, utils.API_ECB_HISTORY_URL, cfg.Currency.ECBHistoryURL)
+	assert.Equal(t, utils.RATES_HISTORY_DEFAULT_PATH, cfg.Currency.HistoryPath)
+	assert.Equal(t, []string{utils.RATES_PROVIDER_FIXER}, Default().Currency.Providers)
+}
+
+func TestLoadFile_InvalidJson(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"format":`), 0644))
+
+	_, err := LoadFile(path)
+
+	assert.Error(t, err)
+}
+
+func TestLoad_MissingFile(t *testing.T) {
+	t.Setenv(utils.CONFIG_PATH_ENV, filepath.Join(t.TempDir(), "missing.json"))
+
+	cfg, err := Load()
+
+	require.NoError(t, err)
+	assert.Equal(t, Default(), cfg)
+}
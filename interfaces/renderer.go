@@ -0,0 +1,14 @@
+package interfaces
+
+import (
+	"io"
+	"service_fraud/models"
+)
+
+// Renderer defines how the results of the application flows are presented to the user.
+type Renderer interface {
+	// RenderTrace writes the result of the 'traceip' flow to the given writer.
+	RenderTrace(w io.Writer, result models.TraceResult) error
+	// RenderStats writes the result of the 'record' flow to the given writer.
+	RenderStats(w io.Writer, summary models.StatsSummary) error
+}
@@ -1,7 +1,9 @@
-package interfaces
-
-// GetSecret retrieves the secret associated with the given name.
-// Returns the secret as a string pointer and any error encountered.
-type SecretsVault interface {
-	GetSecret(name string) (*string, error)
-}
+package interfaces
+
+import "context"
+
+// GetSecret retrieves the secret associated with the given name.
+// Returns the secret as a string pointer and any error encountered.
+type SecretsVault interface {
+	GetSecret(ctx context.Context, name string) (*string, error)
+}
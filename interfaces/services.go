@@ -1,35 +1,66 @@
-package interfaces
-
-import "service_fraud/models"
-
-type IpInformation interface {
-	// Geolocation returns the geolocation data as an IpApiResponse for the specified IP.
-	Geolocation(ip string) models.IpApiResponse
-}
-
-type CountryInformation interface {
-	// GetCountryInformation returns the country information for the given country name.
-	GetCountryInformation(country string) models.CountryResponse
-}
-
-type CurrencyInformation interface {
-	// GetCurrencyInformation returns the currency information as a CurrencyResponse.
-	GetCurrencyInformation() models.CurrencyResponse
-}
-
-type StatsInformation interface {
-	// GetStats retrieves statistical data as a string.
-	GetStats() string
-	// Combine processes a StatsRequest and combines it with existing data.
-	Combine(req models.StatsRequest)
-}
-
-type GetInformation interface {
-	IpInformation
-	CountryInformation
-	CurrencyInformation
-	// GetAllProducts retrieves all relevant products for a given IP address.
-	GetAllProducts(ip string) error
-	// GetStatsService returns an instance of StatsInformation for statistics handling.
-	GetStatsService() StatsInformation
-}
+package interfaces
+
+import (
+	"context"
+	"service_fraud/models"
+	"time"
+)
+
+type IpInformation interface {
+	// Geolocation returns the geolocation data as an IpApiResponse for the specified IP.
+	Geolocation(ctx context.Context, ip string) models.IpApiResponse
+}
+
+type CountryInformation interface {
+	// GetCountryInformation returns the country information for the given country name.
+	GetCountryInformation(ctx context.Context, country string) models.CountryResponse
+}
+
+type CurrencyInformation interface {
+	// GetCurrencyInformation returns the currency information as a CurrencyResponse.
+	GetCurrencyInformation(ctx context.Context) models.CurrencyResponse
+}
+
+type HistoricalCurrencyInformation interface {
+	// GetHistoricalCurrencyInformation returns the currency information published on the given day.
+	GetHistoricalCurrencyInformation(ctx context.Context, date time.Time) models.CurrencyResponse
+}
+
+type StatsInformation interface {
+	// GetStats retrieves the summary of the statistical data.
+	GetStats() models.StatsSummary
+	// Combine processes a StatsRequest and combines it with existing data.
+	Combine(req models.StatsRequest)
+	// GetStatsWindow retrieves the summary of the requests processed in the time range.
+	GetStatsWindow(from, to time.Time) (models.StatsSummary, error)
+}
+
+type RiskEvaluator interface {
+	// Evaluate scores the trace and decides whether the operation is allowed, reviewed or denied.
+	Evaluate(result models.TraceResult) models.RiskAssessment
+}
+
+type ListMatcher interface {
+	// MatchIp returns the IP range list that contains the IP, if any.
+	MatchIp(ip string) (models.ListMatch, bool)
+	// MatchCountry returns the country list that contains the ISO country code, if any.
+	MatchCountry(countryCode string) (models.ListMatch, bool)
+}
+
+type GetInformation interface {
+	IpInformation
+	CountryInformation
+	CurrencyInformation
+	// GetAllProducts retrieves all relevant products for a given IP address. The trace stops
+	// when the context is canceled or its deadline is exceeded.
+	GetAllProducts(ctx context.Context, ip string) (models.TraceResult, error)
+	// GetStatsService returns an instance of StatsInformation for statistics handling.
+	GetStatsService() StatsInformation
+	// GetHealth returns the state of the circuit breakers of the external APIs.
+	GetHealth() models.HealthReport
+	// GetRates returns the snapshot of the exchange rates used by the traces.
+	GetRates(ctx context.Context) (models.RatesSnapshot, error)
+	// Convert converts the amount to the target currency, the one of the traces when it is empty,
+	// with the rates used by the traces.
+	Convert(ctx context.Context, money models.Money, target string) (models.Conversion, error)
+}
@@ -1,15 +1,29 @@
-package interfaces
-
-// DataStore defines a generic interface for storing and retrieving key-value pairs.
-// The key type K must be comparable, and the value type V can be any type.
-type DataStore[K comparable, V any] interface {
-	// Set stores the value associated with the given key.
-	// Returns an error if the operation fails.
-	Set(key K, value V) error
-	// Get retrieves the value associated with the given key.
-	// Returns the value and an error if the key is not found or another error occurs.
-	Get(key K) (V, error)
-	// Expire removes the value associated with the given key.
-	// Returns an error if the operation fails.
-	Expire(key K) error
-}
+package interfaces
+
+import "service_fraud/models"
+
+// DataStore defines a generic interface for storing and retrieving key-value pairs.
+// The key type K must be comparable, and the value type V can be any type.
+type DataStore[K comparable, V any] interface {
+	// Set stores the value associated with the given key.
+	// Returns an error if the operation fails.
+	Set(key K, value V) error
+	// Get retrieves the value associated with the given key.
+	// Returns the value and an error if the key is not found or another error occurs.
+	Get(key K) (V, error)
+	// Expire removes the value associated with the given key.
+	// Returns an error if the operation fails.
+	Expire(key K) error
+}
+
+// StatsStore defines the persistence of the stats records, so they survive the restarts.
+type StatsStore interface {
+	// Load returns the stats records persisted before.
+	// Returns an error if the records cannot be read.
+	Load() ([]models.Stats, error)
+	// Append adds the invokes of the stats to the persisted record of its country.
+	// Returns an error if the operation fails.
+	Append(stats models.Stats) error
+	// Close releases the resources held by the store.
+	Close() error
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// BatchSummary represents the outcome of tracing a list of IPs in a batch.
+type BatchSummary struct {
+	Total          int           `json:"total" yaml:"total"`
+	Succeeded      int           `json:"succeeded" yaml:"succeeded"`
+	Failed         int           `json:"failed" yaml:"failed"`
+	FailuresByCode map[int]int   `json:"failures_by_code" yaml:"failures_by_code"`
+	Elapsed        time.Duration `json:"elapsed" yaml:"elapsed"`
+}
+
+// Add records the outcome of a traced IP in the summary.
+func (b *BatchSummary) Add(err error) {
+	b.Total++
+	if err == nil {
+		b.Succeeded++
+		return
+	}
+	b.Failed++
+	if b.FailuresByCode == nil {
+		b.FailuresByCode = make(map[int]int)
+	}
+	code, _ := ErrorDetails(err)
+	b.FailuresByCode[code]++
+}
@@ -1,17 +1,35 @@
-package models
-
-// CurrencyResponse represents the response from a currency exchange API,
-// including exchange rates, base currency, and any errors encountered.
-type CurrencyResponse struct {
-	Success   bool               `json:"success"`
-	Timestamp int64              `json:"timestamp"`
-	Base      string             `json:"base"`
-	Date      string             `json:"date"`
-	Rates     map[string]float64 `json:"rates"`
-	Error     CurrencyApiError
-}
-
-// HasError checks if the CurrencyResponse contains any error.
-func (i *CurrencyResponse) HasError() bool {
-	return i.Error.Code != 0 || i.Error.Message != ""
-}
+package models
+
+import "fmt"
+
+// CurrencyResponse represents the response from a currency exchange API,
+// including exchange rates, base currency, and any errors encountered.
+type CurrencyResponse struct {
+	Success   bool               `json:"success"`
+	Timestamp int64              `json:"timestamp"`
+	Base      string             `json:"base"`
+	Date      string             `json:"date"`
+	Rates     map[string]float64 `json:"rates"`
+	// Source is the name of the provider of the rates, set by the services.
+	Source string `json:"-"`
+	// Error is set by the services, the error envelope of the provider is decoded apart.
+	Error CurrencyApiError `json:"-"`
+}
+
+// HasError checks if the CurrencyResponse contains any error.
+func (i *CurrencyResponse) HasError() bool {
+	return i.Error.Code != 0 || i.Error.Message != ""
+}
+
+// ValidateCurrencyCode checks that the code is an ISO 4217 code, three uppercase letters.
+func ValidateCurrencyCode(code string) error {
+	if len(code) != 3 {
+		return fmt.Errorf("the currency code %q must have three letters", code)
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return fmt.Errorf("the currency code %q must have only uppercase letters", code)
+		}
+	}
+	return nil
+}
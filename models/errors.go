@@ -1,79 +1,176 @@
-package models
-
-import "fmt"
-
-// OptionInvalidError represents an error related to invalid options.
-type OptionInvalidError struct {
-	Code    int
-	Message string
-}
-
-// Error returns a formatted error string for OptionInvalidError.
-func (e *OptionInvalidError) Error() string {
-	return fmt.Sprintf("Code %d: %s", e.Code, e.Message)
-}
-
-// NewOptionInvalidError creates a new OptionInvalidError with the given code and message.
-func NewOptionInvalidError(code int, msg string) *OptionInvalidError {
-	return &OptionInvalidError{
-		Code:    code,
-		Message: msg,
-	}
-}
-
-// IpApiError represents an error from the IP API.
-type IpApiError struct {
-	Code    int
-	Message string
-}
-
-// Error returns a formatted error string for IpApiError.
-func (e *IpApiError) Error() string {
-	return fmt.Sprintf("		Code %d: %s", e.Code, e.Message)
-}
-
-// NewErrorIpApiError creates a new IpApiError with the given code and message.
-func NewErrorIpApiError(code int, msg string) *IpApiError {
-	return &IpApiError{
-		Code:    code,
-		Message: msg,
-	}
-}
-
-// CountryApiError represents an error from the Country API.
-type CountryApiError struct {
-	Code    int
-	Message string
-}
-
-// Error returns a formatted error string for CountryApiError.
-func (e *CountryApiError) Error() string {
-	return fmt.Sprintf("		Code %d: %s", e.Code, e.Message)
-}
-
-// NewCountryApiError creates a new CountryApiError with the given code and message.
-func NewCountryApiError(code int, msg string) *CountryApiError {
-	return &CountryApiError{
-		Code:    code,
-		Message: msg,
-	}
-}
-
-// CurrencyApiError represents an error from the Currency API.
-type CurrencyApiError struct {
-	Code    int
-	Message string
-}
-
-// Error returns a formatted error string for CurrencyApiError.
-func (e *CurrencyApiError) Error() string {
-	return fmt.Sprintf("		Code %d: %s", e.Code, e.Message)
-}
-
-// NewCurrencyApiError creates a new CurrencyApiError with the given code and message.
-func NewCurrencyApiError(code int, msg string) *CurrencyApiError {
-	return &CurrencyApiError{
-		Code:    code,
-		Message: msg,
-	}
-}
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+// OptionInvalidError represents an error related to invalid options.
+type OptionInvalidError struct {
+	Code    int
+	Message string
+}
+
+// Error returns a formatted error string for OptionInvalidError.
+func (e *OptionInvalidError) Error() string {
+	return fmt.Sprintf("Code %d: %s", e.Code, e.Message)
+}
+
+// NewOptionInvalidError creates a new OptionInvalidError with the given code and message.
+func NewOptionInvalidError(code int, msg string) *OptionInvalidError {
+	return &OptionInvalidError{
+		Code:    code,
+		Message: msg,
+	}
+}
+
+// IpApiError represents an error from the IP API. Err holds the ProviderApiError when the
+// request was rejected by the provider.
+type IpApiError struct {
+	Code    int
+	Message string
+	Err     error
+}
+
+// Error returns a formatted error string for IpApiError.
+func (e *IpApiError) Error() string {
+	return fmt.Sprintf("		Code %d: %s", e.Code, e.Message)
+}
+
+// Unwrap returns the error reported by the provider, if any.
+func (e *IpApiError) Unwrap() error {
+	return e.Err
+}
+
+// NewErrorIpApiError creates a new IpApiError with the given code and message.
+func NewErrorIpApiError(code int, msg string) *IpApiError {
+	return &IpApiError{
+		Code:    code,
+		Message: msg,
+	}
+}
+
+// CountryApiError represents an error from the Country API.
+type CountryApiError struct {
+	Code    int
+	Message string
+}
+
+// Error returns a formatted error string for CountryApiError.
+func (e *CountryApiError) Error() string {
+	return fmt.Sprintf("		Code %d: %s", e.Code, e.Message)
+}
+
+// NewCountryApiError creates a new CountryApiError with the given code and message.
+func NewCountryApiError(code int, msg string) *CountryApiError {
+	return &CountryApiError{
+		Code:    code,
+		Message: msg,
+	}
+}
+
+// CurrencyApiError represents an error from the Currency API. Err holds the ProviderApiError
+// when the request was rejected by the provider.
+type CurrencyApiError struct {
+	Code    int
+	Message string
+	Err     error
+}
+
+// Error returns a formatted error string for CurrencyApiError.
+func (e *CurrencyApiError) Error() string {
+	return fmt.Sprintf("		Code %d: %s", e.Code, e.Message)
+}
+
+// Unwrap returns the error reported by the provider, if any.
+func (e *CurrencyApiError) Unwrap() error {
+	return e.Err
+}
+
+// NewCurrencyApiError creates a new CurrencyApiError with the given code and message.
+func NewCurrencyApiError(code int, msg string) *CurrencyApiError {
+	return &CurrencyApiError{
+		Code:    code,
+		Message: msg,
+	}
+}
+
+// NonRoutableIpError represents an IP that belongs to a private, reserved or
+// special-purpose range and therefore can not be geolocated.
+type NonRoutableIpError struct {
+	Code     int
+	Message  string
+	Category string
+}
+
+// Error returns a formatted error string for NonRoutableIpError.
+func (e *NonRoutableIpError) Error() string {
+	return fmt.Sprintf("		Code %d: %s", e.Code, e.Message)
+}
+
+// NewNonRoutableIpError creates a new NonRoutableIpError with the given code, message and range category.
+func NewNonRoutableIpError(code int, msg string, category string) *NonRoutableIpError {
+	return &NonRoutableIpError{
+		Code:     code,
+		Message:  msg,
+		Category: category,
+	}
+}
+
+// TraceCanceledError represents a trace that was stopped because its context was canceled or
+// its deadline was exceeded. It unwraps to the error of the context.
+type TraceCanceledError struct {
+	Code    int
+	Message string
+	Err     error
+}
+
+// Error returns a formatted error string for TraceCanceledError.
+func (e *TraceCanceledError) Error() string {
+	return fmt.Sprintf("Code %d: %s", e.Code, e.Message)
+}
+
+// Unwrap returns the error of the context that stopped the trace.
+func (e *TraceCanceledError) Unwrap() error {
+	return e.Err
+}
+
+// NewTraceCanceledError creates a new TraceCanceledError with the given code, message and context error.
+func NewTraceCanceledError(code int, msg string, err error) *TraceCanceledError {
+	return &TraceCanceledError{
+		Code:    code,
+		Message: msg,
+		Err:     err,
+	}
+}
+
+// ErrorDetails extracts the application code and message from the known error types.
+// Unknown errors result in code 0 and their own message.
+func ErrorDetails(err error) (int, string) {
+	optionError := &OptionInvalidError{}
+	apiError := &IpApiError{}
+	countryError := &CountryApiError{}
+	currencyError := &CurrencyApiError{}
+	nonRoutableError := &NonRoutableIpError{}
+	canceledError := &TraceCanceledError{}
+	providerError := &ProviderApiError{}
+
+	switch {
+	case errors.As(err, &optionError):
+		return optionError.Code, optionError.Message
+	case errors.As(err, &providerError):
+		return providerError.Code, providerError.Message
+	case errors.As(err, &nonRoutableError):
+		return nonRoutableError.Code, nonRoutableError.Message
+	case errors.As(err, &apiError):
+		return apiError.Code, apiError.Message
+	case errors.As(err, &countryError):
+		return countryError.Code, countryError.Message
+	case errors.As(err, &currencyError):
+		return currencyError.Code, currencyError.Message
+	case errors.As(err, &canceledError):
+		return canceledError.Code, canceledError.Message
+	default:
+		return 0, err.Error()
+	}
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorDetails(t *testing.T) {
+	tests := []struct {
+		err     error
+		code    int
+		message string
+	}{
+		{NewOptionInvalidError(102, "invalid ip"), 102, "invalid ip"},
+		{NewErrorIpApiError(103, "ip service"), 103, "ip service"},
+		{NewCountryApiError(104, "country service"), 104, "country service"},
+		{NewCurrencyApiError(105, "currency service"), 105, "currency service"},
+		{NewNonRoutableIpError(110, "non routable", "private"), 110, "non routable"},
+		{NewTraceCanceledError(113, "canceled", context.Canceled), 113, "canceled"},
+		{fmt.Errorf("wrapped: %w", NewErrorIpApiError(107, "empty")), 107, "empty"},
+		{&CurrencyApiError{Code: 108, Message: "limit", Err: &ProviderApiError{Code: 108, Message: "limit", Provider: "fixer"}}, 108, "limit"},
+		{errors.New("unknown"), 0, "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			code, message := ErrorDetails(tt.err)
+			assert.Equal(t, tt.code, code)
+			assert.Equal(t, tt.message, message)
+		})
+	}
+}
+
+func TestTraceCanceledError_Unwrap(t *testing.T) {
+	err := fmt.Errorf("trace: %w", NewTraceCanceledError(112, "timeout", context.DeadlineExceeded))
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.NotErrorIs(t, err, context.Canceled)
+}
+
+func TestBatchSummary_Add(t *testing.T) {
+	summary := BatchSummary{}
+
+	summary.Add(nil)
+	summary.Add(NewOptionInvalidError(102, "invalid ip"))
+	summary.Add(NewOptionInvalidError(102, "invalid ip"))
+	summary.Add(NewNonRoutableIpError(110, "non routable", "private"))
+
+	assert.Equal(t, 4, summary.Total)
+	assert.Equal(t, 1, summary.Succeeded)
+	assert.Equal(t, 3, summary.Failed)
+	assert.Equal(t, map[int]int{102: 2, 110: 1}, summary.FailuresByCode)
+}
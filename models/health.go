@@ -0,0 +1,38 @@
+package models
+
+import (
+	"service_fraud/utils"
+	"time"
+)
+
+// UpstreamHealth holds the state of the circuit breaker of an external API.
+type UpstreamHealth struct {
+	Name                string     `json:"name" yaml:"name"`
+	State               string     `json:"state" yaml:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures" yaml:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty" yaml:"opened_at,omitempty"`
+	RetryAt             *time.Time `json:"retry_at,omitempty" yaml:"retry_at,omitempty"`
+}
+
+// HealthReport holds the state of the external APIs, 'ok' when all their circuit breakers are
+// closed and 'degraded' otherwise.
+type HealthReport struct {
+	Status    string           `json:"status" yaml:"status"`
+	Upstreams []UpstreamHealth `json:"upstreams" yaml:"upstreams"`
+}
+
+// NewHealthReport builds the report of the given upstreams.
+func NewHealthReport(upstreams ...UpstreamHealth) HealthReport {
+	report := HealthReport{Status: utils.HEALTH_STATUS_OK, Upstreams: upstreams}
+	for _, upstream := range upstreams {
+		if upstream.State != utils.CIRCUIT_STATE_CLOSED {
+			report.Status = utils.HEALTH_STATUS_DEGRADED
+		}
+	}
+	return report
+}
+
+// Healthy reports whether every circuit breaker is closed.
+func (h HealthReport) Healthy() bool {
+	return h.Status == utils.HEALTH_STATUS_OK
+}
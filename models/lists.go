@@ -0,0 +1,21 @@
+package models
+
+// ListDefinition describes an allowlist or blocklist loaded from a file with one entry per line.
+type ListDefinition struct {
+	// Name identifies the list in the trace result.
+	Name string `json:"name"`
+	// Type is the kind of entries of the file, 'cidr' for IP ranges or 'country' for ISO codes.
+	Type string `json:"type"`
+	// Action is applied to the matching IPs, 'allow' or 'block'.
+	Action string `json:"action"`
+	// Path is the file holding the entries.
+	Path string `json:"path"`
+}
+
+// ListMatch identifies the list that matched an IP and the entry that caused it.
+type ListMatch struct {
+	Name   string `json:"name" yaml:"name"`
+	Type   string `json:"type" yaml:"type"`
+	Action string `json:"action" yaml:"action"`
+	Entry  string `json:"entry" yaml:"entry"`
+}
@@ -0,0 +1,179 @@
+package models
+
+import (
+	"fmt"
+	"math/big"
+	"service_fraud/utils"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount of a currency kept as an exact decimal, so the conversions do not carry
+// the rounding errors of float64.
+type Money struct {
+	Amount   *big.Rat
+	Currency string
+}
+
+// currencyDecimals holds the ISO 4217 minor units of the currencies that do not use 2 decimals.
+var currencyDecimals = map[string]int{
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0,
+	"PYG": 0, "RWF": 0, "UGX": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+}
+
+// CurrencyDecimals returns the number of decimals the amounts of the currency are shown with.
+func CurrencyDecimals(code string) int {
+	if decimals, ok := currencyDecimals[code]; ok {
+		return decimals
+	}
+	return utils.CURRENCY_DEFAULT_DECIMALS
+}
+
+// ParseMoney parses an amount given as a positive decimal number with a dot as separator, for
+// example 1500.50, of the currency given by its ISO 4217 code, ignoring the case.
+func ParseMoney(amount, currency string) (Money, error) {
+	currency = strings.ToUpper(currency)
+	if err := ValidateCurrencyCode(currency); err != nil {
+		return Money{}, err
+	}
+	if amount == "" || len(amount) > utils.CURRENCY_AMOUNT_MAX_LEN {
+		return Money{}, fmt.Errorf("the amount %q must have between 1 and %d characters", amount, utils.CURRENCY_AMOUNT_MAX_LEN)
+	}
+	whole, fraction, found := strings.Cut(amount, ".")
+	if !isDigits(whole) || (found && !isDigits(fraction)) {
+		return Money{}, fmt.Errorf("the amount %q must be a decimal number like 1500.50", amount)
+	}
+	value, ok := new(big.Rat).SetString(amount)
+	if !ok || value.Sign() <= 0 {
+		return Money{}, fmt.Errorf("the amount %q must be greater than 0", amount)
+	}
+	return Money{Amount: value, Currency: currency}, nil
+}
+
+// isDigits reports whether the value is a non empty sequence of decimal digits.
+func isDigits(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Convert returns the amount in the target currency, using the rates of both currencies in terms
+// of the base currency of the response. The rates are taken as the decimals the provider
+// published, so the only rounding is the one of Text.
+func (m Money) Convert(target string, rates CurrencyResponse) (Money, error) {
+	fromRate, err := exactRate(m.Currency, rates)
+	if err != nil {
+		return Money{}, err
+	}
+	toRate, err := exactRate(target, rates)
+	if err != nil {
+		return Money{}, err
+	}
+	amount := new(big.Rat).Mul(m.Amount, toRate)
+	return Money{Amount: amount.Quo(amount, fromRate), Currency: target}, nil
+}
+
+// Text returns the amount rounded to the decimals of its currency, halves away from zero.
+func (m Money) Text() string {
+	if m.Amount == nil {
+		return ""
+	}
+	return m.Amount.FloatString(CurrencyDecimals(m.Currency))
+}
+
+// String returns the amount followed by the code of its currency.
+func (m Money) String() string {
+	return m.Text() + " " + m.Currency
+}
+
+// exactRate returns the rate of the currency in terms of the base currency of the response as an
+// exact decimal. The responses hold the rates as float64, so the shortest decimal that represents
+// the float64 is used, which is the one the provider published.
+func exactRate(code string, rates CurrencyResponse) (*big.Rat, error) {
+	rate := baseRate(code, rates)
+	if rate <= 0 {
+		return nil, fmt.Errorf("the rates do not include %s", code)
+	}
+	value, ok := new(big.Rat).SetString(strconv.FormatFloat(rate, 'g', -1, 64))
+	if !ok {
+		return nil, fmt.Errorf("the rate of %s is not a number", code)
+	}
+	return value, nil
+}
+
+// Transaction is the amount of the operation evaluated along with the IP, converted with the
+// rates of the trace to its target currency and to USD, the currency of the amount risk rules.
+type Transaction struct {
+	Amount    string `json:"amount" yaml:"amount"`
+	Currency  string `json:"currency" yaml:"currency"`
+	Converted string `json:"converted" yaml:"converted"`
+	Target    string `json:"target" yaml:"target"`
+	AmountUSD string `json:"amount_usd" yaml:"amount_usd"`
+	// usd is the exact amount in USD, AmountUSD is rounded to cents.
+	usd *big.Rat
+}
+
+// NewTransaction converts the amount of the operation to the target currency and to USD.
+func NewTransaction(money Money, target string, rates CurrencyResponse) (*Transaction, error) {
+	converted, err := money.Convert(target, rates)
+	if err != nil {
+		return nil, err
+	}
+	usd, err := money.Convert(utils.CURRENCY_USD, rates)
+	if err != nil {
+		return nil, err
+	}
+	return &Transaction{
+		Amount:    money.Text(),
+		Currency:  money.Currency,
+		Converted: converted.Text(),
+		Target:    target,
+		AmountUSD: usd.Text(),
+		usd:       usd.Amount,
+	}, nil
+}
+
+// USD returns the exact amount in USD, the rounded one when the transaction was decoded.
+func (t Transaction) USD() *big.Rat {
+	if t.usd != nil {
+		return t.usd
+	}
+	usd, _ := new(big.Rat).SetString(t.AmountUSD)
+	return usd
+}
+
+// Conversion is an amount converted to another currency with the rates of a snapshot, the
+// result of the 'convert' command.
+type Conversion struct {
+	Amount    string `json:"amount" yaml:"amount"`
+	Currency  string `json:"currency" yaml:"currency"`
+	Converted string `json:"converted" yaml:"converted"`
+	Target    string `json:"target" yaml:"target"`
+	// Rate is the value of one unit of Currency in Target, with CURRENCY_RATE_DECIMALS decimals.
+	Rate  string     `json:"rate" yaml:"rate"`
+	Rates *RatesInfo `json:"rates,omitempty" yaml:"rates,omitempty"`
+}
+
+// NewConversion converts the amount to the target currency with the rates of the snapshot.
+func NewConversion(money Money, target string, snapshot RatesSnapshot) (Conversion, error) {
+	converted, err := money.Convert(target, snapshot.Response())
+	if err != nil {
+		return Conversion{}, err
+	}
+	unit, _ := Money{Amount: big.NewRat(1, 1), Currency: money.Currency}.Convert(target, snapshot.Response())
+	return Conversion{
+		Amount:    money.Text(),
+		Currency:  money.Currency,
+		Converted: converted.Text(),
+		Target:    target,
+		Rate:      unit.Amount.FloatString(utils.CURRENCY_RATE_DECIMALS),
+		Rates:     snapshot.Info(),
+	}, nil
+}
@@ -0,0 +1,128 @@
+package models
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var moneyRates = CurrencyResponse{Base: "EUR", Rates: map[string]float64{"USD": 1.1, "ARS": 1050, "JPY": 165.61, "KWD": 0.3297}}
+
+func TestParseMoney(t *testing.T) {
+	money, err := ParseMoney("1500.50", "ars")
+
+	require.NoError(t, err)
+	assert.Equal(t, "ARS", money.Currency)
+	assert.Equal(t, 0, money.Amount.Cmp(big.NewRat(300100, 200)))
+	assert.Equal(t, "1500.50 ARS", money.String())
+
+	for _, tt := range [][2]string{
+		{"", "USD"}, {"0", "USD"}, {"0.00", "USD"}, {"-10", "USD"}, {"1,500.50", "USD"}, {"1e3", "USD"},
+		{".5", "USD"}, {"5.", "USD"}, {"1/3", "USD"}, {"10", "US"}, {"10", "U5D"}, {"1234567890123456789012345678901", "USD"},
+	} {
+		_, err := ParseMoney(tt[0], tt[1])
+		assert.Error(t, err, tt)
+	}
+}
+
+func TestMoney_Convert(t *testing.T) {
+	tests := []struct {
+		amount   string
+		currency string
+		target   string
+		expected string
+	}{
+		{"1500.50", "ARS", "USD", "1.57"},
+		{"1050", "ARS", "USD", "1.10"},
+		{"100", "EUR", "JPY", "16561"},
+		{"100", "USD", "KWD", "29.973"},
+		{"0.01", "USD", "ARS", "9.55"},
+		{"100", "ARS", "ARS", "100.00"},
+	}
+
+	for _, tt := range tests {
+		money, err := ParseMoney(tt.amount, tt.currency)
+		require.NoError(t, err)
+
+		converted, err := money.Convert(tt.target, moneyRates)
+
+		require.NoError(t, err)
+		assert.Equal(t, tt.target, converted.Currency)
+		assert.Equal(t, tt.expected, converted.Text(), tt)
+	}
+}
+
+func TestMoney_Convert_Exact(t *testing.T) {
+	// With float64 1050 * 1.1 / 1050 is 1.1000000000000003.
+	money, err := ParseMoney("1050", "ARS")
+	require.NoError(t, err)
+
+	converted, err := money.Convert("USD", moneyRates)
+
+	require.NoError(t, err)
+	assert.Equal(t, 0, converted.Amount.Cmp(big.NewRat(11, 10)))
+
+	// A round trip gives back the same amount.
+	back, err := converted.Convert("ARS", moneyRates)
+	require.NoError(t, err)
+	assert.Equal(t, 0, back.Amount.Cmp(money.Amount))
+}
+
+func TestMoney_Convert_UnknownCurrency(t *testing.T) {
+	money, err := ParseMoney("10", "BRL")
+	require.NoError(t, err)
+
+	_, err = money.Convert("USD", moneyRates)
+	assert.Error(t, err)
+
+	money.Currency = "USD"
+	_, err = money.Convert("BRL", moneyRates)
+	assert.Error(t, err)
+}
+
+func TestNewTransaction(t *testing.T) {
+	money, err := ParseMoney("1500.50", "ARS")
+	require.NoError(t, err)
+
+	transaction, err := NewTransaction(money, "EUR", moneyRates)
+
+	require.NoError(t, err)
+	assert.Equal(t, "1500.50", transaction.Amount)
+	assert.Equal(t, "ARS", transaction.Currency)
+	assert.Equal(t, "1.43", transaction.Converted)
+	assert.Equal(t, "EUR", transaction.Target)
+	assert.Equal(t, "1.57", transaction.AmountUSD)
+	assert.Equal(t, 0, transaction.USD().Cmp(big.NewRat(165055, 105000)))
+
+	decoded := Transaction{AmountUSD: transaction.AmountUSD}
+	assert.Equal(t, 0, decoded.USD().Cmp(big.NewRat(157, 100)))
+
+	_, err = NewTransaction(money, "BRL", moneyRates)
+	assert.Error(t, err)
+}
+
+func TestNewConversion(t *testing.T) {
+	money, err := ParseMoney("1500.50", "ARS")
+	require.NoError(t, err)
+	snapshot := RatesSnapshot{Source: "ecb", Base: moneyRates.Base, Rates: moneyRates.Rates, Timestamp: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)}
+
+	conversion, err := NewConversion(money, "USD", snapshot)
+
+	require.NoError(t, err)
+	assert.Equal(t, "1.57", conversion.Converted)
+	assert.Equal(t, "0.001048", conversion.Rate)
+	require.NotNil(t, conversion.Rates)
+	assert.Equal(t, "ecb", conversion.Rates.Source)
+
+	_, err = NewConversion(money, "BRL", snapshot)
+	assert.Error(t, err)
+}
+
+func TestCurrencyDecimals(t *testing.T) {
+	assert.Equal(t, 2, CurrencyDecimals("USD"))
+	assert.Equal(t, 0, CurrencyDecimals("JPY"))
+	assert.Equal(t, 3, CurrencyDecimals("KWD"))
+}
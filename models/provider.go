@@ -0,0 +1,77 @@
+package models
+
+import (
+	"fmt"
+	"service_fraud/utils"
+)
+
+// ProviderErrorEnvelope is the body returned by ipapi and fixer, usually with a 200 status, when
+// they reject a request, for example:
+//
+//	{"success": false, "error": {"code": 104, "type": "usage_limit_reached", "info": "..."}}
+type ProviderErrorEnvelope struct {
+	Success *bool          `json:"success"`
+	Error   *ProviderError `json:"error"`
+}
+
+// ProviderError holds the code, type and description of the error reported by the provider.
+type ProviderError struct {
+	Code int    `json:"code"`
+	Type string `json:"type"`
+	Info string `json:"info"`
+}
+
+// Failed reports whether the body is an error envelope rather than a regular response.
+func (e ProviderErrorEnvelope) Failed() bool {
+	return e.Error != nil && (e.Success == nil || !*e.Success) && (e.Error.Code != 0 || e.Error.Type != "")
+}
+
+// ProviderApiError represents a request rejected by an external API, mapped to the application
+// code and message. It keeps the code and type reported by the provider.
+type ProviderApiError struct {
+	Code         int
+	Message      string
+	Provider     string
+	ProviderCode int
+	ProviderType string
+}
+
+// Error returns a formatted error string for ProviderApiError.
+func (e *ProviderApiError) Error() string {
+	return fmt.Sprintf("		Code %d: %s", e.Code, e.Message)
+}
+
+// providerErrorTypes holds the types of the error codes shared by ipapi and fixer, used when a
+// response only carries the code.
+var providerErrorTypes = map[int]string{
+	101: utils.PROVIDER_ERROR_INVALID_KEY,
+	102: utils.PROVIDER_ERROR_INACTIVE_USER,
+	104: utils.PROVIDER_ERROR_USAGE_LIMIT,
+}
+
+// NewProviderApiError maps the error reported by the provider to the application error: an
+// invalid or inactive key, the usage limit of the plan, the rate limit or an invalid IP. The
+// unknown errors keep the given code and message, the ones of the failed service.
+func NewProviderApiError(provider string, providerError ProviderError, code int, msg string) *ProviderApiError {
+	providerType := providerError.Type
+	if providerType == "" {
+		providerType = providerErrorTypes[providerError.Code]
+	}
+	switch providerType {
+	case utils.PROVIDER_ERROR_INVALID_KEY, utils.PROVIDER_ERROR_MISSING_KEY, utils.PROVIDER_ERROR_INACTIVE_USER:
+		code, msg = utils.ERR_CODE_INVALID_API_KEY, utils.ERR_USER_MESSAGE_INVALID_API_KEY
+	case utils.PROVIDER_ERROR_USAGE_LIMIT:
+		code, msg = utils.ERR_CODE_LIMIT_REACHED, utils.ERR_USER_MESSAGE_LIMIT_REACHED
+	case utils.PROVIDER_ERROR_RATE_LIMIT:
+		code, msg = utils.ERR_CODE_RATE_LIMITED, utils.ERR_USER_MESSAGE_RATE_LIMITED
+	case utils.PROVIDER_ERROR_INVALID_IP:
+		code, msg = utils.ERR_CODE_INVALID_IP, utils.ERR_USER_MESSAGE_INVALID_IP
+	}
+	return &ProviderApiError{
+		Code:         code,
+		Message:      msg,
+		Provider:     provider,
+		ProviderCode: providerError.Code,
+		ProviderType: providerError.Type,
+	}
+}
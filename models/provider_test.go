@@ -0,0 +1,62 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"service_fraud/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProviderErrorEnvelope_Failed(t *testing.T) {
+	tests := []struct {
+		body   string
+		failed bool
+	}{
+		{`{"success": false, "error": {"code": 104, "type": "usage_limit_reached"}}`, true},
+		{`{"error": {"code": 101, "type": "invalid_access_key"}}`, true},
+		{`{"success": true, "base": "EUR", "rates": {"USD": 1.1}}`, false},
+		{`{"ip": "1.1.1.1", "country_code": "AU"}`, false},
+		{`{"success": false, "error": {}}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			var envelope ProviderErrorEnvelope
+			require.NoError(t, json.Unmarshal([]byte(tt.body), &envelope))
+			assert.Equal(t, tt.failed, envelope.Failed())
+		})
+	}
+}
+
+func TestNewProviderApiError(t *testing.T) {
+	tests := []struct {
+		name          string
+		providerError ProviderError
+		code          int
+		message       string
+	}{
+		{"invalid key", ProviderError{Code: 101, Type: "invalid_access_key"}, utils.ERR_CODE_INVALID_API_KEY, utils.ERR_USER_MESSAGE_INVALID_API_KEY},
+		{"missing key", ProviderError{Code: 101, Type: "missing_access_key"}, utils.ERR_CODE_INVALID_API_KEY, utils.ERR_USER_MESSAGE_INVALID_API_KEY},
+		{"inactive user", ProviderError{Code: 102}, utils.ERR_CODE_INVALID_API_KEY, utils.ERR_USER_MESSAGE_INVALID_API_KEY},
+		{"usage limit", ProviderError{Code: 104, Type: "usage_limit_reached"}, utils.ERR_CODE_LIMIT_REACHED, utils.ERR_USER_MESSAGE_LIMIT_REACHED},
+		{"usage limit code only", ProviderError{Code: 104}, utils.ERR_CODE_LIMIT_REACHED, utils.ERR_USER_MESSAGE_LIMIT_REACHED},
+		{"rate limit", ProviderError{Code: 429, Type: "rate_limit_reached"}, utils.ERR_CODE_RATE_LIMITED, utils.ERR_USER_MESSAGE_RATE_LIMITED},
+		{"invalid ip", ProviderError{Code: 106, Type: "invalid_ip_address"}, utils.ERR_CODE_INVALID_IP, utils.ERR_USER_MESSAGE_INVALID_IP},
+		{"unknown", ProviderError{Code: 105, Type: "function_access_restricted"}, utils.ERR_CODE_IP_SERVICE, utils.ERR_USER_MESSAGE_IP_SERVICE},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewProviderApiError("ipapi", tt.providerError, utils.ERR_CODE_IP_SERVICE, utils.ERR_USER_MESSAGE_IP_SERVICE)
+
+			assert.Equal(t, tt.code, err.Code)
+			assert.Equal(t, tt.message, err.Message)
+			assert.Equal(t, "ipapi", err.Provider)
+			assert.Equal(t, tt.providerError.Code, err.ProviderCode)
+			assert.Equal(t, tt.providerError.Type, err.ProviderType)
+		})
+	}
+}
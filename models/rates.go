@@ -0,0 +1,117 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// RatesSnapshot holds the exchange rates returned by the currency provider, in terms of its
+// base currency, along with when they were published and retrieved.
+type RatesSnapshot struct {
+	// Source is the name of the provider of the rates.
+	Source string `json:"source" yaml:"source"`
+	Base   string `json:"base" yaml:"base"`
+	// Timestamp is when the provider published the rates.
+	Timestamp time.Time `json:"timestamp" yaml:"timestamp"`
+	// FetchedAt is when the rates were retrieved and ExpiresAt when they must be retrieved again.
+	FetchedAt time.Time `json:"fetched_at" yaml:"fetched_at"`
+	ExpiresAt time.Time `json:"expires_at" yaml:"expires_at"`
+	// StaleSince is set when the snapshot is served after its expiry because the provider failed.
+	StaleSince *time.Time `json:"stale_since,omitempty" yaml:"stale_since,omitempty"`
+	// Date is the day of the historical rates, YYYY-MM-DD, empty for the current ones.
+	Date  string             `json:"date,omitempty" yaml:"date,omitempty"`
+	Rates map[string]float64 `json:"rates" yaml:"rates"`
+}
+
+// RatesInfo identifies the snapshot of the exchange rates a trace was converted with.
+type RatesInfo struct {
+	Source     string     `json:"source" yaml:"source"`
+	Timestamp  time.Time  `json:"timestamp" yaml:"timestamp"`
+	StaleSince *time.Time `json:"stale_since,omitempty" yaml:"stale_since,omitempty"`
+	Date       string     `json:"date,omitempty" yaml:"date,omitempty"`
+}
+
+// NewRatesSnapshot builds the snapshot of the rates retrieved at the given time, which expire
+// after the ttl. The retrieval time is used when the provider does not inform a timestamp.
+func NewRatesSnapshot(response CurrencyResponse, fetchedAt time.Time, ttl time.Duration) RatesSnapshot {
+	timestamp := fetchedAt
+	if response.Timestamp > 0 {
+		timestamp = time.Unix(response.Timestamp, 0)
+	}
+	return RatesSnapshot{
+		Source:    response.Source,
+		Base:      response.Base,
+		Timestamp: timestamp,
+		FetchedAt: fetchedAt,
+		ExpiresAt: fetchedAt.Add(ttl),
+		Rates:     response.Rates,
+	}
+}
+
+// NewHistoricalRatesSnapshot builds the snapshot of the rates of the given day, YYYY-MM-DD,
+// retrieved at the given time. Historical rates do not change, so the snapshot does not expire.
+// The start of the day is used when the provider does not inform a timestamp.
+func NewHistoricalRatesSnapshot(response CurrencyResponse, date string, fetchedAt time.Time) RatesSnapshot {
+	snapshot := NewRatesSnapshot(response, fetchedAt, 0)
+	snapshot.ExpiresAt = time.Time{}
+	snapshot.Date = date
+	if day, err := time.Parse(time.DateOnly, date); err == nil && response.Timestamp <= 0 {
+		snapshot.Timestamp = day
+	}
+	return snapshot
+}
+
+// ParseRatesDate parses the day of the historical rates given as YYYY-MM-DD, which cannot be
+// after the day of now. It returns nil when the value is empty.
+func ParseRatesDate(value string, now time.Time) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	date, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a YYYY-MM-DD date", value)
+	}
+	if date.Format(time.DateOnly) > now.UTC().Format(time.DateOnly) {
+		return nil, fmt.Errorf("%s is in the future", value)
+	}
+	return &date, nil
+}
+
+// Response returns the rates of the snapshot as a CurrencyResponse, to convert the currencies.
+func (r RatesSnapshot) Response() CurrencyResponse {
+	return CurrencyResponse{
+		Success:   true,
+		Timestamp: r.Timestamp.Unix(),
+		Base:      r.Base,
+		Rates:     r.Rates,
+		Source:    r.Source,
+	}
+}
+
+// Expired reports whether the snapshot must be retrieved again at the given time.
+func (r RatesSnapshot) Expired(now time.Time) bool {
+	return !now.Before(r.ExpiresAt)
+}
+
+// Stale returns the snapshot marked as stale since its expiry.
+func (r RatesSnapshot) Stale() RatesSnapshot {
+	staleSince := r.ExpiresAt
+	r.StaleSince = &staleSince
+	return r
+}
+
+// Info returns the provider, timestamp, staleness and day of the snapshot.
+func (r RatesSnapshot) Info() *RatesInfo {
+	return &RatesInfo{Source: r.Source, Timestamp: r.Timestamp, StaleSince: r.StaleSince, Date: r.Date}
+}
+
+// Codes returns the codes of the currencies of the snapshot sorted alphabetically.
+func (r RatesSnapshot) Codes() []string {
+	codes := make([]string, 0, len(r.Rates))
+	for code := range r.Rates {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRatesDate(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	date, err := ParseRatesDate("", now)
+	require.NoError(t, err)
+	assert.Nil(t, date)
+
+	date, err = ParseRatesDate("2024-04-20", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 4, 20, 0, 0, 0, 0, time.UTC), *date)
+
+	date, err = ParseRatesDate("2024-05-01", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), *date)
+
+	_, err = ParseRatesDate("2024-05-02", now)
+	assert.ErrorContains(t, err, "is in the future")
+	_, err = ParseRatesDate("20/04/2024", now)
+	assert.ErrorContains(t, err, "is not a YYYY-MM-DD date")
+}
+
+func TestNewHistoricalRatesSnapshot(t *testing.T) {
+	fetchedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	response := CurrencyResponse{Success: true, Base: "EUR", Rates: map[string]float64{"USD": 1.07}, Source: "ecb"}
+
+	snapshot := NewHistoricalRatesSnapshot(response, "2024-04-20", fetchedAt)
+
+	assert.Equal(t, "2024-04-20", snapshot.Date)
+	assert.Equal(t, time.Date(2024, 4, 20, 0, 0, 0, 0, time.UTC), snapshot.Timestamp)
+	assert.Equal(t, fetchedAt, snapshot.FetchedAt)
+	assert.True(t, snapshot.ExpiresAt.IsZero())
+	assert.Equal(t, &RatesInfo{Source: "ecb", Timestamp: snapshot.Timestamp, Date: "2024-04-20"}, snapshot.Info())
+
+	response.Timestamp = 1713657599
+	snapshot = NewHistoricalRatesSnapshot(response, "2024-04-20", fetchedAt)
+	assert.Equal(t, time.Unix(1713657599, 0), snapshot.Timestamp)
+}
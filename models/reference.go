@@ -0,0 +1,86 @@
+package models
+
+import (
+	"fmt"
+	"service_fraud/utils"
+)
+
+// ReferenceLocation is a named point the distances to the IPs are measured from, for example
+// an office or a customer base.
+type ReferenceLocation struct {
+	Name      string  `json:"name" yaml:"name"`
+	Latitude  float64 `json:"latitude" yaml:"latitude"`
+	Longitude float64 `json:"longitude" yaml:"longitude"`
+}
+
+// ReferenceDistance holds the distance from a reference location to the country of a stats record.
+type ReferenceDistance struct {
+	Name     string  `json:"name" yaml:"name"`
+	Distance float64 `json:"distance_kms" yaml:"distance_kms"`
+}
+
+// ReferenceStats holds the distance statistics of the recorded requests to a reference location.
+type ReferenceStats struct {
+	Name            string  `json:"name" yaml:"name"`
+	Closest         Stats   `json:"closest" yaml:"closest"`
+	Farthest        Stats   `json:"farthest" yaml:"farthest"`
+	AverageDistance float64 `json:"average_distance_kms" yaml:"average_distance_kms"`
+}
+
+// DefaultReferenceLocations returns the reference used when none is configured, Buenos Aires.
+func DefaultReferenceLocations() []ReferenceLocation {
+	return []ReferenceLocation{
+		{Name: utils.BA_REFERENCE_NAME, Latitude: utils.BA_LATITUDE, Longitude: utils.BA_LONGITUDE},
+	}
+}
+
+// ValidateReferenceLocations checks that there is at least one location and that every one has
+// a unique name and valid coordinates.
+func ValidateReferenceLocations(references []ReferenceLocation) error {
+	if len(references) == 0 {
+		return fmt.Errorf("at least one reference location is required")
+	}
+	names := make(map[string]bool, len(references))
+	for _, reference := range references {
+		switch {
+		case reference.Name == "":
+			return fmt.Errorf("the reference location (%f, %f) requires a name", reference.Latitude, reference.Longitude)
+		case names[reference.Name]:
+			return fmt.Errorf("the reference location %q is repeated", reference.Name)
+		case reference.Latitude < -90 || reference.Latitude > 90 || reference.Longitude < -180 || reference.Longitude > 180:
+			return fmt.Errorf("the reference location %q has invalid coordinates (%f, %f)", reference.Name, reference.Latitude, reference.Longitude)
+		}
+		names[reference.Name] = true
+	}
+	return nil
+}
+
+// DistanceTo returns the estimated distance in kms from the reference location to the point.
+func (r ReferenceLocation) DistanceTo(point Coordinates) float64 {
+	return utils.EstimatedDistance(r.Latitude, r.Longitude, point.Latitude, point.Longitude)
+}
+
+// MeasureDistances returns the distance from each reference location to the point, in the
+// order of the references.
+func MeasureDistances(references []ReferenceLocation, point Coordinates) []Distance {
+	distances := make([]Distance, 0, len(references))
+	for _, reference := range references {
+		distances = append(distances, Distance{
+			Name:      reference.Name,
+			Kms:       int(reference.DistanceTo(point)),
+			Reference: Coordinates{Latitude: reference.Latitude, Longitude: reference.Longitude},
+		})
+	}
+	return distances
+}
+
+// NearestDistance returns the shortest of the distances, the first one on a tie.
+func NearestDistance(distances []Distance) Distance {
+	var nearest Distance
+	for i, distance := range distances {
+		if i == 0 || distance.Kms < nearest.Kms {
+			nearest = distance
+		}
+	}
+	return nearest
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testReferences = []ReferenceLocation{
+	{Name: "Buenos Aires", Latitude: -34.61315, Longitude: -58.37723},
+	{Name: "Bogota", Latitude: 4.711, Longitude: -74.0721},
+	{Name: "Madrid", Latitude: 40.4168, Longitude: -3.7038},
+}
+
+func TestValidateReferenceLocations(t *testing.T) {
+	assert.NoError(t, ValidateReferenceLocations(testReferences))
+	assert.NoError(t, ValidateReferenceLocations(DefaultReferenceLocations()))
+
+	assert.Error(t, ValidateReferenceLocations(nil))
+	assert.ErrorContains(t, ValidateReferenceLocations([]ReferenceLocation{{Latitude: 1, Longitude: 1}}), "requires a name")
+	assert.ErrorContains(t, ValidateReferenceLocations([]ReferenceLocation{testReferences[0], testReferences[0]}), "repeated")
+	assert.ErrorContains(t, ValidateReferenceLocations([]ReferenceLocation{{Name: "Invalid", Latitude: 91}}), "invalid coordinates")
+	assert.ErrorContains(t, ValidateReferenceLocations([]ReferenceLocation{{Name: "Invalid", Longitude: -181}}), "invalid coordinates")
+}
+
+func TestTraceResult_SetDistances(t *testing.T) {
+	// An IP located in Medellin.
+	result := TraceResult{Coordinates: Coordinates{Latitude: 6.2442, Longitude: -75.5812}}
+
+	result.SetDistances(testReferences, false)
+
+	assert.Equal(t, "Bogota", result.Distance.Name)
+	assert.Equal(t, Coordinates{Latitude: 4.711, Longitude: -74.0721}, result.Distance.Reference)
+	assert.InDelta(t, 240, result.Distance.Kms, 10)
+	assert.Len(t, result.Distances, 3)
+	assert.Equal(t, "Buenos Aires", result.Distances[0].Name)
+	assert.Equal(t, "Madrid", result.Distances[2].Name)
+
+	result.SetDistances(testReferences, true)
+
+	assert.Equal(t, []Distance{result.Distance}, result.Distances)
+	assert.Equal(t, "Bogota", result.Distance.Name)
+}
+
+func TestNewTraceResult_DefaultReference(t *testing.T) {
+	result := NewTraceResult(IpApiResponse{IP: "1.1.1.1", Latitude: -34.61315, Longitude: -58.37723}, CountryResponse{}, CurrencyResponse{})
+
+	assert.Equal(t, Distance{Name: "Buenos Aires", Kms: 0, Reference: Coordinates{Latitude: -34.61315, Longitude: -58.37723}}, result.Distance)
+	assert.Equal(t, []Distance{result.Distance}, result.Distances)
+}
@@ -1,110 +1,205 @@
-package models
-
-import (
-	"fmt"
-	"service_fraud/utils"
-	"strconv"
-	"strings"
-	"time"
-)
-
-// Response represents the structured output for IP, country, and currency information.
-type Response struct {
-	Ip                string
-	CurrentDate       time.Time
-	Country           string
-	ISO               string
-	Lenguages         string
-	Currency          string
-	CurrentTime       time.Time
-	EstimatedDistance string
-}
-
-// FormatResponse formats and displays the response based on provided data.
-func (r *Response) FormatResponse(ipRes IpApiResponse, countryRes CountryResponse, currencyRes CurrencyResponse) {
-	currencyArr := make([]string, 0, len(countryRes.ArrayResponse[0].Currencies))
-	var str string
-	for k, _ := range countryRes.ArrayResponse[0].Currencies {
-		currencyArr = append(currencyArr, k)
-	}
-
-	str = fmt.Sprintf(`
-		IP: %s,  fecha actual: %s
-			País: %s
-			ISO Code: %s`,
-		ipRes.IP, time.Now().Format("2006-01-02 15:04:05"),
-		ipRes.CountryName,
-		countryRes.ArrayResponse[0].Cca2,
-	)
-
-	for _, v := range ipRes.Location.Languages {
-		str += fmt.Sprintf("\n			Idiomas: %s (%s)", v.Name, v.Code)
-	}
-
-	str += fmt.Sprintf(`
-			Moneda: %v (1 %v = %f U$S)`,
-		currencyArr[0], currencyArr[0], getCurrencyRates(currencyArr[0], currencyRes),
-	)
-
-	for i, _ := range countryRes.ArrayResponse[0].Timezones {
-		hour, _ := parseOffset(countryRes.ArrayResponse[0].Timezones[i])
-		str += fmt.Sprintf("\n			Hora: %s (UTC) o %s (%s)", time.Now().UTC().Format("2006-01-02 15:04:05"), hour, countryRes.ArrayResponse[0].Timezones[i])
-	}
-
-	str += fmt.Sprintf(`
-			Distancia Estimada: %s kms (%f, %f) a (%f, %f)
-	`, utils.GetEstimatedDistance(utils.BA_LATITUDE, utils.BA_LONGITUDE, ipRes.Latitude, ipRes.Longitude), utils.BA_LATITUDE, utils.BA_LONGITUDE, ipRes.Latitude, ipRes.Longitude)
-
-	fmt.Print(str)
-}
-
-// getCurrencyRates calculates the exchange rate for the requested currency in terms of USD.
-func getCurrencyRates(requestedCurrency string, rates CurrencyResponse) float64 {
-	usdRate := rates.Rates["USD"]
-	requestedRate := rates.Rates[requestedCurrency]
-	return (1.0 * ((1 / requestedRate) * usdRate))
-}
-
-// parseOffset converts a timezone offset string to a formatted local time.
-func parseOffset(offsetStr string) (string, error) {
-	// Verificar si el offset es válido
-	if !strings.HasPrefix(offsetStr, "UTC") {
-		return "", fmt.Errorf("offset debe comenzar con 'UTC'")
-	}
-
-	// Extraer el signo y el tiempo
-	offsetStr = strings.TrimPrefix(offsetStr, "UTC")
-	sign := offsetStr[:1]
-	offsetStr = offsetStr[1:]
-
-	// Analizar las horas y minutos
-	parts := strings.Split(offsetStr, ":")
-	if len(parts) != 2 {
-		return "", fmt.Errorf("offset inválido")
-	}
-	hours, err := strconv.Atoi(parts[0])
-	if err != nil {
-		return "", fmt.Errorf("error al analizar las horas: %v", err)
-	}
-	minutes, err := strconv.Atoi(parts[1])
-	if err != nil {
-		return "", fmt.Errorf("error al analizar los minutos: %v", err)
-	}
-
-	// Calcular el desplazamiento en segundos
-	totalMinutes := hours*60 + minutes
-	if sign == "-" {
-		totalMinutes = -totalMinutes
-	}
-	offsetSeconds := totalMinutes * 60
-
-	// Crear una zona horaria fija con el offset calculado
-	location := time.FixedZone(offsetStr, offsetSeconds)
-
-	now := time.Now().UTC()
-
-	// Convertir la hora actual a la zona horaria especificada
-	localTime := now.In(location)
-
-	return localTime.Format("2006-01-02 15:04:05"), nil
-}
+package models
+
+import (
+	"fmt"
+	"service_fraud/utils"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TraceResult represents the structured result of the 'traceip' flow for an IP address.
+type TraceResult struct {
+	Ip         string         `json:"ip" yaml:"ip"`
+	Date       time.Time      `json:"date" yaml:"date"`
+	Country    string         `json:"country" yaml:"country"`
+	ISO        string         `json:"iso_code" yaml:"iso_code"`
+	Languages  []Language     `json:"languages" yaml:"languages"`
+	Currencies []CurrencyRate `json:"currencies" yaml:"currencies"`
+	Timezones  []LocalTime    `json:"timezones" yaml:"timezones"`
+	// Distance is the distance to the nearest reference location and Distances the distance
+	// to each one, or only to the nearest when so configured.
+	Distance    Distance    `json:"distance" yaml:"distance"`
+	Distances   []Distance  `json:"distances" yaml:"distances"`
+	Coordinates Coordinates `json:"coordinates" yaml:"coordinates"`
+	// Continent, ConnectionType and IsEu come from the geolocation and feed the risk rules.
+	Continent      string          `json:"continent" yaml:"continent"`
+	ConnectionType string          `json:"connection_type" yaml:"connection_type"`
+	IsEu           bool            `json:"is_eu" yaml:"is_eu"`
+	Risk           *RiskAssessment `json:"risk,omitempty" yaml:"risk,omitempty"`
+	List           *ListMatch      `json:"list,omitempty" yaml:"list,omitempty"`
+	// Rates identifies the snapshot of the exchange rates the currencies were converted with.
+	Rates *RatesInfo `json:"rates,omitempty" yaml:"rates,omitempty"`
+	// Transaction is the amount of the operation, when one was given.
+	Transaction *Transaction `json:"transaction,omitempty" yaml:"transaction,omitempty"`
+}
+
+// CurrencyRate holds a currency of the country and its exchange rate in terms of USD and of the
+// target currency of the traces.
+type CurrencyRate struct {
+	Code    string  `json:"code" yaml:"code"`
+	Name    string  `json:"name" yaml:"name"`
+	Symbol  string  `json:"symbol" yaml:"symbol"`
+	RateUSD float64 `json:"rate_usd" yaml:"rate_usd"`
+	// Rate is the value of one unit of the currency in the Target currency, 0 when the rates do
+	// not include one of them.
+	Rate   float64 `json:"rate" yaml:"rate"`
+	Target string  `json:"target" yaml:"target"`
+}
+
+// LocalTime holds a timezone of the country and its current local time.
+type LocalTime struct {
+	Timezone  string `json:"timezone" yaml:"timezone"`
+	LocalTime string `json:"local_time" yaml:"local_time"`
+}
+
+// Distance holds the estimated distance from a reference location to the IP location.
+type Distance struct {
+	Name      string      `json:"name" yaml:"name"`
+	Kms       int         `json:"kms" yaml:"kms"`
+	Reference Coordinates `json:"reference" yaml:"reference"`
+}
+
+// Coordinates holds a geographic point.
+type Coordinates struct {
+	Latitude  float64 `json:"latitude" yaml:"latitude"`
+	Longitude float64 `json:"longitude" yaml:"longitude"`
+}
+
+// NewTraceResult builds a TraceResult from the IP, country, and currency API responses.
+func NewTraceResult(ipRes IpApiResponse, countryRes CountryResponse, currencyRes CurrencyResponse) TraceResult {
+	country := CountryResponseElement{}
+	if len(countryRes.ArrayResponse) > 0 {
+		country = countryRes.ArrayResponse[0]
+	}
+
+	now := time.Now()
+	result := TraceResult{
+		Ip:             ipRes.IP,
+		Date:           now,
+		Country:        ipRes.CountryName,
+		ISO:            country.Cca2,
+		Languages:      ipRes.Location.Languages,
+		Coordinates:    Coordinates{Latitude: ipRes.Latitude, Longitude: ipRes.Longitude},
+		Continent:      ipRes.ContinentCode,
+		ConnectionType: ipRes.ConnectionType,
+		IsEu:           ipRes.Location.IsEu,
+	}
+	if result.ISO == "" {
+		result.ISO = ipRes.CountryCode
+	}
+	result.SetDistances(DefaultReferenceLocations(), false)
+
+	codes := make([]string, 0, len(country.Currencies))
+	for code := range country.Currencies {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		currency := country.Currencies[code]
+		result.Currencies = append(result.Currencies, CurrencyRate{
+			Code:    code,
+			Name:    currency.Name,
+			Symbol:  currency.Symbol,
+			RateUSD: CrossRate(code, utils.CURRENCY_USD, currencyRes),
+		})
+	}
+	result.ConvertCurrencies(utils.CURRENCY_USD, currencyRes)
+
+	for _, timezone := range country.Timezones {
+		localTime, _ := parseOffset(timezone)
+		result.Timezones = append(result.Timezones, LocalTime{Timezone: timezone, LocalTime: localTime})
+	}
+	return result
+}
+
+// SetDistances measures the distances from the reference locations to the IP location. Distance
+// is set to the nearest one and Distances to all of them, or only to the nearest one when
+// nearestOnly is set.
+func (t *TraceResult) SetDistances(references []ReferenceLocation, nearestOnly bool) {
+	t.Distances = MeasureDistances(references, t.Coordinates)
+	t.Distance = NearestDistance(t.Distances)
+	if nearestOnly && len(t.Distances) > 0 {
+		t.Distances = []Distance{t.Distance}
+	}
+}
+
+// ConvertCurrencies sets the rate of each currency of the country in terms of the target currency.
+func (t *TraceResult) ConvertCurrencies(target string, rates CurrencyResponse) {
+	for i := range t.Currencies {
+		t.Currencies[i].Rate = CrossRate(t.Currencies[i].Code, target, rates)
+		t.Currencies[i].Target = target
+	}
+}
+
+// CrossRate calculates the value of one unit of the from currency in the to currency, using the
+// rates of both in terms of the base currency of the response. It returns 0 when the rates do
+// not include one of them.
+func CrossRate(from, to string, rates CurrencyResponse) float64 {
+	fromRate, toRate := baseRate(from, rates), baseRate(to, rates)
+	if fromRate <= 0 || toRate <= 0 {
+		return 0
+	}
+	return toRate / fromRate
+}
+
+// baseRate returns the rate of the currency in terms of the base currency of the response, 1 for
+// the base currency itself.
+func baseRate(code string, rates CurrencyResponse) float64 {
+	if rate, ok := rates.Rates[code]; ok {
+		return rate
+	}
+	if code != "" && code == rates.Base {
+		return 1
+	}
+	return 0
+}
+
+// parseOffset converts a timezone offset string to a formatted local time.
+func parseOffset(offsetStr string) (string, error) {
+	// Verificar si el offset es válido
+	if !strings.HasPrefix(offsetStr, "UTC") {
+		return "", fmt.Errorf("offset debe comenzar con 'UTC'")
+	}
+
+	// Extraer el signo y el tiempo
+	offsetStr = strings.TrimPrefix(offsetStr, "UTC")
+	// Sin desplazamiento la hora local es la hora UTC
+	if offsetStr == "" {
+		return time.Now().UTC().Format("2006-01-02 15:04:05"), nil
+	}
+	sign := offsetStr[:1]
+	offsetStr = offsetStr[1:]
+
+	// Analizar las horas y minutos
+	parts := strings.Split(offsetStr, ":")
+	if len(parts) != 2 {
+		return "", fmt.Errorf("offset inválido")
+	}
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return "", fmt.Errorf("error al analizar las horas: %v", err)
+	}
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("error al analizar los minutos: %v", err)
+	}
+
+	// Calcular el desplazamiento en segundos
+	totalMinutes := hours*60 + minutes
+	if sign == "-" {
+		totalMinutes = -totalMinutes
+	}
+	offsetSeconds := totalMinutes * 60
+
+	// Crear una zona horaria fija con el offset calculado
+	location := time.FixedZone(offsetStr, offsetSeconds)
+
+	now := time.Now().UTC()
+
+	// Convertir la hora actual a la zona horaria especificada
+	localTime := now.In(location)
+
+	return localTime.Format("2006-01-02 15:04:05"), nil
+}
@@ -1,98 +1,166 @@
-package models
-
-import (
-	"fmt"
-	"testing"
-
-	"github.com/stretchr/testify/assert"
-)
-
-func TestFormatResponse(t *testing.T) {
-	ipRes := IpApiResponse{
-		IP:          "1.1.1.1",
-		CountryName: "Test Country",
-		Location: Location{
-			Languages: []Language{
-				{Name: "Spanish", Code: "ES"},
-				{Name: "English", Code: "EN"},
-			},
-		},
-		Latitude:  34.0,
-		Longitude: -58.0,
-	}
-
-	countryRes := CountryResponse{
-		ArrayResponse: []CountryResponseElement{
-			{
-				Currencies: map[string]Currency{
-					"USD": {Name: "United States Dollar", Symbol: "$"},
-				},
-				Cca2:      "TC",
-				Timezones: []string{"UTC-3"},
-			},
-		},
-	}
-
-	currencyRes := CurrencyResponse{
-		Rates: map[string]float64{"USD": 1.0},
-	}
-
-	response := Response{}
-	response.FormatResponse(ipRes, countryRes, currencyRes)
-
-	// La prueba no valida la salida, se puede hacer redirigiendo la salida estándar.
-}
-
-func TestGetCurrencyRates(t *testing.T) {
-	rates := CurrencyResponse{
-		Rates: map[string]float64{
-			"USD": 1.0,
-			"EUR": 0.85,
-		},
-	}
-
-	result := getCurrencyRates("EUR", rates)
-	expected := (1.0 * ((1 / 0.85) * 1.0)) // 1 EUR = 1 / 0.85 USD
-
-	assert.Equal(t, expected, result)
-}
-
-func TestParseOffset(t *testing.T) {
-	tests := []struct {
-		offsetStr string
-		expectErr bool
-	}{
-		{"UTC+3:00", false},
-		{"UTC-2:30", false},
-		{"UTC+invalid", true},
-		{"invalid", true},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.offsetStr, func(t *testing.T) {
-			_, err := parseOffset(tt.offsetStr)
-
-			if tt.expectErr {
-				assert.Error(t, err)
-			} else {
-				assert.NoError(t, err)
-			}
-		})
-	}
-}
-
-func TestCountryResponse_HasError(t *testing.T) {
-	tests := []struct {
-		response CountryResponse
-		hasError bool
-	}{
-		{CountryResponse{Error: CountryApiError{Code: 0, Message: ""}}, false},
-		{CountryResponse{Error: CountryApiError{Code: 1, Message: "Some error"}}, true},
-	}
-
-	for _, tt := range tests {
-		t.Run(fmt.Sprintf("HasError: %v", tt.hasError), func(t *testing.T) {
-			assert.Equal(t, tt.hasError, tt.response.HasError())
-		})
-	}
-}
+package models
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTraceResult(t *testing.T) {
+	ipRes := IpApiResponse{
+		IP:          "1.1.1.1",
+		CountryName: "Test Country",
+		Location: Location{
+			Languages: []Language{
+				{Name: "Spanish", Code: "ES"},
+				{Name: "English", Code: "EN"},
+			},
+		},
+		Latitude:  34.0,
+		Longitude: -58.0,
+	}
+
+	countryRes := CountryResponse{
+		ArrayResponse: []CountryResponseElement{
+			{
+				Currencies: map[string]Currency{
+					"USD": {Name: "United States Dollar", Symbol: "$"},
+				},
+				Cca2:      "TC",
+				Timezones: []string{"UTC-3"},
+			},
+		},
+	}
+
+	currencyRes := CurrencyResponse{
+		Rates: map[string]float64{"USD": 1.0},
+	}
+
+	result := NewTraceResult(ipRes, countryRes, currencyRes)
+
+	assert.Equal(t, "1.1.1.1", result.Ip)
+	assert.Equal(t, "Test Country", result.Country)
+	assert.Equal(t, "TC", result.ISO)
+	assert.Len(t, result.Languages, 2)
+	assert.Equal(t, []CurrencyRate{{Code: "USD", Name: "United States Dollar", Symbol: "$", RateUSD: 1.0, Rate: 1.0, Target: "USD"}}, result.Currencies)
+	assert.Len(t, result.Timezones, 1)
+	assert.Equal(t, "UTC-3", result.Timezones[0].Timezone)
+	assert.Equal(t, Coordinates{Latitude: 34.0, Longitude: -58.0}, result.Coordinates)
+	assert.Greater(t, result.Distance.Kms, 0)
+}
+
+func TestNewTraceResult_EmptyCountry(t *testing.T) {
+	result := NewTraceResult(IpApiResponse{IP: "1.1.1.1"}, CountryResponse{}, CurrencyResponse{})
+
+	assert.Equal(t, "1.1.1.1", result.Ip)
+	assert.Empty(t, result.Currencies)
+	assert.Empty(t, result.Timezones)
+}
+
+func TestNewTraceResult_SeveralCurrencies(t *testing.T) {
+	countryRes := CountryResponse{
+		ArrayResponse: []CountryResponseElement{{
+			Currencies: map[string]Currency{
+				"PAB": {Name: "Panamanian balboa", Symbol: "B/."},
+				"USD": {Name: "United States dollar", Symbol: "$"},
+			},
+		}},
+	}
+	currencyRes := CurrencyResponse{Base: "EUR", Rates: map[string]float64{"USD": 1.1, "PAB": 1.1, "ARS": 990}}
+
+	for i := 0; i < 10; i++ {
+		result := NewTraceResult(IpApiResponse{IP: "1.1.1.1"}, countryRes, currencyRes)
+		result.ConvertCurrencies("ARS", currencyRes)
+
+		require.Len(t, result.Currencies, 2)
+		assert.Equal(t, "PAB", result.Currencies[0].Code)
+		assert.Equal(t, "USD", result.Currencies[1].Code)
+		for _, currency := range result.Currencies {
+			assert.InDelta(t, 1.0, currency.RateUSD, 1e-9)
+			assert.InDelta(t, 900.0, currency.Rate, 1e-9)
+			assert.Equal(t, "ARS", currency.Target)
+		}
+	}
+}
+
+func TestCrossRate(t *testing.T) {
+	rates := CurrencyResponse{
+		Base: "EUR",
+		Rates: map[string]float64{
+			"USD": 1.0,
+			"ARS": 1000.0,
+			"COP": 4000.0,
+		},
+	}
+
+	tests := []struct {
+		name     string
+		from, to string
+		expected float64
+	}{
+		{"to usd", "COP", "USD", 0.00025},
+		{"from usd", "USD", "ARS", 1000},
+		{"cross", "COP", "ARS", 0.25},
+		{"from base", "EUR", "ARS", 1000},
+		{"to base", "ARS", "EUR", 0.001},
+		{"same currency", "ARS", "ARS", 1},
+		{"unknown from", "XYZ", "USD", 0},
+		{"unknown to", "USD", "XYZ", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.InDelta(t, tt.expected, CrossRate(tt.from, tt.to, rates), 1e-12)
+		})
+	}
+}
+
+func TestValidateCurrencyCode(t *testing.T) {
+	assert.NoError(t, ValidateCurrencyCode("ARS"))
+	assert.Error(t, ValidateCurrencyCode("ars"))
+	assert.Error(t, ValidateCurrencyCode("EURO"))
+	assert.Error(t, ValidateCurrencyCode(""))
+}
+
+func TestParseOffset(t *testing.T) {
+	tests := []struct {
+		offsetStr string
+		expectErr bool
+	}{
+		{"UTC+3:00", false},
+		{"UTC", false},
+		{"UTC-2:30", false},
+		{"UTC+invalid", true},
+		{"invalid", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.offsetStr, func(t *testing.T) {
+			_, err := parseOffset(tt.offsetStr)
+
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCountryResponse_HasError(t *testing.T) {
+	tests := []struct {
+		response CountryResponse
+		hasError bool
+	}{
+		{CountryResponse{Error: CountryApiError{Code: 0, Message: ""}}, false},
+		{CountryResponse{Error: CountryApiError{Code: 1, Message: "Some error"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("HasError: %v", tt.hasError), func(t *testing.T) {
+			assert.Equal(t, tt.hasError, tt.response.HasError())
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"service_fraud/utils"
+)
+
+// RiskPolicy holds the rules evaluated against a trace and the score thresholds of each decision.
+type RiskPolicy struct {
+	// ReviewThreshold is the minimum score that requires a manual review.
+	ReviewThreshold int `json:"review_threshold"`
+	// DenyThreshold is the minimum score that denies the operation.
+	DenyThreshold int `json:"deny_threshold"`
+	// Rules are evaluated in order and the weight of each one that fires is added to the score.
+	Rules []RiskRule `json:"rules"`
+}
+
+// RiskRule is a condition over the trace data that adds its weight to the score when it fires.
+type RiskRule struct {
+	// Name identifies the rule in the assessment.
+	Name string `json:"name"`
+	// Type is the trace data evaluated: distance_over, country, continent, connection_type,
+	// eu, currency_mismatch or amount_over.
+	Type string `json:"type"`
+	// Weight is added to the score when the rule fires, it can be negative to lower it.
+	Weight int `json:"weight"`
+	// Kms is the distance from the reference point used by the distance_over rules.
+	Kms int `json:"kms,omitempty"`
+	// Amount is the amount in USD of the transaction above which the amount_over rules fire,
+	// kept as the decimal written in the policy.
+	Amount json.Number `json:"amount,omitempty"`
+	// Values are the country codes, continent codes, connection types or accepted currencies
+	// compared by the rule, ignoring the case.
+	Values []string `json:"values,omitempty"`
+	// Negate fires the rule when the condition is not met.
+	Negate bool `json:"negate,omitempty"`
+}
+
+// RiskAssessment is the outcome of evaluating a RiskPolicy against a trace.
+type RiskAssessment struct {
+	Score    int         `json:"score" yaml:"score"`
+	Decision string      `json:"decision" yaml:"decision"`
+	Rules    []FiredRule `json:"rules" yaml:"rules"`
+}
+
+// FiredRule is a rule that fired during an assessment along with the weight it added.
+type FiredRule struct {
+	Name   string `json:"name" yaml:"name"`
+	Type   string `json:"type" yaml:"type"`
+	Weight int    `json:"weight" yaml:"weight"`
+}
+
+// DefaultRiskPolicy returns the policy used when the configuration does not define one. It
+// assumes the operations are expected from South America and paid in ARS or USD.
+func DefaultRiskPolicy() RiskPolicy {
+	return RiskPolicy{
+		ReviewThreshold: 30,
+		DenyThreshold:   60,
+		Rules: []RiskRule{
+			{Name: "distance_over_3000_kms", Type: utils.RISK_RULE_DISTANCE_OVER, Weight: 15, Kms: 3000},
+			{Name: "distance_over_10000_kms", Type: utils.RISK_RULE_DISTANCE_OVER, Weight: 15, Kms: 10000},
+			{Name: "outside_south_america", Type: utils.RISK_RULE_CONTINENT, Weight: 10, Values: []string{"SA"}, Negate: true},
+			{Name: "sanctioned_country", Type: utils.RISK_RULE_COUNTRY, Weight: 60, Values: []string{"CU", "IR", "KP", "SY"}},
+			{Name: "anonymous_connection", Type: utils.RISK_RULE_CONNECTION_TYPE, Weight: 40, Values: []string{"hosting", "proxy", "vpn", "tor"}},
+			{Name: "eu_country", Type: utils.RISK_RULE_EU, Weight: 5},
+			{Name: "currency_not_accepted", Type: utils.RISK_RULE_CURRENCY_MISMATCH, Weight: 10, Values: []string{"ARS", "USD"}},
+			{Name: "amount_over_5000_usd", Type: utils.RISK_RULE_AMOUNT_OVER, Weight: 20, Amount: "5000"},
+		},
+	}
+}
+
+// Validate checks that the thresholds are consistent and every rule has a known type.
+func (p RiskPolicy) Validate() error {
+	if p.ReviewThreshold > p.DenyThreshold {
+		return fmt.Errorf("the review threshold %d is greater than the deny threshold %d", p.ReviewThreshold, p.DenyThreshold)
+	}
+	for _, rule := range p.Rules {
+		switch rule.Type {
+		case utils.RISK_RULE_DISTANCE_OVER, utils.RISK_RULE_EU:
+		case utils.RISK_RULE_COUNTRY, utils.RISK_RULE_CONTINENT, utils.RISK_RULE_CONNECTION_TYPE, utils.RISK_RULE_CURRENCY_MISMATCH:
+			if len(rule.Values) == 0 {
+				return fmt.Errorf("the risk rule %q of type %s requires values", rule.Name, rule.Type)
+			}
+		case utils.RISK_RULE_AMOUNT_OVER:
+			if _, err := ParseMoney(rule.Amount.String(), utils.CURRENCY_USD); err != nil {
+				return fmt.Errorf("the risk rule %q requires a positive amount: %w", rule.Name, err)
+			}
+		default:
+			return fmt.Errorf("the risk rule %q has an unknown type: %s", rule.Name, rule.Type)
+		}
+	}
+	return nil
+}
+
+// Decide returns the decision that corresponds to the score.
+func (p RiskPolicy) Decide(score int) string {
+	switch {
+	case score >= p.DenyThreshold:
+		return utils.RISK_DECISION_DENY
+	case score >= p.ReviewThreshold:
+		return utils.RISK_DECISION_REVIEW
+	default:
+		return utils.RISK_DECISION_ALLOW
+	}
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"encoding/json"
+	"service_fraud/utils"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRiskPolicy_Validate(t *testing.T) {
+	assert.NoError(t, DefaultRiskPolicy().Validate())
+
+	tests := []RiskPolicy{
+		{ReviewThreshold: 70, DenyThreshold: 50},
+		{DenyThreshold: 50, Rules: []RiskRule{{Name: "unknown", Type: "velocity"}}},
+		{DenyThreshold: 50, Rules: []RiskRule{{Name: "no_values", Type: utils.RISK_RULE_COUNTRY}}},
+		{DenyThreshold: 50, Rules: []RiskRule{{Name: "no_amount", Type: utils.RISK_RULE_AMOUNT_OVER}}},
+		{DenyThreshold: 50, Rules: []RiskRule{{Name: "negative_amount", Type: utils.RISK_RULE_AMOUNT_OVER, Amount: "-100"}}},
+	}
+	for _, policy := range tests {
+		assert.Error(t, policy.Validate())
+	}
+}
+
+func TestRiskPolicy_Validate_AmountOver(t *testing.T) {
+	var policy RiskPolicy
+	require.NoError(t, json.Unmarshal([]byte(`{"review_threshold": 30, "deny_threshold": 60,
+		"rules": [{"name": "amount_over_1500_usd", "type": "amount_over", "weight": 20, "amount": 1500.50}]}`), &policy))
+
+	assert.NoError(t, policy.Validate())
+	assert.Equal(t, "1500.50", policy.Rules[0].Amount.String())
+}
+
+func TestRiskPolicy_Decide(t *testing.T) {
+	policy := RiskPolicy{ReviewThreshold: 30, DenyThreshold: 60}
+
+	assert.Equal(t, utils.RISK_DECISION_ALLOW, policy.Decide(29))
+	assert.Equal(t, utils.RISK_DECISION_REVIEW, policy.Decide(30))
+	assert.Equal(t, utils.RISK_DECISION_DENY, policy.Decide(60))
+}
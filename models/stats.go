@@ -1,15 +1,198 @@
-package models
-
-// Stats represents statistics related to a specific country.
-type Stats struct {
-	Country  string
-	Distance string
-	Invokes  int
-}
-
-// StatsRequest is used to capture parameters for requesting statistics.
-type StatsRequest struct {
-	Country string
-	Lat     float64
-	Lon     float64
-}
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Stats represents statistics related to a specific country.
+type Stats struct {
+	Country   string  `json:"country" yaml:"country"`
+	Continent string  `json:"continent,omitempty" yaml:"continent,omitempty"`
+	Distance  float64 `json:"distance_kms" yaml:"distance_kms"`
+	Invokes   int     `json:"invokes" yaml:"invokes"`
+	// Coordinates is the location of the first request of the country, the distances to the
+	// reference locations are measured from it.
+	Coordinates *Coordinates `json:"coordinates,omitempty" yaml:"coordinates,omitempty"`
+	// References holds the distance to each reference location, Distance is the nearest one.
+	References []ReferenceDistance `json:"references,omitempty" yaml:"references,omitempty"`
+	// Time is the start of the time bucket of the invokes, it is only set in the records
+	// persisted by the stats store.
+	Time *time.Time `json:"time,omitempty" yaml:"time,omitempty"`
+}
+
+// StatsSummary represents the statistics calculated from the recorded requests. Every request
+// counts with the distance of its country, so the countries are weighted by their invokes.
+type StatsSummary struct {
+	Closest         Stats                `json:"closest" yaml:"closest"`
+	Farthest        Stats                `json:"farthest" yaml:"farthest"`
+	AverageDistance float64              `json:"average_distance_kms" yaml:"average_distance_kms"`
+	Distribution    DistanceDistribution `json:"distribution" yaml:"distribution"`
+	Histogram       []HistogramBucket    `json:"histogram" yaml:"histogram"`
+	Continents      []ContinentStats     `json:"continents" yaml:"continents"`
+	TotalInvokes    int                  `json:"total_invokes" yaml:"total_invokes"`
+	Records         []Stats              `json:"records" yaml:"records"`
+	// References holds the statistics of the distances to each reference location.
+	References []ReferenceStats `json:"references,omitempty" yaml:"references,omitempty"`
+	// Windows holds the requests of the last minutes or hours, only in the summary of all the
+	// recorded requests.
+	Windows []WindowStats `json:"windows,omitempty" yaml:"windows,omitempty"`
+	// Window is the time range of the requests of the summary, nil when it holds all of them.
+	Window *StatsWindow `json:"window,omitempty" yaml:"window,omitempty"`
+}
+
+// StatsWindow is a time range of recorded requests, From included and To excluded.
+type StatsWindow struct {
+	From time.Time `json:"from" yaml:"from"`
+	To   time.Time `json:"to" yaml:"to"`
+}
+
+// WindowStats holds the requests recorded in a rolling window, for example the last hour.
+type WindowStats struct {
+	Window          string  `json:"window" yaml:"window"`
+	TotalInvokes    int     `json:"total_invokes" yaml:"total_invokes"`
+	AverageDistance float64 `json:"average_distance_kms" yaml:"average_distance_kms"`
+}
+
+// DistanceDistribution holds the median, percentiles and standard deviation of the distances
+// of the recorded requests.
+type DistanceDistribution struct {
+	Median float64 `json:"median_kms" yaml:"median_kms"`
+	P90    float64 `json:"p90_kms" yaml:"p90_kms"`
+	P95    float64 `json:"p95_kms" yaml:"p95_kms"`
+	P99    float64 `json:"p99_kms" yaml:"p99_kms"`
+	StdDev float64 `json:"stddev_kms" yaml:"stddev_kms"`
+}
+
+// HistogramBucket counts the requests whose distance is at least FromKms and less than ToKms.
+// ToKms is nil in the last bucket, which has no upper limit.
+type HistogramBucket struct {
+	FromKms float64  `json:"from_kms" yaml:"from_kms"`
+	ToKms   *float64 `json:"to_kms" yaml:"to_kms"`
+	Count   int      `json:"count" yaml:"count"`
+}
+
+// ContinentStats counts the requests from a continent.
+type ContinentStats struct {
+	Continent string `json:"continent" yaml:"continent"`
+	Invokes   int    `json:"invokes" yaml:"invokes"`
+}
+
+// StatsRequest is used to capture parameters for requesting statistics.
+type StatsRequest struct {
+	Country   string
+	Continent string
+	Lat       float64
+	Lon       float64
+	// Time is when the request was processed, the zero time is replaced with the time it is
+	// recorded.
+	Time time.Time
+	// TraceId correlates the request with the messages logged during its trace.
+	TraceId string
+}
+
+// DefaultHistogramBuckets returns the upper limits, in kms, of the histogram buckets used when
+// none are configured.
+func DefaultHistogramBuckets() []float64 {
+	return []float64{500, 1000, 2500, 5000, 10000}
+}
+
+// ValidateHistogramBuckets checks that the upper limits of the buckets are positive and sorted
+// in ascending order.
+func ValidateHistogramBuckets(buckets []float64) error {
+	for i, bucket := range buckets {
+		if bucket <= 0 {
+			return fmt.Errorf("the histogram bucket %v must be greater than 0", bucket)
+		}
+		if i > 0 && bucket <= buckets[i-1] {
+			return fmt.Errorf("the histogram buckets must be sorted in ascending order: %v", buckets)
+		}
+	}
+	return nil
+}
+
+// DefaultStatsWindows returns the rolling windows shown with the stats when none are configured.
+func DefaultStatsWindows() []string {
+	return []string{"5m", "1h", "24h"}
+}
+
+// ParseStatsWindows parses the rolling windows, which must be positive durations not longer than
+// the retention of the timed stats.
+func ParseStatsWindows(windows []string, retention time.Duration) ([]time.Duration, error) {
+	durations := make([]time.Duration, 0, len(windows))
+	for _, window := range windows {
+		duration, err := time.ParseDuration(window)
+		if err != nil {
+			return nil, err
+		}
+		if duration <= 0 || duration > retention {
+			return nil, fmt.Errorf("the window %s must be greater than 0 and not longer than the retention %s", window, FormatWindow(retention))
+		}
+		durations = append(durations, duration)
+	}
+	return durations, nil
+}
+
+// ParseStatsWindow builds the time range given by 'since', a duration before now, or by 'from'
+// and 'to', which defaults to now. It returns nil when none of them is given.
+func ParseStatsWindow(since, from, to string, now time.Time) (*StatsWindow, error) {
+	if since == "" && from == "" && to == "" {
+		return nil, nil
+	}
+	if since != "" && (from != "" || to != "") {
+		return nil, fmt.Errorf("since cannot be used with from or to")
+	}
+	if since != "" {
+		duration, err := time.ParseDuration(since)
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("invalid duration: %s", since)
+		}
+		return &StatsWindow{From: now.Add(-duration), To: now}, nil
+	}
+
+	if from == "" {
+		return nil, fmt.Errorf("to requires from")
+	}
+	window := &StatsWindow{To: now}
+	var err error
+	if window.From, err = parseStatsTime(from); err != nil {
+		return nil, err
+	}
+	if to != "" {
+		if window.To, err = parseStatsTime(to); err != nil {
+			return nil, err
+		}
+	}
+	if !window.From.Before(window.To) {
+		return nil, fmt.Errorf("the range from %s to %s is empty", from, to)
+	}
+	return window, nil
+}
+
+// statsTimeLayouts are the layouts accepted for the limits of a time range, the ones without a
+// zone are in local time.
+var statsTimeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"}
+
+// parseStatsTime parses a limit of a time range.
+func parseStatsTime(value string) (time.Time, error) {
+	for _, layout := range statsTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time: %s", value)
+}
+
+// FormatWindow formats the duration of a window without its zero units, for example 1h instead
+// of 1h0m0s.
+func FormatWindow(duration time.Duration) string {
+	text := duration.String()
+	if strings.HasSuffix(text, "m0s") {
+		text = strings.TrimSuffix(text, "0s")
+	}
+	if strings.HasSuffix(text, "h0m") {
+		text = strings.TrimSuffix(text, "0m")
+	}
+	return text
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStatsWindow(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+
+	window, err := ParseStatsWindow("", "", "", now)
+	require.NoError(t, err)
+	assert.Nil(t, window)
+
+	window, err = ParseStatsWindow("90m", "", "", now)
+	require.NoError(t, err)
+	assert.Equal(t, &StatsWindow{From: now.Add(-90 * time.Minute), To: now}, window)
+
+	window, err = ParseStatsWindow("", "2024-05-01T10:00", "", now)
+	require.NoError(t, err)
+	assert.Equal(t, &StatsWindow{From: time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local), To: now}, window)
+
+	window, err = ParseStatsWindow("", "2024-04-30", "2024-05-01T09:30:00Z", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 4, 30, 0, 0, 0, 0, time.Local), window.From)
+	assert.True(t, window.To.Equal(time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)))
+
+	tests := []struct {
+		name            string
+		since, from, to string
+	}{
+		{"invalid duration", "yesterday", "", ""},
+		{"negative duration", "-1h", "", ""},
+		{"since with from", "1h", "2024-05-01", ""},
+		{"to without from", "", "", "2024-05-01"},
+		{"invalid time", "", "01/05/2024", ""},
+		{"empty range", "", "2024-05-01T12:00", "2024-05-01T11:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseStatsWindow(tt.since, tt.from, tt.to, now)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestParseStatsWindows(t *testing.T) {
+	windows, err := ParseStatsWindows(DefaultStatsWindows(), 24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Duration{5 * time.Minute, time.Hour, 24 * time.Hour}, windows)
+
+	_, err = ParseStatsWindows([]string{"48h"}, 24*time.Hour)
+	assert.ErrorContains(t, err, "not longer than the retention 24h")
+	_, err = ParseStatsWindows([]string{"0s"}, 24*time.Hour)
+	assert.Error(t, err)
+	_, err = ParseStatsWindows([]string{"1 hour"}, 24*time.Hour)
+	assert.Error(t, err)
+}
+
+func TestFormatWindow(t *testing.T) {
+	assert.Equal(t, "5m", FormatWindow(5*time.Minute))
+	assert.Equal(t, "1h", FormatWindow(time.Hour))
+	assert.Equal(t, "1h30m", FormatWindow(90*time.Minute))
+	assert.Equal(t, "45s", FormatWindow(45*time.Second))
+}
@@ -0,0 +1,128 @@
+package render
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"service_fraud/models"
+	"service_fraud/utils"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// BatchCSVHeader holds the columns written by the CSV batch writer.
+var BatchCSVHeader = append(slices.Clone(TraceCSVHeader), "error_code", "error_message")
+
+// BatchWriter writes the result of each IP of a batch as a single line.
+type BatchWriter interface {
+	// WriteResult writes the result or the error obtained for the given IP.
+	WriteResult(ip string, result models.TraceResult, err error) error
+	// Flush writes any buffered data to the underlying writer.
+	Flush() error
+}
+
+// batchErrorDocument is the JSON line written for an IP that could not be traced.
+type batchErrorDocument struct {
+	SchemaVersion string     `json:"schema_version"`
+	Ip            string     `json:"ip"`
+	Error         batchError `json:"error"`
+}
+
+// batchError holds the code and message of a failed trace.
+type batchError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// NewBatchWriter returns the batch writer for the given format, 'ndjson' or 'csv'.
+func NewBatchWriter(w io.Writer, format string) (BatchWriter, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case utils.FORMAT_NDJSON, utils.FORMAT_JSON, "":
+		return &ndjsonBatchWriter{w: w}, nil
+	case utils.FORMAT_CSV:
+		return &csvBatchWriter{writer: csv.NewWriter(w)}, nil
+	default:
+		return nil, models.NewOptionInvalidError(utils.ERR_CODE_INVALID_FORMAT, fmt.Sprintf(utils.ERR_MESSAGE_INVALID_FORMAT, format))
+	}
+}
+
+// ndjsonBatchWriter writes a JSON document per line.
+type ndjsonBatchWriter struct {
+	w io.Writer
+}
+
+// WriteResult writes the trace document or an error document for the IP.
+func (n *ndjsonBatchWriter) WriteResult(ip string, result models.TraceResult, err error) error {
+	if err == nil {
+		return NewJSONRenderer().RenderTrace(n.w, result)
+	}
+	code, message := models.ErrorDetails(err)
+	return json.NewEncoder(n.w).Encode(batchErrorDocument{
+		SchemaVersion: utils.JSON_SCHEMA_VERSION,
+		Ip:            ip,
+		Error:         batchError{Code: code, Message: message},
+	})
+}
+
+// Flush has nothing to flush as every line is written directly.
+func (n *ndjsonBatchWriter) Flush() error {
+	return nil
+}
+
+// csvBatchWriter writes a header followed by a row per IP.
+type csvBatchWriter struct {
+	writer        *csv.Writer
+	headerWritten bool
+}
+
+// WriteResult writes the trace row or a row with the IP and the error columns.
+func (c *csvBatchWriter) WriteResult(ip string, result models.TraceResult, err error) error {
+	if !c.headerWritten {
+		if err := c.writer.Write(BatchCSVHeader); err != nil {
+			return err
+		}
+		c.headerWritten = true
+	}
+
+	var row []string
+	if err == nil {
+		row = append(TraceCSVRecord(result), "", "")
+	} else {
+		code, message := models.ErrorDetails(err)
+		row = make([]string, len(BatchCSVHeader))
+		row[0] = ip
+		row[len(row)-2] = strconv.Itoa(code)
+		row[len(row)-1] = message
+	}
+	return c.writer.Write(row)
+}
+
+// Flush writes the buffered rows to the underlying writer.
+func (c *csvBatchWriter) Flush() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+// RenderBatchSummary writes the summary of a batch in the console text format.
+func RenderBatchSummary(w io.Writer, summary models.BatchSummary) error {
+	str := fmt.Sprintf(`
+Resumen del proceso batch:
+	Total: %d
+	Exitosas: %d
+	Fallidas: %d`, summary.Total, summary.Succeeded, summary.Failed)
+
+	codes := make([]int, 0, len(summary.FailuresByCode))
+	for code := range summary.FailuresByCode {
+		codes = append(codes, code)
+	}
+	slices.Sort(codes)
+	for _, code := range codes {
+		str += fmt.Sprintf("\n		Codigo %d: %d", code, summary.FailuresByCode[code])
+	}
+	str += fmt.Sprintf("\n	Tiempo transcurrido: %f (segundos)\n", summary.Elapsed.Seconds())
+
+	_, err := fmt.Fprint(w, str)
+	return err
+}
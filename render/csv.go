@@ -0,0 +1,140 @@
+package render
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"service_fraud/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TraceCSVHeader holds the columns written by the CSVRenderer for a trace.
+var TraceCSVHeader = []string{"ip", "date", "country", "iso_code", "languages", "currencies", "timezones", "distance_kms", "latitude", "longitude",
+	"continent", "connection_type", "is_eu", "risk_score", "risk_decision", "risk_rules",
+	"list_name", "list_action", "reference", "distances", "currency_target",
+	"rates_stale_since", "rates_source", "rates_date",
+	"transaction_amount", "transaction_currency", "transaction_converted", "transaction_usd"}
+
+// StatsCSVHeader holds the columns written by the CSVRenderer for the stats.
+var StatsCSVHeader = []string{"country", "distance_kms", "invokes", "references", "continent"}
+
+// CSVRenderer renders the results as comma separated values with a header row.
+type CSVRenderer struct{}
+
+// NewCSVRenderer creates a new CSVRenderer.
+func NewCSVRenderer() *CSVRenderer {
+	return &CSVRenderer{}
+}
+
+// RenderTrace writes the 'traceip' result as a header and a single row.
+func (c *CSVRenderer) RenderTrace(w io.Writer, result models.TraceResult) error {
+	return writeCSV(w, TraceCSVHeader, TraceCSVRecord(result))
+}
+
+// RenderStats writes the 'record' summary as a header and a row per country.
+func (c *CSVRenderer) RenderStats(w io.Writer, summary models.StatsSummary) error {
+	rows := make([][]string, 0, len(summary.Records))
+	for _, stats := range summary.Records {
+		references := make([]string, 0, len(stats.References))
+		for _, v := range stats.References {
+			references = append(references, fmt.Sprintf("%s=%s", v.Name, formatKms(v.Distance)))
+		}
+		rows = append(rows, []string{stats.Country, formatKms(stats.Distance), strconv.Itoa(stats.Invokes), strings.Join(references, ";"), stats.Continent})
+	}
+	return writeCSV(w, StatsCSVHeader, rows...)
+}
+
+// TraceCSVRecord returns the values of the trace in the order of TraceCSVHeader.
+// Multi-valued fields are joined with ';'.
+func TraceCSVRecord(result models.TraceResult) []string {
+	languages := make([]string, 0, len(result.Languages))
+	for _, v := range result.Languages {
+		languages = append(languages, v.Code)
+	}
+	currencies := make([]string, 0, len(result.Currencies))
+	var target string
+	for _, v := range result.Currencies {
+		currencies = append(currencies, fmt.Sprintf("%s=%f", v.Code, v.Rate))
+		target = v.Target
+	}
+	timezones := make([]string, 0, len(result.Timezones))
+	for _, v := range result.Timezones {
+		timezones = append(timezones, v.Timezone)
+	}
+	distances := make([]string, 0, len(result.Distances))
+	for _, v := range result.Distances {
+		distances = append(distances, fmt.Sprintf("%s=%d", v.Name, v.Kms))
+	}
+	var score, decision, listName, listAction, staleSince, source, ratesDate string
+	if result.Rates != nil {
+		source, ratesDate = result.Rates.Source, result.Rates.Date
+		if result.Rates.StaleSince != nil {
+			staleSince = result.Rates.StaleSince.Format(time.RFC3339)
+		}
+	}
+	if result.List != nil {
+		listName, listAction = result.List.Name, result.List.Action
+	}
+	var transaction models.Transaction
+	if result.Transaction != nil {
+		transaction = *result.Transaction
+	}
+	var rules []string
+	if result.Risk != nil {
+		score = strconv.Itoa(result.Risk.Score)
+		decision = result.Risk.Decision
+		for _, rule := range result.Risk.Rules {
+			rules = append(rules, fmt.Sprintf("%s=%d", rule.Name, rule.Weight))
+		}
+	}
+
+	return []string{
+		result.Ip,
+		result.Date.Format("2006-01-02 15:04:05"),
+		result.Country,
+		result.ISO,
+		strings.Join(languages, ";"),
+		strings.Join(currencies, ";"),
+		strings.Join(timezones, ";"),
+		strconv.Itoa(result.Distance.Kms),
+		strconv.FormatFloat(result.Coordinates.Latitude, 'f', -1, 64),
+		strconv.FormatFloat(result.Coordinates.Longitude, 'f', -1, 64),
+		result.Continent,
+		result.ConnectionType,
+		strconv.FormatBool(result.IsEu),
+		score,
+		decision,
+		strings.Join(rules, ";"),
+		listName,
+		listAction,
+		result.Distance.Name,
+		strings.Join(distances, ";"),
+		target,
+		staleSince,
+		source,
+		ratesDate,
+		transaction.Amount,
+		transaction.Currency,
+		transaction.Converted,
+		transaction.AmountUSD,
+	}
+}
+
+// formatKms formats a distance in kms with two decimals.
+func formatKms(kms float64) string {
+	return strconv.FormatFloat(kms, 'f', 2, 64)
+}
+
+// writeCSV writes the header followed by the rows.
+func writeCSV(w io.Writer, header []string, rows ...[]string) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	if err := writer.WriteAll(rows); err != nil {
+		return err
+	}
+	return writer.Error()
+}
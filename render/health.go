@@ -0,0 +1,28 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"service_fraud/models"
+)
+
+// RenderHealth writes the state of the circuit breakers of the external APIs in the console
+// text format.
+func RenderHealth(w io.Writer, report models.HealthReport) error {
+	str := fmt.Sprintf(`
+Estado de los servicios externos: %s`, report.Status)
+
+	for _, upstream := range report.Upstreams {
+		str += fmt.Sprintf("\n	%s: %s", upstream.Name, upstream.State)
+		if upstream.ConsecutiveFailures > 0 {
+			str += fmt.Sprintf(", fallas consecutivas: %d", upstream.ConsecutiveFailures)
+		}
+		if upstream.RetryAt != nil {
+			str += fmt.Sprintf(", proximo intento: %s", upstream.RetryAt.Local().Format("2006-01-02 15:04:05"))
+		}
+	}
+	str += "\n"
+
+	_, err := fmt.Fprint(w, str)
+	return err
+}
@@ -0,0 +1,26 @@
+package render
+
+import (
+	"encoding/json"
+	"io"
+	"service_fraud/models"
+	"service_fraud/utils"
+)
+
+// JSONRenderer renders the results as JSON documents including the schema version.
+type JSONRenderer struct{}
+
+// NewJSONRenderer creates a new JSONRenderer.
+func NewJSONRenderer() *JSONRenderer {
+	return &JSONRenderer{}
+}
+
+// RenderTrace writes the 'traceip' result as a single line JSON document.
+func (j *JSONRenderer) RenderTrace(w io.Writer, result models.TraceResult) error {
+	return json.NewEncoder(w).Encode(traceDocument{SchemaVersion: utils.JSON_SCHEMA_VERSION, TraceResult: result})
+}
+
+// RenderStats writes the 'record' summary as a single line JSON document.
+func (j *JSONRenderer) RenderStats(w io.Writer, summary models.StatsSummary) error {
+	return json.NewEncoder(w).Encode(statsDocument{SchemaVersion: utils.JSON_SCHEMA_VERSION, StatsSummary: summary})
+}
@@ -0,0 +1,52 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"service_fraud/models"
+	"time"
+)
+
+// RenderRates writes the snapshot of the exchange rates, its provider, its age and the rate of
+// each currency in terms of the base currency, in the console text format.
+func RenderRates(w io.Writer, snapshot models.RatesSnapshot) error {
+	str := fmt.Sprintf(`
+Cotizaciones de %s (base %s): %s, hace %s
+	Obtenidas: %s, vencen: %s`,
+		snapshot.Source,
+		snapshot.Base,
+		snapshot.Timestamp.Local().Format("2006-01-02 15:04:05"),
+		time.Since(snapshot.Timestamp).Round(time.Minute),
+		snapshot.FetchedAt.Local().Format("2006-01-02 15:04:05"),
+		snapshot.ExpiresAt.Local().Format("2006-01-02 15:04:05"),
+	)
+	if snapshot.StaleSince != nil {
+		str += fmt.Sprintf("\n	Desactualizadas desde: %s", snapshot.StaleSince.Local().Format("2006-01-02 15:04:05"))
+	}
+
+	for _, code := range snapshot.Codes() {
+		str += fmt.Sprintf("\n	%s: %f", code, snapshot.Rates[code])
+	}
+	str += "\n"
+
+	_, err := fmt.Fprint(w, str)
+	return err
+}
+
+// RenderConversion writes the amount converted by the 'convert' command, the rate used and the
+// rates it was taken from, in the console text format.
+func RenderConversion(w io.Writer, conversion models.Conversion) error {
+	str := fmt.Sprintf(`
+%s %s = %s %s
+	Cotizacion: 1 %s = %s %s`,
+		conversion.Amount, conversion.Currency, conversion.Converted, currencyLabel(conversion.Target),
+		conversion.Currency, conversion.Rate, currencyLabel(conversion.Target),
+	)
+	if conversion.Rates != nil {
+		str += fmt.Sprintf("\n	Cotizaciones: %s", ratesText(*conversion.Rates))
+	}
+	str += "\n"
+
+	_, err := fmt.Fprint(w, str)
+	return err
+}
@@ -0,0 +1,70 @@
+package render
+
+import (
+	"fmt"
+	"service_fraud/interfaces"
+	"service_fraud/models"
+	"service_fraud/utils"
+	"strings"
+)
+
+// New returns the renderer for the given output format.
+func New(format string) (interfaces.Renderer, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case utils.FORMAT_TEXT, "":
+		return NewTextRenderer(), nil
+	case utils.FORMAT_JSON:
+		return NewJSONRenderer(), nil
+	case utils.FORMAT_YAML:
+		return NewYAMLRenderer(), nil
+	case utils.FORMAT_CSV:
+		return NewCSVRenderer(), nil
+	case utils.FORMAT_TABLE:
+		return NewTableRenderer(), nil
+	default:
+		return nil, models.NewOptionInvalidError(utils.ERR_CODE_INVALID_FORMAT, fmt.Sprintf(utils.ERR_MESSAGE_INVALID_FORMAT, format))
+	}
+}
+
+// currencyLabel returns how the target currency of the rates is shown, U$S for dollars.
+func currencyLabel(target string) string {
+	if target == "" || target == utils.CURRENCY_USD {
+		return "U$S"
+	}
+	return target
+}
+
+// ratesText describes the provider and date of the rates of a trace, since when they are stale,
+// if they are, and the day asked for, if they are historical.
+func ratesText(rates models.RatesInfo) string {
+	str := fmt.Sprintf("%s (%s)", rates.Source, rates.Timestamp.Local().Format("2006-01-02 15:04:05"))
+	if rates.StaleSince != nil {
+		str += fmt.Sprintf(", desactualizadas desde %s", rates.StaleSince.Local().Format("2006-01-02 15:04:05"))
+	}
+	if rates.Date != "" {
+		str += fmt.Sprintf(", historicas del %s", rates.Date)
+	}
+	return str
+}
+
+// transactionText describes the amount of the operation and its value in the target currency
+// and, when it is another one, in USD.
+func transactionText(transaction models.Transaction) string {
+	str := fmt.Sprintf("%s %s = %s %s", transaction.Amount, transaction.Currency, transaction.Converted, currencyLabel(transaction.Target))
+	if transaction.Target != "" && transaction.Target != utils.CURRENCY_USD {
+		str += fmt.Sprintf(" (%s %s)", transaction.AmountUSD, currencyLabel(utils.CURRENCY_USD))
+	}
+	return str
+}
+
+// traceDocument is the versioned document written by the JSON and YAML renderers for a trace.
+type traceDocument struct {
+	SchemaVersion      string `json:"schema_version" yaml:"schema_version"`
+	models.TraceResult `yaml:",inline"`
+}
+
+// statsDocument is the versioned document written by the JSON and YAML renderers for the stats.
+type statsDocument struct {
+	SchemaVersion       string `json:"schema_version" yaml:"schema_version"`
+	models.StatsSummary `yaml:",inline"`
+}
@@ -0,0 +1,217 @@
+package render
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"service_fraud/models"
+	"service_fraud/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		format   string
+		expected any
+	}{
+		{"", &TextRenderer{}},
+		{"text", &TextRenderer{}},
+		{"JSON", &JSONRenderer{}},
+		{"yaml", &YAMLRenderer{}},
+		{"csv", &CSVRenderer{}},
+		{"table", &TableRenderer{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			renderer, err := New(tt.format)
+			require.NoError(t, err)
+			assert.IsType(t, tt.expected, renderer)
+		})
+	}
+}
+
+func TestNew_InvalidFormat(t *testing.T) {
+	_, err := New("xml")
+
+	var optionError *models.OptionInvalidError
+	require.ErrorAs(t, err, &optionError)
+	assert.Equal(t, utils.ERR_CODE_INVALID_FORMAT, optionError.Code)
+}
+
+func TestJSONRenderer_RenderTrace(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, NewJSONRenderer().RenderTrace(&buf, newTraceResult()))
+
+	var doc map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &doc))
+	assert.Equal(t, utils.JSON_SCHEMA_VERSION, doc["schema_version"])
+	assert.Equal(t, "1.1.1.1", doc["ip"])
+	assert.Equal(t, "CO", doc["iso_code"])
+
+	var result models.TraceResult
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &result))
+	assert.Equal(t, newTraceResult(), result)
+}
+
+func TestJSONRenderer_RenderStats(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, NewJSONRenderer().RenderStats(&buf, newStatsSummary()))
+
+	var doc map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &doc))
+	assert.Equal(t, utils.JSON_SCHEMA_VERSION, doc["schema_version"])
+	assert.EqualValues(t, 3, doc["total_invokes"])
+}
+
+func TestYAMLRenderer_RenderTrace(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, NewYAMLRenderer().RenderTrace(&buf, newTraceResult()))
+
+	var doc map[string]any
+	require.NoError(t, yaml.Unmarshal(buf.Bytes(), &doc))
+	assert.Equal(t, utils.JSON_SCHEMA_VERSION, doc["schema_version"])
+	assert.Equal(t, "1.1.1.1", doc["ip"])
+	assert.Equal(t, "Colombia", doc["country"])
+}
+
+func TestYAMLRenderer_RenderStats(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, NewYAMLRenderer().RenderStats(&buf, newStatsSummary()))
+
+	var doc map[string]any
+	require.NoError(t, yaml.Unmarshal(buf.Bytes(), &doc))
+	assert.Equal(t, 1553.75, doc["average_distance_kms"])
+}
+
+func TestCSVRenderer_RenderTrace(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, NewCSVRenderer().RenderTrace(&buf, newTraceResult()))
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, TraceCSVHeader, rows[0])
+	assert.Equal(t, []string{"1.1.1.1", "2024-09-01 10:00:00", "Colombia", "CO", "es", "COP=0.000250", "UTC-05:00", "4661", "4.6", "-74.08",
+		"SA", "", "false", "25", "allow", "distance_over_3000_kms=15;currency_not_accepted=10", "", "",
+		"Buenos Aires", "Buenos Aires=4661", "USD", "", "", "", "", "", "", ""}, rows[1])
+}
+
+func TestCSVRenderer_RenderTrace_Transaction(t *testing.T) {
+	result := newTraceResult()
+	result.Transaction = &models.Transaction{Amount: "1500.50", Currency: "ARS", Converted: "1.57", Target: "USD", AmountUSD: "1.57"}
+	var buf bytes.Buffer
+	require.NoError(t, NewCSVRenderer().RenderTrace(&buf, result))
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1500.50", "ARS", "1.57", "1.57"}, rows[1][len(rows[1])-4:])
+}
+
+func TestCSVRenderer_RenderStats(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, NewCSVRenderer().RenderStats(&buf, newStatsSummary()))
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{StatsCSVHeader, {"Argentina", "0.00", "2", "Buenos Aires=0.00", "SA"}, {"Colombia", "4661.25", "1", "Buenos Aires=4661.25", "SA"}}, rows)
+}
+
+func TestTableRenderer_RenderTrace(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, NewTableRenderer().RenderTrace(&buf, newTraceResult()))
+
+	out := buf.String()
+	assert.Contains(t, out, "IP                  1.1.1.1")
+	assert.Contains(t, out, "Distancia Estimada  4661 kms (Buenos Aires)")
+	assert.Contains(t, out, "Riesgo              25/100 (allow)")
+}
+
+func TestTableRenderer_RenderStats(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, NewTableRenderer().RenderStats(&buf, newStatsSummary()))
+
+	out := buf.String()
+	assert.Contains(t, out, "PAIS       DISTANCIA (KMS)  INVOCACIONES")
+	assert.Contains(t, out, "Colombia   4661             1             SA")
+	assert.Contains(t, out, "p90 / p95 / p99      3729.0 / 4195.1 / 4568.0 kms")
+	assert.Contains(t, out, "500 - 5000 kms  1")
+}
+
+func TestRenderHealth(t *testing.T) {
+	var buf bytes.Buffer
+	retryAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	report := models.NewHealthReport(
+		models.UpstreamHealth{Name: utils.METRICS_UPSTREAM_IPAPI, State: utils.CIRCUIT_STATE_OPEN, ConsecutiveFailures: 5, RetryAt: &retryAt},
+		models.UpstreamHealth{Name: utils.METRICS_UPSTREAM_FIXER, State: utils.CIRCUIT_STATE_CLOSED},
+	)
+	require.NoError(t, RenderHealth(&buf, report))
+
+	out := buf.String()
+	assert.Contains(t, out, "Estado de los servicios externos: degraded")
+	assert.Contains(t, out, "ipapi: open, fallas consecutivas: 5, proximo intento: 2024-05-01 12:00:00")
+	assert.Contains(t, out, "fixer: closed\n")
+}
+
+func TestRenderRates(t *testing.T) {
+	var buf bytes.Buffer
+	timestamp := time.Now().Add(-90 * time.Minute)
+	fetchedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	snapshot := models.RatesSnapshot{
+		Source:    "ecb",
+		Base:      "EUR",
+		Timestamp: timestamp,
+		FetchedAt: fetchedAt,
+		ExpiresAt: fetchedAt.Add(30 * time.Minute),
+		Rates:     map[string]float64{"USD": 1.1, "ARS": 1050},
+	}
+	require.NoError(t, RenderRates(&buf, snapshot.Stale()))
+
+	out := buf.String()
+	assert.Contains(t, out, "Cotizaciones de ecb (base EUR): "+timestamp.Format("2006-01-02 15:04:05")+", hace 1h30m0s")
+	assert.Contains(t, out, "Obtenidas: 2024-05-01 12:00:00, vencen: 2024-05-01 12:30:00")
+	assert.Contains(t, out, "Desactualizadas desde: 2024-05-01 12:30:00")
+	assert.Contains(t, out, "ARS: 1050.000000\n\tUSD: 1.100000\n")
+}
+
+func TestRenderConversion(t *testing.T) {
+	var buf bytes.Buffer
+	conversion := models.Conversion{
+		Amount:    "1500.50",
+		Currency:  "ARS",
+		Converted: "1.57",
+		Target:    "USD",
+		Rate:      "0.001048",
+		Rates:     &models.RatesInfo{Source: "ecb", Timestamp: time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)},
+	}
+	require.NoError(t, RenderConversion(&buf, conversion))
+
+	out := buf.String()
+	assert.Contains(t, out, "1500.50 ARS = 1.57 U$S\n")
+	assert.Contains(t, out, "Cotizacion: 1 ARS = 0.001048 U$S")
+	assert.Contains(t, out, "Cotizaciones: ecb (2024-05-01 12:00:00)")
+}
+
+func TestRenderBatchSummary(t *testing.T) {
+	var buf bytes.Buffer
+	summary := models.BatchSummary{
+		Total:          3,
+		Succeeded:      1,
+		Failed:         2,
+		FailuresByCode: map[int]int{110: 1, 102: 1},
+	}
+	require.NoError(t, RenderBatchSummary(&buf, summary))
+
+	out := buf.String()
+	assert.Contains(t, out, "Total: 3")
+	assert.Contains(t, out, "Exitosas: 1")
+	assert.Contains(t, out, "Fallidas: 2")
+	assert.Less(t, strings.Index(out, "Codigo 102: 1"), strings.Index(out, "Codigo 110: 1"))
+}
@@ -0,0 +1,132 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"service_fraud/models"
+	"service_fraud/utils"
+	"strings"
+	"text/tabwriter"
+)
+
+// TableRenderer renders the results as aligned columns.
+type TableRenderer struct{}
+
+// NewTableRenderer creates a new TableRenderer.
+func NewTableRenderer() *TableRenderer {
+	return &TableRenderer{}
+}
+
+// RenderTrace writes the 'traceip' result as a two column table of fields and values.
+func (t *TableRenderer) RenderTrace(w io.Writer, result models.TraceResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	languages := make([]string, 0, len(result.Languages))
+	for _, v := range result.Languages {
+		languages = append(languages, fmt.Sprintf("%s (%s)", v.Name, v.Code))
+	}
+	currencies := make([]string, 0, len(result.Currencies))
+	for _, v := range result.Currencies {
+		currencies = append(currencies, fmt.Sprintf("%s (1 %s = %f %s)", v.Code, v.Code, v.Rate, currencyLabel(v.Target)))
+	}
+	timezones := make([]string, 0, len(result.Timezones))
+	for _, v := range result.Timezones {
+		timezones = append(timezones, fmt.Sprintf("%s (%s)", v.LocalTime, v.Timezone))
+	}
+
+	fmt.Fprintf(tw, "CAMPO\tVALOR\n")
+	fmt.Fprintf(tw, "IP\t%s\n", result.Ip)
+	fmt.Fprintf(tw, "Fecha\t%s\n", result.Date.Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(tw, "País\t%s\n", result.Country)
+	fmt.Fprintf(tw, "ISO Code\t%s\n", result.ISO)
+	if result.List != nil {
+		fmt.Fprintf(tw, "Lista\t%s (%s, %s)\n", result.List.Name, result.List.Action, result.List.Entry)
+	}
+	fmt.Fprintf(tw, "Idiomas\t%s\n", strings.Join(languages, ", "))
+	fmt.Fprintf(tw, "Monedas\t%s\n", strings.Join(currencies, ", "))
+	if result.Rates != nil {
+		fmt.Fprintf(tw, "Cotizaciones\t%s\n", ratesText(*result.Rates))
+	}
+	if result.Transaction != nil {
+		fmt.Fprintf(tw, "Monto\t%s\n", transactionText(*result.Transaction))
+	}
+	fmt.Fprintf(tw, "Hora\t%s\n", strings.Join(timezones, ", "))
+	if result.Distance.Name != "" {
+		fmt.Fprintf(tw, "Distancia Estimada\t%d kms (%s)\n", result.Distance.Kms, result.Distance.Name)
+	} else {
+		fmt.Fprintf(tw, "Distancia Estimada\t%d kms\n", result.Distance.Kms)
+	}
+	if len(result.Distances) > 1 {
+		for _, v := range result.Distances {
+			fmt.Fprintf(tw, "Distancia a %s\t%d kms\n", v.Name, v.Kms)
+		}
+	}
+	fmt.Fprintf(tw, "Coordenadas\t(%f, %f)\n", result.Coordinates.Latitude, result.Coordinates.Longitude)
+	if result.Risk != nil {
+		rules := make([]string, 0, len(result.Risk.Rules))
+		for _, rule := range result.Risk.Rules {
+			rules = append(rules, fmt.Sprintf("%s (%+d)", rule.Name, rule.Weight))
+		}
+		fmt.Fprintf(tw, "Riesgo\t%d/%d (%s)\n", result.Risk.Score, utils.RISK_MAX_SCORE, result.Risk.Decision)
+		fmt.Fprintf(tw, "Reglas\t%s\n", strings.Join(rules, ", "))
+	}
+	return tw.Flush()
+}
+
+// RenderStats writes the 'record' summary as a table with a row per country.
+func (t *TableRenderer) RenderStats(w io.Writer, summary models.StatsSummary) error {
+	if len(summary.Records) == 0 {
+		_, err := fmt.Fprintln(w, utils.NO_RECORD_INFORMATION_AVAILABLE_YET)
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "PAIS\tDISTANCIA (KMS)\tINVOCACIONES\tCONTINENTE\n")
+	for _, stats := range summary.Records {
+		fmt.Fprintf(tw, "%s\t%.0f\t%d\t%s\n", stats.Country, stats.Distance, stats.Invokes, stats.Continent)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw)
+	if summary.Window != nil {
+		fmt.Fprintf(tw, "Desde\t%s\n", summary.Window.From.Local().Format("2006-01-02 15:04:05"))
+		fmt.Fprintf(tw, "Hasta\t%s\n", summary.Window.To.Local().Format("2006-01-02 15:04:05"))
+	}
+	fmt.Fprintf(tw, "Más cercana\t%s (%.0f kms)\n", summary.Closest.Country, summary.Closest.Distance)
+	fmt.Fprintf(tw, "Más lejana\t%s (%.0f kms)\n", summary.Farthest.Country, summary.Farthest.Distance)
+	fmt.Fprintf(tw, "Promedio\t%.1f kms\n", summary.AverageDistance)
+	fmt.Fprintf(tw, "Mediana\t%.1f kms\n", summary.Distribution.Median)
+	fmt.Fprintf(tw, "p90 / p95 / p99\t%.1f / %.1f / %.1f kms\n", summary.Distribution.P90, summary.Distribution.P95, summary.Distribution.P99)
+	fmt.Fprintf(tw, "Desviacion estandar\t%.1f kms\n", summary.Distribution.StdDev)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "\nDISTANCIA\tINVOCACIONES\n")
+	for _, bucket := range summary.Histogram {
+		fmt.Fprintf(tw, "%s\t%d\n", bucketLabel(bucket), bucket.Count)
+	}
+	fmt.Fprintf(tw, "\nCONTINENTE\tINVOCACIONES\n")
+	for _, continent := range summary.Continents {
+		fmt.Fprintf(tw, "%s\t%d\n", continent.Continent, continent.Invokes)
+	}
+	if len(summary.Windows) > 0 {
+		fmt.Fprintf(tw, "\nVENTANA\tINVOCACIONES\tPROMEDIO (KMS)\n")
+		for _, window := range summary.Windows {
+			fmt.Fprintf(tw, "ultimos %s\t%d\t%.1f\n", window.Window, window.TotalInvokes, window.AverageDistance)
+		}
+	}
+	if len(summary.References) > 1 {
+		for _, v := range summary.References {
+			fmt.Fprintf(tw, "\nReferencia\t%s\n", v.Name)
+			fmt.Fprintf(tw, "Más cercana\t%s (%.0f kms)\n", v.Closest.Country, v.Closest.Distance)
+			fmt.Fprintf(tw, "Más lejana\t%s (%.0f kms)\n", v.Farthest.Country, v.Farthest.Distance)
+			fmt.Fprintf(tw, "Promedio\t%.1f kms\n", v.AverageDistance)
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,147 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"service_fraud/models"
+	"service_fraud/utils"
+)
+
+// TextRenderer renders the results as the Spanish text shown in the interactive console.
+type TextRenderer struct{}
+
+// NewTextRenderer creates a new TextRenderer.
+func NewTextRenderer() *TextRenderer {
+	return &TextRenderer{}
+}
+
+// RenderTrace writes the 'traceip' result in the console text format.
+func (t *TextRenderer) RenderTrace(w io.Writer, result models.TraceResult) error {
+	str := fmt.Sprintf(`
+		IP: %s,  fecha actual: %s
+			País: %s
+			ISO Code: %s`,
+		result.Ip, result.Date.Format("2006-01-02 15:04:05"),
+		result.Country,
+		result.ISO,
+	)
+
+	if result.List != nil {
+		str += fmt.Sprintf("\n			Lista: %s (%s, %s)", result.List.Name, result.List.Action, result.List.Entry)
+	}
+
+	for _, v := range result.Languages {
+		str += fmt.Sprintf("\n			Idiomas: %s (%s)", v.Name, v.Code)
+	}
+
+	for _, v := range result.Currencies {
+		str += fmt.Sprintf("\n			Moneda: %s (1 %s = %f %s)", v.Code, v.Code, v.Rate, currencyLabel(v.Target))
+	}
+	if result.Rates != nil {
+		str += fmt.Sprintf("\n			Cotizaciones: %s", ratesText(*result.Rates))
+	}
+	if result.Transaction != nil {
+		str += fmt.Sprintf("\n			Monto: %s", transactionText(*result.Transaction))
+	}
+
+	for _, v := range result.Timezones {
+		str += fmt.Sprintf("\n			Hora: %s (UTC) o %s (%s)", result.Date.UTC().Format("2006-01-02 15:04:05"), v.LocalTime, v.Timezone)
+	}
+
+	str += fmt.Sprintf(`
+			Distancia Estimada: %d kms (%f, %f) a (%f, %f)`,
+		result.Distance.Kms, result.Distance.Reference.Latitude, result.Distance.Reference.Longitude,
+		result.Coordinates.Latitude, result.Coordinates.Longitude)
+	if result.Distance.Name != "" {
+		str += fmt.Sprintf(" desde %s", result.Distance.Name)
+	}
+	if len(result.Distances) > 1 {
+		for _, v := range result.Distances {
+			str += fmt.Sprintf("\n			Distancia a %s: %d kms", v.Name, v.Kms)
+		}
+	}
+	str += "\n	"
+
+	if result.Risk != nil {
+		str += fmt.Sprintf("		Riesgo: %d/%d (%s)", result.Risk.Score, utils.RISK_MAX_SCORE, result.Risk.Decision)
+		for _, rule := range result.Risk.Rules {
+			str += fmt.Sprintf("\n			Regla: %s (%+d)", rule.Name, rule.Weight)
+		}
+		str += "\n"
+	}
+
+	_, err := fmt.Fprint(w, str)
+	return err
+}
+
+// RenderStats writes the 'record' summary in the console text format.
+func (t *TextRenderer) RenderStats(w io.Writer, summary models.StatsSummary) error {
+	if len(summary.Records) == 0 {
+		_, err := fmt.Fprint(w, utils.NO_RECORD_INFORMATION_AVAILABLE_YET)
+		return err
+	}
+
+	reference := utils.BA_REFERENCE_NAME
+	if len(summary.References) == 1 {
+		reference = summary.References[0].Name
+	} else if len(summary.References) > 1 {
+		reference = "la referencia más cercana"
+	}
+	lower := fmt.Sprintf("Distancia más cercana a %s consultada: \n %s con una distancia aproximada de: %.0f kms",
+		reference, summary.Closest.Country, summary.Closest.Distance)
+	higher := fmt.Sprintf("Distancia más lejana a %s consultada: \n %s con una distancia aproximada de: %.0f kms",
+		reference, summary.Farthest.Country, summary.Farthest.Distance)
+
+	average := "==============================\n"
+	for _, stats := range summary.Records {
+		average += fmt.Sprintf(`%s -- %.0f (kms) -- %d invocaciones %s`, stats.Country, stats.Distance, stats.Invokes, "\n")
+	}
+	average += "==============================\n"
+	average += fmt.Sprintf("Distancia promedio entre las peticiones : %.1f (kms)", summary.AverageDistance)
+	average += fmt.Sprintf("\nMediana: %.1f (kms) -- p90: %.1f (kms) -- p95: %.1f (kms) -- p99: %.1f (kms)",
+		summary.Distribution.Median, summary.Distribution.P90, summary.Distribution.P95, summary.Distribution.P99)
+	average += fmt.Sprintf("\nDesviacion estandar: %.1f (kms)", summary.Distribution.StdDev)
+
+	average += "\nHistograma de distancias:"
+	for _, bucket := range summary.Histogram {
+		average += fmt.Sprintf("\n %s -- %d invocaciones", bucketLabel(bucket), bucket.Count)
+	}
+	average += "\nInvocaciones por continente:"
+	for _, continent := range summary.Continents {
+		average += fmt.Sprintf("\n %s -- %d invocaciones", continent.Continent, continent.Invokes)
+	}
+	if len(summary.Windows) > 0 {
+		average += "\nInvocaciones recientes:"
+		for _, window := range summary.Windows {
+			average += fmt.Sprintf("\n ultimos %s -- %d invocaciones -- promedio %.1f (kms)", window.Window, window.TotalInvokes, window.AverageDistance)
+		}
+	}
+
+	if len(summary.References) > 1 {
+		for _, v := range summary.References {
+			average += fmt.Sprintf("\nReferencia %s: más cercana %s (%.0f kms), más lejana %s (%.0f kms), promedio %.1f (kms)",
+				v.Name, v.Closest.Country, v.Closest.Distance, v.Farthest.Country, v.Farthest.Distance, v.AverageDistance)
+		}
+	}
+
+	if summary.Window != nil {
+		lower = windowLabel(*summary.Window) + "\n" + lower
+	}
+
+	_, err := fmt.Fprintln(w, "\n"+lower+"\n"+higher+"\n"+average)
+	return err
+}
+
+// windowLabel describes the time range of the requests of the summary.
+func windowLabel(window models.StatsWindow) string {
+	return fmt.Sprintf("Estadisticas desde %s hasta %s",
+		window.From.Local().Format("2006-01-02 15:04:05"), window.To.Local().Format("2006-01-02 15:04:05"))
+}
+
+// bucketLabel describes the distances counted by the histogram bucket.
+func bucketLabel(bucket models.HistogramBucket) string {
+	if bucket.ToKms == nil {
+		return fmt.Sprintf(">= %.0f kms", bucket.FromKms)
+	}
+	return fmt.Sprintf("%.0f - %.0f kms", bucket.FromKms, *bucket.ToKms)
+}
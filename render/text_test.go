@@ -0,0 +1,229 @@
+package render
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"service_fraud/models"
+	"service_fraud/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTraceResult() models.TraceResult {
+	return models.TraceResult{
+		Ip:      "1.1.1.1",
+		Date:    time.Date(2024, 9, 1, 10, 0, 0, 0, time.UTC),
+		Country: "Colombia",
+		ISO:     "CO",
+		Languages: []models.Language{
+			{Name: "Spanish", Code: "es"},
+		},
+		Currencies: []models.CurrencyRate{
+			{Code: "COP", RateUSD: 0.00025, Rate: 0.00025, Target: "USD"},
+		},
+		Timezones: []models.LocalTime{
+			{Timezone: "UTC-05:00", LocalTime: "2024-09-01 05:00:00"},
+		},
+		Distance: models.Distance{
+			Name:      "Buenos Aires",
+			Kms:       4661,
+			Reference: models.Coordinates{Latitude: -34.61315, Longitude: -58.37723},
+		},
+		Distances: []models.Distance{{
+			Name:      "Buenos Aires",
+			Kms:       4661,
+			Reference: models.Coordinates{Latitude: -34.61315, Longitude: -58.37723},
+		}},
+		Coordinates: models.Coordinates{Latitude: 4.6, Longitude: -74.08},
+		Continent:   "SA",
+		Risk: &models.RiskAssessment{
+			Score:    25,
+			Decision: "allow",
+			Rules: []models.FiredRule{
+				{Name: "distance_over_3000_kms", Type: "distance_over", Weight: 15},
+				{Name: "currency_not_accepted", Type: "currency_mismatch", Weight: 10},
+			},
+		},
+	}
+}
+
+func newStatsSummary() models.StatsSummary {
+	limits := []float64{500, 5000}
+	return models.StatsSummary{
+		Closest:         models.Stats{Country: "Argentina", Continent: "SA", Distance: 0, Invokes: 2},
+		Farthest:        models.Stats{Country: "Colombia", Continent: "SA", Distance: 4661.25, Invokes: 1},
+		AverageDistance: 1553.75,
+		Distribution:    models.DistanceDistribution{Median: 0, P90: 3729, P95: 4195.13, P99: 4568.03, StdDev: 2197.29},
+		Histogram: []models.HistogramBucket{
+			{FromKms: 0, ToKms: &limits[0], Count: 2},
+			{FromKms: 500, ToKms: &limits[1], Count: 1},
+			{FromKms: 5000, Count: 0},
+		},
+		Continents:   []models.ContinentStats{{Continent: "SA", Invokes: 3}},
+		TotalInvokes: 3,
+		Records: []models.Stats{
+			{Country: "Argentina", Continent: "SA", Distance: 0, Invokes: 2, References: []models.ReferenceDistance{{Name: "Buenos Aires", Distance: 0}}},
+			{Country: "Colombia", Continent: "SA", Distance: 4661.25, Invokes: 1, References: []models.ReferenceDistance{{Name: "Buenos Aires", Distance: 4661.25}}},
+		},
+		References: []models.ReferenceStats{{
+			Name:            "Buenos Aires",
+			Closest:         models.Stats{Country: "Argentina", Continent: "SA", Distance: 0, Invokes: 2},
+			Farthest:        models.Stats{Country: "Colombia", Continent: "SA", Distance: 4661.25, Invokes: 1},
+			AverageDistance: 1553.75,
+		}},
+	}
+}
+
+func TestTextRenderer_RenderTrace(t *testing.T) {
+	var buf bytes.Buffer
+	err := NewTextRenderer().RenderTrace(&buf, newTraceResult())
+	require.NoError(t, err)
+
+	out := buf.String()
+	assert.Contains(t, out, "IP: 1.1.1.1,  fecha actual: 2024-09-01 10:00:00")
+	assert.Contains(t, out, "País: Colombia")
+	assert.Contains(t, out, "ISO Code: CO")
+	assert.Contains(t, out, "Idiomas: Spanish (es)")
+	assert.Contains(t, out, "Moneda: COP (1 COP = 0.000250 U$S)")
+	assert.Contains(t, out, "Hora: 2024-09-01 10:00:00 (UTC) o 2024-09-01 05:00:00 (UTC-05:00)")
+	assert.Contains(t, out, "Distancia Estimada: 4661 kms (-34.613150, -58.377230) a (4.600000, -74.080000) desde Buenos Aires")
+	assert.NotContains(t, out, "Distancia a ")
+	assert.Contains(t, out, "Riesgo: 25/100 (allow)")
+	assert.Contains(t, out, "Regla: distance_over_3000_kms (+15)")
+}
+
+func TestTextRenderer_RenderTrace_List(t *testing.T) {
+	result := newTraceResult()
+	result.List = &models.ListMatch{Name: "partners", Type: "cidr", Action: "allow", Entry: "1.1.1.0/24"}
+	var buf bytes.Buffer
+
+	require.NoError(t, NewTextRenderer().RenderTrace(&buf, result))
+
+	assert.Contains(t, buf.String(), "Lista: partners (allow, 1.1.1.0/24)")
+}
+
+func TestTextRenderer_RenderTrace_Currencies(t *testing.T) {
+	result := newTraceResult()
+	result.Currencies = []models.CurrencyRate{
+		{Code: "PAB", RateUSD: 1, Rate: 0.9, Target: "EUR"},
+		{Code: "USD", RateUSD: 1, Rate: 0.9, Target: "EUR"},
+	}
+	var buf bytes.Buffer
+
+	require.NoError(t, NewTextRenderer().RenderTrace(&buf, result))
+
+	out := buf.String()
+	assert.Contains(t, out, "Moneda: PAB (1 PAB = 0.900000 EUR)")
+	assert.Contains(t, out, "Moneda: USD (1 USD = 0.900000 EUR)")
+	assert.Less(t, strings.Index(out, "Moneda: PAB"), strings.Index(out, "Moneda: USD"))
+}
+
+func TestTextRenderer_RenderTrace_StaleRates(t *testing.T) {
+	result := newTraceResult()
+	staleSince := time.Date(2024, 9, 1, 9, 30, 0, 0, time.Local)
+	result.Rates = &models.RatesInfo{Source: "ecb", Timestamp: staleSince.Add(-time.Hour), StaleSince: &staleSince}
+	var buf bytes.Buffer
+
+	require.NoError(t, NewTextRenderer().RenderTrace(&buf, result))
+
+	assert.Contains(t, buf.String(), "Cotizaciones: ecb (2024-09-01 08:30:00), desactualizadas desde 2024-09-01 09:30:00")
+}
+
+func TestTextRenderer_RenderTrace_HistoricalRates(t *testing.T) {
+	result := newTraceResult()
+	result.Rates = &models.RatesInfo{Source: "ecb", Timestamp: time.Date(2024, 8, 30, 0, 0, 0, 0, time.Local), Date: "2024-09-01"}
+	var buf bytes.Buffer
+
+	require.NoError(t, NewTextRenderer().RenderTrace(&buf, result))
+
+	assert.Contains(t, buf.String(), "Cotizaciones: ecb (2024-08-30 00:00:00), historicas del 2024-09-01")
+}
+
+func TestTextRenderer_RenderTrace_Transaction(t *testing.T) {
+	result := newTraceResult()
+	result.Transaction = &models.Transaction{Amount: "1500.50", Currency: "ARS", Converted: "1.48", Target: "EUR", AmountUSD: "1.57"}
+	var buf bytes.Buffer
+
+	require.NoError(t, NewTextRenderer().RenderTrace(&buf, result))
+
+	assert.Contains(t, buf.String(), "Monto: 1500.50 ARS = 1.48 EUR (1.57 U$S)")
+}
+
+func TestTextRenderer_RenderTrace_References(t *testing.T) {
+	result := newTraceResult()
+	result.Distance = models.Distance{Name: "Bogota", Kms: 9, Reference: models.Coordinates{Latitude: 4.6, Longitude: -74.0}}
+	result.Distances = append(result.Distances, result.Distance)
+	var buf bytes.Buffer
+
+	require.NoError(t, NewTextRenderer().RenderTrace(&buf, result))
+
+	out := buf.String()
+	assert.Contains(t, out, "Distancia Estimada: 9 kms (4.600000, -74.000000) a (4.600000, -74.080000) desde Bogota")
+	assert.Contains(t, out, "Distancia a Buenos Aires: 4661 kms")
+	assert.Contains(t, out, "Distancia a Bogota: 9 kms")
+}
+
+func TestTextRenderer_RenderStats(t *testing.T) {
+	var buf bytes.Buffer
+	err := NewTextRenderer().RenderStats(&buf, newStatsSummary())
+	require.NoError(t, err)
+
+	out := buf.String()
+	assert.Contains(t, out, "Distancia más cercana a Buenos Aires consultada: \n Argentina con una distancia aproximada de: 0 kms")
+	assert.Contains(t, out, "Distancia más lejana a Buenos Aires consultada: \n Colombia con una distancia aproximada de: 4661 kms")
+	assert.Contains(t, out, "Colombia -- 4661 (kms) -- 1 invocaciones")
+	assert.Contains(t, out, "Distancia promedio entre las peticiones : 1553.8 (kms)")
+	assert.Contains(t, out, "Mediana: 0.0 (kms) -- p90: 3729.0 (kms) -- p95: 4195.1 (kms) -- p99: 4568.0 (kms)")
+	assert.Contains(t, out, "Desviacion estandar: 2197.3 (kms)")
+	assert.Contains(t, out, " 0 - 500 kms -- 2 invocaciones")
+	assert.Contains(t, out, " 500 - 5000 kms -- 1 invocaciones")
+	assert.Contains(t, out, " >= 5000 kms -- 0 invocaciones")
+	assert.Contains(t, out, " SA -- 3 invocaciones")
+}
+
+func TestTextRenderer_RenderStats_References(t *testing.T) {
+	summary := newStatsSummary()
+	summary.References = append(summary.References, models.ReferenceStats{
+		Name:            "Bogota",
+		Closest:         models.Stats{Country: "Colombia", Distance: 9, Invokes: 1},
+		Farthest:        models.Stats{Country: "Argentina", Distance: 4654, Invokes: 2},
+		AverageDistance: 3105.67,
+	})
+	var buf bytes.Buffer
+
+	require.NoError(t, NewTextRenderer().RenderStats(&buf, summary))
+
+	out := buf.String()
+	assert.Contains(t, out, "Distancia más cercana a la referencia más cercana consultada")
+	assert.Contains(t, out, "Referencia Buenos Aires: más cercana Argentina (0 kms), más lejana Colombia (4661 kms), promedio 1553.8 (kms)")
+	assert.Contains(t, out, "Referencia Bogota: más cercana Colombia (9 kms), más lejana Argentina (4654 kms), promedio 3105.7 (kms)")
+}
+
+func TestTextRenderer_RenderStats_Windows(t *testing.T) {
+	summary := newStatsSummary()
+	summary.Windows = []models.WindowStats{
+		{Window: "5m", TotalInvokes: 1, AverageDistance: 4661.25},
+		{Window: "1h", TotalInvokes: 3, AverageDistance: 1553.75},
+	}
+	from := time.Date(2024, 9, 1, 9, 0, 0, 0, time.Local)
+	summary.Window = &models.StatsWindow{From: from, To: from.Add(time.Hour)}
+	var buf bytes.Buffer
+
+	require.NoError(t, NewTextRenderer().RenderStats(&buf, summary))
+
+	out := buf.String()
+	assert.Contains(t, out, "Estadisticas desde 2024-09-01 09:00:00 hasta 2024-09-01 10:00:00\nDistancia más cercana")
+	assert.Contains(t, out, "Invocaciones recientes:\n ultimos 5m -- 1 invocaciones -- promedio 4661.2 (kms)\n ultimos 1h -- 3 invocaciones -- promedio 1553.8 (kms)")
+}
+
+func TestTextRenderer_RenderStats_NoRecords(t *testing.T) {
+	var buf bytes.Buffer
+	err := NewTextRenderer().RenderStats(&buf, models.StatsSummary{})
+	require.NoError(t, err)
+
+	assert.Equal(t, utils.NO_RECORD_INFORMATION_AVAILABLE_YET, buf.String())
+}
@@ -0,0 +1,37 @@
+package render
+
+import (
+	"io"
+	"service_fraud/models"
+	"service_fraud/utils"
+
+	"gopkg.in/yaml.v3"
+)
+
+// YAMLRenderer renders the results as YAML documents including the schema version.
+type YAMLRenderer struct{}
+
+// NewYAMLRenderer creates a new YAMLRenderer.
+func NewYAMLRenderer() *YAMLRenderer {
+	return &YAMLRenderer{}
+}
+
+// RenderTrace writes the 'traceip' result as a YAML document.
+func (y *YAMLRenderer) RenderTrace(w io.Writer, result models.TraceResult) error {
+	return encodeYAML(w, traceDocument{SchemaVersion: utils.JSON_SCHEMA_VERSION, TraceResult: result})
+}
+
+// RenderStats writes the 'record' summary as a YAML document.
+func (y *YAMLRenderer) RenderStats(w io.Writer, summary models.StatsSummary) error {
+	return encodeYAML(w, statsDocument{SchemaVersion: utils.JSON_SCHEMA_VERSION, StatsSummary: summary})
+}
+
+// encodeYAML writes the value as a YAML document.
+func encodeYAML(w io.Writer, value any) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(value); err != nil {
+		return err
+	}
+	return enc.Close()
+}
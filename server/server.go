@@ -0,0 +1,173 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"service_fraud/interfaces"
+	"service_fraud/models"
+	"service_fraud/render"
+	"service_fraud/services"
+	"service_fraud/utils"
+	"time"
+)
+
+// Server exposes the 'traceip' and 'record' flows as an HTTP JSON API.
+type Server struct {
+	information interfaces.GetInformation
+	renderer    interfaces.Renderer
+	mux         *http.ServeMux
+	metrics     *services.Metrics
+}
+
+// ErrorResponse is the JSON body returned when a request fails.
+type ErrorResponse struct {
+	Code     int    `json:"code"`
+	Message  string `json:"message"`
+	Category string `json:"category,omitempty"`
+}
+
+// NewServer creates a new Server backed by the given information service.
+func NewServer(information interfaces.GetInformation) *Server {
+	s := &Server{
+		information: information,
+		renderer:    render.NewJSONRenderer(),
+		mux:         http.NewServeMux(),
+		metrics:     services.DefaultMetrics(),
+	}
+	s.mux.HandleFunc("GET /v1/trace/{ip}", s.handleTrace)
+	s.mux.HandleFunc("GET /v1/stats", s.handleStats)
+	s.mux.HandleFunc("GET /metrics", s.handleMetrics)
+	s.mux.HandleFunc("GET /health", s.handleHealth)
+	return s
+}
+
+// SetMetrics sets the metrics exposed on /metrics, the ones shared by the services by default.
+func (s *Server) SetMetrics(metrics *services.Metrics) {
+	s.metrics = metrics
+}
+
+// ServeHTTP dispatches the request to the registered handlers.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// ListenAndServe starts listening for HTTP requests on the given address.
+func (s *Server) ListenAndServe(addr string) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	slog.Info(utils.LOG_MESSAGE_SERVER_LISTENING, "addr", addr)
+	return srv.ListenAndServe()
+}
+
+// handleTrace retrieves the information of the IP given in the path, converting the currencies
+// with the historical rates of the day given by the 'at' query parameter, if any, and the amount
+// of the operation given by the 'amount' and 'currency' ones.
+func (s *Server) handleTrace(w http.ResponseWriter, r *http.Request) {
+	ip, ok := utils.CanonicalIp(r.PathValue("ip"))
+	if !ok {
+		writeError(w, models.NewOptionInvalidError(utils.ERR_CODE_INVALID_IP, fmt.Sprintf(utils.ERR_MESSAGE_INVALID_IP, r.PathValue("ip"))))
+		return
+	}
+	// The trace is canceled when the client disconnects.
+	ctx, err := services.WithRatesDateValue(r.Context(), r.URL.Query().Get("at"))
+	if err == nil {
+		ctx, err = services.WithTransactionValue(ctx, r.URL.Query().Get("amount"), r.URL.Query().Get("currency"))
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	since := time.Now()
+	result, err := s.information.GetAllProducts(ctx, ip)
+	slog.Info(utils.LOG_MESSAGE_ELAPSED_TIME, "path", r.URL.Path, "elapsed_seconds", time.Since(since).Seconds())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := s.renderer.RenderTrace(w, result); err != nil {
+		slog.Error(utils.ERR_MESSAGE_ENCODE_RESPONSE, "error", err)
+	}
+}
+
+// handleStats returns the statistics recorded so far or, with the 'since' or 'from' and 'to'
+// query parameters, the ones of a time range.
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	summary, err := services.GetStatsRange(s.information.GetStatsService(), query.Get("since"), query.Get("from"), query.Get("to"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := s.renderer.RenderStats(w, summary); err != nil {
+		slog.Error(utils.ERR_MESSAGE_ENCODE_RESPONSE, "error", err)
+	}
+}
+
+// handleMetrics writes the metrics of the services in the Prometheus text format.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", utils.METRICS_CONTENT_TYPE)
+	if err := s.metrics.WriteText(w); err != nil {
+		slog.Error(utils.ERR_MESSAGE_WRITE_METRICS, "error", err)
+	}
+}
+
+// handleHealth returns the state of the circuit breakers of the external APIs, with the 503
+// status while any of them is not closed.
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	report := s.information.GetHealth()
+	status := http.StatusOK
+	if !report.Healthy() {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
+
+// writeJSON encodes the value as the JSON body of the response.
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		slog.Error(utils.ERR_MESSAGE_ENCODE_RESPONSE, "error", err)
+	}
+}
+
+// writeError writes the error as JSON with the HTTP status derived from its code.
+func writeError(w http.ResponseWriter, err error) {
+	code, message := models.ErrorDetails(err)
+	response := ErrorResponse{Code: code, Message: message}
+	nonRoutableError := &models.NonRoutableIpError{}
+	if errors.As(err, &nonRoutableError) {
+		response.Category = nonRoutableError.Category
+	}
+	writeJSON(w, StatusFromCode(code), response)
+}
+
+// StatusFromCode maps an application error code to an HTTP status code.
+func StatusFromCode(code int) int {
+	switch code {
+	case utils.ERR_CODE_INVALID_OPTION, utils.ERR_CODE_INVALID_IP, utils.ERR_CODE_INVALID_FORMAT, utils.ERR_CODE_INVALID_RANGE,
+		utils.ERR_CODE_INVALID_DATE, utils.ERR_CODE_INVALID_AMOUNT, utils.ERR_CODE_CURRENCY_RATE:
+		return http.StatusBadRequest
+	case utils.ERR_CODE_IP_RESP_EMPTY, utils.ERR_CODE_RATES_HISTORY:
+		return http.StatusNotFound
+	case utils.ERR_CODE_NON_ROUTABLE_IP:
+		return http.StatusUnprocessableEntity
+	case utils.ERR_CODE_LIMIT_REACHED, utils.ERR_CODE_RATE_LIMITED:
+		return http.StatusTooManyRequests
+	case utils.ERR_CODE_IP_SERVICE, utils.ERR_CODE_COUNTRY_SERVICE, utils.ERR_CODE_CURRENCY_SERVICE, utils.ERR_CODE_INVALID_API_KEY:
+		return http.StatusBadGateway
+	case utils.ERR_CODE_TRACE_TIMEOUT:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,354 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"service_fraud/models"
+	"service_fraud/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSecrets struct{}
+
+func (f fakeSecrets) GetSecret(ctx context.Context, name string) (*string, error) {
+	key := "dummyKey"
+	return &key, nil
+}
+
+const ipApiBody = `{
+	"ip": "1.1.1.1",
+	"continent_code": "SA",
+	"country_code": "CO",
+	"country_name": "Colombia",
+	"region_name": "Bogota",
+	"latitude": 4.6,
+	"longitude": -74.08,
+	"location": {"languages": [{"code": "es", "name": "Spanish"}]}
+}`
+
+const countryApiBody = `[{
+	"cca2": "CO",
+	"currencies": {"COP": {"name": "Colombian peso", "symbol": "$"}},
+	"timezones": ["UTC-05:00"]
+}]`
+
+const currencyApiBody = `{
+	"success": true,
+	"base": "EUR",
+	"rates": {"USD": 1.1, "COP": 4400}
+}`
+
+// newFakeUpstreams starts fake ipapi, restcountries and fixer servers.
+func newFakeUpstreams(t *testing.T, ipStatus int) services.Endpoints {
+	ipApi := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(ipStatus)
+		w.Write([]byte(ipApiBody))
+	}))
+	countryApi := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(countryApiBody))
+	}))
+	currencyApi := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(currencyApiBody))
+	}))
+	t.Cleanup(ipApi.Close)
+	t.Cleanup(countryApi.Close)
+	t.Cleanup(currencyApi.Close)
+
+	return services.Endpoints{
+		IpApiURL:           ipApi.URL + "/api/%s?access_key=%s",
+		CountryApiURL:      countryApi.URL + "/v3.1/name/%s",
+		CurrencyApiURL:     currencyApi.URL + "/api/latest?access_key=%s",
+		CurrencyHistoryURL: currencyApi.URL + "/api/%s?access_key=%s",
+	}
+}
+
+func newTestServer(t *testing.T, ipStatus int) *httptest.Server {
+	information := services.NewInformationService(fakeSecrets{},
+		services.NewRequestDataStore[string, models.IpApiResponse](),
+		services.NewRequestDataStore[string, models.CountryResponse]())
+	information.SetEndpoints(newFakeUpstreams(t, ipStatus))
+
+	srv := httptest.NewServer(NewServer(information))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestServer_Trace(t *testing.T) {
+	srv := newTestServer(t, http.StatusOK)
+
+	resp, err := http.Get(srv.URL + "/v1/trace/1.1.1.1")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	var body models.TraceResult
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, "1.1.1.1", body.Ip)
+	assert.Equal(t, "Colombia", body.Country)
+	assert.Equal(t, "CO", body.ISO)
+	require.Len(t, body.Currencies, 1)
+	assert.Equal(t, "COP", body.Currencies[0].Code)
+	require.NotNil(t, body.Risk)
+	assert.Equal(t, "allow", body.Risk.Decision)
+	assert.Equal(t, 25, body.Risk.Score)
+}
+
+func TestServer_Trace_IPv6(t *testing.T) {
+	srv := newTestServer(t, http.StatusOK)
+
+	resp, err := http.Get(srv.URL + "/v1/trace/2800:810:400::1")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestServer_Trace_InvalidIp(t *testing.T) {
+	srv := newTestServer(t, http.StatusOK)
+
+	resp, err := http.Get(srv.URL + "/v1/trace/invalid_ip")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	var body ErrorResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, 102, body.Code)
+}
+
+func TestServer_Trace_HistoricalRates(t *testing.T) {
+	srv := newTestServer(t, http.StatusOK)
+
+	resp, err := http.Get(srv.URL + "/v1/trace/1.1.1.1?at=2024-04-20")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var body models.TraceResult
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.NotNil(t, body.Rates)
+	assert.Equal(t, "2024-04-20", body.Rates.Date)
+
+	resp, err = http.Get(srv.URL + "/v1/trace/1.1.1.1?at=yesterday")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	var errorBody ErrorResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&errorBody))
+	assert.Equal(t, 116, errorBody.Code)
+}
+
+func TestServer_Trace_Transaction(t *testing.T) {
+	srv := newTestServer(t, http.StatusOK)
+
+	resp, err := http.Get(srv.URL + "/v1/trace/1.1.1.1?amount=440000&currency=cop")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var body models.TraceResult
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.NotNil(t, body.Transaction)
+	assert.Equal(t, models.Transaction{Amount: "440000.00", Currency: "COP", Converted: "110.00", Target: "USD", AmountUSD: "110.00"}, *body.Transaction)
+
+	for query, code := range map[string]int{"amount=-5": 118, "amount=10&currency=XXX": 119} {
+		resp, err = http.Get(srv.URL + "/v1/trace/1.1.1.1?" + query)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+		var errorBody ErrorResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&errorBody))
+		assert.Equal(t, code, errorBody.Code, query)
+	}
+}
+
+func TestServer_Trace_NonRoutableIp(t *testing.T) {
+	srv := newTestServer(t, http.StatusOK)
+
+	resp, err := http.Get(srv.URL + "/v1/trace/192.168.0.10")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	var body ErrorResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, 110, body.Code)
+	assert.Equal(t, "private", body.Category)
+}
+
+func TestServer_Trace_UpstreamError(t *testing.T) {
+	srv := newTestServer(t, http.StatusInternalServerError)
+
+	resp, err := http.Get(srv.URL + "/v1/trace/1.1.1.1")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+
+	var body ErrorResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, 103, body.Code)
+}
+
+func TestServer_Stats(t *testing.T) {
+	srv := newTestServer(t, http.StatusOK)
+
+	resp, err := http.Get(srv.URL + "/v1/trace/1.1.1.1")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Eventually(t, func() bool {
+		resp, err := http.Get(srv.URL + "/v1/stats")
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+
+		var body models.StatsSummary
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			return false
+		}
+		for _, record := range body.Records {
+			if strings.EqualFold(record.Country, "Bogota") {
+				return true
+			}
+		}
+		return false
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestServer_Stats_Range(t *testing.T) {
+	srv := newTestServer(t, http.StatusOK)
+
+	resp, err := http.Get(srv.URL + "/v1/stats?since=1h")
+	require.NoError(t, err)
+	var body models.StatsSummary
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NotNil(t, body.Window)
+	assert.Equal(t, time.Hour, body.Window.To.Sub(body.Window.From))
+
+	resp, err = http.Get(srv.URL + "/v1/stats?since=yesterday")
+	require.NoError(t, err)
+	var errBody ErrorResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&errBody))
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, 111, errBody.Code)
+}
+
+func TestServer_Metrics(t *testing.T) {
+	metrics := services.NewMetrics()
+	information := services.NewInformationService(fakeSecrets{},
+		services.NewRequestDataStore[string, models.IpApiResponse](),
+		services.NewRequestDataStore[string, models.CountryResponse]())
+	information.SetEndpoints(newFakeUpstreams(t, http.StatusOK))
+	information.SetMetrics(metrics)
+	handler := NewServer(information)
+	handler.SetMetrics(metrics)
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	resp, err := http.Get(srv.URL + "/v1/trace/1.1.1.1")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	resp, err = http.Get(srv.URL + "/metrics")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", resp.Header.Get("Content-Type"))
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	for _, line := range []string{
+		"# TYPE service_fraud_traces_total counter",
+		`service_fraud_traces_total{code="ok"} 1`,
+		`service_fraud_trace_decisions_total{decision="allow"} 1`,
+		`service_fraud_upstream_requests_total{upstream="ipapi",status="200"} 1`,
+		`service_fraud_upstream_request_duration_seconds_count{upstream="fixer"} 1`,
+		`service_fraud_trace_duration_seconds_bucket{code="ok",le="+Inf"} 1`,
+	} {
+		assert.Contains(t, string(body), line+"\n")
+	}
+}
+
+func TestServer_Health(t *testing.T) {
+	information := services.NewInformationService(fakeSecrets{},
+		services.NewRequestDataStore[string, models.IpApiResponse](),
+		services.NewRequestDataStore[string, models.CountryResponse]())
+	information.SetEndpoints(newFakeUpstreams(t, http.StatusInternalServerError))
+	information.SetUpstreams(services.NewUpstreams(services.RetryPolicy{MaxAttempts: 1},
+		services.BreakerPolicy{FailureThreshold: 1, OpenDuration: time.Minute}))
+	srv := httptest.NewServer(NewServer(information))
+	t.Cleanup(srv.Close)
+
+	getHealth := func() (int, models.HealthReport) {
+		resp, err := http.Get(srv.URL + "/health")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var report models.HealthReport
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+		return resp.StatusCode, report
+	}
+
+	status, report := getHealth()
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "ok", report.Status)
+
+	resp, err := http.Get(srv.URL + "/v1/trace/1.1.1.1")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	status, report = getHealth()
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, "degraded", report.Status)
+	require.NotEmpty(t, report.Upstreams)
+	assert.Equal(t, "ipapi", report.Upstreams[0].Name)
+	assert.Equal(t, "open", report.Upstreams[0].State)
+	assert.NotNil(t, report.Upstreams[0].RetryAt)
+}
+
+func TestStatusFromCode(t *testing.T) {
+	tests := []struct {
+		code     int
+		expected int
+	}{
+		{101, http.StatusBadRequest},
+		{102, http.StatusBadRequest},
+		{103, http.StatusBadGateway},
+		{104, http.StatusBadGateway},
+		{105, http.StatusBadGateway},
+		{106, http.StatusInternalServerError},
+		{107, http.StatusNotFound},
+		{108, http.StatusTooManyRequests},
+		{114, http.StatusBadGateway},
+		{115, http.StatusTooManyRequests},
+		{109, http.StatusBadRequest},
+		{110, http.StatusUnprocessableEntity},
+		{111, http.StatusBadRequest},
+		{112, http.StatusGatewayTimeout},
+		{118, http.StatusBadRequest},
+		{119, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, StatusFromCode(tt.code))
+	}
+}
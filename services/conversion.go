@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"service_fraud/models"
+	"service_fraud/utils"
+)
+
+// transactionKey is the key of the amount of the operation in the context of a trace.
+type transactionKey struct{}
+
+// WithTransaction returns a copy of the context whose traces convert the amount of the operation
+// and evaluate the amount risk rules with it. An amount without currency is in the target
+// currency of the traces.
+func WithTransaction(ctx context.Context, money models.Money) context.Context {
+	return context.WithValue(ctx, transactionKey{}, money)
+}
+
+// TransactionMoney returns the amount of the operation the traces of the context convert, if any.
+func TransactionMoney(ctx context.Context) (models.Money, bool) {
+	money, ok := ctx.Value(transactionKey{}).(models.Money)
+	return money, ok
+}
+
+// WithTransactionValue parses the amount of the operation, a decimal like 1500.50, and its
+// currency and returns a copy of the context whose traces convert it, or the same context when
+// both are empty. Without currency the amount is in the target currency of the traces.
+func WithTransactionValue(ctx context.Context, amount, currency string) (context.Context, error) {
+	if amount == "" && currency == "" {
+		return ctx, nil
+	}
+	code := currency
+	if code == "" {
+		code = utils.CURRENCY_USD
+	}
+	money, err := models.ParseMoney(amount, code)
+	if err != nil {
+		return ctx, models.NewOptionInvalidError(utils.ERR_CODE_INVALID_AMOUNT, fmt.Sprintf(utils.ERR_USER_MESSAGE_INVALID_AMOUNT, err))
+	}
+	if currency == "" {
+		money.Currency = ""
+	}
+	return WithTransaction(ctx, money), nil
+}
+
+// Convert converts the amount to the target currency, the one of the traces when it is empty,
+// with the rates the traces would use: the historical ones of the day carried by the context,
+// if any, or the current ones.
+func (s *InformationService) Convert(ctx context.Context, money models.Money, target string) (models.Conversion, error) {
+	if target == "" {
+		target = s.target()
+	}
+	snapshot, err := s.lookupRates(ctx)
+	if err != nil {
+		return models.Conversion{}, err
+	}
+	conversion, err := models.NewConversion(money, target, snapshot)
+	if err != nil {
+		return models.Conversion{}, models.NewOptionInvalidError(utils.ERR_CODE_CURRENCY_RATE, fmt.Sprintf(utils.ERR_USER_MESSAGE_CURRENCY_RATE, err))
+	}
+	return conversion, nil
+}
+
+// newTransaction converts the amount of the operation carried by the context, if any, to the
+// target currency of the traces and to USD.
+func (s *InformationService) newTransaction(ctx context.Context, rates models.CurrencyResponse) (*models.Transaction, error) {
+	money, ok := TransactionMoney(ctx)
+	if !ok {
+		return nil, nil
+	}
+	if money.Currency == "" {
+		money.Currency = s.target()
+	}
+	transaction, err := models.NewTransaction(money, s.target(), rates)
+	if err != nil {
+		return nil, models.NewOptionInvalidError(utils.ERR_CODE_CURRENCY_RATE, fmt.Sprintf(utils.ERR_USER_MESSAGE_CURRENCY_RATE, err))
+	}
+	return transaction, nil
+}
+
+// target returns the currency the traces are converted to, USD when none is set.
+func (s *InformationService) target() string {
+	if s.targetCurrency == "" {
+		return utils.CURRENCY_DEFAULT_TARGET
+	}
+	return s.targetCurrency
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"service_fraud/models"
+	"service_fraud/utils"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithTransactionValue(t *testing.T) {
+	ctx, err := WithTransactionValue(context.Background(), "", "")
+	require.NoError(t, err)
+	_, ok := TransactionMoney(ctx)
+	assert.False(t, ok)
+
+	ctx, err = WithTransactionValue(context.Background(), "1500.50", "ars")
+	require.NoError(t, err)
+	money, ok := TransactionMoney(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "1500.50 ARS", money.String())
+
+	// Without currency the amount is in the target currency of the traces.
+	ctx, err = WithTransactionValue(context.Background(), "10", "")
+	require.NoError(t, err)
+	money, _ = TransactionMoney(ctx)
+	assert.Empty(t, money.Currency)
+
+	for _, value := range [][2]string{{"", "ARS"}, {"0", "ARS"}, {"1500,50", "ARS"}, {"10", "pesos"}} {
+		_, err = WithTransactionValue(context.Background(), value[0], value[1])
+		var optionError *models.OptionInvalidError
+		require.ErrorAs(t, err, &optionError, value)
+		assert.Equal(t, utils.ERR_CODE_INVALID_AMOUNT, optionError.Code)
+	}
+}
+
+func TestGetAllProducts_Transaction(t *testing.T) {
+	service, _ := newTestInformationService(t)
+	service.SetRiskEvaluator(NewRiskService(models.DefaultRiskPolicy()))
+	ctx, err := WithTransactionValue(context.Background(), "5775000", "ARS")
+	require.NoError(t, err)
+
+	result, err := service.GetAllProducts(ctx, "2800:810:400::1")
+
+	require.NoError(t, err)
+	require.NotNil(t, result.Transaction)
+	assert.Equal(t, "5775000.00", result.Transaction.Amount)
+	assert.Equal(t, "6050.00", result.Transaction.Converted)
+	assert.Equal(t, utils.CURRENCY_USD, result.Transaction.Target)
+	assert.Equal(t, "6050.00", result.Transaction.AmountUSD)
+	require.NotNil(t, result.Risk)
+	assert.Equal(t, "amount_over_5000_usd", result.Risk.Rules[0].Name)
+
+	// The amounts without currency are in the target currency.
+	service.SetTargetCurrency("ARS")
+	ctx, err = WithTransactionValue(context.Background(), "1050", "")
+	require.NoError(t, err)
+	result, err = service.GetAllProducts(ctx, "2800:810:400::1")
+	require.NoError(t, err)
+	assert.Equal(t, "ARS", result.Transaction.Currency)
+	assert.Equal(t, "1050.00", result.Transaction.Converted)
+	assert.Equal(t, "1.10", result.Transaction.AmountUSD)
+
+	ctx, err = WithTransactionValue(context.Background(), "10", "BRL")
+	require.NoError(t, err)
+	_, err = service.GetAllProducts(ctx, "2800:810:400::1")
+	var optionError *models.OptionInvalidError
+	require.ErrorAs(t, err, &optionError)
+	assert.Equal(t, utils.ERR_CODE_CURRENCY_RATE, optionError.Code)
+}
+
+func TestInformationService_Convert(t *testing.T) {
+	service, _ := newTestInformationService(t)
+	money, err := models.ParseMoney("1500.50", "ARS")
+	require.NoError(t, err)
+
+	conversion, err := service.Convert(context.Background(), money, "")
+
+	require.NoError(t, err)
+	assert.Equal(t, "1.57", conversion.Converted)
+	assert.Equal(t, utils.CURRENCY_USD, conversion.Target)
+	assert.Equal(t, "0.001048", conversion.Rate)
+	require.NotNil(t, conversion.Rates)
+	assert.Equal(t, utils.RATES_PROVIDER_FIXER, conversion.Rates.Source)
+
+	conversion, err = service.Convert(context.Background(), money, "EUR")
+	require.NoError(t, err)
+	assert.Equal(t, "1.43", conversion.Converted)
+
+	// The historical rates of the day carried by the context are used.
+	ctx := WithRatesDate(context.Background(), time.Date(2024, 4, 20, 0, 0, 0, 0, time.UTC))
+	conversion, err = service.Convert(ctx, money, "")
+	require.NoError(t, err)
+	assert.Equal(t, "1.83", conversion.Converted)
+	assert.Equal(t, "2024-04-20", conversion.Rates.Date)
+
+	_, err = service.Convert(context.Background(), money, "BRL")
+	var optionError *models.OptionInvalidError
+	require.ErrorAs(t, err, &optionError)
+	assert.Equal(t, utils.ERR_CODE_CURRENCY_RATE, optionError.Code)
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"service_fraud/models"
+	"service_fraud/utils"
+	"sort"
+	"strings"
+)
+
+// embeddedCountries is the snapshot of the restcountries v3.1 dataset shipped with the binary.
+//
+//go:embed data/countries.json
+var embeddedCountries []byte
+
+// errEmptyCountrySnapshot is returned when a snapshot does not contain any country.
+var errEmptyCountrySnapshot = errors.New("the country snapshot does not contain any country")
+
+// CountrySnapshot answers the country lookups from a local copy of the restcountries v3.1
+// dataset, so the traces keep working when restcountries.com is not reachable.
+type CountrySnapshot struct {
+	countries models.ArrayResponse
+	index     map[string]int
+}
+
+// countrySnapshotEntry holds the fields of a restcountries v3.1 country kept in the snapshot.
+type countrySnapshotEntry struct {
+	Name         countrySnapshotName        `json:"name"`
+	Cca2         string                     `json:"cca2"`
+	Cca3         string                     `json:"cca3,omitempty"`
+	Ccn3         string                     `json:"ccn3,omitempty"`
+	Currencies   map[string]models.Currency `json:"currencies,omitempty"`
+	Capital      []string                   `json:"capital,omitempty"`
+	AltSpellings []string                   `json:"altSpellings,omitempty"`
+	Region       string                     `json:"region,omitempty"`
+	Subregion    string                     `json:"subregion,omitempty"`
+	Latlng       []float64                  `json:"latlng,omitempty"`
+	Timezones    []string                   `json:"timezones,omitempty"`
+	Continents   []string                   `json:"continents,omitempty"`
+	Flag         string                     `json:"flag,omitempty"`
+}
+
+// countrySnapshotName holds the names of a country kept in the snapshot.
+type countrySnapshotName struct {
+	Common   string `json:"common"`
+	Official string `json:"official"`
+}
+
+// NewEmbeddedCountrySnapshot creates a CountrySnapshot from the snapshot embedded in the binary.
+func NewEmbeddedCountrySnapshot() (*CountrySnapshot, error) {
+	return NewCountrySnapshot(embeddedCountries)
+}
+
+// LoadCountrySnapshot creates a CountrySnapshot from the snapshot stored in the given path.
+func LoadCountrySnapshot(path string) (*CountrySnapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewCountrySnapshot(data)
+}
+
+// NewCountrySnapshot creates a CountrySnapshot from a JSON array of restcountries v3.1 countries.
+func NewCountrySnapshot(data []byte) (*CountrySnapshot, error) {
+	var countries models.ArrayResponse
+	if err := json.Unmarshal(data, &countries); err != nil {
+		return nil, err
+	}
+	if len(countries) == 0 {
+		return nil, errEmptyCountrySnapshot
+	}
+
+	// The names and codes take precedence over the alternative spellings, which may be shared.
+	snapshot := &CountrySnapshot{countries: countries, index: make(map[string]int)}
+	for i, country := range countries {
+		for _, key := range []string{country.Name.Common, country.Name.Official, country.Cca2, country.Cca3} {
+			snapshot.addKey(key, i)
+		}
+	}
+	for i, country := range countries {
+		for _, key := range country.AltSpellings {
+			snapshot.addKey(key, i)
+		}
+	}
+	return snapshot, nil
+}
+
+// addKey indexes the country under the given name unless the name is already taken.
+func (c *CountrySnapshot) addKey(key string, i int) {
+	key = strings.ToLower(strings.TrimSpace(key))
+	if _, ok := c.index[key]; key != "" && !ok {
+		c.index[key] = i
+	}
+}
+
+// Len returns the number of countries in the snapshot.
+func (c *CountrySnapshot) Len() int {
+	return len(c.countries)
+}
+
+// GetCountryInformation returns the country whose name, alternative spelling or ISO code
+// matches the given one, ignoring the case.
+func (c *CountrySnapshot) GetCountryInformation(ctx context.Context, country string) models.CountryResponse {
+	countryresp := models.CountryResponse{}
+	i, ok := c.index[strings.ToLower(strings.TrimSpace(country))]
+	if !ok {
+		utils.Logger(ctx).Warn(utils.ERR_MESSAGE_COUNTRY_SNAPSHOT_MISS, "country", country)
+		countryresp.Error = *models.NewCountryApiError(utils.ERR_CODE_COUNTRY_SERVICE, utils.ERR_USER_MESSAGE_COUNTRY_SERVICE)
+		return countryresp
+	}
+	countryresp.ArrayResponse = models.ArrayResponse{c.countries[i]}
+	return countryresp
+}
+
+// RefreshCountrySnapshot reads a restcountries v3.1 dataset, for example the one downloaded
+// from https://restcountries.com/v3.1/all, and writes the snapshot with the fields used by
+// the application, sorted by country code. It returns the number of countries written.
+func RefreshCountrySnapshot(in io.Reader, out io.Writer) (int, error) {
+	var countries []countrySnapshotEntry
+	if err := json.NewDecoder(in).Decode(&countries); err != nil {
+		return 0, err
+	}
+	if len(countries) == 0 {
+		return 0, errEmptyCountrySnapshot
+	}
+	for _, country := range countries {
+		if country.Cca2 == "" || country.Name.Common == "" {
+			return 0, fmt.Errorf("the country %q does not have a name or code", country.Name.Common+country.Cca2)
+		}
+	}
+	sort.Slice(countries, func(i, j int) bool {
+		return countries[i].Cca2 < countries[j].Cca2
+	})
+
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return len(countries), enc.Encode(countries)
+}
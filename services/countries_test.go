@@ -0,0 +1,104 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddedCountrySnapshot(t *testing.T) {
+	snapshot, err := NewEmbeddedCountrySnapshot()
+	require.NoError(t, err)
+	assert.Greater(t, snapshot.Len(), 200)
+
+	tests := []struct {
+		country  string
+		cca2     string
+		currency string
+	}{
+		{"Colombia", "CO", "COP"},
+		{"argentina", "AR", "ARS"},
+		{"United States", "US", "USD"},
+		{"United States of America", "US", "USD"},
+		{"Russian Federation", "RU", "RUB"},
+		{"DE", "DE", "EUR"},
+		{"BRA", "BR", "BRL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.country, func(t *testing.T) {
+			countryResponse := snapshot.GetCountryInformation(context.Background(), tt.country)
+
+			require.False(t, countryResponse.HasError())
+			require.Len(t, countryResponse.ArrayResponse, 1)
+			assert.Equal(t, tt.cca2, countryResponse.ArrayResponse[0].Cca2)
+			assert.Contains(t, countryResponse.ArrayResponse[0].Currencies, tt.currency)
+			assert.NotEmpty(t, countryResponse.ArrayResponse[0].Timezones)
+		})
+	}
+
+	countryResponse := snapshot.GetCountryInformation(context.Background(), "Atlantis")
+	assert.True(t, countryResponse.HasError())
+}
+
+func TestRefreshCountrySnapshot(t *testing.T) {
+	dataset := `[
+		{"name": {"common": "Colombia", "official": "Republic of Colombia"}, "cca2": "CO", "population": 50882884,
+		 "currencies": {"COP": {"name": "Colombian peso", "symbol": "$"}}, "timezones": ["UTC-05:00"]},
+		{"name": {"common": "Argentina", "official": "Argentine Republic"}, "cca2": "AR", "area": 2780400,
+		 "currencies": {"ARS": {"name": "Argentine peso", "symbol": "$"}}, "timezones": ["UTC-03:00"]}
+	]`
+	var out bytes.Buffer
+
+	count, err := RefreshCountrySnapshot(strings.NewReader(dataset), &out)
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.NotContains(t, out.String(), "population")
+	assert.Less(t, strings.Index(out.String(), `"AR"`), strings.Index(out.String(), `"CO"`))
+
+	snapshot, err := NewCountrySnapshot(out.Bytes())
+	require.NoError(t, err)
+	countryResponse := snapshot.GetCountryInformation(context.Background(), "Colombia")
+	require.False(t, countryResponse.HasError())
+	assert.Equal(t, "Colombian peso", countryResponse.ArrayResponse[0].Currencies["COP"].Name)
+}
+
+func TestRefreshCountrySnapshot_InvalidDataset(t *testing.T) {
+	for _, dataset := range []string{`[]`, `{"status": 404}`, `[{"name": {"common": "Colombia"}}]`} {
+		var out bytes.Buffer
+
+		_, err := RefreshCountrySnapshot(strings.NewReader(dataset), &out)
+
+		assert.Error(t, err, dataset)
+		assert.Empty(t, out.String())
+	}
+}
+
+func TestGetAllProducts_CountryFallback(t *testing.T) {
+	service, _ := newTestInformationService(t)
+	failingCountryApi := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(failingCountryApi.Close)
+	service.endpoints.CountryApiURL = failingCountryApi.URL + "/v3.1/name/%s"
+
+	_, err := service.GetAllProducts(context.Background(), "1.1.1.1")
+	assert.Error(t, err)
+
+	snapshot, err := NewEmbeddedCountrySnapshot()
+	require.NoError(t, err)
+	service.SetCountryProviders(service, snapshot)
+
+	result, err := service.GetAllProducts(context.Background(), "1.1.1.1")
+	require.NoError(t, err)
+	assert.Equal(t, "AR", result.ISO)
+	require.Len(t, result.Currencies, 1)
+	assert.Equal(t, "ARS", result.Currencies[0].Code)
+}
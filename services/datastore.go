@@ -1,57 +1,84 @@
-package services
-
-import (
-	"fmt"
-	"service_fraud/utils"
-	"time"
-)
-
-// RequestDataStore is a generic data structure that stores key-value pairs
-// with an expiration time for each entry.
-type RequestDataStore[K comparable, V any] struct {
-	data   map[K]V
-	expiry map[K]time.Time
-}
-
-// timeLimit defines the global expiration time for stored items.
-const timeLimit = utils.TTL_IN_MINUTES * time.Minute
-
-// NewRequestDataStore creates and initializes a new RequestDataStore.
-func NewRequestDataStore[K comparable, V any]() *RequestDataStore[K, V] {
-	return &RequestDataStore[K, V]{
-		data:   make(map[K]V),
-		expiry: make(map[K]time.Time),
-	}
-}
-
-// Set stores a value with a specified key and sets its expiration time.
-func (store *RequestDataStore[K, V]) Set(key K, value V) error {
-	store.data[key] = value
-	store.expiry[key] = time.Now().Add(timeLimit)
-	return nil
-}
-
-// Get retrieves a value associated with the specified key.
-// It returns an error if the key has expired or does not exist.
-func (store *RequestDataStore[K, V]) Get(key K) (V, error) {
-	if time.Now().After(store.expiry[key]) {
-		delete(store.data, key)
-		delete(store.expiry, key)
-		var zeroValue V // Valor cero para el tipo V
-		return zeroValue, fmt.Errorf("el dato ha expirado")
-	}
-
-	value, exists := store.data[key]
-	if !exists {
-		var zeroValue V // Valor cero para el tipo V
-		return zeroValue, fmt.Errorf("clave no encontrada")
-	}
-	return value, nil
-}
-
-// Expire manually removes a key and its associated value from the store.
-func (store *RequestDataStore[K, V]) Expire(key K) error {
-	delete(store.data, key)
-	delete(store.expiry, key)
-	return nil
-}
+package services
+
+import (
+	"fmt"
+	"service_fraud/utils"
+	"sync"
+	"time"
+)
+
+// RequestDataStore is a generic data structure that stores key-value pairs
+// with an expiration time for each entry. It is safe for concurrent use.
+type RequestDataStore[K comparable, V any] struct {
+	lock    sync.Mutex
+	data    map[K]V
+	expiry  map[K]time.Time
+	name    string
+	metrics *Metrics
+}
+
+// timeLimit defines the global expiration time for stored items.
+const timeLimit = utils.TTL_IN_MINUTES * time.Minute
+
+// NewRequestDataStore creates and initializes a new RequestDataStore.
+func NewRequestDataStore[K comparable, V any]() *RequestDataStore[K, V] {
+	return &RequestDataStore[K, V]{
+		data:   make(map[K]V),
+		expiry: make(map[K]time.Time),
+	}
+}
+
+// SetMetrics records the hits, misses and expirations of the lookups in the metrics, labeled
+// with the name of the store.
+func (store *RequestDataStore[K, V]) SetMetrics(name string, metrics *Metrics) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	store.name = name
+	store.metrics = metrics
+}
+
+// Set stores a value with a specified key and sets its expiration time.
+func (store *RequestDataStore[K, V]) Set(key K, value V) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	store.data[key] = value
+	store.expiry[key] = time.Now().Add(timeLimit)
+	return nil
+}
+
+// Get retrieves a value associated with the specified key.
+// It returns an error if the key has expired or does not exist.
+func (store *RequestDataStore[K, V]) Get(key K) (V, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	expiry, found := store.expiry[key]
+	if time.Now().After(expiry) {
+		if found {
+			store.metrics.observeCache(store.name, utils.METRICS_CACHE_EXPIRED)
+		} else {
+			store.metrics.observeCache(store.name, utils.METRICS_CACHE_MISS)
+		}
+		delete(store.data, key)
+		delete(store.expiry, key)
+		var zeroValue V // Valor cero para el tipo V
+		return zeroValue, fmt.Errorf("el dato ha expirado")
+	}
+
+	value, exists := store.data[key]
+	if !exists {
+		store.metrics.observeCache(store.name, utils.METRICS_CACHE_MISS)
+		var zeroValue V // Valor cero para el tipo V
+		return zeroValue, fmt.Errorf("clave no encontrada")
+	}
+	store.metrics.observeCache(store.name, utils.METRICS_CACHE_HIT)
+	return value, nil
+}
+
+// Expire manually removes a key and its associated value from the store.
+func (store *RequestDataStore[K, V]) Expire(key K) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	delete(store.data, key)
+	delete(store.expiry, key)
+	return nil
+}
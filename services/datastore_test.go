@@ -1,50 +1,70 @@
-package services
-
-import (
-	"testing"
-
-	"github.com/stretchr/testify/assert"
-)
-
-func TestRequestDataStore_SetAndGet(t *testing.T) {
-	store := NewRequestDataStore[string, string]()
-	key := "testKey"
-	value := "testValue"
-	err := store.Set(key, value)
-	assert.NoError(t, err)
-
-	retrievedValue, err := store.Get(key)
-
-	assert.NoError(t, err)
-	assert.Equal(t, value, retrievedValue)
-}
-
-func TestRequestDataStore_Get_NotFound(t *testing.T) {
-	store := NewRequestDataStore[string, string]()
-	key := "nonExistentKey"
-
-	retrievedValue, err := store.Get(key)
-
-	assert.Error(t, err)
-	assert.Equal(t, "el dato ha expirado", err.Error())
-	assert.Equal(t, "", retrievedValue)
-}
-
-func TestRequestDataStore_Expire(t *testing.T) {
-
-	store := NewRequestDataStore[string, string]()
-	key := "testKey"
-	value := "testValue"
-
-	err := store.Set(key, value)
-	assert.NoError(t, err)
-
-	err = store.Expire(key)
-	assert.NoError(t, err)
-
-	retrievedValue, err := store.Get(key)
-
-	assert.Error(t, err)
-	assert.Equal(t, "el dato ha expirado", err.Error())
-	assert.Equal(t, "", retrievedValue)
-}
+package services
+
+import (
+	"service_fraud/utils"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestDataStore_SetAndGet(t *testing.T) {
+	store := NewRequestDataStore[string, string]()
+	key := "testKey"
+	value := "testValue"
+	err := store.Set(key, value)
+	assert.NoError(t, err)
+
+	retrievedValue, err := store.Get(key)
+
+	assert.NoError(t, err)
+	assert.Equal(t, value, retrievedValue)
+}
+
+func TestRequestDataStore_Get_NotFound(t *testing.T) {
+	store := NewRequestDataStore[string, string]()
+	key := "nonExistentKey"
+
+	retrievedValue, err := store.Get(key)
+
+	assert.Error(t, err)
+	assert.Equal(t, "el dato ha expirado", err.Error())
+	assert.Equal(t, "", retrievedValue)
+}
+
+func TestRequestDataStore_Expire(t *testing.T) {
+
+	store := NewRequestDataStore[string, string]()
+	key := "testKey"
+	value := "testValue"
+
+	err := store.Set(key, value)
+	assert.NoError(t, err)
+
+	err = store.Expire(key)
+	assert.NoError(t, err)
+
+	retrievedValue, err := store.Get(key)
+
+	assert.Error(t, err)
+	assert.Equal(t, "el dato ha expirado", err.Error())
+	assert.Equal(t, "", retrievedValue)
+}
+
+func TestRequestDataStore_Metrics(t *testing.T) {
+	metrics := NewMetrics()
+	store := NewRequestDataStore[string, string]()
+	store.SetMetrics("ip", metrics)
+	store.Set("cached", "value")
+	store.Set("old", "value")
+	store.expiry["old"] = time.Now().Add(-time.Minute)
+
+	store.Get("cached")
+	store.Get("cached")
+	store.Get("missing")
+	store.Get("old")
+
+	assert.Equal(t, 2.0, metrics.cacheRequests.Value("ip", utils.METRICS_CACHE_HIT))
+	assert.Equal(t, 1.0, metrics.cacheRequests.Value("ip", utils.METRICS_CACHE_MISS))
+	assert.Equal(t, 1.0, metrics.cacheRequests.Value("ip", utils.METRICS_CACHE_EXPIRED))
+}
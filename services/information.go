@@ -1,219 +1,608 @@
-package services
-
-import (
-	"context"
-	"encoding/json"
-	"fmt"
-	"log"
-	"net/http"
-	"service_fraud/interfaces"
-	"service_fraud/models"
-	"service_fraud/utils"
-	"time"
-)
-
-// InformationService provides methods to retrieve information about IPs, countries, and currencies.
-type InformationService struct {
-	secrets           interfaces.SecretsVault
-	StatsService      interfaces.StatsInformation
-	processed         chan models.StatsRequest
-	countryDataStore  interfaces.DataStore[string, models.CountryResponse]
-	currencyDataStore interfaces.DataStore[string, models.CurrencyResponse]
-}
-
-// NewInformationService creates a new instance of InformationService.
-func NewInformationService(secrets interfaces.SecretsVault,
-	countryDs interfaces.DataStore[string, models.CountryResponse],
-	currencyDs interfaces.DataStore[string, models.CurrencyResponse]) *InformationService {
-
-	processed := make(chan models.StatsRequest, WorkerCount)
-	statService := NewStatsService(processed)
-	return &InformationService{
-		secrets:           secrets,
-		StatsService:      statService,
-		processed:         processed,
-		countryDataStore:  countryDs,
-		currencyDataStore: currencyDs,
-	}
-}
-
-// Geolocation fetches geolocation information for a given IP address.
-func (s *InformationService) Geolocation(ip string) models.IpApiResponse {
-	value, err := s.secrets.GetSecret(utils.SECRET_API_IP_KEY)
-	ipresp := models.IpApiResponse{}
-	if err != nil {
-		log.Printf(utils.ERR_MESSAGE_GET_SECRETS, err)
-		ipresp.Error = *models.NewErrorIpApiError(utils.ERR_CODE_GET_SECRETS, utils.ERR_USER_MESSAGE_GET_SECRETS)
-		return ipresp
-	}
-	url := fmt.Sprintf(utils.API_IP_URL, ip, *value)
-	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
-	defer cancel()
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		log.Printf(utils.ERR_MESSAGE_IP_SERVICE, err)
-		ipresp.Error = *models.NewErrorIpApiError(utils.ERR_CODE_IP_SERVICE, fmt.Sprint(utils.ERR_USER_MESSAGE_IP_SERVICE))
-		return ipresp
-	}
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		log.Printf(utils.ERR_MESSAGE_IP_SERVICE, err)
-		ipresp.Error = *models.NewErrorIpApiError(utils.ERR_CODE_IP_SERVICE, fmt.Sprint(utils.ERR_USER_MESSAGE_IP_SERVICE))
-		return ipresp
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		str := fmt.Sprintf("Error getting the request: %s", resp.Status)
-		log.Println(str)
-		ipresp.Error = *models.NewErrorIpApiError(utils.ERR_CODE_IP_SERVICE, fmt.Sprint(utils.ERR_USER_MESSAGE_IP_SERVICE))
-		return ipresp
-	}
-
-	defer resp.Body.Close()
-
-	dec := json.NewDecoder(resp.Body)
-
-	if err := dec.Decode(&ipresp); err != nil {
-		log.Printf("error: can't decode - %s \n", err)
-		ipresp.Error = *models.NewErrorIpApiError(utils.ERR_CODE_IP_SERVICE, fmt.Sprint(utils.ERR_USER_MESSAGE_IP_SERVICE))
-		return ipresp
-	}
-	return ipresp
-}
-
-// GetCountryInformation fetches information for a given country.
-func (s *InformationService) GetCountryInformation(country string) models.CountryResponse {
-	countryresp := models.CountryResponse{}
-	arr := &countryresp.ArrayResponse
-	url := fmt.Sprintf(utils.API_COUNTRY_URL, country)
-	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
-	defer cancel()
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		log.Printf(utils.ERR_MESSAGE_COUNTRY_SERVICE, err)
-		countryresp.Error = *models.NewCountryApiError(utils.ERR_CODE_COUNTRY_SERVICE, fmt.Sprint(utils.ERR_USER_MESSAGE_COUNTRY_SERVICE))
-		return countryresp
-	}
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		log.Printf(utils.ERR_MESSAGE_COUNTRY_SERVICE, err)
-		countryresp.Error = *models.NewCountryApiError(utils.ERR_CODE_COUNTRY_SERVICE, fmt.Sprint(utils.ERR_USER_MESSAGE_COUNTRY_SERVICE))
-		return countryresp
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		str := fmt.Sprintf("Error getting the request: %s", resp.Status)
-		log.Println(str)
-		countryresp.Error = *models.NewCountryApiError(utils.ERR_CODE_COUNTRY_SERVICE, fmt.Sprint(utils.ERR_USER_MESSAGE_COUNTRY_SERVICE))
-		return countryresp
-	}
-
-	defer resp.Body.Close()
-
-	dec := json.NewDecoder(resp.Body)
-
-	if err := dec.Decode(&arr); err != nil {
-		log.Printf("error: can't decode - %s \n", err)
-		countryresp.Error = *models.NewCountryApiError(utils.ERR_CODE_COUNTRY_SERVICE, fmt.Sprint(utils.ERR_USER_MESSAGE_COUNTRY_SERVICE))
-		return countryresp
-	}
-
-	return countryresp
-}
-
-// GetCurrencyInformation fetches current currency information.
-func (s *InformationService) GetCurrencyInformation() models.CurrencyResponse {
-	value, err := s.secrets.GetSecret(utils.SECRET_API_CURRENCY_KEY)
-	currencyResponse := models.CurrencyResponse{}
-	if err != nil {
-		log.Printf(utils.ERR_MESSAGE_GET_SECRETS, err)
-		currencyResponse.Error = *models.NewCurrencyApiError(utils.ERR_CODE_GET_SECRETS, fmt.Sprintf(utils.ERR_USER_MESSAGE_IP_SERVICE))
-		return currencyResponse
-	}
-
-	url := fmt.Sprintf(utils.API_CURRENCY_URL, *value)
-	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
-	defer cancel()
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		log.Printf(utils.ERR_MESSAGE_CURRENCY_SERVICE, err)
-		currencyResponse.Error = *models.NewCurrencyApiError(utils.ERR_CODE_CURRENCY_SERVICE, fmt.Sprint(utils.ERR_USER_MESSAGE_CURRENCY_SERVICE))
-		return currencyResponse
-	}
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		log.Printf(utils.ERR_MESSAGE_CURRENCY_SERVICE, err)
-		currencyResponse.Error = *models.NewCurrencyApiError(utils.ERR_CODE_CURRENCY_SERVICE, fmt.Sprint(utils.ERR_USER_MESSAGE_CURRENCY_SERVICE))
-		return currencyResponse
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		str := fmt.Sprintf("Error getting the request: %s", resp.Status)
-		log.Println(str)
-		currencyResponse.Error = *models.NewCurrencyApiError(utils.ERR_CODE_CURRENCY_SERVICE, fmt.Sprint(utils.ERR_USER_MESSAGE_CURRENCY_SERVICE))
-		return currencyResponse
-	}
-
-	defer resp.Body.Close()
-
-	dec := json.NewDecoder(resp.Body)
-
-	if err := dec.Decode(&currencyResponse); err != nil {
-		log.Printf("error: can't decode - %s \n", err)
-		currencyResponse.Error = *models.NewCurrencyApiError(utils.ERR_CODE_CURRENCY_SERVICE, fmt.Sprint(utils.ERR_USER_MESSAGE_CURRENCY_SERVICE))
-		return currencyResponse
-	}
-	return currencyResponse
-}
-
-// GetStatsService returns the stats service instance.
-func (s *InformationService) GetStatsService() interfaces.StatsInformation {
-	return s.StatsService
-}
-
-// GetAllProducts processes all information related to products based on an IP address.
-func (s *InformationService) GetAllProducts(ip string) error {
-	response := models.Response{}
-	ipResponse := s.Geolocation(ip)
-	if ipResponse.HasError() {
-		return &ipResponse.Error
-	}
-	if !ipResponse.ContainsValidResponse() {
-		log.Printf(utils.ERR_MESSAGE_IP_RESP_EMPTY, ip)
-		return models.NewErrorIpApiError(utils.ERR_CODE_IP_RESP_EMPTY, utils.ERR_USER_MESSAGE_IP_RESP_EMPTY)
-	}
-
-	stats := models.StatsRequest{
-		Country: ipResponse.RegionName,
-		Lat:     ipResponse.Latitude,
-		Lon:     ipResponse.Longitude,
-	}
-
-	s.processed <- stats
-
-	countryResponse, err := s.countryDataStore.Get(ipResponse.RegionName)
-	if err != nil {
-		countryResponse = s.GetCountryInformation(ipResponse.CountryName)
-		if countryResponse.HasError() {
-			return &countryResponse.Error
-		}
-		s.countryDataStore.Set(ipResponse.RegionName, countryResponse)
-	}
-
-	currencyResponse, err := s.currencyDataStore.Get("currency")
-	if err != nil {
-		currencyResponse = s.GetCurrencyInformation()
-		if currencyResponse.HasError() {
-			if currencyResponse.Error.Message == "" {
-				currencyResponse.Error.Message = utils.ERR_USER_MESSAGE_LIMIT_REACHED
-			}
-			return &currencyResponse.Error
-		}
-	}
-
-	response.FormatResponse(ipResponse, countryResponse, currencyResponse)
-	return nil
-}
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	neturl "net/url"
+	"service_fraud/interfaces"
+	"service_fraud/models"
+	"service_fraud/utils"
+	"time"
+)
+
+// InformationService provides methods to retrieve information about IPs, countries, and currencies.
+type InformationService struct {
+	secrets          interfaces.SecretsVault
+	StatsService     interfaces.StatsInformation
+	processed        chan models.StatsRequest
+	ipDataStore      interfaces.DataStore[string, models.IpApiResponse]
+	countryDataStore interfaces.DataStore[string, models.CountryResponse]
+	endpoints        Endpoints
+	geolocators      []interfaces.IpInformation
+	countryProviders []interfaces.CountryInformation
+	risk             interfaces.RiskEvaluator
+	lists            interfaces.ListMatcher
+	references       []models.ReferenceLocation
+	nearestOnly      bool
+	metrics          *Metrics
+	traceTimeout     time.Duration
+	upstreams        *Upstreams
+	targetCurrency   string
+	rates            *RatesManager
+}
+
+// Endpoints holds the URL templates used to reach the external APIs.
+type Endpoints struct {
+	IpApiURL       string
+	CountryApiURL  string
+	CurrencyApiURL string
+	// CurrencyHistoryURL has the day of the rates, YYYY-MM-DD, before the key.
+	CurrencyHistoryURL string
+}
+
+// DefaultEndpoints returns the URL templates of the production APIs.
+func DefaultEndpoints() Endpoints {
+	return Endpoints{
+		IpApiURL:           utils.API_IP_URL,
+		CountryApiURL:      utils.API_COUNTRY_URL,
+		CurrencyApiURL:     utils.API_CURRENCY_URL,
+		CurrencyHistoryURL: utils.API_CURRENCY_HISTORY_URL,
+	}
+}
+
+// NewInformationService creates a new instance of InformationService. The exchange rates are
+// kept by a RatesManager with the default policy, see SetRatesManager.
+func NewInformationService(secrets interfaces.SecretsVault,
+	ipDs interfaces.DataStore[string, models.IpApiResponse],
+	countryDs interfaces.DataStore[string, models.CountryResponse]) *InformationService {
+
+	// The stats service is shared, so the requests must be sent to the channel its workers listen to.
+	statService := NewStatsService(make(chan models.StatsRequest, WorkerCount))
+	service := &InformationService{
+		secrets:          secrets,
+		StatsService:     statService,
+		processed:        statService.processedChannel,
+		ipDataStore:      ipDs,
+		countryDataStore: countryDs,
+		endpoints:        DefaultEndpoints(),
+		risk:             NewRiskService(models.DefaultRiskPolicy()),
+		metrics:          DefaultMetrics(),
+		upstreams:        NewUpstreams(DefaultRetryPolicy(), DefaultBreakerPolicy()),
+	}
+	service.rates = NewRatesManager(DefaultRatesPolicy(), service)
+	return service
+}
+
+// SetEndpoints overrides the URL templates of the external APIs, for example to point to fake upstreams.
+func (s *InformationService) SetEndpoints(endpoints Endpoints) {
+	s.endpoints = endpoints
+}
+
+// SetGeolocators sets the providers used to geolocate the IPs. They are tried in order until
+// one of them locates the IP, so a local database can be used as a fallback of ipapi.
+func (s *InformationService) SetGeolocators(geolocators ...interfaces.IpInformation) {
+	s.geolocators = geolocators
+}
+
+// SetCountryProviders sets the providers used to retrieve the country information. They are
+// tried in order until one of them answers, so the embedded snapshot can be used as a
+// fallback of restcountries.
+func (s *InformationService) SetCountryProviders(providers ...interfaces.CountryInformation) {
+	s.countryProviders = providers
+}
+
+// SetRiskEvaluator sets the evaluator used to score the traces, nil disables the scoring.
+func (s *InformationService) SetRiskEvaluator(risk interfaces.RiskEvaluator) {
+	s.risk = risk
+}
+
+// SetListMatcher sets the allowlists and blocklists checked before calling the upstreams,
+// nil disables them.
+func (s *InformationService) SetListMatcher(lists interfaces.ListMatcher) {
+	s.lists = lists
+}
+
+// SetReferences sets the locations the distances of the traces are measured from, Buenos Aires
+// when none is set. With nearestOnly the traces only include the distance to the nearest one.
+func (s *InformationService) SetReferences(references []models.ReferenceLocation, nearestOnly bool) {
+	s.references = references
+	s.nearestOnly = nearestOnly
+}
+
+// SetTraceTimeout sets how long a trace can take, including the calls to the external APIs.
+// A zero timeout uses the default one.
+func (s *InformationService) SetTraceTimeout(timeout time.Duration) {
+	s.traceTimeout = timeout
+}
+
+// getTraceTimeout returns the configured trace timeout or the default one.
+func (s *InformationService) getTraceTimeout() time.Duration {
+	if s.traceTimeout <= 0 {
+		return utils.TRACE_DEFAULT_TIMEOUT_SECONDS * time.Second
+	}
+	return s.traceTimeout
+}
+
+// SetUpstreams sets the retries and circuit breakers of the calls to the external APIs, nil
+// sends each call once.
+func (s *InformationService) SetUpstreams(upstreams *Upstreams) {
+	s.upstreams = upstreams
+}
+
+// SetTargetCurrency sets the currency the currencies of the countries are converted to, USD
+// when none is set.
+func (s *InformationService) SetTargetCurrency(code string) {
+	s.targetCurrency = code
+}
+
+// SetRatesManager sets the manager that keeps the snapshot of the exchange rates used by the traces.
+func (s *InformationService) SetRatesManager(rates *RatesManager) {
+	s.rates = rates
+}
+
+// GetRates returns the snapshot of the exchange rates used by the traces, retrieving it when
+// there is none or it expired.
+func (s *InformationService) GetRates(ctx context.Context) (models.RatesSnapshot, error) {
+	return s.rates.Get(ctx)
+}
+
+// lookupRates returns the snapshot of the rates the trace is converted with, the historical one
+// of the day carried by the context, if any, or the current one.
+func (s *InformationService) lookupRates(ctx context.Context) (models.RatesSnapshot, error) {
+	if date, ok := RatesDate(ctx); ok {
+		return s.rates.GetAt(ctx, date)
+	}
+	return s.rates.Get(ctx)
+}
+
+// GetHealth returns the state of the circuit breakers of the external APIs.
+func (s *InformationService) GetHealth() models.HealthReport {
+	return models.NewHealthReport(
+		s.upstreams.Status(utils.METRICS_UPSTREAM_IPAPI),
+		s.upstreams.Status(utils.METRICS_UPSTREAM_RESTCOUNTRIES),
+		s.upstreams.Status(utils.METRICS_UPSTREAM_FIXER),
+	)
+}
+
+// SetMetrics sets the metrics the traces and the calls to the external APIs are recorded in,
+// nil disables them.
+func (s *InformationService) SetMetrics(metrics *Metrics) {
+	s.metrics = metrics
+}
+
+// urls returns the configured endpoints, falling back to the production APIs when none are set.
+func (s *InformationService) urls() Endpoints {
+	if s.endpoints == (Endpoints{}) {
+		return DefaultEndpoints()
+	}
+	endpoints := s.endpoints
+	if endpoints.CurrencyHistoryURL == "" {
+		endpoints.CurrencyHistoryURL = utils.API_CURRENCY_HISTORY_URL
+	}
+	return endpoints
+}
+
+// Geolocation fetches geolocation information for a given IP address.
+func (s *InformationService) Geolocation(ctx context.Context, ip string) models.IpApiResponse {
+	logger := utils.Logger(ctx)
+	value, err := s.secrets.GetSecret(ctx, utils.SECRET_API_IP_KEY)
+	ipresp := models.IpApiResponse{}
+	if err != nil {
+		logger.Error(utils.ERR_MESSAGE_GET_SECRETS, "error", err)
+		ipresp.Error = *models.NewErrorIpApiError(utils.ERR_CODE_GET_SECRETS, utils.ERR_USER_MESSAGE_GET_SECRETS)
+		return ipresp
+	}
+	url := fmt.Sprintf(s.urls().IpApiURL, neturl.PathEscape(ip), *value)
+	since, status := time.Now(), 0
+	defer func() {
+		s.metrics.observeUpstream(utils.METRICS_UPSTREAM_IPAPI, status, ipresp.Error.Code, time.Since(since))
+	}()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		logger.Error(utils.ERR_MESSAGE_IP_SERVICE, "upstream", utils.METRICS_UPSTREAM_IPAPI, "error", err)
+		ipresp.Error = *models.NewErrorIpApiError(utils.ERR_CODE_IP_SERVICE, fmt.Sprint(utils.ERR_USER_MESSAGE_IP_SERVICE))
+		return ipresp
+	}
+
+	resp, err := s.upstreams.Do(utils.METRICS_UPSTREAM_IPAPI, req)
+	if err != nil {
+		logger.Error(utils.ERR_MESSAGE_IP_SERVICE, "upstream", utils.METRICS_UPSTREAM_IPAPI, "error", err)
+		ipresp.Error = *models.NewErrorIpApiError(utils.ERR_CODE_IP_SERVICE, fmt.Sprint(utils.ERR_USER_MESSAGE_IP_SERVICE))
+		return ipresp
+	}
+	status = resp.StatusCode
+
+	defer resp.Body.Close()
+
+	// ipapi rejects the requests with an error envelope, usually with a 200 status.
+	providerError, err := decodeProviderResponse(resp.Body, &ipresp)
+	if providerError != nil {
+		rejected := models.NewProviderApiError(utils.METRICS_UPSTREAM_IPAPI, *providerError, utils.ERR_CODE_IP_SERVICE, utils.ERR_USER_MESSAGE_IP_SERVICE)
+		logProviderError(logger, rejected, resp.StatusCode)
+		ipresp.Error = models.IpApiError{Code: rejected.Code, Message: rejected.Message, Err: rejected}
+		return ipresp
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		logger.Error(utils.ERR_MESSAGE_UPSTREAM_STATUS, "upstream", utils.METRICS_UPSTREAM_IPAPI, "status", resp.StatusCode)
+		ipresp.Error = *models.NewErrorIpApiError(statusErrorCode(resp.StatusCode, utils.ERR_CODE_IP_SERVICE, utils.ERR_USER_MESSAGE_IP_SERVICE))
+		return ipresp
+	}
+
+	if err != nil {
+		logger.Error(utils.ERR_MESSAGE_DECODE_RESPONSE, "upstream", utils.METRICS_UPSTREAM_IPAPI, "error", err)
+		ipresp.Error = *models.NewErrorIpApiError(utils.ERR_CODE_IP_SERVICE, fmt.Sprint(utils.ERR_USER_MESSAGE_IP_SERVICE))
+		return ipresp
+	}
+	return ipresp
+}
+
+// locate geolocates the IP with the configured providers, ipapi when none is set. It returns
+// the first valid response or, when every provider fails, the first error found.
+func (s *InformationService) locate(ctx context.Context, ip string) models.IpApiResponse {
+	geolocators := s.geolocators
+	if len(geolocators) == 0 {
+		geolocators = []interfaces.IpInformation{s}
+	}
+
+	var ipResponse, failed models.IpApiResponse
+	for _, geolocator := range geolocators {
+		ipResponse = geolocator.Geolocation(ctx, ip)
+		if !ipResponse.HasError() && ipResponse.ContainsValidResponse() {
+			return ipResponse
+		}
+		if ipResponse.HasError() && !failed.HasError() {
+			failed = ipResponse
+		}
+	}
+	if failed.HasError() {
+		return failed
+	}
+	return ipResponse
+}
+
+// lookupCountry retrieves the country information with the configured providers, restcountries
+// when none is set. It returns the first response without errors or the first error found.
+func (s *InformationService) lookupCountry(ctx context.Context, country string) models.CountryResponse {
+	providers := s.countryProviders
+	if len(providers) == 0 {
+		providers = []interfaces.CountryInformation{s}
+	}
+
+	var failed models.CountryResponse
+	for _, provider := range providers {
+		countryResponse := provider.GetCountryInformation(ctx, country)
+		if !countryResponse.HasError() {
+			return countryResponse
+		}
+		if !failed.HasError() {
+			failed = countryResponse
+		}
+	}
+	return failed
+}
+
+// GetCountryInformation fetches information for a given country.
+func (s *InformationService) GetCountryInformation(ctx context.Context, country string) models.CountryResponse {
+	logger := utils.Logger(ctx)
+	countryresp := models.CountryResponse{}
+	arr := &countryresp.ArrayResponse
+	url := fmt.Sprintf(s.urls().CountryApiURL, country)
+	since, status := time.Now(), 0
+	defer func() {
+		s.metrics.observeUpstream(utils.METRICS_UPSTREAM_RESTCOUNTRIES, status, countryresp.Error.Code, time.Since(since))
+	}()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		logger.Error(utils.ERR_MESSAGE_COUNTRY_SERVICE, "upstream", utils.METRICS_UPSTREAM_RESTCOUNTRIES, "error", err)
+		countryresp.Error = *models.NewCountryApiError(utils.ERR_CODE_COUNTRY_SERVICE, fmt.Sprint(utils.ERR_USER_MESSAGE_COUNTRY_SERVICE))
+		return countryresp
+	}
+
+	resp, err := s.upstreams.Do(utils.METRICS_UPSTREAM_RESTCOUNTRIES, req)
+	if err != nil {
+		logger.Error(utils.ERR_MESSAGE_COUNTRY_SERVICE, "upstream", utils.METRICS_UPSTREAM_RESTCOUNTRIES, "error", err)
+		countryresp.Error = *models.NewCountryApiError(utils.ERR_CODE_COUNTRY_SERVICE, fmt.Sprint(utils.ERR_USER_MESSAGE_COUNTRY_SERVICE))
+		return countryresp
+	}
+	status = resp.StatusCode
+
+	if resp.StatusCode != http.StatusOK {
+		logger.Error(utils.ERR_MESSAGE_UPSTREAM_STATUS, "upstream", utils.METRICS_UPSTREAM_RESTCOUNTRIES, "status", resp.StatusCode)
+		countryresp.Error = *models.NewCountryApiError(utils.ERR_CODE_COUNTRY_SERVICE, fmt.Sprint(utils.ERR_USER_MESSAGE_COUNTRY_SERVICE))
+		return countryresp
+	}
+
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+
+	if err := dec.Decode(&arr); err != nil {
+		logger.Error(utils.ERR_MESSAGE_DECODE_RESPONSE, "upstream", utils.METRICS_UPSTREAM_RESTCOUNTRIES, "error", err)
+		countryresp.Error = *models.NewCountryApiError(utils.ERR_CODE_COUNTRY_SERVICE, fmt.Sprint(utils.ERR_USER_MESSAGE_COUNTRY_SERVICE))
+		return countryresp
+	}
+
+	return countryresp
+}
+
+// GetCurrencyInformation fetches current currency information.
+func (s *InformationService) GetCurrencyInformation(ctx context.Context) models.CurrencyResponse {
+	return s.fetchCurrencyInformation(ctx, func(key string) string {
+		return fmt.Sprintf(s.urls().CurrencyApiURL, key)
+	})
+}
+
+// GetHistoricalCurrencyInformation fetches the currency information published on the given day.
+func (s *InformationService) GetHistoricalCurrencyInformation(ctx context.Context, date time.Time) models.CurrencyResponse {
+	return s.fetchCurrencyInformation(ctx, func(key string) string {
+		return fmt.Sprintf(s.urls().CurrencyHistoryURL, date.Format(time.DateOnly), key)
+	})
+}
+
+// fetchCurrencyInformation fetches the currency information from the fixer URL built with the key.
+func (s *InformationService) fetchCurrencyInformation(ctx context.Context, urlWithKey func(key string) string) models.CurrencyResponse {
+	logger := utils.Logger(ctx)
+	value, err := s.secrets.GetSecret(ctx, utils.SECRET_API_CURRENCY_KEY)
+	currencyResponse := models.CurrencyResponse{}
+	if err != nil {
+		logger.Error(utils.ERR_MESSAGE_GET_SECRETS, "error", err)
+		currencyResponse.Error = *models.NewCurrencyApiError(utils.ERR_CODE_GET_SECRETS, fmt.Sprintf(utils.ERR_USER_MESSAGE_IP_SERVICE))
+		return currencyResponse
+	}
+
+	url := urlWithKey(*value)
+	since, status := time.Now(), 0
+	defer func() {
+		s.metrics.observeUpstream(utils.METRICS_UPSTREAM_FIXER, status, currencyResponse.Error.Code, time.Since(since))
+	}()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		logger.Error(utils.ERR_MESSAGE_CURRENCY_SERVICE, "upstream", utils.METRICS_UPSTREAM_FIXER, "error", err)
+		currencyResponse.Error = *models.NewCurrencyApiError(utils.ERR_CODE_CURRENCY_SERVICE, fmt.Sprint(utils.ERR_USER_MESSAGE_CURRENCY_SERVICE))
+		return currencyResponse
+	}
+
+	resp, err := s.upstreams.Do(utils.METRICS_UPSTREAM_FIXER, req)
+	if err != nil {
+		logger.Error(utils.ERR_MESSAGE_CURRENCY_SERVICE, "upstream", utils.METRICS_UPSTREAM_FIXER, "error", err)
+		currencyResponse.Error = *models.NewCurrencyApiError(utils.ERR_CODE_CURRENCY_SERVICE, fmt.Sprint(utils.ERR_USER_MESSAGE_CURRENCY_SERVICE))
+		return currencyResponse
+	}
+	status = resp.StatusCode
+
+	defer resp.Body.Close()
+
+	// fixer rejects the requests with an error envelope, usually with a 200 status.
+	providerError, err := decodeProviderResponse(resp.Body, &currencyResponse)
+	if providerError != nil {
+		rejected := models.NewProviderApiError(utils.METRICS_UPSTREAM_FIXER, *providerError, utils.ERR_CODE_CURRENCY_SERVICE, utils.ERR_USER_MESSAGE_CURRENCY_SERVICE)
+		logProviderError(logger, rejected, resp.StatusCode)
+		currencyResponse.Error = models.CurrencyApiError{Code: rejected.Code, Message: rejected.Message, Err: rejected}
+		return currencyResponse
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		logger.Error(utils.ERR_MESSAGE_UPSTREAM_STATUS, "upstream", utils.METRICS_UPSTREAM_FIXER, "status", resp.StatusCode)
+		currencyResponse.Error = *models.NewCurrencyApiError(statusErrorCode(resp.StatusCode, utils.ERR_CODE_CURRENCY_SERVICE, utils.ERR_USER_MESSAGE_CURRENCY_SERVICE))
+		return currencyResponse
+	}
+
+	if err != nil {
+		logger.Error(utils.ERR_MESSAGE_DECODE_RESPONSE, "upstream", utils.METRICS_UPSTREAM_FIXER, "error", err)
+		currencyResponse.Error = *models.NewCurrencyApiError(utils.ERR_CODE_CURRENCY_SERVICE, fmt.Sprint(utils.ERR_USER_MESSAGE_CURRENCY_SERVICE))
+		return currencyResponse
+	}
+	currencyResponse.Source = utils.RATES_PROVIDER_FIXER
+	return currencyResponse
+}
+
+// decodeProviderResponse decodes the body of a response of ipapi or fixer into target. When the
+// body is an error envelope it returns the error reported by the provider instead.
+func decodeProviderResponse(body io.Reader, target any) (*models.ProviderError, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	var envelope models.ProviderErrorEnvelope
+	if json.Unmarshal(data, &envelope) == nil && envelope.Failed() {
+		return envelope.Error, nil
+	}
+	return nil, json.Unmarshal(data, target)
+}
+
+// logProviderError logs a request rejected by an external API with the code and type it reported.
+func logProviderError(logger *slog.Logger, rejected *models.ProviderApiError, status int) {
+	logger.Error(utils.ERR_MESSAGE_PROVIDER_ERROR, "upstream", rejected.Provider, "status", status,
+		"provider_code", rejected.ProviderCode, "provider_type", rejected.ProviderType, "code", rejected.Code)
+}
+
+// statusErrorCode returns the code and message of a call that failed with an unexpected HTTP
+// status: the rate limit for a 429 and the given ones, those of the failed service, otherwise.
+func statusErrorCode(status int, code int, msg string) (int, string) {
+	if status == http.StatusTooManyRequests {
+		return utils.ERR_CODE_RATE_LIMITED, utils.ERR_USER_MESSAGE_RATE_LIMITED
+	}
+	return code, msg
+}
+
+// GetStatsService returns the stats service instance.
+func (s *InformationService) GetStatsService() interfaces.StatsInformation {
+	return s.StatsService
+}
+
+// GetAllProducts processes all information related to products based on an IPv4 or IPv6
+// address and returns the resulting TraceResult. The whole trace, including the calls to the
+// external APIs, must finish within the trace timeout.
+func (s *InformationService) GetAllProducts(ctx context.Context, ip string) (models.TraceResult, error) {
+	// Every message logged during the trace carries the same ID, so they can be correlated.
+	if utils.TraceId(ctx) == "" {
+		ctx = utils.WithTraceId(ctx, utils.NewTraceId())
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.getTraceTimeout())
+	defer cancel()
+
+	since := time.Now()
+	result, err := s.getAllProducts(ctx, ip)
+	if err != nil && ctx.Err() != nil {
+		// The upstream failed because the trace was stopped, which is what the user must see.
+		err = traceCanceledError(ctx.Err())
+	}
+	elapsed := time.Since(since)
+	s.metrics.observeTrace(result, err, elapsed)
+	logger := utils.Logger(ctx)
+	if err != nil {
+		code, _ := models.ErrorDetails(err)
+		logger = logger.With("code", code)
+	}
+	logger.Info(utils.LOG_MESSAGE_TRACE_FINISHED, "ip", ip, "elapsed_seconds", elapsed.Seconds())
+	return result, err
+}
+
+// getAllProducts builds the TraceResult of the IP from the caches and the external APIs.
+func (s *InformationService) getAllProducts(ctx context.Context, ip string) (models.TraceResult, error) {
+	if canonical, ok := utils.CanonicalIp(ip); ok {
+		ip = canonical
+	}
+
+	// The IP range lists are checked first, so a blocked IP never reaches the upstreams.
+	listMatch, listed := s.matchIpList(ctx, ip)
+	if listed && listMatch.Action == utils.LIST_ACTION_BLOCK {
+		return blockedTraceResult(models.TraceResult{Ip: ip, Date: time.Now()}, listMatch), nil
+	}
+
+	if category, ok := utils.ClassifyIp(ip); ok {
+		utils.Logger(ctx).Warn(utils.ERR_MESSAGE_NON_ROUTABLE_IP, "ip", ip, "category", category)
+		return models.TraceResult{}, models.NewNonRoutableIpError(utils.ERR_CODE_NON_ROUTABLE_IP, fmt.Sprintf(utils.ERR_USER_MESSAGE_NON_ROUTABLE_IP, category), category)
+	}
+
+	ipResponse, err := s.ipDataStore.Get(ip)
+	if err != nil {
+		ipResponse = s.locate(ctx, ip)
+		if ipResponse.HasError() {
+			return models.TraceResult{}, &ipResponse.Error
+		}
+		if !ipResponse.ContainsValidResponse() {
+			utils.Logger(ctx).Warn(utils.ERR_MESSAGE_IP_RESP_EMPTY, "ip", ip)
+			return models.TraceResult{}, models.NewErrorIpApiError(utils.ERR_CODE_IP_RESP_EMPTY, utils.ERR_USER_MESSAGE_IP_RESP_EMPTY)
+		}
+		s.ipDataStore.Set(ip, ipResponse)
+	}
+
+	stats := models.StatsRequest{
+		Country:   ipResponse.StatsRegion(),
+		Continent: ipResponse.ContinentCode,
+		Lat:       ipResponse.Latitude,
+		Lon:       ipResponse.Longitude,
+		Time:      time.Now(),
+		TraceId:   utils.TraceId(ctx),
+	}
+
+	select {
+	case s.processed <- stats:
+	case <-ctx.Done():
+		return models.TraceResult{}, traceCanceledError(ctx.Err())
+	}
+
+	if !listed {
+		listMatch, listed = s.matchCountryList(ctx, ipResponse.CountryCode)
+		if listed && listMatch.Action == utils.LIST_ACTION_BLOCK {
+			result := s.newTraceResult(ipResponse, models.CountryResponse{}, models.CurrencyResponse{})
+			return blockedTraceResult(result, listMatch), nil
+		}
+	}
+
+	// The country information is kept by country, the regions of a country share it.
+	countryResponse, err := s.countryDataStore.Get(ipResponse.CountryName)
+	if err != nil {
+		countryResponse = s.lookupCountry(ctx, ipResponse.CountryName)
+		if countryResponse.HasError() {
+			return models.TraceResult{}, &countryResponse.Error
+		}
+		s.countryDataStore.Set(ipResponse.CountryName, countryResponse)
+	}
+
+	rates, err := s.lookupRates(ctx)
+	if err != nil {
+		return models.TraceResult{}, err
+	}
+
+	result := s.newTraceResult(ipResponse, countryResponse, rates.Response())
+	result.Rates = rates.Info()
+	if result.Transaction, err = s.newTransaction(ctx, rates.Response()); err != nil {
+		return models.TraceResult{}, err
+	}
+	if s.risk != nil {
+		assessment := s.risk.Evaluate(result)
+		result.Risk = &assessment
+	}
+	if listed {
+		// An allowlist overrides the decision of the rules, which are kept for reference.
+		result.List = &listMatch
+		if result.Risk != nil {
+			result.Risk.Decision = utils.RISK_DECISION_ALLOW
+		}
+	}
+	return result, nil
+}
+
+// traceCanceledError returns the error of a trace stopped by its context.
+func traceCanceledError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return models.NewTraceCanceledError(utils.ERR_CODE_TRACE_TIMEOUT, utils.ERR_USER_MESSAGE_TRACE_TIMEOUT, err)
+	}
+	return models.NewTraceCanceledError(utils.ERR_CODE_TRACE_CANCELED, utils.ERR_USER_MESSAGE_TRACE_CANCELED, err)
+}
+
+// newTraceResult builds the TraceResult with the distances to the configured reference locations
+// and the rates in the configured target currency.
+func (s *InformationService) newTraceResult(ipRes models.IpApiResponse, countryRes models.CountryResponse, currencyRes models.CurrencyResponse) models.TraceResult {
+	result := models.NewTraceResult(ipRes, countryRes, currencyRes)
+	if len(s.references) > 0 {
+		result.SetDistances(s.references, s.nearestOnly)
+	}
+	if s.targetCurrency != "" {
+		result.ConvertCurrencies(s.targetCurrency, currencyRes)
+	}
+	return result
+}
+
+// matchIpList returns the IP range list that contains the IP, if lists are configured.
+func (s *InformationService) matchIpList(ctx context.Context, ip string) (models.ListMatch, bool) {
+	if s.lists == nil {
+		return models.ListMatch{}, false
+	}
+	listMatch, ok := s.lists.MatchIp(ip)
+	if ok {
+		utils.Logger(ctx).Info(utils.LOG_MESSAGE_LIST_MATCH, "ip", ip, "list", listMatch.Name, "action", listMatch.Action)
+	}
+	return listMatch, ok
+}
+
+// matchCountryList returns the country list that contains the country, if lists are configured.
+func (s *InformationService) matchCountryList(ctx context.Context, countryCode string) (models.ListMatch, bool) {
+	if s.lists == nil {
+		return models.ListMatch{}, false
+	}
+	listMatch, ok := s.lists.MatchCountry(countryCode)
+	if ok {
+		utils.Logger(ctx).Info(utils.LOG_MESSAGE_LIST_MATCH, "country", countryCode, "list", listMatch.Name, "action", listMatch.Action)
+	}
+	return listMatch, ok
+}
+
+// blockedTraceResult marks the result as stopped by the blocklist with a deny decision.
+func blockedTraceResult(result models.TraceResult, listMatch models.ListMatch) models.TraceResult {
+	result.List = &listMatch
+	result.Risk = &models.RiskAssessment{
+		Score:    utils.RISK_MAX_SCORE,
+		Decision: utils.RISK_DECISION_DENY,
+		Rules:    []models.FiredRule{{Name: listMatch.Name, Type: utils.RISK_RULE_LIST, Weight: utils.RISK_MAX_SCORE}},
+	}
+	return result
+}
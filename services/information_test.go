@@ -1,101 +1,496 @@
-package services
-
-import (
-	"errors"
-	"service_fraud/models"
-	"service_fraud/utils"
-	"testing"
-
-	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/mock"
-)
-
-type MockSecretsVault struct {
-	mock.Mock
-}
-
-func (m *MockSecretsVault) GetSecret(name string) (*string, error) {
-	args := m.Called(name)
-	return args.Get(0).(*string), args.Error(1)
-}
-
-type MockDataStoreCountry struct {
-	mock.Mock
-}
-
-func (m *MockDataStoreCountry) Set(key string, value models.CountryResponse) error {
-	return m.Called(key, value).Error(0)
-}
-
-func (m *MockDataStoreCountry) Get(key string) (models.CountryResponse, error) {
-	args := m.Called(key)
-	return args.Get(0).(models.CountryResponse), args.Error(1)
-}
-
-func (m *MockDataStoreCountry) Expire(key string) error {
-	return m.Called(key).Error(0)
-}
-
-type MockDataStoreCurrency struct {
-	mock.Mock
-}
-
-func (m *MockDataStoreCurrency) Set(key string, value models.CurrencyResponse) error {
-	return m.Called(key, value).Error(0)
-}
-
-func (m *MockDataStoreCurrency) Get(key string) (models.CurrencyResponse, error) {
-	args := m.Called(key)
-	return args.Get(0).(models.CurrencyResponse), args.Error(1)
-}
-
-func (m *MockDataStoreCurrency) Expire(key string) error {
-	return m.Called(key).Error(0)
-}
-
-func TestGeolocation_Success(t *testing.T) {
-	mockSecrets := new(MockSecretsVault)
-	apiKey := "dummyApiKey"
-	mockSecrets.On("GetSecret", utils.SECRET_API_IP_KEY).Return(&apiKey, nil)
-
-	service := InformationService{secrets: mockSecrets}
-	ipResponse := service.Geolocation("192.168.1.1")
-
-	assert.NotNil(t, ipResponse)
-
-}
-
-func TestGetCountryInformation_Success(t *testing.T) {
-	mockSecrets := new(MockSecretsVault)
-	mockCountryStore := new(MockDataStoreCountry)
-	service := NewInformationService(mockSecrets, mockCountryStore, nil)
-
-	mockCountryStore.On("Get", "CountryName").Return(models.CountryResponse{}, nil)
-
-	countryResponse := service.GetCountryInformation("CountryName")
-
-	assert.NotNil(t, countryResponse)
-}
-
-func TestGetCountryInformation_ErrorOnRequest(t *testing.T) {
-	mockSecrets := new(MockSecretsVault)
-	mockCountryStore := new(MockDataStoreCountry)
-	service := NewInformationService(mockSecrets, mockCountryStore, nil)
-
-	mockCountryStore.On("Get", "CountryName").Return(models.CountryResponse{}, errors.New("not found"))
-
-	countryResponse := service.GetCountryInformation("CountryName")
-
-	assert.True(t, countryResponse.HasError())
-}
-
-func TestGetCurrencyInformation_Success(t *testing.T) {
-	mockSecrets := new(MockSecretsVault)
-	apiKey := "dummyCurrencyApiKey"
-	mockSecrets.On("GetSecret", utils.SECRET_API_CURRENCY_KEY).Return(&apiKey, nil)
-
-	service := InformationService{secrets: mockSecrets}
-	currencyResponse := service.GetCurrencyInformation()
-
-	assert.NotNil(t, currencyResponse)
-}
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"service_fraud/models"
+	"service_fraud/utils"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockSecretsVault struct {
+	mock.Mock
+}
+
+func (m *MockSecretsVault) GetSecret(ctx context.Context, name string) (*string, error) {
+	args := m.Called(name)
+	return args.Get(0).(*string), args.Error(1)
+}
+
+type MockDataStoreCountry struct {
+	mock.Mock
+}
+
+func (m *MockDataStoreCountry) Set(key string, value models.CountryResponse) error {
+	return m.Called(key, value).Error(0)
+}
+
+func (m *MockDataStoreCountry) Get(key string) (models.CountryResponse, error) {
+	args := m.Called(key)
+	return args.Get(0).(models.CountryResponse), args.Error(1)
+}
+
+func (m *MockDataStoreCountry) Expire(key string) error {
+	return m.Called(key).Error(0)
+}
+
+type MockDataStoreCurrency struct {
+	mock.Mock
+}
+
+func (m *MockDataStoreCurrency) Set(key string, value models.CurrencyResponse) error {
+	return m.Called(key, value).Error(0)
+}
+
+func (m *MockDataStoreCurrency) Get(key string) (models.CurrencyResponse, error) {
+	args := m.Called(key)
+	return args.Get(0).(models.CurrencyResponse), args.Error(1)
+}
+
+func (m *MockDataStoreCurrency) Expire(key string) error {
+	return m.Called(key).Error(0)
+}
+
+func TestGeolocation_Success(t *testing.T) {
+	mockSecrets := new(MockSecretsVault)
+	apiKey := "dummyApiKey"
+	mockSecrets.On("GetSecret", utils.SECRET_API_IP_KEY).Return(&apiKey, nil)
+
+	service := InformationService{secrets: mockSecrets}
+	ipResponse := service.Geolocation(context.Background(), "192.168.1.1")
+
+	assert.NotNil(t, ipResponse)
+
+}
+
+func TestGetCountryInformation_Success(t *testing.T) {
+	mockSecrets := new(MockSecretsVault)
+	mockCountryStore := new(MockDataStoreCountry)
+	service := NewInformationService(mockSecrets, nil, mockCountryStore)
+
+	mockCountryStore.On("Get", "CountryName").Return(models.CountryResponse{}, nil)
+
+	countryResponse := service.GetCountryInformation(context.Background(), "CountryName")
+
+	assert.NotNil(t, countryResponse)
+}
+
+func TestGetCountryInformation_ErrorOnRequest(t *testing.T) {
+	mockSecrets := new(MockSecretsVault)
+	mockCountryStore := new(MockDataStoreCountry)
+	service := NewInformationService(mockSecrets, nil, mockCountryStore)
+
+	mockCountryStore.On("Get", "CountryName").Return(models.CountryResponse{}, errors.New("not found"))
+
+	countryResponse := service.GetCountryInformation(context.Background(), "CountryName")
+
+	assert.True(t, countryResponse.HasError())
+}
+
+func TestGetCurrencyInformation_Success(t *testing.T) {
+	mockSecrets := new(MockSecretsVault)
+	apiKey := "dummyCurrencyApiKey"
+	mockSecrets.On("GetSecret", utils.SECRET_API_CURRENCY_KEY).Return(&apiKey, nil)
+
+	service := InformationService{secrets: mockSecrets}
+	currencyResponse := service.GetCurrencyInformation(context.Background())
+
+	assert.NotNil(t, currencyResponse)
+}
+
+// newFakeUpstreams starts fake ipapi, restcountries and fixer servers and returns their
+// endpoints along with a function listing the paths requested to the fake ipapi.
+func newFakeUpstreams(t *testing.T) (Endpoints, func() []string) {
+	var lock sync.Mutex
+	var ipPaths []string
+	ipApi := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		ipPaths = append(ipPaths, r.URL.Path)
+		lock.Unlock()
+		w.Write([]byte(`{"ip": "2800:810:400::1", "continent_code": "SA", "country_code": "AR",
+			"country_name": "Argentina", "region_name": "Buenos Aires", "latitude": -34.6, "longitude": -58.4}`))
+	}))
+	countryApi := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"cca2": "AR", "currencies": {"ARS": {"name": "Argentine peso"}}, "timezones": ["UTC-03:00"]}]`))
+	}))
+	currencyApi := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/latest" {
+			w.Write([]byte(`{"success": true, "historical": true, "date": "2024-04-20", "base": "EUR", "rates": {"USD": 1.1, "ARS": 900}}`))
+			return
+		}
+		w.Write([]byte(`{"success": true, "base": "EUR", "rates": {"USD": 1.1, "ARS": 1050}}`))
+	}))
+	t.Cleanup(ipApi.Close)
+	t.Cleanup(countryApi.Close)
+	t.Cleanup(currencyApi.Close)
+
+	endpoints := Endpoints{
+		IpApiURL:       ipApi.URL + "/api/%s?access_key=%s",
+		CountryApiURL:  countryApi.URL + "/v3.1/name/%s",
+		CurrencyApiURL: currencyApi.URL + "/api/latest?access_key=%s",
+		// The day of the historical rates is the path, as in fixer.
+		CurrencyHistoryURL: currencyApi.URL + "/api/%s?access_key=%s",
+	}
+	return endpoints, func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]string(nil), ipPaths...)
+	}
+}
+
+func newTestInformationService(t *testing.T) (*InformationService, func() []string) {
+	mockSecrets := new(MockSecretsVault)
+	apiKey := "dummyApiKey"
+	mockSecrets.On("GetSecret", mock.Anything).Return(&apiKey, nil)
+
+	// A private channel keeps the shared stats service out of these tests.
+	endpoints, ipPaths := newFakeUpstreams(t)
+	service := &InformationService{
+		secrets:          mockSecrets,
+		processed:        make(chan models.StatsRequest, 10),
+		ipDataStore:      NewRequestDataStore[string, models.IpApiResponse](),
+		countryDataStore: NewRequestDataStore[string, models.CountryResponse](),
+		endpoints:        endpoints,
+	}
+	service.rates = NewRatesManager(DefaultRatesPolicy(), service)
+	return service, ipPaths
+}
+
+func TestGetAllProducts_IPv6(t *testing.T) {
+	service, ipPaths := newTestInformationService(t)
+
+	result, err := service.GetAllProducts(context.Background(), "2800:810:400::1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Argentina", result.Country)
+	assert.Equal(t, []string{"/api/2800:810:400::1"}, ipPaths())
+}
+
+func TestGetAllProducts_CanonicalIpIsCached(t *testing.T) {
+	service, ipPaths := newTestInformationService(t)
+
+	for _, ip := range []string{"2800:810:400::1", "2800:0810:0400:0000:0000:0000:0000:0001", "2800:810:400:0::1"} {
+		_, err := service.GetAllProducts(context.Background(), ip)
+		assert.NoError(t, err)
+	}
+	for _, ip := range []string{"1.1.1.1", "::ffff:1.1.1.1"} {
+		_, err := service.GetAllProducts(context.Background(), ip)
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, []string{"/api/2800:810:400::1", "/api/1.1.1.1"}, ipPaths())
+}
+
+func TestGetAllProducts_NonRoutableIp(t *testing.T) {
+	service, ipPaths := newTestInformationService(t)
+
+	for _, ip := range []string{"10.0.0.1", "127.0.0.1", "100.64.0.1", "::ffff:192.168.0.1", "fe80::1", "2001:db8::1"} {
+		_, err := service.GetAllProducts(context.Background(), ip)
+
+		var nonRoutableError *models.NonRoutableIpError
+		assert.ErrorAs(t, err, &nonRoutableError)
+		assert.Equal(t, utils.ERR_CODE_NON_ROUTABLE_IP, nonRoutableError.Code)
+		assert.NotEmpty(t, nonRoutableError.Category)
+	}
+
+	assert.Empty(t, ipPaths())
+}
+
+func TestGetAllProducts_References(t *testing.T) {
+	service, _ := newTestInformationService(t)
+	references := []models.ReferenceLocation{
+		{Name: "Madrid", Latitude: 40.4168, Longitude: -3.7038},
+		{Name: "Buenos Aires", Latitude: -34.61315, Longitude: -58.37723},
+	}
+	service.SetReferences(references, false)
+
+	result, err := service.GetAllProducts(context.Background(), "2800:810:400::1")
+
+	require.NoError(t, err)
+	assert.Equal(t, "Buenos Aires", result.Distance.Name)
+	assert.Len(t, result.Distances, 2)
+	assert.Equal(t, "Madrid", result.Distances[0].Name)
+
+	service.SetReferences(references, true)
+
+	result, err = service.GetAllProducts(context.Background(), "2800:810:400::1")
+
+	require.NoError(t, err)
+	assert.Equal(t, []models.Distance{result.Distance}, result.Distances)
+}
+
+func TestGetAllProducts_TargetCurrency(t *testing.T) {
+	service, _ := newTestInformationService(t)
+
+	result, err := service.GetAllProducts(context.Background(), "2800:810:400::1")
+
+	require.NoError(t, err)
+	require.Len(t, result.Currencies, 1)
+	assert.Equal(t, "USD", result.Currencies[0].Target)
+	assert.InDelta(t, 1.1/1050, result.Currencies[0].Rate, 1e-12)
+
+	service.SetTargetCurrency("EUR")
+
+	result, err = service.GetAllProducts(context.Background(), "2800:810:400::1")
+
+	require.NoError(t, err)
+	assert.Equal(t, "EUR", result.Currencies[0].Target)
+	assert.InDelta(t, 1/1050.0, result.Currencies[0].Rate, 1e-12)
+	assert.InDelta(t, 1.1/1050, result.Currencies[0].RateUSD, 1e-12)
+}
+
+func TestGetAllProducts_Metrics(t *testing.T) {
+	service, _ := newTestInformationService(t)
+	metrics := NewMetrics()
+	service.SetMetrics(metrics)
+
+	for _, ip := range []string{"2800:810:400::1", "2800:810:400::1", "10.0.0.1"} {
+		service.GetAllProducts(context.Background(), ip)
+	}
+
+	assert.Equal(t, 2.0, metrics.traces.Value(utils.METRICS_CODE_OK))
+	assert.Equal(t, 1.0, metrics.traces.Value(strconv.Itoa(utils.ERR_CODE_NON_ROUTABLE_IP)))
+	assert.Equal(t, uint64(3), metrics.traceDuration.Count(utils.METRICS_CODE_OK)+metrics.traceDuration.Count(strconv.Itoa(utils.ERR_CODE_NON_ROUTABLE_IP)))
+	// The second trace of the IP is answered by the caches and the snapshot of the rates.
+	assert.Equal(t, 1.0, metrics.upstreamRequests.Value(utils.METRICS_UPSTREAM_IPAPI, "200"))
+	assert.Equal(t, 1.0, metrics.upstreamRequests.Value(utils.METRICS_UPSTREAM_RESTCOUNTRIES, "200"))
+	assert.Equal(t, 1.0, metrics.upstreamRequests.Value(utils.METRICS_UPSTREAM_FIXER, "200"))
+	assert.Equal(t, uint64(1), metrics.upstreamDuration.Count(utils.METRICS_UPSTREAM_FIXER))
+}
+
+func TestGetAllProducts_Metrics_UpstreamError(t *testing.T) {
+	service, _ := newTestInformationService(t)
+	metrics := NewMetrics()
+	service.SetMetrics(metrics)
+	ipApi := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(ipApi.Close)
+	service.endpoints.IpApiURL = ipApi.URL + "/api/%s?access_key=%s"
+
+	_, err := service.GetAllProducts(context.Background(), "2800:810:400::1")
+
+	require.Error(t, err)
+	code := strconv.Itoa(utils.ERR_CODE_IP_SERVICE)
+	assert.Equal(t, 1.0, metrics.traces.Value(code))
+	assert.Equal(t, 1.0, metrics.upstreamRequests.Value(utils.METRICS_UPSTREAM_IPAPI, "503"))
+	assert.Equal(t, 1.0, metrics.upstreamErrors.Value(utils.METRICS_UPSTREAM_IPAPI, code))
+	assert.Equal(t, 0.0, metrics.upstreamRequests.Value(utils.METRICS_UPSTREAM_RESTCOUNTRIES, "200"))
+}
+
+// captureLog sets a default logger that writes JSON lines to the returned buffer during the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	logger, err := utils.NewLogger(&buf, utils.LOG_FORMAT_JSON, "debug")
+	require.NoError(t, err)
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+// logLines decodes the JSON lines written to the buffer.
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var lines []map[string]any
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var line map[string]any
+		require.NoError(t, dec.Decode(&line))
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestGetAllProducts_TraceId(t *testing.T) {
+	buf := captureLog(t)
+	service, _ := newTestInformationService(t)
+	ipApi := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(ipApi.Close)
+	service.endpoints.IpApiURL = ipApi.URL + "/api/%s?access_key=%s"
+
+	_, err := service.GetAllProducts(context.Background(), "2800:810:400::1")
+
+	require.Error(t, err)
+	lines := logLines(t, buf)
+	require.Len(t, lines, 2)
+	assert.Equal(t, utils.ERR_MESSAGE_UPSTREAM_STATUS, lines[0]["msg"])
+	assert.Equal(t, utils.METRICS_UPSTREAM_IPAPI, lines[0]["upstream"])
+	assert.EqualValues(t, http.StatusServiceUnavailable, lines[0]["status"])
+	assert.Equal(t, utils.LOG_MESSAGE_TRACE_FINISHED, lines[1]["msg"])
+	assert.EqualValues(t, utils.ERR_CODE_IP_SERVICE, lines[1]["code"])
+	assert.NotEmpty(t, lines[0][utils.LOG_KEY_TRACE_ID])
+	assert.Equal(t, lines[0][utils.LOG_KEY_TRACE_ID], lines[1][utils.LOG_KEY_TRACE_ID])
+}
+
+func TestGetAllProducts_TraceId_Stats(t *testing.T) {
+	buf := captureLog(t)
+	service, _ := newTestInformationService(t)
+
+	for i := 0; i < 2; i++ {
+		_, err := service.GetAllProducts(context.Background(), "2800:810:400::1")
+		require.NoError(t, err)
+	}
+
+	lines := logLines(t, buf)
+	require.Len(t, lines, 2)
+	first, second := <-service.processed, <-service.processed
+	assert.Equal(t, lines[0][utils.LOG_KEY_TRACE_ID], first.TraceId)
+	assert.Equal(t, lines[1][utils.LOG_KEY_TRACE_ID], second.TraceId)
+	assert.NotEqual(t, first.TraceId, second.TraceId)
+}
+
+func TestGetAllProducts_Timeout(t *testing.T) {
+	service, _ := newTestInformationService(t)
+	ipApi := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	t.Cleanup(ipApi.Close)
+	service.endpoints.IpApiURL = ipApi.URL + "/api/%s?access_key=%s"
+	service.SetTraceTimeout(50 * time.Millisecond)
+
+	since := time.Now()
+	_, err := service.GetAllProducts(context.Background(), "2800:810:400::1")
+
+	var canceledError *models.TraceCanceledError
+	require.ErrorAs(t, err, &canceledError)
+	assert.Equal(t, utils.ERR_CODE_TRACE_TIMEOUT, canceledError.Code)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(since), time.Second)
+}
+
+func TestGetAllProducts_Canceled(t *testing.T) {
+	service, ipPaths := newTestInformationService(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := service.GetAllProducts(ctx, "2800:810:400::1")
+
+	var canceledError *models.TraceCanceledError
+	require.ErrorAs(t, err, &canceledError)
+	assert.Equal(t, utils.ERR_CODE_TRACE_CANCELED, canceledError.Code)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, ipPaths())
+}
+
+func TestGetAllProducts_KeepsTraceId(t *testing.T) {
+	buf := captureLog(t)
+	service, _ := newTestInformationService(t)
+
+	_, err := service.GetAllProducts(utils.WithTraceId(context.Background(), "request-1"), "2800:810:400::1")
+
+	require.NoError(t, err)
+	lines := logLines(t, buf)
+	require.Len(t, lines, 1)
+	assert.Equal(t, "request-1", lines[0][utils.LOG_KEY_TRACE_ID])
+	assert.Equal(t, "request-1", (<-service.processed).TraceId)
+}
+
+func TestGetAllProducts_RetriesUpstream(t *testing.T) {
+	service, _ := newTestInformationService(t)
+	var calls atomic.Int32
+	ipApi := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"ip": "2800:810:400::1", "continent_code": "SA", "country_code": "AR", "country_name": "Argentina",
+			"region_name": "Buenos Aires", "latitude": -34.6, "longitude": -58.4}`))
+	}))
+	t.Cleanup(ipApi.Close)
+	service.endpoints.IpApiURL = ipApi.URL + "/api/%s?access_key=%s"
+	service.SetUpstreams(NewUpstreams(fastRetries(3), DefaultBreakerPolicy()))
+
+	result, err := service.GetAllProducts(context.Background(), "2800:810:400::1")
+
+	require.NoError(t, err)
+	assert.Equal(t, "AR", result.ISO)
+	assert.EqualValues(t, 2, calls.Load())
+}
+
+func TestGetHealth(t *testing.T) {
+	service, _ := newTestInformationService(t)
+	ipApi, _ := newFlakyUpstream(t, nil, http.StatusInternalServerError)
+	service.endpoints.IpApiURL = ipApi.URL + "/api/%s?access_key=%s"
+	service.SetUpstreams(NewUpstreams(fastRetries(1), BreakerPolicy{FailureThreshold: 1, OpenDuration: time.Minute}))
+	assert.True(t, service.GetHealth().Healthy())
+
+	service.GetAllProducts(context.Background(), "2800:810:400::1")
+
+	health := service.GetHealth()
+	assert.Equal(t, utils.HEALTH_STATUS_DEGRADED, health.Status)
+	require.Len(t, health.Upstreams, 3)
+	assert.Equal(t, utils.METRICS_UPSTREAM_IPAPI, health.Upstreams[0].Name)
+	assert.Equal(t, utils.CIRCUIT_STATE_OPEN, health.Upstreams[0].State)
+	assert.Equal(t, utils.CIRCUIT_STATE_CLOSED, health.Upstreams[1].State)
+}
+
+func TestGeolocation_ProviderError(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		code   int
+	}{
+		{"usage limit", http.StatusOK, `{"success": false, "error": {"code": 104, "type": "usage_limit_reached", "info": "Your monthly usage limit has been reached."}}`, utils.ERR_CODE_LIMIT_REACHED},
+		{"invalid key", http.StatusOK, `{"success": false, "error": {"code": 101, "type": "invalid_access_key"}}`, utils.ERR_CODE_INVALID_API_KEY},
+		{"invalid ip", http.StatusOK, `{"success": false, "error": {"code": 106, "type": "invalid_ip_address"}}`, utils.ERR_CODE_INVALID_IP},
+		{"rate limit envelope", http.StatusTooManyRequests, `{"success": false, "error": {"code": 106, "type": "rate_limit_reached"}}`, utils.ERR_CODE_RATE_LIMITED},
+		{"rate limit status", http.StatusTooManyRequests, ``, utils.ERR_CODE_RATE_LIMITED},
+		{"unknown error", http.StatusOK, `{"success": false, "error": {"code": 303, "type": "batch_not_supported"}}`, utils.ERR_CODE_IP_SERVICE},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, _ := newTestInformationService(t)
+			ipApi := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			t.Cleanup(ipApi.Close)
+			service.endpoints.IpApiURL = ipApi.URL + "/api/%s?access_key=%s"
+
+			_, err := service.GetAllProducts(context.Background(), "2800:810:400::1")
+
+			code, _ := models.ErrorDetails(err)
+			assert.Equal(t, tt.code, code)
+		})
+	}
+}
+
+func TestGetCurrencyInformation_ProviderError(t *testing.T) {
+	service, _ := newTestInformationService(t)
+	currencyApi := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"success": false, "error": {"code": 104, "type": "usage_limit_reached"}}`))
+	}))
+	t.Cleanup(currencyApi.Close)
+	service.endpoints.CurrencyApiURL = currencyApi.URL + "/api/latest?access_key=%s"
+
+	_, err := service.GetAllProducts(context.Background(), "2800:810:400::1")
+
+	var currencyError *models.CurrencyApiError
+	require.ErrorAs(t, err, &currencyError)
+	assert.Equal(t, utils.ERR_CODE_LIMIT_REACHED, currencyError.Code)
+	var providerError *models.ProviderApiError
+	require.ErrorAs(t, err, &providerError)
+	assert.Equal(t, utils.METRICS_UPSTREAM_FIXER, providerError.Provider)
+	assert.Equal(t, 104, providerError.ProviderCode)
+	assert.Equal(t, "usage_limit_reached", providerError.ProviderType)
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"service_fraud/models"
+	"service_fraud/utils"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ListService matches the IPs against allowlists and blocklists of IP ranges and country codes
+// loaded from files. The files are reloaded when they change, see Watch.
+type ListService struct {
+	lock  sync.RWMutex
+	lists []*accessList
+}
+
+// accessList holds the entries of a list file and the state of the file when it was loaded.
+type accessList struct {
+	definition models.ListDefinition
+	modTime    time.Time
+	size       int64
+	prefixes   *utils.PrefixSet
+	countries  map[string]bool
+}
+
+// NewListService loads the given lists. A list that cannot be loaded starts empty and is
+// loaded once its file is fixed, the errors of all those lists are returned together.
+func NewListService(definitions []models.ListDefinition) (*ListService, error) {
+	service := &ListService{}
+	var errs []error
+	for _, definition := range definitions {
+		if err := validateListDefinition(definition); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		list, err := loadAccessList(definition)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", definition.Name, err))
+			list = newAccessList(definition)
+		}
+		service.lists = append(service.lists, list)
+	}
+	return service, errors.Join(errs...)
+}
+
+// validateListDefinition checks that the list has a name, a path and a known type and action.
+func validateListDefinition(definition models.ListDefinition) error {
+	switch {
+	case definition.Name == "" || definition.Path == "":
+		return fmt.Errorf("the list %q requires a name and a path", definition.Name)
+	case definition.Type != utils.LIST_TYPE_CIDR && definition.Type != utils.LIST_TYPE_COUNTRY:
+		return fmt.Errorf("the list %q has an unknown type: %s", definition.Name, definition.Type)
+	case definition.Action != utils.LIST_ACTION_ALLOW && definition.Action != utils.LIST_ACTION_BLOCK:
+		return fmt.Errorf("the list %q has an unknown action: %s", definition.Name, definition.Action)
+	}
+	return nil
+}
+
+// MatchIp returns the first IP range list, in configuration order, that contains the IP.
+func (l *ListService) MatchIp(ip string) (models.ListMatch, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return models.ListMatch{}, false
+	}
+
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	for _, list := range l.lists {
+		if list.definition.Type != utils.LIST_TYPE_CIDR {
+			continue
+		}
+		if prefix, ok := list.prefixes.Lookup(addr); ok {
+			return list.match(prefix.String()), true
+		}
+	}
+	return models.ListMatch{}, false
+}
+
+// MatchCountry returns the first country list, in configuration order, that contains the
+// ISO code of the country.
+func (l *ListService) MatchCountry(countryCode string) (models.ListMatch, bool) {
+	code := strings.ToUpper(strings.TrimSpace(countryCode))
+	if code == "" {
+		return models.ListMatch{}, false
+	}
+
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	for _, list := range l.lists {
+		if list.definition.Type == utils.LIST_TYPE_COUNTRY && list.countries[code] {
+			return list.match(code), true
+		}
+	}
+	return models.ListMatch{}, false
+}
+
+// Reload loads again the lists whose file changed since the last load. A list that fails to
+// load keeps its previous entries.
+func (l *ListService) Reload() {
+	l.lock.RLock()
+	lists := l.lists
+	l.lock.RUnlock()
+
+	for _, list := range lists {
+		info, err := os.Stat(list.definition.Path)
+		if err != nil {
+			slog.Error(utils.ERR_MESSAGE_LIST_LOAD, "list", list.definition.Name, "error", err)
+			continue
+		}
+		l.lock.RLock()
+		changed := !info.ModTime().Equal(list.modTime) || info.Size() != list.size
+		l.lock.RUnlock()
+		if !changed {
+			continue
+		}
+
+		loaded, err := loadAccessList(list.definition)
+		if err != nil {
+			slog.Error(utils.ERR_MESSAGE_LIST_LOAD, "list", list.definition.Name, "error", err)
+			continue
+		}
+		l.lock.Lock()
+		*list = *loaded
+		l.lock.Unlock()
+	}
+}
+
+// Watch reloads the changed lists every interval until the returned function is called, which
+// waits for the reload in progress to finish.
+func (l *ListService) Watch(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				l.Reload()
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		<-stopped
+	}
+}
+
+// newAccessList creates an empty list for the given definition.
+func newAccessList(definition models.ListDefinition) *accessList {
+	return &accessList{definition: definition, prefixes: utils.NewPrefixSet(), countries: map[string]bool{}}
+}
+
+// loadAccessList creates a list with the entries of the file of the given definition.
+func loadAccessList(definition models.ListDefinition) (*accessList, error) {
+	list := newAccessList(definition)
+	if err := list.load(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// match builds the ListMatch of the list for the given entry.
+func (a *accessList) match(entry string) models.ListMatch {
+	return models.ListMatch{
+		Name:   a.definition.Name,
+		Type:   a.definition.Type,
+		Action: a.definition.Action,
+		Entry:  entry,
+	}
+}
+
+// load reads the entries of the list file, one per line. Empty lines and lines starting with
+// '#' are ignored, and an invalid entry fails the whole load.
+func (a *accessList) load() error {
+	file, err := os.Open(a.definition.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		if err := a.add(entry); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	a.modTime = info.ModTime()
+	a.size = info.Size()
+	count := a.prefixes.Len() + len(a.countries)
+	slog.Info(utils.LOG_MESSAGE_LIST_RELOADED, "list", a.definition.Name, "entries", count)
+	return nil
+}
+
+// add parses the entry according to the type of the list. The IP range lists accept CIDR
+// prefixes and single addresses.
+func (a *accessList) add(entry string) error {
+	if a.definition.Type == utils.LIST_TYPE_COUNTRY {
+		if len(entry) != 2 {
+			return fmt.Errorf("invalid country code: %s", entry)
+		}
+		a.countries[strings.ToUpper(entry)] = true
+		return nil
+	}
+
+	if !strings.Contains(entry, "/") {
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return err
+		}
+		a.prefixes.Add(netip.PrefixFrom(addr.WithZone(""), addr.BitLen()))
+		return nil
+	}
+	prefix, err := netip.ParsePrefix(entry)
+	if err != nil {
+		return err
+	}
+	a.prefixes.Add(prefix)
+	return nil
+}
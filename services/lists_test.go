@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"service_fraud/models"
+	"service_fraud/utils"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeListFile writes the entries to a list file in the test directory and returns its path.
+func writeListFile(t *testing.T, dir string, name string, content string) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func newTestListService(t *testing.T) (*ListService, string) {
+	dir := t.TempDir()
+	lists, err := NewListService([]models.ListDefinition{
+		{Name: "partners", Type: utils.LIST_TYPE_CIDR, Action: utils.LIST_ACTION_ALLOW,
+			Path: writeListFile(t, dir, "partners.txt", "# partner offices\n1.1.1.0/24\n2800:810::/32\n")},
+		{Name: "abuse", Type: utils.LIST_TYPE_CIDR, Action: utils.LIST_ACTION_BLOCK,
+			Path: writeListFile(t, dir, "abuse.txt", "1.0.0.0/8\n203.0.113.7\n")},
+		{Name: "sanctioned", Type: utils.LIST_TYPE_COUNTRY, Action: utils.LIST_ACTION_BLOCK,
+			Path: writeListFile(t, dir, "sanctioned.txt", "kp\nIR\n\n")},
+	})
+	require.NoError(t, err)
+	return lists, dir
+}
+
+func TestListService_MatchIp(t *testing.T) {
+	lists, _ := newTestListService(t)
+
+	tests := []struct {
+		ip    string
+		list  string
+		entry string
+	}{
+		{"1.1.1.1", "partners", "1.1.1.0/24"},
+		{"1.2.3.4", "abuse", "1.0.0.0/8"},
+		{"203.0.113.7", "abuse", "203.0.113.7/32"},
+		{"2800:810:400::1", "partners", "2800:810::/32"},
+		{"8.8.8.8", "", ""},
+		{"invalid_ip", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			match, ok := lists.MatchIp(tt.ip)
+
+			assert.Equal(t, tt.list != "", ok)
+			assert.Equal(t, tt.list, match.Name)
+			assert.Equal(t, tt.entry, match.Entry)
+		})
+	}
+}
+
+func TestListService_MatchCountry(t *testing.T) {
+	lists, _ := newTestListService(t)
+
+	match, ok := lists.MatchCountry("kp")
+	assert.True(t, ok)
+	assert.Equal(t, models.ListMatch{Name: "sanctioned", Type: utils.LIST_TYPE_COUNTRY, Action: utils.LIST_ACTION_BLOCK, Entry: "KP"}, match)
+
+	_, ok = lists.MatchCountry("AR")
+	assert.False(t, ok)
+}
+
+func TestNewListService_InvalidLists(t *testing.T) {
+	dir := t.TempDir()
+
+	lists, err := NewListService([]models.ListDefinition{
+		{Name: "invalid_entry", Type: utils.LIST_TYPE_CIDR, Action: utils.LIST_ACTION_BLOCK,
+			Path: writeListFile(t, dir, "invalid.txt", "1.0.0.0/8\n1.2.3.4/40\n")},
+		{Name: "missing", Type: utils.LIST_TYPE_COUNTRY, Action: utils.LIST_ACTION_BLOCK, Path: filepath.Join(dir, "missing.txt")},
+		{Name: "unknown_action", Type: utils.LIST_TYPE_COUNTRY, Action: "review", Path: filepath.Join(dir, "missing.txt")},
+		{Name: "valid", Type: utils.LIST_TYPE_COUNTRY, Action: utils.LIST_ACTION_BLOCK,
+			Path: writeListFile(t, dir, "valid.txt", "KP\n")},
+	})
+
+	assert.ErrorContains(t, err, "invalid_entry: line 2")
+	assert.ErrorContains(t, err, "missing")
+	assert.ErrorContains(t, err, "unknown action")
+	_, ok := lists.MatchIp("1.2.3.4")
+	assert.False(t, ok)
+	_, ok = lists.MatchCountry("KP")
+	assert.True(t, ok)
+}
+
+func TestListService_Reload(t *testing.T) {
+	lists, dir := newTestListService(t)
+	stop := lists.Watch(10 * time.Millisecond)
+
+	writeListFile(t, dir, "abuse.txt", "8.8.8.0/24\n")
+	assert.Eventually(t, func() bool {
+		_, blocked := lists.MatchIp("8.8.8.8")
+		return blocked
+	}, time.Second, 10*time.Millisecond)
+	_, ok := lists.MatchIp("1.2.3.4")
+	assert.False(t, ok)
+
+	// An invalid file keeps the previous entries.
+	stop()
+	writeListFile(t, dir, "abuse.txt", "8.8.8.0/24\nnot_a_range\n")
+	lists.Reload()
+	_, ok = lists.MatchIp("8.8.8.8")
+	assert.True(t, ok)
+}
+
+func TestGetAllProducts_Lists(t *testing.T) {
+	service, ipPaths := newTestInformationService(t)
+	lists, dir := newTestListService(t)
+	service.SetListMatcher(lists)
+	service.SetRiskEvaluator(NewRiskService(models.DefaultRiskPolicy()))
+
+	result, err := service.GetAllProducts(context.Background(), "1.2.3.4")
+	require.NoError(t, err)
+	assert.Equal(t, "abuse", result.List.Name)
+	assert.Equal(t, utils.RISK_DECISION_DENY, result.Risk.Decision)
+	assert.Empty(t, ipPaths())
+
+	result, err = service.GetAllProducts(context.Background(), "1.1.1.1")
+	require.NoError(t, err)
+	assert.Equal(t, "partners", result.List.Name)
+	assert.Equal(t, utils.RISK_DECISION_ALLOW, result.Risk.Decision)
+	assert.Equal(t, "Argentina", result.Country)
+
+	// The fake geolocation answers AR for every IP, so a country blocklist stops after it.
+	writeListFile(t, dir, "sanctioned.txt", "AR\n")
+	lists.Reload()
+	result, err = service.GetAllProducts(context.Background(), "8.8.8.8")
+	require.NoError(t, err)
+	assert.Equal(t, "sanctioned", result.List.Name)
+	assert.Equal(t, "AR", result.ISO)
+	assert.Equal(t, utils.RISK_DECISION_DENY, result.Risk.Decision)
+	assert.Empty(t, result.Currencies)
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"io"
+	"service_fraud/models"
+	"service_fraud/utils"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var instanceMetrics *Metrics
+var onceCreationMetrics sync.Once
+
+// Metrics holds the counters and latency histograms of the traces, the upstream calls, the
+// request caches and the stats, exposed in the Prometheus text format by the server. A nil
+// Metrics records nothing.
+type Metrics struct {
+	registry         *utils.MetricsRegistry
+	traces           *utils.CounterVec
+	traceDuration    *utils.HistogramVec
+	decisions        *utils.CounterVec
+	upstreamRequests *utils.CounterVec
+	upstreamDuration *utils.HistogramVec
+	upstreamErrors   *utils.CounterVec
+	upstreamRetries  *utils.CounterVec
+	circuitRejected  *utils.CounterVec
+	circuitChanges   *utils.CounterVec
+	cacheRequests    *utils.CounterVec
+	statsRequests    *utils.CounterVec
+	statsDuration    *utils.HistogramVec
+	statsStoreErrors *utils.CounterVec
+}
+
+// NewMetrics creates the metrics of the services in a new registry.
+func NewMetrics() *Metrics {
+	registry := utils.NewMetricsRegistry()
+	latency := utils.DefaultLatencyBuckets()
+	return &Metrics{
+		registry:         registry,
+		traces:           registry.Counter("service_fraud_traces_total", "Traces processed, by result code.", "code"),
+		traceDuration:    registry.Histogram("service_fraud_trace_duration_seconds", "Duration of the traces, by result code.", latency, "code"),
+		decisions:        registry.Counter("service_fraud_trace_decisions_total", "Risk decisions of the traces.", "decision"),
+		upstreamRequests: registry.Counter("service_fraud_upstream_requests_total", "Calls to the external APIs, by upstream and HTTP status.", "upstream", "status"),
+		upstreamDuration: registry.Histogram("service_fraud_upstream_request_duration_seconds", "Duration of the calls to the external APIs.", latency, "upstream"),
+		upstreamErrors:   registry.Counter("service_fraud_upstream_errors_total", "Failed calls to the external APIs, by upstream and error code.", "upstream", "code"),
+		upstreamRetries:  registry.Counter("service_fraud_upstream_retries_total", "Retried calls to the external APIs, by upstream and reason.", "upstream", "reason"),
+		circuitRejected:  registry.Counter("service_fraud_upstream_circuit_rejections_total", "Calls to the external APIs rejected by an open circuit breaker.", "upstream"),
+		circuitChanges:   registry.Counter("service_fraud_upstream_circuit_changes_total", "State changes of the circuit breakers, by upstream and new state.", "upstream", "state"),
+		cacheRequests:    registry.Counter("service_fraud_cache_requests_total", "Lookups in the request caches, by cache and result.", "cache", "result"),
+		statsRequests:    registry.Counter("service_fraud_stats_requests_total", "Requests recorded by the stats service."),
+		statsDuration:    registry.Histogram("service_fraud_stats_combine_duration_seconds", "Duration of recording a request in the stats.", latency),
+		statsStoreErrors: registry.Counter("service_fraud_stats_store_errors_total", "Requests that could not be persisted in the stats store."),
+	}
+}
+
+// DefaultMetrics returns the metrics shared by the services of the application.
+func DefaultMetrics() *Metrics {
+	onceCreationMetrics.Do(func() {
+		instanceMetrics = NewMetrics()
+	})
+	return instanceMetrics
+}
+
+// WriteText writes the metrics in the Prometheus text format, nothing for a nil Metrics.
+func (m *Metrics) WriteText(w io.Writer) error {
+	if m == nil {
+		return nil
+	}
+	return m.registry.WriteText(w)
+}
+
+// observeTrace records a trace with the code of its error, 'ok' when it succeeded, and the
+// decision of its risk assessment.
+func (m *Metrics) observeTrace(result models.TraceResult, err error, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	code := utils.METRICS_CODE_OK
+	if err != nil {
+		errCode, _ := models.ErrorDetails(err)
+		code = strconv.Itoa(errCode)
+	}
+	m.traces.Inc(code)
+	m.traceDuration.Observe(elapsed.Seconds(), code)
+	if err == nil && result.Risk != nil {
+		m.decisions.Inc(result.Risk.Decision)
+	}
+}
+
+// observeUpstream records a call to an external API. The status is the HTTP status code, 0 when
+// no response was received, and code the error code of the call, 0 when it succeeded.
+func (m *Metrics) observeUpstream(upstream string, status int, code int, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	statusLabel := utils.METRICS_STATUS_NO_RESPONSE
+	if status != 0 {
+		statusLabel = strconv.Itoa(status)
+	}
+	m.upstreamRequests.Inc(upstream, statusLabel)
+	m.upstreamDuration.Observe(elapsed.Seconds(), upstream)
+	if code != 0 {
+		m.upstreamErrors.Inc(upstream, strconv.Itoa(code))
+	}
+}
+
+// observeRetry records a retried call to an external API, the reason being the HTTP status
+// of the failed call or 'timeout'.
+func (m *Metrics) observeRetry(upstream, reason string) {
+	if m == nil {
+		return
+	}
+	m.upstreamRetries.Inc(upstream, reason)
+}
+
+// observeCircuitRejection records a call to an external API rejected by its open breaker.
+func (m *Metrics) observeCircuitRejection(upstream string) {
+	if m == nil {
+		return
+	}
+	m.circuitRejected.Inc(upstream)
+}
+
+// observeCircuitChange records the new state of the circuit breaker of an external API.
+func (m *Metrics) observeCircuitChange(upstream, state string) {
+	if m == nil {
+		return
+	}
+	m.circuitChanges.Inc(upstream, state)
+}
+
+// observeCache records a lookup in a request cache, the result being hit, miss or expired.
+func (m *Metrics) observeCache(cache, result string) {
+	if m == nil {
+		return
+	}
+	m.cacheRequests.Inc(cache, result)
+}
+
+// observeStats records a request combined in the stats and whether it could be persisted.
+func (m *Metrics) observeStats(elapsed time.Duration, stored bool) {
+	if m == nil {
+		return
+	}
+	m.statsRequests.Inc()
+	m.statsDuration.Observe(elapsed.Seconds())
+	if !stored {
+		m.statsStoreErrors.Inc()
+	}
+}
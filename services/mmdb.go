@@ -0,0 +1,392 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/netip"
+	"os"
+	"service_fraud/models"
+	"service_fraud/utils"
+)
+
+// mmdbMetadataMarker precedes the metadata section at the end of a MaxMind DB file.
+var mmdbMetadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// errMMDBCorrupt is returned when the database does not follow the MaxMind DB format.
+var errMMDBCorrupt = errors.New("invalid MaxMind DB file")
+
+// Data types of the MaxMind DB format.
+const (
+	mmdbExtended = iota
+	mmdbPointer
+	mmdbString
+	mmdbDouble
+	mmdbBytes
+	mmdbUint16
+	mmdbUint32
+	mmdbMap
+	mmdbInt32
+	mmdbUint64
+	mmdbUint128
+	mmdbArray
+	mmdbContainer
+	mmdbEndMarker
+	mmdbBool
+	mmdbFloat
+)
+
+// mmdbDataSeparator is the size of the zeroed section between the search tree and the data.
+const mmdbDataSeparator = 16
+
+// mmdbMaxDepth limits the nesting of the decoded values to protect against corrupt files.
+const mmdbMaxDepth = 32
+
+// MMDBGeolocation resolves the geolocation of an IP from a local MaxMind database in the
+// GeoLite2-City format, so it works without network access, quota or secrets.
+type MMDBGeolocation struct {
+	reader *mmdbReader
+}
+
+// NewMMDBGeolocation loads the MaxMind database stored in the given path.
+func NewMMDBGeolocation(path string) (*MMDBGeolocation, error) {
+	buffer, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := newMMDBReader(buffer)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &MMDBGeolocation{reader: reader}, nil
+}
+
+// Geolocation looks up the IP in the database and maps the GeoLite2-City record to an
+// IpApiResponse. An IP that is not in the database results in an empty response.
+func (g *MMDBGeolocation) Geolocation(ctx context.Context, ip string) models.IpApiResponse {
+	ipresp := models.IpApiResponse{IP: ip}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		utils.Logger(ctx).Error(utils.ERR_MESSAGE_MMDB_LOOKUP, "ip", ip, "error", err)
+		ipresp.Error = *models.NewErrorIpApiError(utils.ERR_CODE_IP_SERVICE, utils.ERR_USER_MESSAGE_IP_SERVICE)
+		return ipresp
+	}
+	addr = addr.Unmap()
+
+	record, found, err := g.reader.lookup(addr)
+	if err != nil {
+		utils.Logger(ctx).Error(utils.ERR_MESSAGE_MMDB_LOOKUP, "ip", ip, "error", err)
+		ipresp.Error = *models.NewErrorIpApiError(utils.ERR_CODE_IP_SERVICE, utils.ERR_USER_MESSAGE_IP_SERVICE)
+		return ipresp
+	}
+	if !found {
+		return ipresp
+	}
+
+	ipresp.Type = "ipv6"
+	if addr.Is4() {
+		ipresp.Type = "ipv4"
+	}
+	ipresp.ContinentCode = mmdbLookupString(record, "continent", "code")
+	ipresp.ContinentName = mmdbLookupString(record, "continent", "names", "en")
+	ipresp.CountryCode = mmdbLookupString(record, "country", "iso_code")
+	ipresp.CountryName = mmdbLookupString(record, "country", "names", "en")
+	ipresp.RegionCode = mmdbLookupString(record, "subdivisions", 0, "iso_code")
+	ipresp.RegionName = mmdbLookupString(record, "subdivisions", 0, "names", "en")
+	ipresp.City = mmdbLookupString(record, "city", "names", "en")
+	ipresp.Zip = mmdbLookupString(record, "postal", "code")
+	ipresp.Latitude, _ = mmdbLookup(record, "location", "latitude").(float64)
+	ipresp.Longitude, _ = mmdbLookup(record, "location", "longitude").(float64)
+	if geonameID, ok := mmdbLookup(record, "city", "geoname_id").(uint64); ok {
+		ipresp.Location.GeonameID = int64(geonameID)
+	}
+	ipresp.Location.IsEu, _ = mmdbLookup(record, "country", "is_in_european_union").(bool)
+	return ipresp
+}
+
+// mmdbLookup walks the decoded record following the given map keys and array indexes.
+func mmdbLookup(value any, path ...any) any {
+	for _, step := range path {
+		switch key := step.(type) {
+		case string:
+			m, ok := value.(map[string]any)
+			if !ok {
+				return nil
+			}
+			value = m[key]
+		case int:
+			a, ok := value.([]any)
+			if !ok || key >= len(a) {
+				return nil
+			}
+			value = a[key]
+		}
+	}
+	return value
+}
+
+// mmdbLookupString returns the string found in the given path of the record or an empty string.
+func mmdbLookupString(value any, path ...any) string {
+	str, _ := mmdbLookup(value, path...).(string)
+	return str
+}
+
+// mmdbReader reads the search tree and the data section of a MaxMind DB file.
+type mmdbReader struct {
+	tree       []byte
+	data       mmdbDecoder
+	nodeCount  int
+	recordSize int
+	ipVersion  int
+	ipv4Start  int
+}
+
+// newMMDBReader validates the metadata of the database and prepares it for lookups.
+func newMMDBReader(buffer []byte) (*mmdbReader, error) {
+	markerIndex := bytes.LastIndex(buffer, mmdbMetadataMarker)
+	if markerIndex < 0 {
+		return nil, errMMDBCorrupt
+	}
+	metadata, _, err := mmdbDecoder{buffer: buffer[markerIndex+len(mmdbMetadataMarker):]}.decode(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	nodeCount, _ := mmdbLookup(metadata, "node_count").(uint64)
+	recordSize, _ := mmdbLookup(metadata, "record_size").(uint64)
+	ipVersion, _ := mmdbLookup(metadata, "ip_version").(uint64)
+	if recordSize != 24 && recordSize != 28 && recordSize != 32 {
+		return nil, fmt.Errorf("%w: unsupported record size %d", errMMDBCorrupt, recordSize)
+	}
+	if ipVersion != 4 && ipVersion != 6 {
+		return nil, fmt.Errorf("%w: unsupported ip version %d", errMMDBCorrupt, ipVersion)
+	}
+
+	treeSize := int(nodeCount) * int(recordSize) / 4
+	if treeSize+mmdbDataSeparator > markerIndex {
+		return nil, errMMDBCorrupt
+	}
+	r := &mmdbReader{
+		tree:       buffer[:treeSize],
+		data:       mmdbDecoder{buffer: buffer[treeSize+mmdbDataSeparator : markerIndex]},
+		nodeCount:  int(nodeCount),
+		recordSize: int(recordSize),
+		ipVersion:  int(ipVersion),
+	}
+
+	// The IPv4 addresses of an IPv6 database live in ::/96, so their lookups start 96 nodes deep.
+	if r.ipVersion == 6 {
+		for i := 0; i < 96 && r.ipv4Start < r.nodeCount; i++ {
+			r.ipv4Start = r.readRecord(r.ipv4Start, 0)
+		}
+	}
+	return r, nil
+}
+
+// lookup returns the record of the network that contains the address and whether it was found.
+func (r *mmdbReader) lookup(addr netip.Addr) (any, bool, error) {
+	node := 0
+	if addr.Is4() && r.ipVersion == 6 {
+		node = r.ipv4Start
+	} else if addr.Is6() && r.ipVersion == 4 {
+		return nil, false, nil
+	}
+
+	ip := addr.AsSlice()
+	for i := 0; i < len(ip)*8 && node < r.nodeCount; i++ {
+		bit := int(ip[i/8]>>(7-i%8)) & 1
+		node = r.readRecord(node, bit)
+	}
+	if node == r.nodeCount {
+		return nil, false, nil
+	}
+	if node < r.nodeCount {
+		return nil, false, errMMDBCorrupt
+	}
+
+	value, _, err := r.data.decode(node-r.nodeCount-mmdbDataSeparator, 0)
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// readRecord returns the left (bit 0) or right (bit 1) record of the given node.
+func (r *mmdbReader) readRecord(node int, bit int) int {
+	base := node * r.recordSize / 4
+	switch r.recordSize {
+	case 24:
+		return mmdbUint(r.tree[base+bit*3 : base+bit*3+3])
+	case 28:
+		if bit == 0 {
+			return int(r.tree[base+3]&0xF0)<<20 | mmdbUint(r.tree[base:base+3])
+		}
+		return int(r.tree[base+3]&0x0F)<<24 | mmdbUint(r.tree[base+4:base+7])
+	default:
+		return mmdbUint(r.tree[base+bit*4 : base+bit*4+4])
+	}
+}
+
+// mmdbUint decodes a big-endian unsigned integer.
+func mmdbUint(b []byte) int {
+	value := 0
+	for _, c := range b {
+		value = value<<8 | int(c)
+	}
+	return value
+}
+
+// mmdbDecoder decodes the values stored in the data and metadata sections.
+type mmdbDecoder struct {
+	buffer []byte
+}
+
+// decode returns the value stored at the given offset and the offset of the next value.
+func (d mmdbDecoder) decode(offset int, depth int) (any, int, error) {
+	if depth > mmdbMaxDepth || offset < 0 || offset >= len(d.buffer) {
+		return nil, 0, errMMDBCorrupt
+	}
+	control := d.buffer[offset]
+	offset++
+	dataType := int(control >> 5)
+
+	if dataType == mmdbPointer {
+		pointer, next, err := d.decodePointer(control, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(pointer, depth+1)
+		return value, next, err
+	}
+
+	if dataType == mmdbExtended {
+		if offset >= len(d.buffer) {
+			return nil, 0, errMMDBCorrupt
+		}
+		dataType = 7 + int(d.buffer[offset])
+		offset++
+	}
+
+	size := int(control & 0x1F)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > len(d.buffer) {
+			return nil, 0, errMMDBCorrupt
+		}
+		extra := mmdbUint(d.buffer[offset : offset+n])
+		offset += n
+		switch n {
+		case 1:
+			size = 29 + extra
+		case 2:
+			size = 285 + extra
+		default:
+			size = 65821 + extra
+		}
+	}
+
+	// Every entry of a map or array takes at least one byte, so a larger size is corrupt and is
+	// rejected before allocating it.
+	if (dataType == mmdbMap || dataType == mmdbArray) && size > len(d.buffer)-offset {
+		return nil, 0, errMMDBCorrupt
+	}
+
+	switch dataType {
+	case mmdbMap:
+		m := make(map[string]any, size)
+		for i := 0; i < size; i++ {
+			key, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, errMMDBCorrupt
+			}
+			m[name], offset, err = d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		return m, offset, nil
+	case mmdbArray:
+		a := make([]any, size)
+		for i := range a {
+			var err error
+			a[i], offset, err = d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		return a, offset, nil
+	case mmdbBool:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > len(d.buffer) {
+		return nil, 0, errMMDBCorrupt
+	}
+	payload := d.buffer[offset : offset+size]
+	offset += size
+
+	switch dataType {
+	case mmdbString:
+		return string(payload), offset, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, errMMDBCorrupt
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(payload)), offset, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, errMMDBCorrupt
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(payload))), offset, nil
+	case mmdbBytes:
+		return bytes.Clone(payload), offset, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64:
+		if size > 8 {
+			return nil, 0, errMMDBCorrupt
+		}
+		value := uint64(0)
+		for _, c := range payload {
+			value = value<<8 | uint64(c)
+		}
+		return value, offset, nil
+	case mmdbInt32:
+		if size > 4 {
+			return nil, 0, errMMDBCorrupt
+		}
+		value := uint32(0)
+		for _, c := range payload {
+			value = value<<8 | uint32(c)
+		}
+		return int64(int32(value)), offset, nil
+	case mmdbUint128:
+		return new(big.Int).SetBytes(payload), offset, nil
+	default:
+		return nil, 0, fmt.Errorf("%w: unsupported data type %d", errMMDBCorrupt, dataType)
+	}
+}
+
+// decodePointer returns the offset a pointer refers to and the offset after the pointer.
+func (d mmdbDecoder) decodePointer(control byte, offset int) (int, int, error) {
+	size := int(control>>3)&0x3 + 1
+	if offset+size > len(d.buffer) {
+		return 0, 0, errMMDBCorrupt
+	}
+	value := mmdbUint(d.buffer[offset : offset+size])
+	prefix := int(control & 0x7)
+	switch size {
+	case 1:
+		value = prefix<<8 | value
+	case 2:
+		value = (prefix<<16 | value) + 2048
+	case 3:
+		value = (prefix<<24 | value) + 526336
+	}
+	return value, offset + size, nil
+}
@@ -0,0 +1,328 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"runtime"
+	"service_fraud/models"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mmdbFixtureNetwork is a network written to the generated MMDB fixture along with its record.
+type mmdbFixtureNetwork struct {
+	prefix string
+	record map[string]any
+}
+
+var mmdbFixtureNetworks = []mmdbFixtureNetwork{
+	{"81.2.69.0/24", map[string]any{
+		"city":         map[string]any{"geoname_id": uint32(2643743), "names": map[string]any{"en": "London"}},
+		"continent":    map[string]any{"code": "EU", "names": map[string]any{"en": "Europe"}},
+		"country":      map[string]any{"iso_code": "GB", "names": map[string]any{"en": "United Kingdom"}},
+		"location":     map[string]any{"latitude": 51.5142, "longitude": -0.0931, "time_zone": "Europe/London"},
+		"postal":       map[string]any{"code": "EC2V"},
+		"subdivisions": []any{map[string]any{"iso_code": "ENG", "names": map[string]any{"en": "England"}}},
+	}},
+	{"2.125.160.216/29", map[string]any{
+		"continent": map[string]any{"code": "EU", "names": map[string]any{"en": "Europe"}},
+		"country":   map[string]any{"iso_code": "DE", "is_in_european_union": true, "names": map[string]any{"en": "Germany"}},
+		"location":  map[string]any{"latitude": 51.2993, "longitude": 9.491},
+	}},
+	{"2800:810::/32", map[string]any{
+		"continent":    map[string]any{"code": "SA", "names": map[string]any{"en": "South America"}},
+		"country":      map[string]any{"iso_code": "AR", "names": map[string]any{"en": "Argentina"}},
+		"location":     map[string]any{"latitude": -34.6, "longitude": -58.4},
+		"subdivisions": []any{map[string]any{"iso_code": "C", "names": map[string]any{"en": "Buenos Aires"}}},
+	}},
+}
+
+// writeMMDBFixture generates an IPv6 MaxMind database with 24 bits records holding the
+// given networks and returns its path.
+func writeMMDBFixture(t *testing.T, networks []mmdbFixtureNetwork) string {
+	// Records below -1 point to the data of the network -(record+2), -1 marks an empty record.
+	nodes := [][2]int{{-1, -1}}
+	for i, network := range networks {
+		prefix := netip.MustParsePrefix(network.prefix)
+		ip := prefix.Addr().As16()
+		bits := prefix.Bits()
+		if prefix.Addr().Is4() {
+			ip = [16]byte{}
+			copy(ip[12:], prefix.Addr().AsSlice())
+			bits += 96
+		}
+
+		node := 0
+		for b := 0; b < bits; b++ {
+			bit := int(ip[b/8]>>(7-b%8)) & 1
+			if b == bits-1 {
+				nodes[node][bit] = -(i + 2)
+				break
+			}
+			if nodes[node][bit] < 0 {
+				nodes = append(nodes, [2]int{-1, -1})
+				nodes[node][bit] = len(nodes) - 1
+			}
+			node = nodes[node][bit]
+		}
+	}
+
+	var data bytes.Buffer
+	offsets := make([]int, len(networks))
+	for i, network := range networks {
+		offsets[i] = data.Len()
+		encodeMMDBValue(&data, network.record)
+	}
+
+	var file bytes.Buffer
+	nodeCount := len(nodes)
+	for _, node := range nodes {
+		for _, record := range node {
+			value := nodeCount
+			if record >= 0 {
+				value = record
+			} else if record < -1 {
+				value = nodeCount + mmdbDataSeparator + offsets[-record-2]
+			}
+			file.Write([]byte{byte(value >> 16), byte(value >> 8), byte(value)})
+		}
+	}
+	file.Write(make([]byte, mmdbDataSeparator))
+	file.Write(data.Bytes())
+	file.Write(mmdbMetadataMarker)
+	encodeMMDBValue(&file, map[string]any{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(1700000000),
+		"database_type":               "GeoLite2-City",
+		"description":                 map[string]any{"en": "service_fraud test fixture"},
+		"ip_version":                  uint16(6),
+		"languages":                   []any{"en"},
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(24),
+	})
+
+	path := filepath.Join(t.TempDir(), "GeoLite2-City.mmdb")
+	require.NoError(t, os.WriteFile(path, file.Bytes(), 0644))
+	return path
+}
+
+// encodeMMDBValue writes the value using the MaxMind DB data section format.
+func encodeMMDBValue(buf *bytes.Buffer, value any) {
+	switch v := value.(type) {
+	case string:
+		writeMMDBControl(buf, mmdbString, len(v))
+		buf.WriteString(v)
+	case float64:
+		writeMMDBControl(buf, mmdbDouble, 8)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(v))
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+		writeMMDBControl(buf, mmdbBool, size)
+	case uint16:
+		writeMMDBControl(buf, mmdbUint16, 2)
+		binary.Write(buf, binary.BigEndian, v)
+	case uint32:
+		writeMMDBControl(buf, mmdbUint32, 4)
+		binary.Write(buf, binary.BigEndian, v)
+	case uint64:
+		writeMMDBControl(buf, mmdbUint64, 8)
+		binary.Write(buf, binary.BigEndian, v)
+	case []any:
+		writeMMDBControl(buf, mmdbArray, len(v))
+		for _, item := range v {
+			encodeMMDBValue(buf, item)
+		}
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		writeMMDBControl(buf, mmdbMap, len(v))
+		for _, key := range keys {
+			encodeMMDBValue(buf, key)
+			encodeMMDBValue(buf, v[key])
+		}
+	}
+}
+
+// writeMMDBControl writes the control byte of a value along with its extended type and size.
+func writeMMDBControl(buf *bytes.Buffer, dataType int, size int) {
+	control := byte(dataType << 5)
+	if dataType > 7 {
+		control = 0
+	}
+	switch {
+	case size < 29:
+		buf.WriteByte(control | byte(size))
+	case size < 285:
+		buf.WriteByte(control | 29)
+	default:
+		buf.WriteByte(control | 30)
+	}
+	if dataType > 7 {
+		buf.WriteByte(byte(dataType - 7))
+	}
+	switch {
+	case size < 29:
+	case size < 285:
+		buf.WriteByte(byte(size - 29))
+	default:
+		buf.WriteByte(byte((size - 285) >> 8))
+		buf.WriteByte(byte(size - 285))
+	}
+}
+
+func TestMMDBGeolocation(t *testing.T) {
+	geolocation, err := NewMMDBGeolocation(writeMMDBFixture(t, mmdbFixtureNetworks))
+	require.NoError(t, err)
+
+	tests := []struct {
+		ip       string
+		expected models.IpApiResponse
+	}{
+		{"81.2.69.160", models.IpApiResponse{
+			IP: "81.2.69.160", Type: "ipv4", ContinentCode: "EU", ContinentName: "Europe",
+			CountryCode: "GB", CountryName: "United Kingdom", RegionCode: "ENG", RegionName: "England",
+			City: "London", Zip: "EC2V", Latitude: 51.5142, Longitude: -0.0931,
+			Location: models.Location{GeonameID: 2643743},
+		}},
+		{"2.125.160.217", models.IpApiResponse{
+			IP: "2.125.160.217", Type: "ipv4", ContinentCode: "EU", ContinentName: "Europe",
+			CountryCode: "DE", CountryName: "Germany", Latitude: 51.2993, Longitude: 9.491,
+			Location: models.Location{IsEu: true},
+		}},
+		{"2800:810:400::1", models.IpApiResponse{
+			IP: "2800:810:400::1", Type: "ipv6", ContinentCode: "SA", ContinentName: "South America",
+			CountryCode: "AR", CountryName: "Argentina", RegionCode: "C", RegionName: "Buenos Aires",
+			Latitude: -34.6, Longitude: -58.4,
+		}},
+		{"8.8.8.8", models.IpApiResponse{IP: "8.8.8.8"}},
+		{"2001:4860::8888", models.IpApiResponse{IP: "2001:4860::8888"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			assert.Equal(t, tt.expected, geolocation.Geolocation(context.Background(), tt.ip))
+		})
+	}
+}
+
+func TestMMDBGeolocation_InvalidIp(t *testing.T) {
+	geolocation, err := NewMMDBGeolocation(writeMMDBFixture(t, mmdbFixtureNetworks))
+	require.NoError(t, err)
+
+	ipResponse := geolocation.Geolocation(context.Background(), "invalid_ip")
+
+	assert.True(t, ipResponse.HasError())
+}
+
+func TestNewMMDBGeolocation_InvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "invalid.mmdb")
+	require.NoError(t, os.WriteFile(path, []byte("not a database"), 0644))
+
+	_, err := NewMMDBGeolocation(path)
+	assert.ErrorIs(t, err, errMMDBCorrupt)
+
+	_, err = NewMMDBGeolocation(filepath.Join(t.TempDir(), "missing.mmdb"))
+	assert.Error(t, err)
+}
+
+func TestMMDBDecoder_Pointer(t *testing.T) {
+	// A map whose value is a pointer to the string stored at the beginning of the buffer.
+	decoder := mmdbDecoder{buffer: []byte{
+		0x43, 'a', 'b', 'c',
+		0xE1, 0x41, 'k', 0x20, 0x00,
+	}}
+
+	value, next, err := decoder.decode(4, 0)
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"k": "abc"}, value)
+	assert.Equal(t, len(decoder.buffer), next)
+}
+
+func TestMMDBDecoder_OversizedContainer(t *testing.T) {
+	// A map and an array that claim 16.8M entries in a few bytes are rejected before allocating them.
+	for _, buffer := range [][]byte{
+		{0xFF, 0xFF, 0xFF, 0xFF},
+		{0x1F, 0x04, 0xFF, 0xFF, 0xFF},
+		{0xE3, 0x41, 'k', 0x41, 'v'},
+	} {
+		decoder := mmdbDecoder{buffer: buffer}
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+
+		_, _, err := decoder.decode(0, 0)
+
+		runtime.ReadMemStats(&after)
+		assert.ErrorIs(t, err, errMMDBCorrupt, buffer)
+		assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(1<<20), buffer)
+	}
+}
+
+func TestGetAllProducts_GeolocationFallback(t *testing.T) {
+	service, ipPaths := newTestInformationService(t)
+	failingIpApi := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(failingIpApi.Close)
+	service.endpoints.IpApiURL = failingIpApi.URL + "/api/%s?access_key=%s"
+
+	mmdb, err := NewMMDBGeolocation(writeMMDBFixture(t, mmdbFixtureNetworks))
+	require.NoError(t, err)
+	service.SetGeolocators(service, mmdb)
+
+	result, err := service.GetAllProducts(context.Background(), "2800:810:400::1")
+	require.NoError(t, err)
+	assert.Equal(t, "Argentina", result.Country)
+	assert.Empty(t, ipPaths())
+
+	// When no provider locates the IP the error of ipapi is returned.
+	_, err = service.GetAllProducts(context.Background(), "8.8.8.8")
+	var ipApiError *models.IpApiError
+	assert.ErrorAs(t, err, &ipApiError)
+}
+
+func TestGetAllProducts_GeolocationWithoutRegion(t *testing.T) {
+	service, _ := newTestInformationService(t)
+	networks := append([]mmdbFixtureNetwork{{"1.0.16.0/24", map[string]any{
+		"continent": map[string]any{"code": "AS", "names": map[string]any{"en": "Asia"}},
+		"country":   map[string]any{"iso_code": "JP", "names": map[string]any{"en": "Japan"}},
+		"location":  map[string]any{"latitude": 35.69, "longitude": 139.69},
+	}}}, mmdbFixtureNetworks...)
+	mmdb, err := NewMMDBGeolocation(writeMMDBFixture(t, networks))
+	require.NoError(t, err)
+	service.SetGeolocators(mmdb)
+	snapshot, err := NewEmbeddedCountrySnapshot()
+	require.NoError(t, err)
+	service.SetCountryProviders(snapshot)
+
+	// The records without subdivisions do not share the information of their countries.
+	for _, tt := range []struct{ ip, country, iso, currency string }{
+		{"2.125.160.217", "Germany", "DE", "EUR"},
+		{"1.0.16.1", "Japan", "JP", "JPY"},
+	} {
+		result, err := service.GetAllProducts(context.Background(), tt.ip)
+
+		require.NoError(t, err, tt.ip)
+		assert.Equal(t, tt.iso, result.ISO)
+		require.Len(t, result.Currencies, 1)
+		assert.Equal(t, tt.currency, result.Currencies[0].Code)
+		assert.Equal(t, tt.country, (<-service.processed).Country)
+	}
+}
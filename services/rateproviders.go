@@ -0,0 +1,317 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"service_fraud/models"
+	"service_fraud/utils"
+	"sort"
+	"strings"
+	"time"
+)
+
+// errNoRates is returned when the response of a rates provider does not include any rate.
+var errNoRates = errors.New("the response does not include any rate")
+
+// errNoHistoricalRates is returned when a rates provider has no rates for the requested day.
+var errNoHistoricalRates = errors.New("the provider has no rates for the day")
+
+// ECBRates retrieves the euro foreign exchange reference rates published every working day by
+// the European Central Bank in the eurofxref XML format, which needs no key.
+type ECBRates struct {
+	url        string
+	historyURL string
+	upstreams  *Upstreams
+	metrics    *Metrics
+}
+
+// NewECBRates creates the provider of the rates published in the given URL, the daily
+// eurofxref feed when it is empty. The historical rates are retrieved from the feed of the
+// last 90 days, see SetHistoryURL.
+func NewECBRates(url string) *ECBRates {
+	if url == "" {
+		url = utils.API_ECB_URL
+	}
+	return &ECBRates{url: url, historyURL: utils.API_ECB_HISTORY_URL, metrics: DefaultMetrics()}
+}
+
+// SetHistoryURL sets the eurofxref feed with the rates of several days the historical rates are
+// retrieved from, for example the one with every day since 1999. An empty URL keeps the current one.
+func (e *ECBRates) SetHistoryURL(url string) {
+	if url != "" {
+		e.historyURL = url
+	}
+}
+
+// SetUpstreams sets the retries and circuit breakers of the calls to the feed, nil sends each
+// call once.
+func (e *ECBRates) SetUpstreams(upstreams *Upstreams) {
+	e.upstreams = upstreams
+}
+
+// SetMetrics sets the metrics the calls to the feed are recorded in, nil disables them.
+func (e *ECBRates) SetMetrics(metrics *Metrics) {
+	e.metrics = metrics
+}
+
+// GetCurrencyInformation retrieves the newest rates of the feed, in terms of the euro.
+func (e *ECBRates) GetCurrencyInformation(ctx context.Context) models.CurrencyResponse {
+	return fetchRates(ctx, e.upstreams, e.metrics, utils.RATES_PROVIDER_ECB, e.url, func(body io.Reader) (models.CurrencyResponse, error) {
+		days, err := ParseECBRates(body)
+		if err != nil {
+			return models.CurrencyResponse{}, err
+		}
+		return days[0], nil
+	})
+}
+
+// GetHistoricalCurrencyInformation retrieves the rates of the given day from the historical feed.
+// The ECB does not publish rates on weekends and holidays, so those days use the rates of the
+// previous working day.
+func (e *ECBRates) GetHistoricalCurrencyInformation(ctx context.Context, date time.Time) models.CurrencyResponse {
+	day := date.Format(time.DateOnly)
+	return fetchRates(ctx, e.upstreams, e.metrics, utils.RATES_PROVIDER_ECB, e.historyURL, func(body io.Reader) (models.CurrencyResponse, error) {
+		days, err := ParseECBRates(body)
+		if err != nil {
+			return models.CurrencyResponse{}, err
+		}
+		for _, rates := range days {
+			if rates.Date <= day {
+				return rates, nil
+			}
+		}
+		return models.CurrencyResponse{}, errNoHistoricalRates
+	})
+}
+
+// ecbEnvelope is the eurofxref document, with a Cube per day holding a Cube per currency.
+type ecbEnvelope struct {
+	Days []struct {
+		Time  string `xml:"time,attr"`
+		Rates []struct {
+			Currency string  `xml:"currency,attr"`
+			Rate     float64 `xml:"rate,attr"`
+		} `xml:"Cube"`
+	} `xml:"Cube>Cube"`
+}
+
+// ParseECBRates parses a eurofxref document, the daily feed or the historical ones with the
+// rates of several days, and returns the rates of each day from the newest to the oldest.
+func ParseECBRates(r io.Reader) ([]models.CurrencyResponse, error) {
+	var envelope ecbEnvelope
+	if err := xml.NewDecoder(r).Decode(&envelope); err != nil {
+		return nil, err
+	}
+
+	days := make([]models.CurrencyResponse, 0, len(envelope.Days))
+	for _, day := range envelope.Days {
+		date, err := time.Parse(time.DateOnly, day.Time)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date of the rates: %w", err)
+		}
+		rates := make(map[string]float64, len(day.Rates))
+		for _, rate := range day.Rates {
+			if rate.Currency == "" || rate.Rate <= 0 {
+				return nil, fmt.Errorf("invalid rate of %q on %s", rate.Currency, day.Time)
+			}
+			rates[rate.Currency] = rate.Rate
+		}
+		days = append(days, models.CurrencyResponse{
+			Success:   true,
+			Timestamp: date.Unix(),
+			Base:      "EUR",
+			Date:      day.Time,
+			Rates:     rates,
+		})
+	}
+	if len(days) == 0 {
+		return nil, errNoRates
+	}
+	sort.SliceStable(days, func(i, j int) bool { return days[i].Timestamp > days[j].Timestamp })
+	return days, nil
+}
+
+// JSONRatesFormat describes where a JSON response holds the rates. The fields are the keys of
+// the response, nested keys separated by dots, for example 'data.rates'.
+type JSONRatesFormat struct {
+	// RatesField holds an object with the rate of each currency.
+	RatesField string
+	// BaseField holds the code of the base currency of the rates.
+	BaseField string
+	// TimestampField holds when the rates were published, as a Unix time or an RFC 3339 or
+	// YYYY-MM-DD date.
+	TimestampField string
+	// Base is the base currency when the response does not include it.
+	Base string
+}
+
+// DefaultJSONRatesFormat returns the format of the responses of fixer and its clones.
+func DefaultJSONRatesFormat() JSONRatesFormat {
+	return JSONRatesFormat{RatesField: "rates", BaseField: "base", TimestampField: "timestamp"}
+}
+
+// JSONRates retrieves the rates from any API that answers them as a JSON object, for example
+// a self-hosted service or a free alternative to fixer.
+type JSONRates struct {
+	name       string
+	url        string
+	historyURL string
+	format     JSONRatesFormat
+	upstreams  *Upstreams
+	metrics    *Metrics
+}
+
+// NewJSONRates creates the provider of the rates answered by the given URL in the given format.
+// The name identifies the provider in the traces, the log and the metrics.
+func NewJSONRates(name, url string, format JSONRatesFormat) (*JSONRates, error) {
+	if url == "" {
+		return nil, fmt.Errorf("the JSON rates provider %q requires a url", name)
+	}
+	if name == "" {
+		name = utils.RATES_PROVIDER_JSON
+	}
+	defaults := DefaultJSONRatesFormat()
+	if format.RatesField == "" {
+		format.RatesField = defaults.RatesField
+	}
+	if format.BaseField == "" {
+		format.BaseField = defaults.BaseField
+	}
+	if format.TimestampField == "" {
+		format.TimestampField = defaults.TimestampField
+	}
+	return &JSONRates{name: name, url: url, format: format, metrics: DefaultMetrics()}, nil
+}
+
+// SetHistoryURL sets the address the historical rates are retrieved from, with a %s replaced by
+// the day as YYYY-MM-DD, in the same format as the current ones. Without it the provider has no
+// historical rates.
+func (j *JSONRates) SetHistoryURL(url string) {
+	j.historyURL = url
+}
+
+// SetUpstreams sets the retries and circuit breakers of the calls to the API, nil sends each
+// call once.
+func (j *JSONRates) SetUpstreams(upstreams *Upstreams) {
+	j.upstreams = upstreams
+}
+
+// SetMetrics sets the metrics the calls to the API are recorded in, nil disables them.
+func (j *JSONRates) SetMetrics(metrics *Metrics) {
+	j.metrics = metrics
+}
+
+// GetCurrencyInformation retrieves the rates from the API.
+func (j *JSONRates) GetCurrencyInformation(ctx context.Context) models.CurrencyResponse {
+	return fetchRates(ctx, j.upstreams, j.metrics, j.name, j.url, func(body io.Reader) (models.CurrencyResponse, error) {
+		return ParseJSONRates(body, j.format)
+	})
+}
+
+// GetHistoricalCurrencyInformation retrieves the rates of the given day from the API, when it has
+// a history URL.
+func (j *JSONRates) GetHistoricalCurrencyInformation(ctx context.Context, date time.Time) models.CurrencyResponse {
+	if j.historyURL == "" {
+		return models.CurrencyResponse{Error: *models.NewCurrencyApiError(utils.ERR_CODE_RATES_HISTORY, utils.ERR_USER_MESSAGE_RATES_HISTORY)}
+	}
+	url := fmt.Sprintf(j.historyURL, date.Format(time.DateOnly))
+	return fetchRates(ctx, j.upstreams, j.metrics, j.name, url, func(body io.Reader) (models.CurrencyResponse, error) {
+		return ParseJSONRates(body, j.format)
+	})
+}
+
+// ParseJSONRates extracts the rates, base currency and timestamp of a JSON response.
+func ParseJSONRates(r io.Reader, format JSONRatesFormat) (models.CurrencyResponse, error) {
+	var document map[string]any
+	if err := json.NewDecoder(r).Decode(&document); err != nil {
+		return models.CurrencyResponse{}, err
+	}
+
+	values, ok := jsonField(document, format.RatesField).(map[string]any)
+	if !ok {
+		return models.CurrencyResponse{}, fmt.Errorf("the field %q does not hold the rates", format.RatesField)
+	}
+	response := models.CurrencyResponse{Success: true, Base: format.Base, Rates: make(map[string]float64, len(values))}
+	for code, value := range values {
+		if rate, ok := value.(float64); ok && rate > 0 {
+			response.Rates[strings.ToUpper(code)] = rate
+		}
+	}
+	if len(response.Rates) == 0 {
+		return models.CurrencyResponse{}, errNoRates
+	}
+	if base, ok := jsonField(document, format.BaseField).(string); ok && base != "" {
+		response.Base = strings.ToUpper(base)
+	}
+	switch timestamp := jsonField(document, format.TimestampField).(type) {
+	case float64:
+		response.Timestamp = int64(timestamp)
+	case string:
+		for _, layout := range []string{time.RFC3339, time.DateOnly} {
+			if date, err := time.Parse(layout, timestamp); err == nil {
+				response.Timestamp = date.Unix()
+				break
+			}
+		}
+	}
+	return response, nil
+}
+
+// jsonField returns the value of the field of the document, nested keys separated by dots, or
+// nil when it is not present.
+func jsonField(document map[string]any, field string) any {
+	var value any = document
+	for _, key := range strings.Split(field, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
+
+// fetchRates retrieves the rates of a provider without key from the URL, decoding the body of
+// the response with the given function. The rates are tagged with the name of the provider.
+func fetchRates(ctx context.Context, upstreams *Upstreams, metrics *Metrics, source, url string,
+	decode func(io.Reader) (models.CurrencyResponse, error)) (response models.CurrencyResponse) {
+	logger := utils.Logger(ctx)
+	since, status := time.Now(), 0
+	defer func() {
+		metrics.observeUpstream(source, status, response.Error.Code, time.Since(since))
+	}()
+	failed := func(err error, code int, msg string) models.CurrencyResponse {
+		logger.Error(utils.ERR_MESSAGE_RATES_SERVICE, "upstream", source, "status", status, "error", err)
+		return models.CurrencyResponse{Error: *models.NewCurrencyApiError(code, msg)}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return failed(err, utils.ERR_CODE_CURRENCY_SERVICE, utils.ERR_USER_MESSAGE_CURRENCY_SERVICE)
+	}
+	resp, err := upstreams.Do(source, req)
+	if err != nil {
+		return failed(err, utils.ERR_CODE_CURRENCY_SERVICE, utils.ERR_USER_MESSAGE_CURRENCY_SERVICE)
+	}
+	defer resp.Body.Close()
+	status = resp.StatusCode
+	if resp.StatusCode != http.StatusOK {
+		code, msg := statusErrorCode(resp.StatusCode, utils.ERR_CODE_CURRENCY_SERVICE, utils.ERR_USER_MESSAGE_CURRENCY_SERVICE)
+		return failed(errors.New(utils.ERR_MESSAGE_UPSTREAM_STATUS), code, msg)
+	}
+
+	response, err = decode(resp.Body)
+	if errors.Is(err, errNoHistoricalRates) {
+		return failed(err, utils.ERR_CODE_RATES_HISTORY, utils.ERR_USER_MESSAGE_RATES_HISTORY)
+	}
+	if err != nil {
+		return failed(err, utils.ERR_CODE_CURRENCY_SERVICE, utils.ERR_USER_MESSAGE_CURRENCY_SERVICE)
+	}
+	response.Source = source
+	return response
+}
@@ -0,0 +1,260 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"service_fraud/models"
+	"service_fraud/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const ecbDailyFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+	<gesmes:subject>Reference rates</gesmes:subject>
+	<gesmes:Sender>
+		<gesmes:name>European Central Bank</gesmes:name>
+	</gesmes:Sender>
+	<Cube>
+		<Cube time='2024-05-02'>
+			<Cube currency='USD' rate='1.0712'/>
+			<Cube currency='JPY' rate='165.61'/>
+			<Cube currency='BRL' rate='5.5123'/>
+		</Cube>
+	</Cube>
+</gesmes:Envelope>`
+
+const ecbHistoricalFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+	<Cube>
+		<Cube time="2024-04-30"><Cube currency="USD" rate="1.0665"/></Cube>
+		<Cube time="2024-05-02"><Cube currency="USD" rate="1.0712"/></Cube>
+		<Cube time="2024-05-01"><Cube currency="USD" rate="1.0686"/></Cube>
+	</Cube>
+</gesmes:Envelope>`
+
+func TestParseECBRates(t *testing.T) {
+	days, err := ParseECBRates(strings.NewReader(ecbDailyFeed))
+
+	require.NoError(t, err)
+	require.Len(t, days, 1)
+	assert.Equal(t, "EUR", days[0].Base)
+	assert.Equal(t, "2024-05-02", days[0].Date)
+	assert.Equal(t, time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC).Unix(), days[0].Timestamp)
+	assert.Equal(t, map[string]float64{"USD": 1.0712, "JPY": 165.61, "BRL": 5.5123}, days[0].Rates)
+}
+
+func TestParseECBRates_Historical(t *testing.T) {
+	days, err := ParseECBRates(strings.NewReader(ecbHistoricalFeed))
+
+	require.NoError(t, err)
+	require.Len(t, days, 3)
+	assert.Equal(t, "2024-05-02", days[0].Date)
+	assert.Equal(t, "2024-05-01", days[1].Date)
+	assert.Equal(t, "2024-04-30", days[2].Date)
+}
+
+func TestParseECBRates_Invalid(t *testing.T) {
+	for _, body := range []string{
+		"not xml",
+		`<Envelope><Cube></Cube></Envelope>`,
+		`<Envelope><Cube><Cube time="yesterday"><Cube currency="USD" rate="1.07"/></Cube></Cube></Envelope>`,
+		`<Envelope><Cube><Cube time="2024-05-02"><Cube currency="USD" rate="0"/></Cube></Cube></Envelope>`,
+	} {
+		_, err := ParseECBRates(strings.NewReader(body))
+		assert.Error(t, err, body)
+	}
+}
+
+func TestParseJSONRates(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		format    JSONRatesFormat
+		base      string
+		timestamp int64
+	}{
+		{"fixer format", `{"base": "EUR", "timestamp": 1714608000, "rates": {"USD": 1.07, "ARS": 950}}`,
+			DefaultJSONRatesFormat(), "EUR", 1714608000},
+		{"nested fields and date", `{"result": "success", "data": {"base_code": "usd", "date": "2024-05-02", "conversion_rates": {"usd": 1, "ars": 880}}}`,
+			JSONRatesFormat{RatesField: "data.conversion_rates", BaseField: "data.base_code", TimestampField: "data.date"}, "USD", 1714608000},
+		{"configured base", `{"rates": {"USD": 1.07, "ARS": 950}}`,
+			JSONRatesFormat{RatesField: "rates", Base: "EUR"}, "EUR", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := ParseJSONRates(strings.NewReader(tt.body), tt.format)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.base, response.Base)
+			assert.Equal(t, tt.timestamp, response.Timestamp)
+			assert.Len(t, response.Rates, 2)
+			assert.Contains(t, response.Rates, "ARS")
+		})
+	}
+}
+
+func TestParseJSONRates_Invalid(t *testing.T) {
+	for _, body := range []string{"not json", `{"rates": "none"}`, `{"rates": {}}`, `{"data": {"rates": {"USD": 1}}}`} {
+		_, err := ParseJSONRates(strings.NewReader(body), DefaultJSONRatesFormat())
+		assert.Error(t, err, body)
+	}
+}
+
+func TestECBRates_GetCurrencyInformation(t *testing.T) {
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(ecbDailyFeed))
+	}))
+	defer feed.Close()
+	metrics := NewMetrics()
+	ecb := NewECBRates(feed.URL)
+	ecb.SetMetrics(metrics)
+
+	response := ecb.GetCurrencyInformation(context.Background())
+
+	assert.False(t, response.HasError())
+	assert.Equal(t, utils.RATES_PROVIDER_ECB, response.Source)
+	assert.Equal(t, 1.0712, response.Rates["USD"])
+	assert.Equal(t, 1.0, metrics.upstreamRequests.Value(utils.RATES_PROVIDER_ECB, "200"))
+}
+
+func TestJSONRates_GetCurrencyInformation_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		code   int
+	}{
+		{"server error", http.StatusInternalServerError, "", utils.ERR_CODE_CURRENCY_SERVICE},
+		{"rate limited", http.StatusTooManyRequests, "", utils.ERR_CODE_RATE_LIMITED},
+		{"invalid body", http.StatusOK, `{"error": "quota"}`, utils.ERR_CODE_CURRENCY_SERVICE},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer api.Close()
+			provider, err := NewJSONRates("openrates", api.URL, DefaultJSONRatesFormat())
+			require.NoError(t, err)
+			provider.SetMetrics(nil)
+
+			response := provider.GetCurrencyInformation(context.Background())
+
+			assert.True(t, response.HasError())
+			assert.Equal(t, tt.code, response.Error.Code)
+		})
+	}
+}
+
+func TestNewJSONRates_RequiresUrl(t *testing.T) {
+	_, err := NewJSONRates("openrates", "", DefaultJSONRatesFormat())
+
+	assert.Error(t, err)
+}
+
+func TestRatesManager_Failover(t *testing.T) {
+	fixer := &fakeRatesProvider{response: failedRatesResponse()}
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(ecbDailyFeed))
+	}))
+	defer feed.Close()
+	ecb := NewECBRates(feed.URL)
+	ecb.SetMetrics(nil)
+	manager := NewRatesManager(DefaultRatesPolicy(), fixer, ecb)
+	manager.SetMetrics(nil)
+
+	snapshot, err := manager.Get(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, fixer.count())
+	assert.Equal(t, utils.RATES_PROVIDER_ECB, snapshot.Source)
+	assert.Equal(t, utils.RATES_PROVIDER_ECB, snapshot.Info().Source)
+	assert.Equal(t, "EUR", snapshot.Base)
+}
+
+func TestRatesManager_Failover_AllFail(t *testing.T) {
+	first := &fakeRatesProvider{response: models.CurrencyResponse{Error: *models.NewCurrencyApiError(utils.ERR_CODE_RATE_LIMITED, utils.ERR_USER_MESSAGE_RATE_LIMITED)}}
+	second := &fakeRatesProvider{response: failedRatesResponse()}
+	manager := NewRatesManager(DefaultRatesPolicy(), first, second)
+	manager.SetMetrics(nil)
+
+	_, err := manager.Get(context.Background())
+
+	var currencyError *models.CurrencyApiError
+	require.ErrorAs(t, err, &currencyError)
+	assert.Equal(t, utils.ERR_CODE_RATE_LIMITED, currencyError.Code)
+	assert.Equal(t, 1, second.count())
+
+	_, err = NewRatesManager(DefaultRatesPolicy()).Get(context.Background())
+	assert.Error(t, err)
+}
+
+func TestECBRates_GetHistoricalCurrencyInformation(t *testing.T) {
+	var paths []string
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Write([]byte(ecbHistoricalFeed))
+	}))
+	defer feed.Close()
+	ecb := NewECBRates(feed.URL + "/daily.xml")
+	ecb.SetHistoryURL(feed.URL + "/hist.xml")
+	ecb.SetMetrics(nil)
+
+	tests := []struct {
+		date string
+		day  string
+		usd  float64
+	}{
+		{"2024-05-01", "2024-05-01", 1.0686},
+		// The days without rates use the ones of the previous working day.
+		{"2024-05-04", "2024-05-02", 1.0712},
+	}
+	for _, tt := range tests {
+		date, _ := time.Parse(time.DateOnly, tt.date)
+
+		response := ecb.GetHistoricalCurrencyInformation(context.Background(), date)
+
+		require.False(t, response.HasError(), tt.date)
+		assert.Equal(t, tt.day, response.Date)
+		assert.Equal(t, tt.usd, response.Rates["USD"])
+		assert.Equal(t, utils.RATES_PROVIDER_ECB, response.Source)
+	}
+	assert.Equal(t, []string{"/hist.xml", "/hist.xml"}, paths)
+
+	response := ecb.GetHistoricalCurrencyInformation(context.Background(), time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC))
+	assert.True(t, response.HasError())
+	assert.Equal(t, utils.ERR_CODE_RATES_HISTORY, response.Error.Code)
+}
+
+func TestJSONRates_GetHistoricalCurrencyInformation(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"base": "USD", "date": "` + strings.TrimPrefix(r.URL.Path, "/history/") + `", "rates": {"ARS": 880}}`))
+	}))
+	defer api.Close()
+	provider, err := NewJSONRates("openrates", api.URL+"/latest", JSONRatesFormat{TimestampField: "date"})
+	require.NoError(t, err)
+	provider.SetMetrics(nil)
+	date := time.Date(2024, 4, 20, 0, 0, 0, 0, time.UTC)
+
+	response := provider.GetHistoricalCurrencyInformation(context.Background(), date)
+	assert.True(t, response.HasError())
+	assert.Equal(t, utils.ERR_CODE_RATES_HISTORY, response.Error.Code)
+
+	provider.SetHistoryURL(api.URL + "/history/%s")
+	response = provider.GetHistoricalCurrencyInformation(context.Background(), date)
+
+	require.False(t, response.HasError())
+	assert.Equal(t, date.Unix(), response.Timestamp)
+	assert.Equal(t, "openrates", response.Source)
+	assert.Equal(t, 880.0, response.Rates["ARS"])
+}
@@ -0,0 +1,305 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"service_fraud/interfaces"
+	"service_fraud/models"
+	"service_fraud/utils"
+	"sync"
+	"time"
+)
+
+// RatesPolicy defines how long a snapshot of the exchange rates is used.
+type RatesPolicy struct {
+	// TTL is how long a snapshot is used before the rates are retrieved again.
+	TTL time.Duration
+	// MaxStale is how long after its expiry a snapshot is still served when the provider fails,
+	// 0 serves it until the provider answers again.
+	MaxStale time.Duration
+}
+
+// DefaultRatesPolicy returns the policy used when none is configured.
+func DefaultRatesPolicy() RatesPolicy {
+	return RatesPolicy{
+		TTL:      utils.RATES_DEFAULT_TTL_SECONDS * time.Second,
+		MaxStale: utils.RATES_DEFAULT_MAX_STALE_SECONDS * time.Second,
+	}
+}
+
+// ratesDateKey is the key of the day of the historical rates in the context of a trace.
+type ratesDateKey struct{}
+
+// WithRatesDate returns a copy of the context whose traces are converted with the rates of the
+// given day instead of the current ones.
+func WithRatesDate(ctx context.Context, date time.Time) context.Context {
+	return context.WithValue(ctx, ratesDateKey{}, date)
+}
+
+// RatesDate returns the day of the historical rates the traces of the context are converted
+// with, if any.
+func RatesDate(ctx context.Context) (time.Time, bool) {
+	date, ok := ctx.Value(ratesDateKey{}).(time.Time)
+	return date, ok
+}
+
+// WithRatesDateValue parses the day of the historical rates given as YYYY-MM-DD and returns a
+// copy of the context whose traces are converted with them, or the same context when the value
+// is empty.
+func WithRatesDateValue(ctx context.Context, value string) (context.Context, error) {
+	date, err := models.ParseRatesDate(value, time.Now())
+	if err != nil {
+		return ctx, models.NewOptionInvalidError(utils.ERR_CODE_INVALID_DATE, fmt.Sprintf(utils.ERR_USER_MESSAGE_INVALID_DATE, err))
+	}
+	if date == nil {
+		return ctx, nil
+	}
+	return WithRatesDate(ctx, *date), nil
+}
+
+// RatesManager keeps the last snapshot of the exchange rates, so a single call to the currency
+// providers serves the traces until the snapshot expires. The providers are tried in order until
+// one of them answers. When all of them fail the last snapshot keeps being served, marked as
+// stale, for the time allowed by the policy. The historical rates are kept by day in the history,
+// as they do not change.
+type RatesManager struct {
+	providers []interfaces.CurrencyInformation
+	policy    RatesPolicy
+	// refreshLock lets a single call to the provider be in flight.
+	refreshLock sync.Mutex
+	lock        sync.Mutex
+	snapshot    *models.RatesSnapshot
+	// historyLock guards dayLocks, which let a single lookup of the historical rates of each day
+	// be in flight, so the lookups of different days do not wait for each other. A day is only
+	// kept while it has lookups in flight.
+	historyLock sync.Mutex
+	dayLocks    map[string]*dayLock
+	history     interfaces.DataStore[string, models.RatesSnapshot]
+	metrics     *Metrics
+	clock       func() time.Time
+}
+
+// NewRatesManager creates a manager that retrieves the rates from the providers, in order, with
+// the given policy.
+func NewRatesManager(policy RatesPolicy, providers ...interfaces.CurrencyInformation) *RatesManager {
+	if policy.TTL <= 0 {
+		policy.TTL = utils.RATES_DEFAULT_TTL_SECONDS * time.Second
+	}
+	return &RatesManager{providers: providers, policy: policy, dayLocks: make(map[string]*dayLock),
+		history: NewRatesHistory(""), metrics: DefaultMetrics()}
+}
+
+// SetHistory sets the store the historical rates are kept in, by day.
+func (m *RatesManager) SetHistory(history interfaces.DataStore[string, models.RatesSnapshot]) {
+	m.history = history
+}
+
+// SetMetrics sets the metrics the lookups of the snapshot are recorded in, nil disables them.
+func (m *RatesManager) SetMetrics(metrics *Metrics) {
+	m.metrics = metrics
+}
+
+// Get returns the current snapshot, retrieving the rates when there is none or it expired.
+// When the providers fail it returns the last snapshot marked as stale, or the error of the
+// first provider when there is none or it is older than the policy allows.
+func (m *RatesManager) Get(ctx context.Context) (models.RatesSnapshot, error) {
+	snapshot, ok := m.current()
+	switch {
+	case !ok:
+		m.metrics.observeCache(utils.METRICS_CACHE_CURRENCY, utils.METRICS_CACHE_MISS)
+	case snapshot.Expired(m.now()):
+		m.metrics.observeCache(utils.METRICS_CACHE_CURRENCY, utils.METRICS_CACHE_EXPIRED)
+	default:
+		m.metrics.observeCache(utils.METRICS_CACHE_CURRENCY, utils.METRICS_CACHE_HIT)
+		return snapshot, nil
+	}
+
+	m.refreshLock.Lock()
+	defer m.refreshLock.Unlock()
+	// Another trace may have retrieved the rates while this one waited.
+	if snapshot, ok := m.current(); ok && !snapshot.Expired(m.now()) {
+		return snapshot, nil
+	}
+	return m.refresh(ctx)
+}
+
+// GetAt returns the snapshot of the rates of the given day in UTC, retrieving it from the
+// providers that keep historical rates when it is not in the history. The rates of today are the
+// current ones.
+func (m *RatesManager) GetAt(ctx context.Context, date time.Time) (models.RatesSnapshot, error) {
+	date = date.UTC()
+	day := date.Format(time.DateOnly)
+	if day >= m.now().UTC().Format(time.DateOnly) {
+		return m.Get(ctx)
+	}
+
+	unlock := m.lockDay(day)
+	defer unlock()
+	if snapshot, err := m.history.Get(day); err == nil {
+		return snapshot, nil
+	}
+	response := m.lookupHistoricalRates(ctx, date)
+	if response.HasError() {
+		return models.RatesSnapshot{}, &response.Error
+	}
+	snapshot := models.NewHistoricalRatesSnapshot(response, day, m.now())
+	if err := m.history.Set(day, snapshot); err != nil {
+		utils.Logger(ctx).Warn(utils.ERR_MESSAGE_RATES_HISTORY, "date", day, "error", err)
+	}
+	return snapshot, nil
+}
+
+// dayLock is the lock of the lookups of the historical rates of a day, along with the number of
+// lookups holding or waiting for it.
+type dayLock struct {
+	sync.Mutex
+	lookups int
+}
+
+// lockDay locks the lookups of the historical rates of the day and returns the function that
+// unlocks them, which forgets the day once no lookup is left.
+func (m *RatesManager) lockDay(day string) (unlock func()) {
+	m.historyLock.Lock()
+	lock, ok := m.dayLocks[day]
+	if !ok {
+		lock = &dayLock{}
+		m.dayLocks[day] = lock
+	}
+	lock.lookups++
+	m.historyLock.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		m.historyLock.Lock()
+		defer m.historyLock.Unlock()
+		lock.lookups--
+		if lock.lookups == 0 {
+			delete(m.dayLocks, day)
+		}
+	}
+}
+
+// Refresh retrieves the rates when the snapshot expires before the given time, keeping the
+// current snapshot when the providers fail. It does nothing while no snapshot was retrieved,
+// so the rates are only retrieved in the background once a trace needed them.
+func (m *RatesManager) Refresh(ctx context.Context, before time.Time) {
+	if snapshot, ok := m.current(); !ok || before.Before(snapshot.ExpiresAt) {
+		return
+	}
+	m.refreshLock.Lock()
+	defer m.refreshLock.Unlock()
+	if snapshot, ok := m.current(); !ok || before.Before(snapshot.ExpiresAt) {
+		return
+	}
+	m.refresh(ctx)
+}
+
+// Watch refreshes every interval the snapshot that would expire before the next tick, so the
+// traces do not wait for the provider, until the returned function is called, which waits for
+// the refresh in progress to finish.
+func (m *RatesManager) Watch(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.Refresh(context.Background(), m.now().Add(interval))
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		<-stopped
+	}
+}
+
+// refresh retrieves the rates from the providers and stores the new snapshot. When all of them
+// fail it returns the last snapshot, marked as stale once expired, while the policy allows it.
+func (m *RatesManager) refresh(ctx context.Context) (models.RatesSnapshot, error) {
+	response := m.lookupRates(ctx)
+	now := m.now()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if !response.HasError() {
+		snapshot := models.NewRatesSnapshot(response, now, m.policy.TTL)
+		m.snapshot = &snapshot
+		return snapshot, nil
+	}
+	if m.snapshot == nil || (m.policy.MaxStale > 0 && now.Sub(m.snapshot.ExpiresAt) > m.policy.MaxStale) {
+		return models.RatesSnapshot{}, &response.Error
+	}
+	utils.Logger(ctx).Warn(utils.ERR_MESSAGE_RATES_REFRESH, "error", response.Error.Message, "expires_at", m.snapshot.ExpiresAt)
+	if m.snapshot.Expired(now) {
+		return m.snapshot.Stale(), nil
+	}
+	return *m.snapshot, nil
+}
+
+// lookupRates retrieves the rates from the providers, in order, returning the first response
+// without errors or the first error found.
+func (m *RatesManager) lookupRates(ctx context.Context) models.CurrencyResponse {
+	var failed models.CurrencyResponse
+	for _, provider := range m.providers {
+		response := provider.GetCurrencyInformation(ctx)
+		if !response.HasError() {
+			return response
+		}
+		if !failed.HasError() {
+			failed = response
+		}
+	}
+	if !failed.HasError() {
+		failed.Error = *models.NewCurrencyApiError(utils.ERR_CODE_CURRENCY_SERVICE, utils.ERR_USER_MESSAGE_CURRENCY_SERVICE)
+	}
+	return failed
+}
+
+// lookupHistoricalRates retrieves the rates of the day from the providers that keep historical
+// rates, in order, returning the first response without errors or the first error found.
+func (m *RatesManager) lookupHistoricalRates(ctx context.Context, date time.Time) models.CurrencyResponse {
+	var failed models.CurrencyResponse
+	for _, provider := range m.providers {
+		historical, ok := provider.(interfaces.HistoricalCurrencyInformation)
+		if !ok {
+			continue
+		}
+		response := historical.GetHistoricalCurrencyInformation(ctx, date)
+		if !response.HasError() {
+			return response
+		}
+		if !failed.HasError() {
+			failed = response
+		}
+	}
+	if !failed.HasError() {
+		failed.Error = *models.NewCurrencyApiError(utils.ERR_CODE_RATES_HISTORY, utils.ERR_USER_MESSAGE_RATES_HISTORY)
+	}
+	return failed
+}
+
+// current returns the last snapshot retrieved, if any.
+func (m *RatesManager) current() (models.RatesSnapshot, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.snapshot == nil {
+		return models.RatesSnapshot{}, false
+	}
+	return *m.snapshot, true
+}
+
+// now returns the current time, the one of the clock when it is set.
+func (m *RatesManager) now() time.Time {
+	if m.clock != nil {
+		return m.clock()
+	}
+	return time.Now()
+}
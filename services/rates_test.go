@@ -0,0 +1,365 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"service_fraud/models"
+	"service_fraud/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRatesProvider answers the rates it holds, or the error when it is set, counting the calls.
+type fakeRatesProvider struct {
+	lock     sync.Mutex
+	calls    int
+	response models.CurrencyResponse
+}
+
+func (f *fakeRatesProvider) GetCurrencyInformation(ctx context.Context) models.CurrencyResponse {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.calls++
+	return f.response
+}
+
+func (f *fakeRatesProvider) set(response models.CurrencyResponse) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.response = response
+}
+
+func (f *fakeRatesProvider) count() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.calls
+}
+
+// fakeHistoricalRatesProvider also answers the historical rates, recording the days asked for.
+type fakeHistoricalRatesProvider struct {
+	fakeRatesProvider
+	days []string
+}
+
+func (f *fakeHistoricalRatesProvider) GetHistoricalCurrencyInformation(ctx context.Context, date time.Time) models.CurrencyResponse {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.days = append(f.days, date.Format(time.DateOnly))
+	return f.response
+}
+
+// newTestRatesManager creates a manager with a one hour ttl and a clock moved by the returned
+// function.
+func newTestRatesManager(provider *fakeRatesProvider, maxStale time.Duration) (*RatesManager, func(time.Duration)) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	manager := NewRatesManager(RatesPolicy{TTL: time.Hour, MaxStale: maxStale}, provider)
+	manager.SetMetrics(nil)
+	manager.clock = func() time.Time { return now }
+	return manager, func(d time.Duration) { now = now.Add(d) }
+}
+
+func ratesResponse(ars float64) models.CurrencyResponse {
+	return models.CurrencyResponse{Success: true, Base: "EUR", Timestamp: 1714564800, Rates: map[string]float64{"USD": 1.1, "ARS": ars}}
+}
+
+func failedRatesResponse() models.CurrencyResponse {
+	return models.CurrencyResponse{Error: *models.NewCurrencyApiError(utils.ERR_CODE_CURRENCY_SERVICE, utils.ERR_USER_MESSAGE_CURRENCY_SERVICE)}
+}
+
+func TestRatesManager_Get(t *testing.T) {
+	provider := &fakeRatesProvider{response: ratesResponse(950)}
+	manager, advance := newTestRatesManager(provider, 0)
+
+	snapshot, err := manager.Get(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, "EUR", snapshot.Base)
+	assert.Equal(t, 950.0, snapshot.Rates["ARS"])
+	assert.Equal(t, time.Unix(1714564800, 0), snapshot.Timestamp)
+	assert.Nil(t, snapshot.StaleSince)
+
+	advance(59 * time.Minute)
+	_, err = manager.Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, provider.count())
+
+	provider.set(ratesResponse(1000))
+	advance(time.Minute)
+	snapshot, err = manager.Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1000.0, snapshot.Rates["ARS"])
+	assert.Equal(t, 2, provider.count())
+}
+
+func TestRatesManager_Get_StaleOnError(t *testing.T) {
+	provider := &fakeRatesProvider{response: ratesResponse(950)}
+	manager, advance := newTestRatesManager(provider, 2*time.Hour)
+	first, err := manager.Get(context.Background())
+	require.NoError(t, err)
+
+	provider.set(failedRatesResponse())
+	advance(90 * time.Minute)
+	snapshot, err := manager.Get(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 950.0, snapshot.Rates["ARS"])
+	require.NotNil(t, snapshot.StaleSince)
+	assert.Equal(t, first.ExpiresAt, *snapshot.StaleSince)
+
+	advance(2 * time.Hour)
+	_, err = manager.Get(context.Background())
+
+	var currencyError *models.CurrencyApiError
+	require.ErrorAs(t, err, &currencyError)
+	assert.Equal(t, utils.ERR_CODE_CURRENCY_SERVICE, currencyError.Code)
+}
+
+func TestRatesManager_Get_NoSnapshot(t *testing.T) {
+	provider := &fakeRatesProvider{response: failedRatesResponse()}
+	manager, _ := newTestRatesManager(provider, 0)
+
+	_, err := manager.Get(context.Background())
+
+	assert.Error(t, err)
+}
+
+func TestRatesManager_Refresh(t *testing.T) {
+	provider := &fakeRatesProvider{response: ratesResponse(950)}
+	manager, advance := newTestRatesManager(provider, 0)
+
+	// Nothing is retrieved in the background until a trace needs the rates.
+	manager.Refresh(context.Background(), manager.now().Add(2*time.Hour))
+	assert.Zero(t, provider.count())
+
+	_, err := manager.Get(context.Background())
+	require.NoError(t, err)
+
+	manager.Refresh(context.Background(), manager.now().Add(time.Minute))
+	assert.Equal(t, 1, provider.count())
+
+	provider.set(ratesResponse(1000))
+	advance(59 * time.Minute)
+	manager.Refresh(context.Background(), manager.now().Add(time.Minute))
+	assert.Equal(t, 2, provider.count())
+
+	// The refreshed snapshot is served without calling the provider again.
+	advance(2 * time.Minute)
+	snapshot, err := manager.Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1000.0, snapshot.Rates["ARS"])
+	assert.Equal(t, 2, provider.count())
+}
+
+func TestRatesManager_Refresh_KeepsSnapshotOnError(t *testing.T) {
+	provider := &fakeRatesProvider{response: ratesResponse(950)}
+	manager, advance := newTestRatesManager(provider, 0)
+	_, err := manager.Get(context.Background())
+	require.NoError(t, err)
+
+	provider.set(failedRatesResponse())
+	advance(59 * time.Minute)
+	manager.Refresh(context.Background(), manager.now().Add(time.Minute))
+
+	snapshot, err := manager.Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 950.0, snapshot.Rates["ARS"])
+	assert.Nil(t, snapshot.StaleSince)
+}
+
+func TestRatesManager_Get_Concurrent(t *testing.T) {
+	provider := &fakeRatesProvider{response: ratesResponse(950)}
+	manager, _ := newTestRatesManager(provider, 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			manager.Get(context.Background())
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, provider.count())
+}
+
+func TestGetAllProducts_StaleRates(t *testing.T) {
+	service, _ := newTestInformationService(t)
+	provider := &fakeRatesProvider{response: ratesResponse(1050)}
+	manager, advance := newTestRatesManager(provider, 0)
+	service.SetRatesManager(manager)
+
+	result, err := service.GetAllProducts(context.Background(), "2800:810:400::1")
+	require.NoError(t, err)
+	require.NotNil(t, result.Rates)
+	assert.Nil(t, result.Rates.StaleSince)
+
+	provider.set(failedRatesResponse())
+	advance(2 * time.Hour)
+	result, err = service.GetAllProducts(context.Background(), "2800:810:400::1")
+
+	require.NoError(t, err)
+	require.NotNil(t, result.Rates.StaleSince)
+	assert.InDelta(t, 1.1/1050, result.Currencies[0].Rate, 1e-12)
+}
+
+func TestRatesManager_GetAt(t *testing.T) {
+	latest := &fakeRatesProvider{response: ratesResponse(1050)}
+	historical := &fakeHistoricalRatesProvider{fakeRatesProvider: fakeRatesProvider{response: ratesResponse(900)}}
+	historical.response.Source = utils.RATES_PROVIDER_ECB
+	manager := NewRatesManager(DefaultRatesPolicy(), latest, historical)
+	manager.SetMetrics(nil)
+	manager.clock = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+
+	for i := 0; i < 2; i++ {
+		snapshot, err := manager.GetAt(context.Background(), time.Date(2024, 4, 20, 0, 0, 0, 0, time.UTC))
+
+		require.NoError(t, err)
+		assert.Equal(t, "2024-04-20", snapshot.Date)
+		assert.Equal(t, utils.RATES_PROVIDER_ECB, snapshot.Source)
+		assert.Equal(t, 900.0, snapshot.Rates["ARS"])
+		assert.Equal(t, "2024-04-20", snapshot.Info().Date)
+	}
+	assert.Equal(t, []string{"2024-04-20"}, historical.days)
+	assert.Zero(t, latest.count())
+
+	snapshot, err := manager.GetAt(context.Background(), time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Empty(t, snapshot.Date)
+	assert.Equal(t, 1050.0, snapshot.Rates["ARS"])
+	assert.Equal(t, 1, latest.count())
+}
+
+func TestRatesManager_GetAt_Errors(t *testing.T) {
+	date := time.Date(2024, 4, 20, 0, 0, 0, 0, time.UTC)
+	manager := NewRatesManager(DefaultRatesPolicy(), &fakeRatesProvider{response: ratesResponse(1050)})
+	manager.SetMetrics(nil)
+
+	_, err := manager.GetAt(context.Background(), date)
+
+	var currencyError *models.CurrencyApiError
+	require.ErrorAs(t, err, &currencyError)
+	assert.Equal(t, utils.ERR_CODE_RATES_HISTORY, currencyError.Code)
+
+	historical := &fakeHistoricalRatesProvider{fakeRatesProvider: fakeRatesProvider{response: failedRatesResponse()}}
+	manager = NewRatesManager(DefaultRatesPolicy(), historical)
+	manager.SetMetrics(nil)
+	for i := 0; i < 2; i++ {
+		_, err = manager.GetAt(context.Background(), date)
+		require.ErrorAs(t, err, &currencyError)
+		assert.Equal(t, utils.ERR_CODE_CURRENCY_SERVICE, currencyError.Code)
+	}
+	// The failures are not kept, so the day is asked for again.
+	assert.Len(t, historical.days, 2)
+
+	// Asking for many days does not keep a lock for each of them.
+	for i := 1; i <= 100; i++ {
+		_, err = manager.GetAt(context.Background(), date.AddDate(0, 0, -i))
+		require.Error(t, err)
+	}
+	assert.Empty(t, manager.dayLocks)
+}
+
+func TestRatesManager_GetAt_UTC(t *testing.T) {
+	latest := &fakeRatesProvider{response: ratesResponse(1050)}
+	historical := &fakeHistoricalRatesProvider{fakeRatesProvider: fakeRatesProvider{response: ratesResponse(900)}}
+	manager := NewRatesManager(DefaultRatesPolicy(), latest, historical)
+	manager.SetMetrics(nil)
+	manager.clock = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+	buenosAires := time.FixedZone("ART", -3*60*60)
+
+	// 22:00 of the previous day in Buenos Aires is already today in UTC.
+	snapshot, err := manager.GetAt(context.Background(), time.Date(2024, 4, 30, 22, 0, 0, 0, buenosAires))
+	require.NoError(t, err)
+	assert.Empty(t, snapshot.Date)
+	assert.Empty(t, historical.days)
+
+	snapshot, err = manager.GetAt(context.Background(), time.Date(2024, 4, 19, 22, 0, 0, 0, buenosAires))
+	require.NoError(t, err)
+	assert.Equal(t, "2024-04-20", snapshot.Date)
+	assert.Equal(t, []string{"2024-04-20"}, historical.days)
+}
+
+// blockingHistoricalRatesProvider answers the rates of the first day once the rates of the second
+// one were asked for.
+type blockingHistoricalRatesProvider struct {
+	fakeRatesProvider
+	asked chan struct{}
+}
+
+func (b *blockingHistoricalRatesProvider) GetHistoricalCurrencyInformation(ctx context.Context, date time.Time) models.CurrencyResponse {
+	if date.Day() == 21 {
+		close(b.asked)
+		return ratesResponse(910)
+	}
+	select {
+	case <-b.asked:
+		return ratesResponse(900)
+	case <-time.After(5 * time.Second):
+		return failedRatesResponse()
+	}
+}
+
+func TestRatesManager_GetAt_ConcurrentDays(t *testing.T) {
+	provider := &blockingHistoricalRatesProvider{asked: make(chan struct{})}
+	manager := NewRatesManager(DefaultRatesPolicy(), provider)
+	manager.SetMetrics(nil)
+	manager.clock = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := manager.GetAt(context.Background(), time.Date(2024, 4, 20, 0, 0, 0, 0, time.UTC))
+		errs <- err
+	}()
+	// The lookup of another day does not wait for the one in flight.
+	time.Sleep(10 * time.Millisecond)
+	snapshot, err := manager.GetAt(context.Background(), time.Date(2024, 4, 21, 0, 0, 0, 0, time.UTC))
+
+	require.NoError(t, err)
+	assert.Equal(t, 910.0, snapshot.Rates["ARS"])
+	assert.NoError(t, <-errs)
+	// The days are forgotten once their lookups finish.
+	assert.Empty(t, manager.dayLocks)
+}
+
+func TestWithRatesDateValue(t *testing.T) {
+	ctx, err := WithRatesDateValue(context.Background(), "")
+	require.NoError(t, err)
+	_, ok := RatesDate(ctx)
+	assert.False(t, ok)
+
+	ctx, err = WithRatesDateValue(context.Background(), "2024-04-20")
+	require.NoError(t, err)
+	date, ok := RatesDate(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2024, 4, 20, 0, 0, 0, 0, time.UTC), date)
+
+	for _, value := range []string{"20/04/2024", "2024-04-31", time.Now().AddDate(0, 0, 2).Format(time.DateOnly)} {
+		_, err = WithRatesDateValue(context.Background(), value)
+		var optionError *models.OptionInvalidError
+		require.ErrorAs(t, err, &optionError, value)
+		assert.Equal(t, utils.ERR_CODE_INVALID_DATE, optionError.Code)
+	}
+}
+
+func TestGetAllProducts_HistoricalRates(t *testing.T) {
+	service, _ := newTestInformationService(t)
+	ctx := WithRatesDate(context.Background(), time.Date(2024, 4, 20, 0, 0, 0, 0, time.UTC))
+
+	result, err := service.GetAllProducts(ctx, "2800:810:400::1")
+
+	require.NoError(t, err)
+	require.NotNil(t, result.Rates)
+	assert.Equal(t, "2024-04-20", result.Rates.Date)
+	assert.Equal(t, utils.RATES_PROVIDER_FIXER, result.Rates.Source)
+	assert.InDelta(t, 1.1/900, result.Currencies[0].Rate, 1e-12)
+
+	result, err = service.GetAllProducts(context.Background(), "2800:810:400::1")
+	require.NoError(t, err)
+	assert.Empty(t, result.Rates.Date)
+	assert.InDelta(t, 1.1/1050, result.Currencies[0].Rate, 1e-12)
+}
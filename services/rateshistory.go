@@ -0,0 +1,138 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"service_fraud/models"
+	"service_fraud/utils"
+	"sync"
+	"time"
+)
+
+// RatesHistory keeps the snapshots of the historical exchange rates by day, YYYY-MM-DD. The
+// historical rates do not change, so the snapshots never expire. With a directory each snapshot
+// is also saved in a JSON file named after its day, so the investigations of the same day do not
+// call the providers again after a restart or in the next run of a command. It is safe for
+// concurrent use.
+type RatesHistory struct {
+	lock      sync.Mutex
+	dir       string
+	snapshots map[string]models.RatesSnapshot
+	metrics   *Metrics
+}
+
+// NewRatesHistory creates the history saved in the given directory, which is created on the
+// first snapshot. An empty directory keeps the snapshots only in memory.
+func NewRatesHistory(dir string) *RatesHistory {
+	return &RatesHistory{dir: dir, snapshots: make(map[string]models.RatesSnapshot), metrics: DefaultMetrics()}
+}
+
+// SetMetrics sets the metrics the lookups of the history are recorded in, nil disables them.
+func (h *RatesHistory) SetMetrics(metrics *Metrics) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.metrics = metrics
+}
+
+// Set stores the snapshot of the day and, with a directory, saves it in its file.
+func (h *RatesHistory) Set(date string, snapshot models.RatesSnapshot) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.snapshots[date] = snapshot
+	if h.dir == "" {
+		return nil
+	}
+	return h.write(date, snapshot)
+}
+
+// Get returns the snapshot of the day, reading it from its file when it is not in memory.
+// It returns an error if the snapshot was never stored.
+func (h *RatesHistory) Get(date string) (models.RatesSnapshot, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	snapshot, ok := h.snapshots[date]
+	if !ok {
+		var err error
+		if snapshot, err = h.read(date); err != nil {
+			h.metrics.observeCache(utils.METRICS_CACHE_RATES_HISTORY, utils.METRICS_CACHE_MISS)
+			return models.RatesSnapshot{}, err
+		}
+		h.snapshots[date] = snapshot
+	}
+	h.metrics.observeCache(utils.METRICS_CACHE_RATES_HISTORY, utils.METRICS_CACHE_HIT)
+	return snapshot, nil
+}
+
+// Expire removes the snapshot of the day and its file.
+func (h *RatesHistory) Expire(date string) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	delete(h.snapshots, date)
+	if h.dir == "" {
+		return nil
+	}
+	path, err := h.path(date)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// path returns the file of the snapshot of the day, which must be a YYYY-MM-DD date.
+func (h *RatesHistory) path(date string) (string, error) {
+	if _, err := time.Parse(time.DateOnly, date); err != nil {
+		return "", fmt.Errorf("%s is not a YYYY-MM-DD date", date)
+	}
+	return filepath.Join(h.dir, date+".json"), nil
+}
+
+// read loads the snapshot of the day from its file.
+func (h *RatesHistory) read(date string) (models.RatesSnapshot, error) {
+	if h.dir == "" {
+		return models.RatesSnapshot{}, fmt.Errorf("no rates stored for %s", date)
+	}
+	path, err := h.path(date)
+	if err != nil {
+		return models.RatesSnapshot{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return models.RatesSnapshot{}, err
+	}
+	var snapshot models.RatesSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return models.RatesSnapshot{}, err
+	}
+	if len(snapshot.Rates) == 0 {
+		return models.RatesSnapshot{}, fmt.Errorf("the file %s does not include any rate", path)
+	}
+	return snapshot, nil
+}
+
+// write saves the snapshot of the day in a temporary file that replaces its file, so a crash
+// never leaves a file half written.
+func (h *RatesHistory) write(date string, snapshot models.RatesSnapshot) error {
+	path, err := h.path(date)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(h.dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
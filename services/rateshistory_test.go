@@ -0,0 +1,75 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"service_fraud/models"
+	"service_fraud/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func historicalSnapshot(date string) models.RatesSnapshot {
+	response := models.CurrencyResponse{Success: true, Base: "EUR", Rates: map[string]float64{"USD": 1.07, "ARS": 900}, Source: "ecb"}
+	return models.NewHistoricalRatesSnapshot(response, date, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+}
+
+func TestRatesHistory_Persists(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "rates")
+	history := NewRatesHistory(dir)
+	history.SetMetrics(nil)
+	require.NoError(t, history.Set("2024-04-20", historicalSnapshot("2024-04-20")))
+
+	// Another process, or the next run of a command, reads the snapshot saved by the first one.
+	metrics := NewMetrics()
+	reloaded := NewRatesHistory(dir)
+	reloaded.SetMetrics(metrics)
+	snapshot, err := reloaded.Get("2024-04-20")
+
+	require.NoError(t, err)
+	assert.Equal(t, "2024-04-20", snapshot.Date)
+	assert.Equal(t, "ecb", snapshot.Source)
+	assert.Equal(t, 900.0, snapshot.Rates["ARS"])
+	assert.True(t, snapshot.Timestamp.Equal(time.Date(2024, 4, 20, 0, 0, 0, 0, time.UTC)))
+	_, err = reloaded.Get("2024-04-21")
+	assert.Error(t, err)
+	assert.Equal(t, 1.0, metrics.cacheRequests.Value(utils.METRICS_CACHE_RATES_HISTORY, utils.METRICS_CACHE_HIT))
+	assert.Equal(t, 1.0, metrics.cacheRequests.Value(utils.METRICS_CACHE_RATES_HISTORY, utils.METRICS_CACHE_MISS))
+
+	require.NoError(t, reloaded.Expire("2024-04-20"))
+	_, err = os.Stat(filepath.Join(dir, "2024-04-20.json"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = reloaded.Get("2024-04-20")
+	assert.Error(t, err)
+}
+
+func TestRatesHistory_InMemory(t *testing.T) {
+	history := NewRatesHistory("")
+	history.SetMetrics(nil)
+
+	_, err := history.Get("2024-04-20")
+	assert.Error(t, err)
+
+	require.NoError(t, history.Set("2024-04-20", historicalSnapshot("2024-04-20")))
+	snapshot, err := history.Get("2024-04-20")
+	require.NoError(t, err)
+	assert.Equal(t, "2024-04-20", snapshot.Date)
+}
+
+func TestRatesHistory_InvalidFiles(t *testing.T) {
+	dir := t.TempDir()
+	history := NewRatesHistory(dir)
+	history.SetMetrics(nil)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "2024-04-20.json"), []byte(`{"rates": {}}`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "2024-04-21.json"), []byte(`{"rates":`), 0644))
+
+	for _, date := range []string{"2024-04-20", "2024-04-21", "../2024-04-20"} {
+		_, err := history.Get(date)
+		assert.Error(t, err, date)
+	}
+	assert.Error(t, history.Set("../outside", historicalSnapshot("2024-04-20")))
+}
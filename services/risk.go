@@ -0,0 +1,77 @@
+package services
+
+import (
+	"math/big"
+	"service_fraud/models"
+	"service_fraud/utils"
+	"strings"
+)
+
+// RiskService scores the traces with the rules of a RiskPolicy.
+type RiskService struct {
+	policy models.RiskPolicy
+}
+
+// NewRiskService creates a new RiskService that evaluates the given policy. The policy is
+// expected to be valid, see RiskPolicy.Validate.
+func NewRiskService(policy models.RiskPolicy) *RiskService {
+	return &RiskService{policy: policy}
+}
+
+// Evaluate adds the weights of the rules that fire for the trace into a score between 0 and
+// RISK_MAX_SCORE and decides whether the operation is allowed, reviewed or denied.
+func (r *RiskService) Evaluate(result models.TraceResult) models.RiskAssessment {
+	assessment := models.RiskAssessment{Rules: []models.FiredRule{}}
+	for _, rule := range r.policy.Rules {
+		matched, known := matchRiskRule(rule, result)
+		if !known || matched == rule.Negate {
+			continue
+		}
+		assessment.Score += rule.Weight
+		assessment.Rules = append(assessment.Rules, models.FiredRule{Name: rule.Name, Type: rule.Type, Weight: rule.Weight})
+	}
+	assessment.Score = min(max(assessment.Score, 0), utils.RISK_MAX_SCORE)
+	assessment.Decision = r.policy.Decide(assessment.Score)
+	return assessment
+}
+
+// matchRiskRule reports whether the condition of the rule is met by the trace. The rules over
+// data missing from the trace are reported as unknown and never fire.
+func matchRiskRule(rule models.RiskRule, result models.TraceResult) (matched bool, known bool) {
+	switch rule.Type {
+	case utils.RISK_RULE_DISTANCE_OVER:
+		return result.Distance.Kms > rule.Kms, true
+	case utils.RISK_RULE_COUNTRY:
+		return containsFold(rule.Values, result.ISO), result.ISO != ""
+	case utils.RISK_RULE_CONTINENT:
+		return containsFold(rule.Values, result.Continent), result.Continent != ""
+	case utils.RISK_RULE_CONNECTION_TYPE:
+		return containsFold(rule.Values, result.ConnectionType), result.ConnectionType != ""
+	case utils.RISK_RULE_EU:
+		return result.IsEu, true
+	case utils.RISK_RULE_CURRENCY_MISMATCH:
+		for _, currency := range result.Currencies {
+			if containsFold(rule.Values, currency.Code) {
+				return false, true
+			}
+		}
+		return true, len(result.Currencies) > 0
+	case utils.RISK_RULE_AMOUNT_OVER:
+		limit, ok := new(big.Rat).SetString(rule.Amount.String())
+		if result.Transaction == nil || result.Transaction.USD() == nil || !ok {
+			return false, false
+		}
+		return result.Transaction.USD().Cmp(limit) > 0, true
+	}
+	return false, false
+}
+
+// containsFold reports whether the value is in the list, ignoring the case.
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"service_fraud/models"
+	"service_fraud/utils"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRiskService_Evaluate(t *testing.T) {
+	service := NewRiskService(models.DefaultRiskPolicy())
+
+	tests := []struct {
+		name     string
+		result   models.TraceResult
+		score    int
+		decision string
+		rules    []string
+	}{
+		{
+			name: "nearby country paying in its currency",
+			result: models.TraceResult{ISO: "AR", Continent: "SA", ConnectionType: "cable",
+				Distance: models.Distance{Kms: 10}, Currencies: []models.CurrencyRate{{Code: "ARS"}}},
+			score:    0,
+			decision: utils.RISK_DECISION_ALLOW,
+			rules:    []string{},
+		},
+		{
+			name: "distant eu country",
+			result: models.TraceResult{ISO: "DE", Continent: "EU", IsEu: true,
+				Distance: models.Distance{Kms: 11500}, Currencies: []models.CurrencyRate{{Code: "EUR"}}},
+			score:    55,
+			decision: utils.RISK_DECISION_REVIEW,
+			rules:    []string{"distance_over_3000_kms", "distance_over_10000_kms", "outside_south_america", "eu_country", "currency_not_accepted"},
+		},
+		{
+			name: "anonymous connection from a sanctioned country",
+			result: models.TraceResult{ISO: "ir", Continent: "AS", ConnectionType: "VPN",
+				Distance: models.Distance{Kms: 13000}, Currencies: []models.CurrencyRate{{Code: "IRR"}}},
+			score:    100,
+			decision: utils.RISK_DECISION_DENY,
+			rules: []string{"distance_over_3000_kms", "distance_over_10000_kms", "outside_south_america",
+				"sanctioned_country", "anonymous_connection", "currency_not_accepted"},
+		},
+		{
+			name:     "missing data does not fire rules",
+			result:   models.TraceResult{},
+			score:    0,
+			decision: utils.RISK_DECISION_ALLOW,
+			rules:    []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assessment := service.Evaluate(tt.result)
+
+			assert.Equal(t, tt.score, assessment.Score)
+			assert.Equal(t, tt.decision, assessment.Decision)
+			names := []string{}
+			for _, rule := range assessment.Rules {
+				names = append(names, rule.Name)
+			}
+			assert.Equal(t, tt.rules, names)
+		})
+	}
+}
+
+func TestRiskService_Evaluate_NegativeWeight(t *testing.T) {
+	service := NewRiskService(models.RiskPolicy{
+		ReviewThreshold: 10,
+		DenyThreshold:   20,
+		Rules: []models.RiskRule{
+			{Name: "trusted_country", Type: utils.RISK_RULE_COUNTRY, Weight: -30, Values: []string{"AR"}},
+			{Name: "far", Type: utils.RISK_RULE_DISTANCE_OVER, Weight: 15, Kms: 100},
+		},
+	})
+
+	assessment := service.Evaluate(models.TraceResult{ISO: "AR", Distance: models.Distance{Kms: 1000}})
+
+	assert.Equal(t, 0, assessment.Score)
+	assert.Equal(t, utils.RISK_DECISION_ALLOW, assessment.Decision)
+	assert.Len(t, assessment.Rules, 2)
+}
+
+func TestRiskService_Evaluate_AmountOver(t *testing.T) {
+	service := NewRiskService(models.RiskPolicy{
+		ReviewThreshold: 10,
+		DenyThreshold:   20,
+		Rules:           []models.RiskRule{{Name: "amount_over_1000_usd", Type: utils.RISK_RULE_AMOUNT_OVER, Weight: 15, Amount: "1000"}},
+	})
+	rates := models.CurrencyResponse{Base: "EUR", Rates: map[string]float64{"USD": 1.1, "ARS": 1050}}
+
+	tests := []struct {
+		amount   string
+		currency string
+		score    int
+	}{
+		{"1000", "USD", 0},
+		{"1000.01", "USD", 15},
+		// 954545.45 ARS are 999.999995 USD, under the limit even though they are 1000.00 rounded to cents.
+		{"954545.45", "ARS", 0},
+		{"954545.46", "ARS", 15},
+	}
+	for _, tt := range tests {
+		money, err := models.ParseMoney(tt.amount, tt.currency)
+		require.NoError(t, err)
+		transaction, err := models.NewTransaction(money, utils.CURRENCY_USD, rates)
+		require.NoError(t, err)
+
+		assessment := service.Evaluate(models.TraceResult{Transaction: transaction})
+
+		assert.Equal(t, tt.score, assessment.Score, tt.amount)
+	}
+
+	assessment := service.Evaluate(models.TraceResult{})
+	assert.Equal(t, 0, assessment.Score)
+	assert.Empty(t, assessment.Rules)
+}
+
+func TestGetAllProducts_Risk(t *testing.T) {
+	service, _ := newTestInformationService(t)
+
+	result, err := service.GetAllProducts(context.Background(), "1.1.1.1")
+	assert.NoError(t, err)
+	assert.Nil(t, result.Risk)
+
+	service.SetRiskEvaluator(NewRiskService(models.DefaultRiskPolicy()))
+	result, err = service.GetAllProducts(context.Background(), "1.1.1.1")
+	assert.NoError(t, err)
+	if assert.NotNil(t, result.Risk) {
+		assert.Equal(t, 0, result.Risk.Score)
+		assert.Equal(t, utils.RISK_DECISION_ALLOW, result.Risk.Decision)
+		assert.Empty(t, result.Risk.Rules)
+	}
+}
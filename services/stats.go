@@ -1,172 +1,611 @@
-package services
-
-import (
-	"fmt"
-	"log"
-	"service_fraud/models"
-	"service_fraud/utils"
-	"sort"
-	"strconv"
-	"sync"
-)
-
-const WorkerCount = 3
-
-var instanceStats *StatsService
-var onceCreationStats sync.Once
-
-// InformationService proporciona una implementación para obtener información de IP, país y moneda.
-type StatsService struct {
-	lock             sync.Mutex
-	StatsRecord      []models.Stats
-	processedChannel chan models.StatsRequest
-	StatsChannel     chan models.Stats
-	Done             chan struct{}
-	Result           string
-}
-
-// NewStatsService initializes the StatsService and starts worker goroutines for processing stats.
-func NewStatsService(processedChannel chan models.StatsRequest) *StatsService {
-	onceCreationStats.Do(func() {
-		instanceStats = &StatsService{
-			processedChannel: processedChannel,
-		}
-		for i := 0; i < WorkerCount; i++ {
-			go instanceStats.processStats()
-		}
-	})
-	return instanceStats
-}
-
-// processStats listens for incoming stats requests and processes them.
-func (s *StatsService) processStats() {
-	log.Println("Start stats processing started")
-	for {
-		select {
-		case stats, ok := <-s.processedChannel:
-			if !ok {
-				fmt.Println("Processed channel closed")
-				return
-			}
-			s.Combine(stats)
-		case <-s.Done:
-			fmt.Println("The stats service is stopped")
-			return
-		}
-	}
-}
-
-// GetStats returns the current stats result or a message if none are available.
-func (s *StatsService) GetStats() string {
-	s.lock.Lock()
-	defer s.lock.Unlock()
-	if s.Result == "" {
-		return utils.NO_RECORD_INFORMATION_AVAILABLE_YET
-	} else {
-		return s.Result
-	}
-
-}
-
-// Combine processes a stats request and updates the stats record.
-func (s *StatsService) Combine(req models.StatsRequest) {
-	s.lock.Lock()
-	defer s.lock.Unlock()
-	s.validateStatsRecord(req)
-}
-
-// validateStatsRecord checks if a country already has an entry in the stats record and updates it.
-func (s *StatsService) validateStatsRecord(req models.StatsRequest) {
-	found := false
-
-	for i := 0; i < len(s.StatsRecord); i++ {
-		stats := s.StatsRecord[i]
-		if stats.Country == req.Country {
-			found = true
-			s.StatsRecord[i].Invokes++
-		}
-	}
-
-	if !found {
-		s.StatsRecord = append(s.StatsRecord, models.Stats{
-			Country:  req.Country,
-			Distance: utils.GetEstimatedDistance(utils.BA_LATITUDE, utils.BA_LONGITUDE, req.Lat, req.Lon),
-			Invokes:  1,
-		})
-	}
-
-	s.Result = fmt.Sprintln("\n" + s.getLowerDistance() + "\n" + s.getHigherDistance() + "\n" + s.getAverageDistance())
-}
-
-// getLowerDistance finds and returns the country with the closest distance to Buenos Aires.
-func (s *StatsService) getLowerDistance() string {
-	var lowerDistance models.Stats
-	isSet := false // Bandera para verificar si lowerDistance ha sido asignado
-
-	for i := 0; i < len(s.StatsRecord); i++ {
-		if !isSet {
-			lowerDistance = s.StatsRecord[i]
-			isSet = true
-		} else {
-			curDist, _ := strconv.ParseFloat(lowerDistance.Distance, 64)
-			arrDist, _ := strconv.ParseFloat(s.StatsRecord[i].Distance, 64)
-			if arrDist < curDist {
-				lowerDistance = s.StatsRecord[i]
-			}
-		}
-	}
-
-	return fmt.Sprintf("Distancia más cercana a Buenos Aires consultada: \n %s con una distancia aproximada de: %s kms",
-		lowerDistance.Country, lowerDistance.Distance)
-}
-
-// getHigherDistance finds and returns the country with the furthest distance from Buenos Aires.
-func (s *StatsService) getHigherDistance() string {
-	var higherDistance models.Stats
-	isSet := false // Bandera para verificar si higherDistance ha sido asignado
-
-	for i := 0; i < len(s.StatsRecord); i++ {
-		if !isSet {
-			higherDistance = s.StatsRecord[i]
-			isSet = true
-		} else {
-			curDist, _ := strconv.ParseFloat(higherDistance.Distance, 64)
-			arrDist, _ := strconv.ParseFloat(s.StatsRecord[i].Distance, 64)
-			if arrDist > curDist {
-				higherDistance = s.StatsRecord[i]
-			}
-		}
-	}
-
-	return fmt.Sprintf("Distancia más lejana a Buenos Aires consultada: \n %s con una distancia aproximada de: %s kms",
-		higherDistance.Country, higherDistance.Distance)
-}
-
-// getAverageDistance calculates and returns the average distance of all recorded countries.
-func (s *StatsService) getAverageDistance() string {
-	average := 0
-	totalInvokes := 0
-	s.StatsRecord = orderStats(s.StatsRecord)
-	var str string = "==============================\n"
-	for i := 0; i < len(s.StatsRecord); i++ {
-		stats := s.StatsRecord[i]
-		intDistance, _ := strconv.Atoi(stats.Distance)
-		totalInvokes += stats.Invokes
-		average += (stats.Invokes * intDistance)
-		str += fmt.Sprintf(`%s -- %s (kms) -- %d invocaciones %s`, stats.Country, stats.Distance, stats.Invokes, "\n")
-	}
-	str += "==============================\n"
-
-	str += fmt.Sprintf("Distancia promedio entre las peticiones : %d (kms)", (average / totalInvokes))
-
-	return str
-}
-
-// orderStats sorts the stats records by country name.
-func orderStats(stats []models.Stats) []models.Stats {
-	sort.Slice(stats, func(i, j int) bool {
-		return stats[i].Country < stats[j].Country
-	})
-
-	return stats
-}
+package services
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"service_fraud/interfaces"
+	"service_fraud/models"
+	"service_fraud/utils"
+	"sort"
+	"sync"
+	"time"
+)
+
+const WorkerCount = 3
+
+var instanceStats *StatsService
+var onceCreationStats sync.Once
+
+// StatsService records the processed requests and calculates the distance statistics. Besides
+// the totals of each country, the requests are counted in time buckets so the statistics of a
+// time range can be calculated while the buckets are kept.
+type StatsService struct {
+	lock             sync.Mutex
+	StatsRecord      []models.Stats
+	processedChannel chan models.StatsRequest
+	StatsChannel     chan models.Stats
+	Done             chan struct{}
+	Summary          models.StatsSummary
+	store            interfaces.StatsStore
+	references       []models.ReferenceLocation
+	histogramBuckets []float64
+	buckets          []statsBucket
+	bucketSize       time.Duration
+	retention        time.Duration
+	windows          []time.Duration
+	clock            func() time.Time
+	metrics          *Metrics
+}
+
+// statsBucket counts the requests of each country processed since start, during the bucket size.
+type statsBucket struct {
+	start   time.Time
+	invokes map[string]int
+}
+
+// NewStatsService initializes the StatsService and starts worker goroutines for processing stats.
+func NewStatsService(processedChannel chan models.StatsRequest) *StatsService {
+	onceCreationStats.Do(func() {
+		instanceStats = &StatsService{
+			processedChannel: processedChannel,
+			metrics:          DefaultMetrics(),
+		}
+		for i := 0; i < WorkerCount; i++ {
+			go instanceStats.processStats()
+		}
+	})
+	return instanceStats
+}
+
+// GetStatsRange returns the summary of the time range given by 'since' or by 'from' and 'to', or
+// the summary of all the recorded requests when none of them is given.
+func GetStatsRange(stats interfaces.StatsInformation, since, from, to string) (models.StatsSummary, error) {
+	window, err := models.ParseStatsWindow(since, from, to, time.Now())
+	if err != nil {
+		return models.StatsSummary{}, models.NewOptionInvalidError(utils.ERR_CODE_INVALID_RANGE, fmt.Sprintf(utils.ERR_USER_MESSAGE_INVALID_RANGE, err))
+	}
+	if window == nil {
+		return stats.GetStats(), nil
+	}
+	summary, err := stats.GetStatsWindow(window.From, window.To)
+	if err != nil {
+		return models.StatsSummary{}, models.NewOptionInvalidError(utils.ERR_CODE_INVALID_RANGE, fmt.Sprintf(utils.ERR_USER_MESSAGE_INVALID_RANGE, err))
+	}
+	return summary, nil
+}
+
+// processStats listens for incoming stats requests and processes them.
+func (s *StatsService) processStats() {
+	slog.Info(utils.LOG_MESSAGE_STATS_STARTED)
+	for {
+		select {
+		case stats, ok := <-s.processedChannel:
+			if !ok {
+				slog.Info(utils.LOG_MESSAGE_STATS_CLOSED)
+				return
+			}
+			s.Combine(stats)
+		case <-s.Done:
+			slog.Info(utils.LOG_MESSAGE_STATS_STOPPED)
+			return
+		}
+	}
+}
+
+// GetStats returns the summary calculated from the recorded stats, along with the requests of
+// the rolling windows.
+func (s *StatsService) GetStats() models.StatsSummary {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	summary := s.Summary
+	summary.Records = make([]models.Stats, len(s.Summary.Records))
+	copy(summary.Records, s.Summary.Records)
+	summary.Windows = s.getWindowStats()
+	return summary
+}
+
+// GetStatsWindow returns the summary calculated from the requests processed from 'from' to 'to',
+// rounded to the time buckets. It fails when the range starts before the oldest kept bucket.
+func (s *StatsService) GetStatsWindow(from, to time.Time) (models.StatsSummary, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.pruneBuckets()
+	if oldest := s.oldestBucket(); from.Before(oldest) {
+		return models.StatsSummary{}, fmt.Errorf("the stats are kept for %s, the oldest ones are from %s",
+			models.FormatWindow(s.getRetention()), oldest.Local().Format(time.RFC3339))
+	}
+
+	invokes := s.windowInvokes(from, to)
+	records := make([]models.Stats, 0, len(invokes))
+	for _, stats := range s.StatsRecord {
+		if count := invokes[stats.Country]; count > 0 {
+			stats.Invokes = count
+			records = append(records, stats)
+		}
+	}
+	summary := s.summarize(records)
+	summary.Window = &models.StatsWindow{From: from, To: to}
+	return summary, nil
+}
+
+// SetStore replaces the recorded stats and time buckets with the ones persisted in the store,
+// which then persists the following requests. The store is not used when its records cannot be
+// loaded.
+func (s *StatsService) SetStore(store interfaces.StatsStore) error {
+	records, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.store = store
+	s.buckets = nil
+	totals := make(map[string]models.Stats)
+	for _, stats := range records {
+		if stats.Time != nil {
+			s.addToBucket(stats.Country, *stats.Time, stats.Invokes)
+			stats.Time = nil
+		}
+		addStats(totals, stats)
+	}
+	s.pruneBuckets()
+
+	s.StatsRecord = make([]models.Stats, 0, len(totals))
+	for _, stats := range totals {
+		s.measureStats(&stats)
+		s.StatsRecord = append(s.StatsRecord, stats)
+	}
+	s.StatsRecord = orderStats(s.StatsRecord)
+	s.updateSummary()
+	return nil
+}
+
+// SetReferences sets the locations the distances are measured from and measures again the
+// recorded stats. Buenos Aires is used when no location is set.
+func (s *StatsService) SetReferences(references []models.ReferenceLocation) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.references = references
+	for i := range s.StatsRecord {
+		s.measureStats(&s.StatsRecord[i])
+	}
+	s.updateSummary()
+}
+
+// SetHistogramBuckets sets the upper limits, in kms, of the buckets of the distance histogram.
+// The default buckets are used when none are set.
+func (s *StatsService) SetHistogramBuckets(buckets []float64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.histogramBuckets = buckets
+	s.updateSummary()
+}
+
+// SetWindows sets the size of the time buckets the requests are counted in, how long the
+// buckets are kept and the rolling windows shown with the stats. The defaults are used for the
+// values that are not set.
+func (s *StatsService) SetWindows(bucketSize, retention time.Duration, windows []time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.bucketSize, s.retention, s.windows = bucketSize, retention, windows
+	// The kept requests are counted again in the buckets of the new size.
+	buckets := s.buckets
+	s.buckets = nil
+	for _, bucket := range buckets {
+		for country, invokes := range bucket.invokes {
+			s.addToBucket(country, bucket.start, invokes)
+		}
+	}
+	s.pruneBuckets()
+}
+
+// Combine processes a stats request and updates the stats record.
+func (s *StatsService) Combine(req models.StatsRequest) {
+	since := time.Now()
+	stored := true
+	defer func() { s.metrics.observeStats(time.Since(since), stored) }()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if req.Time.IsZero() {
+		req.Time = s.now()
+	}
+	stats := s.validateStatsRecord(req)
+	start := s.addToBucket(req.Country, req.Time, 1)
+	s.pruneBuckets()
+	if s.store == nil {
+		return
+	}
+	stats.Invokes = 1
+	stats.Time = &start
+	if err := s.store.Append(stats); err != nil {
+		slog.Error(utils.ERR_MESSAGE_STATS_STORE, utils.LOG_KEY_TRACE_ID, req.TraceId, "error", err)
+		stored = false
+	}
+}
+
+// validateStatsRecord checks if a country already has an entry in the stats record, updates it
+// and returns it.
+func (s *StatsService) validateStatsRecord(req models.StatsRequest) models.Stats {
+	found := false
+	var record models.Stats
+
+	for i := 0; i < len(s.StatsRecord); i++ {
+		stats := s.StatsRecord[i]
+		if stats.Country == req.Country {
+			found = true
+			s.StatsRecord[i].Invokes++
+			if stats.Continent == "" {
+				s.StatsRecord[i].Continent = req.Continent
+			}
+			record = s.StatsRecord[i]
+		}
+	}
+
+	if !found {
+		record = models.Stats{
+			Country:     req.Country,
+			Continent:   req.Continent,
+			Invokes:     1,
+			Coordinates: &models.Coordinates{Latitude: req.Lat, Longitude: req.Lon},
+		}
+		s.measureStats(&record)
+		s.StatsRecord = append(s.StatsRecord, record)
+	}
+
+	s.StatsRecord = orderStats(s.StatsRecord)
+	s.updateSummary()
+	return record
+}
+
+// updateSummary calculates the summary from the stats record.
+func (s *StatsService) updateSummary() {
+	s.Summary = s.summarize(s.StatsRecord)
+}
+
+// summarize calculates the summary of the given stats records.
+func (s *StatsService) summarize(records []models.Stats) models.StatsSummary {
+	sorted := sortByDistance(records)
+	totalInvokes := getTotalInvokes(records)
+	return models.StatsSummary{
+		Closest:         getLowerDistance(records),
+		Farthest:        getHigherDistance(records),
+		AverageDistance: getAverageDistance(records),
+		Distribution: models.DistanceDistribution{
+			Median: percentile(sorted, totalInvokes, 50),
+			P90:    percentile(sorted, totalInvokes, 90),
+			P95:    percentile(sorted, totalInvokes, 95),
+			P99:    percentile(sorted, totalInvokes, 99),
+			StdDev: getStdDevDistance(records),
+		},
+		Histogram:    s.getHistogram(records),
+		Continents:   getContinentStats(records),
+		TotalInvokes: totalInvokes,
+		Records:      records,
+		References:   s.getReferenceStats(records),
+	}
+}
+
+// now returns the current time, the one of the clock when it is set.
+func (s *StatsService) now() time.Time {
+	if s.clock != nil {
+		return s.clock()
+	}
+	return time.Now()
+}
+
+// getBucketSize returns the size of the time buckets.
+func (s *StatsService) getBucketSize() time.Duration {
+	if s.bucketSize <= 0 {
+		return utils.STATS_DEFAULT_BUCKET_SECONDS * time.Second
+	}
+	return s.bucketSize
+}
+
+// getRetention returns how long the time buckets are kept.
+func (s *StatsService) getRetention() time.Duration {
+	if s.retention <= 0 {
+		return utils.STATS_DEFAULT_RETENTION_HOURS * time.Hour
+	}
+	return s.retention
+}
+
+// rollingWindows returns the rolling windows shown with the stats. The default windows longer
+// than the retention are left out.
+func (s *StatsService) rollingWindows() []time.Duration {
+	if s.windows != nil {
+		return s.windows
+	}
+	var windows []time.Duration
+	for _, window := range models.DefaultStatsWindows() {
+		duration, err := time.ParseDuration(window)
+		if err == nil && duration <= s.getRetention() {
+			windows = append(windows, duration)
+		}
+	}
+	return windows
+}
+
+// addToBucket adds the invokes of the country to the bucket of the given time, keeping the
+// buckets sorted by start, and returns the start of the bucket.
+func (s *StatsService) addToBucket(country string, t time.Time, invokes int) time.Time {
+	start := t.UTC().Truncate(s.getBucketSize())
+	i := sort.Search(len(s.buckets), func(i int) bool {
+		return !s.buckets[i].start.Before(start)
+	})
+	if i == len(s.buckets) || !s.buckets[i].start.Equal(start) {
+		s.buckets = append(s.buckets, statsBucket{})
+		copy(s.buckets[i+1:], s.buckets[i:])
+		s.buckets[i] = statsBucket{start: start, invokes: make(map[string]int)}
+	}
+	s.buckets[i].invokes[country] += invokes
+	return start
+}
+
+// oldestBucket returns the start of the oldest bucket that is kept.
+func (s *StatsService) oldestBucket() time.Time {
+	return s.now().Add(-s.getRetention()).UTC().Truncate(s.getBucketSize())
+}
+
+// pruneBuckets discards the buckets older than the retention, so the memory used by the buckets
+// does not grow with the uptime.
+func (s *StatsService) pruneBuckets() {
+	oldest := s.oldestBucket()
+	i := sort.Search(len(s.buckets), func(i int) bool {
+		return !s.buckets[i].start.Before(oldest)
+	})
+	s.buckets = s.buckets[i:]
+}
+
+// windowInvokes counts the requests of each country in the buckets that overlap the range from
+// 'from' to 'to', a zero 'to' has no upper limit.
+func (s *StatsService) windowInvokes(from, to time.Time) map[string]int {
+	invokes := make(map[string]int)
+	size := s.getBucketSize()
+	for _, bucket := range s.buckets {
+		if !bucket.start.Add(size).After(from) || (!to.IsZero() && !bucket.start.Before(to)) {
+			continue
+		}
+		for country, count := range bucket.invokes {
+			invokes[country] += count
+		}
+	}
+	return invokes
+}
+
+// getWindowStats counts the requests of each rolling window and calculates their average
+// distance.
+func (s *StatsService) getWindowStats() []models.WindowStats {
+	s.pruneBuckets()
+	now := s.now()
+	windows := make([]models.WindowStats, 0, len(s.rollingWindows()))
+	for _, window := range s.rollingWindows() {
+		invokes := s.windowInvokes(now.Add(-window), time.Time{})
+		windowStats := models.WindowStats{Window: models.FormatWindow(window)}
+		total := 0.0
+		for _, stats := range s.StatsRecord {
+			windowStats.TotalInvokes += invokes[stats.Country]
+			total += stats.Distance * float64(invokes[stats.Country])
+		}
+		if windowStats.TotalInvokes > 0 {
+			windowStats.AverageDistance = total / float64(windowStats.TotalInvokes)
+		}
+		windows = append(windows, windowStats)
+	}
+	return windows
+}
+
+// referenceLocations returns the locations the distances are measured from.
+func (s *StatsService) referenceLocations() []models.ReferenceLocation {
+	if len(s.references) == 0 {
+		return models.DefaultReferenceLocations()
+	}
+	return s.references
+}
+
+// measureStats sets the distances from the reference locations to the country of the record,
+// Distance being the nearest one. The records persisted without coordinates keep their distance.
+func (s *StatsService) measureStats(stats *models.Stats) {
+	if stats.Coordinates == nil {
+		return
+	}
+	stats.References = make([]models.ReferenceDistance, 0, len(s.referenceLocations()))
+	for i, reference := range s.referenceLocations() {
+		distance := reference.DistanceTo(*stats.Coordinates)
+		if i == 0 || distance < stats.Distance {
+			stats.Distance = distance
+		}
+		stats.References = append(stats.References, models.ReferenceDistance{Name: reference.Name, Distance: distance})
+	}
+}
+
+// getReferenceStats calculates the closest and farthest country and the average distance of
+// the requests for each reference location with recorded distances.
+func (s *StatsService) getReferenceStats(records []models.Stats) []models.ReferenceStats {
+	var references []models.ReferenceStats
+	for _, reference := range s.referenceLocations() {
+		referenceStats := models.ReferenceStats{Name: reference.Name}
+		total, invokes := 0.0, 0
+		for _, stats := range records {
+			distance, ok := findReferenceDistance(stats, reference.Name)
+			if !ok {
+				continue
+			}
+			record := models.Stats{Country: stats.Country, Continent: stats.Continent, Distance: distance, Invokes: stats.Invokes}
+			if invokes == 0 || distance < referenceStats.Closest.Distance {
+				referenceStats.Closest = record
+			}
+			if invokes == 0 || distance > referenceStats.Farthest.Distance {
+				referenceStats.Farthest = record
+			}
+			total += distance * float64(stats.Invokes)
+			invokes += stats.Invokes
+		}
+		if invokes == 0 {
+			continue
+		}
+		referenceStats.AverageDistance = total / float64(invokes)
+		references = append(references, referenceStats)
+	}
+	return references
+}
+
+// findReferenceDistance returns the distance of the record to the reference location.
+func findReferenceDistance(stats models.Stats, name string) (float64, bool) {
+	for _, reference := range stats.References {
+		if reference.Name == name {
+			return reference.Distance, true
+		}
+	}
+	return 0, false
+}
+
+// getLowerDistance finds and returns the country with the closest distance to the reference locations.
+func getLowerDistance(records []models.Stats) models.Stats {
+	var lowerDistance models.Stats
+	for i, stats := range records {
+		if i == 0 || stats.Distance < lowerDistance.Distance {
+			lowerDistance = stats
+		}
+	}
+	return lowerDistance
+}
+
+// getHigherDistance finds and returns the country with the furthest distance from the reference locations.
+func getHigherDistance(records []models.Stats) models.Stats {
+	var higherDistance models.Stats
+	for i, stats := range records {
+		if i == 0 || stats.Distance > higherDistance.Distance {
+			higherDistance = stats
+		}
+	}
+	return higherDistance
+}
+
+// getAverageDistance calculates and returns the average distance of the requests of the records.
+func getAverageDistance(records []models.Stats) float64 {
+	totalInvokes := getTotalInvokes(records)
+	if totalInvokes == 0 {
+		return 0
+	}
+	total := 0.0
+	for _, stats := range records {
+		total += stats.Distance * float64(stats.Invokes)
+	}
+	return total / float64(totalInvokes)
+}
+
+// getStdDevDistance calculates the standard deviation of the distances of the requests of the records.
+func getStdDevDistance(records []models.Stats) float64 {
+	totalInvokes := getTotalInvokes(records)
+	if totalInvokes == 0 {
+		return 0
+	}
+	average := getAverageDistance(records)
+	variance := 0.0
+	for _, stats := range records {
+		variance += math.Pow(stats.Distance-average, 2) * float64(stats.Invokes)
+	}
+	return math.Sqrt(variance / float64(totalInvokes))
+}
+
+// getHistogram counts the recorded requests in the configured distance buckets. The last
+// bucket holds the requests beyond the last limit.
+func (s *StatsService) getHistogram(records []models.Stats) []models.HistogramBucket {
+	limits := append([]float64(nil), s.histogramBuckets...)
+	if s.histogramBuckets == nil {
+		limits = models.DefaultHistogramBuckets()
+	}
+	histogram := make([]models.HistogramBucket, len(limits)+1)
+	for i := range limits {
+		histogram[i].ToKms = &limits[i]
+		if i > 0 {
+			histogram[i].FromKms = limits[i-1]
+		}
+	}
+	if len(limits) > 0 {
+		histogram[len(limits)].FromKms = limits[len(limits)-1]
+	}
+
+	for _, stats := range records {
+		i := sort.Search(len(limits), func(i int) bool { return stats.Distance < limits[i] })
+		histogram[i].Count += stats.Invokes
+	}
+	return histogram
+}
+
+// getContinentStats counts the recorded requests of each continent, sorted by continent code.
+// The countries recorded without a continent are counted as unknown.
+func getContinentStats(records []models.Stats) []models.ContinentStats {
+	invokes := make(map[string]int)
+	for _, stats := range records {
+		continent := stats.Continent
+		if continent == "" {
+			continent = utils.STATS_UNKNOWN_CONTINENT
+		}
+		invokes[continent] += stats.Invokes
+	}
+
+	continents := make([]models.ContinentStats, 0, len(invokes))
+	for continent, count := range invokes {
+		continents = append(continents, models.ContinentStats{Continent: continent, Invokes: count})
+	}
+	sort.Slice(continents, func(i, j int) bool {
+		return continents[i].Continent < continents[j].Continent
+	})
+	return continents
+}
+
+// getTotalInvokes returns the number of requests of the records.
+func getTotalInvokes(records []models.Stats) int {
+	totalInvokes := 0
+	for i := 0; i < len(records); i++ {
+		totalInvokes += records[i].Invokes
+	}
+	return totalInvokes
+}
+
+// orderStats sorts the stats records by country name.
+func orderStats(stats []models.Stats) []models.Stats {
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Country < stats[j].Country
+	})
+
+	return stats
+}
+
+// sortByDistance returns a copy of the stats records sorted by distance.
+func sortByDistance(stats []models.Stats) []models.Stats {
+	sorted := make([]models.Stats, len(stats))
+	copy(sorted, stats)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Distance < sorted[j].Distance
+	})
+	return sorted
+}
+
+// percentile returns the p-th percentile of the distances of the requests, interpolating
+// between the two closest ranks. The records must be sorted by distance and every one of them
+// counts as many requests as its invokes.
+func percentile(sorted []models.Stats, totalInvokes int, p float64) float64 {
+	if totalInvokes == 0 {
+		return 0
+	}
+	rank := p / 100 * float64(totalInvokes-1)
+	lower := distanceAt(sorted, int(math.Floor(rank)))
+	upper := distanceAt(sorted, int(math.Ceil(rank)))
+	return lower + (upper-lower)*(rank-math.Floor(rank))
+}
+
+// distanceAt returns the distance of the request at the given position of the requests sorted
+// by distance.
+func distanceAt(sorted []models.Stats, position int) float64 {
+	for _, stats := range sorted {
+		if position < stats.Invokes {
+			return stats.Distance
+		}
+		position -= stats.Invokes
+	}
+	return sorted[len(sorted)-1].Distance
+}
@@ -1,85 +1,251 @@
-package services
-
-import (
-	"testing"
-
-	"service_fraud/models"
-	"service_fraud/utils"
-
-	"github.com/stretchr/testify/assert"
-)
-
-func TestStatsService_NewStatsService(t *testing.T) {
-	processedChannel := make(chan models.StatsRequest)
-
-	statsService := NewStatsService(processedChannel)
-
-	assert.NotNil(t, statsService)
-}
-
-func TestStatsService_GetStats_NoRecords(t *testing.T) {
-	processedChannel := make(chan models.StatsRequest)
-	statsService := NewStatsService(processedChannel)
-
-	result := statsService.GetStats()
-	assert.Equal(t, utils.NO_RECORD_INFORMATION_AVAILABLE_YET, result)
-}
-
-func TestStatsService_Combine_NewCountry(t *testing.T) {
-
-	processedChannel := make(chan models.StatsRequest)
-	statsService := NewStatsService(processedChannel)
-
-	req := models.StatsRequest{
-		Country: "Colombia",
-		Lat:     -34.61,
-		Lon:     -58.38,
-	}
-	statsService.Combine(req)
-
-	assert.Equal(t, 1, len(statsService.StatsRecord))
-	assert.Equal(t, "Colombia", statsService.StatsRecord[0].Country)
-	assert.Equal(t, 1, statsService.StatsRecord[0].Invokes)
-}
-
-func TestStatsService_Combine_ExistingCountry(t *testing.T) {
-	processedChannel := make(chan models.StatsRequest)
-	statsService := NewStatsService(processedChannel)
-	statsService.StatsRecord = make([]models.Stats, 0)
-
-	req1 := models.StatsRequest{
-		Country: "Argentina",
-		Lat:     -34.61,
-		Lon:     -58.38,
-	}
-	statsService.Combine(req1)
-
-	req2 := models.StatsRequest{
-		Country: "Argentina",
-		Lat:     -34.61,
-		Lon:     -58.38,
-	}
-
-	statsService.Combine(req2)
-
-	assert.Equal(t, 1, len(statsService.StatsRecord))
-	assert.Equal(t, 2, statsService.StatsRecord[0].Invokes)
-}
-
-func TestStatsService_GetStats_WithRecords(t *testing.T) {
-	processedChannel := make(chan models.StatsRequest)
-	statsService := NewStatsService(processedChannel)
-
-	req := models.StatsRequest{
-		Country: "Argentina",
-		Lat:     -34.61,
-		Lon:     -58.38,
-	}
-	statsService.Combine(req)
-
-	result := statsService.GetStats()
-
-	assert.Contains(t, result, "Distancia más cercana a Buenos Aires")
-	assert.Contains(t, result, "Distancia más lejana a Buenos Aires")
-	assert.Contains(t, result, "Distancia promedio entre las peticiones")
-}
+package services
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+	"time"
+
+	"service_fraud/models"
+	"service_fraud/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsService_NewStatsService(t *testing.T) {
+	processedChannel := make(chan models.StatsRequest)
+
+	statsService := NewStatsService(processedChannel)
+
+	assert.NotNil(t, statsService)
+}
+
+func TestStatsService_ProcessStats_Logs(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := utils.NewLogger(&buf, utils.LOG_FORMAT_JSON, "info")
+	require.NoError(t, err)
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	closed := make(chan models.StatsRequest)
+	close(closed)
+	(&StatsService{processedChannel: closed}).processStats()
+	done := make(chan struct{})
+	close(done)
+	(&StatsService{processedChannel: make(chan models.StatsRequest), Done: done}).processStats()
+
+	assert.Contains(t, buf.String(), `"msg":"`+utils.LOG_MESSAGE_STATS_CLOSED+`"`)
+	assert.Contains(t, buf.String(), `"msg":"`+utils.LOG_MESSAGE_STATS_STOPPED+`"`)
+}
+
+func TestStatsService_GetStats_NoRecords(t *testing.T) {
+	processedChannel := make(chan models.StatsRequest)
+	statsService := NewStatsService(processedChannel)
+
+	result := statsService.GetStats()
+	assert.Empty(t, result.Records)
+	assert.Equal(t, 0, result.TotalInvokes)
+}
+
+func TestStatsService_Combine_NewCountry(t *testing.T) {
+
+	processedChannel := make(chan models.StatsRequest)
+	statsService := NewStatsService(processedChannel)
+
+	req := models.StatsRequest{
+		Country: "Colombia",
+		Lat:     -34.61,
+		Lon:     -58.38,
+	}
+	statsService.Combine(req)
+
+	assert.Equal(t, 1, len(statsService.StatsRecord))
+	assert.Equal(t, "Colombia", statsService.StatsRecord[0].Country)
+	assert.Equal(t, 1, statsService.StatsRecord[0].Invokes)
+}
+
+func TestStatsService_Combine_ExistingCountry(t *testing.T) {
+	processedChannel := make(chan models.StatsRequest)
+	statsService := NewStatsService(processedChannel)
+	statsService.StatsRecord = make([]models.Stats, 0)
+
+	req1 := models.StatsRequest{
+		Country: "Argentina",
+		Lat:     -34.61,
+		Lon:     -58.38,
+	}
+	statsService.Combine(req1)
+
+	req2 := models.StatsRequest{
+		Country: "Argentina",
+		Lat:     -34.61,
+		Lon:     -58.38,
+	}
+
+	statsService.Combine(req2)
+
+	assert.Equal(t, 1, len(statsService.StatsRecord))
+	assert.Equal(t, 2, statsService.StatsRecord[0].Invokes)
+}
+
+func TestStatsService_GetStats_WithRecords(t *testing.T) {
+	processedChannel := make(chan models.StatsRequest)
+	statsService := NewStatsService(processedChannel)
+
+	req := models.StatsRequest{
+		Country: "Argentina",
+		Lat:     -34.61,
+		Lon:     -58.38,
+	}
+	statsService.Combine(req)
+
+	result := statsService.GetStats()
+
+	assert.Equal(t, "Argentina", result.Closest.Country)
+	assert.Equal(t, "Argentina", result.Farthest.Country)
+	assert.InDelta(t, 0, result.AverageDistance, 1)
+	assert.NotEmpty(t, result.Records)
+}
+
+func TestStatsService_References(t *testing.T) {
+	service := &StatsService{}
+	service.SetReferences([]models.ReferenceLocation{
+		{Name: "Buenos Aires", Latitude: -34.61315, Longitude: -58.37723},
+		{Name: "Madrid", Latitude: 40.4168, Longitude: -3.7038},
+	})
+	service.Combine(models.StatsRequest{Country: "Argentina", Lat: -34.61, Lon: -58.38})
+	service.Combine(models.StatsRequest{Country: "Argentina", Lat: -34.61, Lon: -58.38})
+	service.Combine(models.StatsRequest{Country: "Spain", Lat: 40.41, Lon: -3.70})
+
+	summary := service.GetStats()
+
+	// The distance of each country is the one to the nearest reference.
+	assert.InDelta(t, 0, summary.Records[0].Distance, 1)
+	assert.InDelta(t, 0, summary.Records[1].Distance, 1)
+	assert.InDelta(t, 0, summary.AverageDistance, 1)
+	require.Len(t, summary.References, 2)
+	assert.Equal(t, "Buenos Aires", summary.References[0].Name)
+	assert.Equal(t, "Argentina", summary.References[0].Closest.Country)
+	assert.Equal(t, "Spain", summary.References[0].Farthest.Country)
+	assert.Equal(t, "Madrid", summary.References[1].Name)
+	assert.Equal(t, "Spain", summary.References[1].Closest.Country)
+	assert.InDelta(t, 0, summary.References[1].Closest.Distance, 1)
+	assert.Equal(t, "Argentina", summary.References[1].Farthest.Country)
+	farthest := summary.References[1].Farthest.Distance
+	assert.InDelta(t, (farthest*2+summary.References[1].Closest.Distance)/3, summary.References[1].AverageDistance, 0.001)
+
+	// Changing the references measures the recorded countries again.
+	service.SetReferences(nil)
+
+	summary = service.GetStats()
+	require.Len(t, summary.References, 1)
+	assert.Equal(t, "Buenos Aires", summary.References[0].Name)
+	assert.Equal(t, summary.Records[1].Distance, summary.Farthest.Distance)
+	assert.Greater(t, summary.Records[1].Distance, 10000.0)
+}
+
+func TestStatsService_Distribution(t *testing.T) {
+	service := &StatsService{}
+	// Fixed distances make the expected values easy to follow.
+	service.StatsRecord = []models.Stats{
+		{Country: "A", Continent: "SA", Distance: 100, Invokes: 5},
+		{Country: "B", Continent: "SA", Distance: 1000, Invokes: 3},
+		{Country: "C", Continent: "EU", Distance: 10000, Invokes: 1},
+		{Country: "D", Distance: 20000, Invokes: 1},
+	}
+	service.SetHistogramBuckets([]float64{500, 5000})
+
+	summary := service.GetStats()
+
+	assert.Equal(t, 10, summary.TotalInvokes)
+	assert.Equal(t, "A", summary.Closest.Country)
+	assert.Equal(t, "D", summary.Farthest.Country)
+	assert.InDelta(t, 3350, summary.AverageDistance, 0.001)
+	// The requests sorted by distance are 100 x5, 1000 x3, 10000 and 20000.
+	assert.InDelta(t, 550, summary.Distribution.Median, 0.001)
+	assert.InDelta(t, 11000, summary.Distribution.P90, 0.001)
+	assert.InDelta(t, 15500, summary.Distribution.P95, 0.001)
+	assert.InDelta(t, 19100, summary.Distribution.P99, 0.001)
+	assert.InDelta(t, 6251.6, summary.Distribution.StdDev, 0.01)
+
+	require.Len(t, summary.Histogram, 3)
+	assert.Equal(t, 0.0, summary.Histogram[0].FromKms)
+	assert.Equal(t, 500.0, *summary.Histogram[0].ToKms)
+	assert.Equal(t, 5, summary.Histogram[0].Count)
+	assert.Equal(t, 500.0, summary.Histogram[1].FromKms)
+	assert.Equal(t, 3, summary.Histogram[1].Count)
+	assert.Equal(t, 5000.0, summary.Histogram[2].FromKms)
+	assert.Nil(t, summary.Histogram[2].ToKms)
+	assert.Equal(t, 2, summary.Histogram[2].Count)
+
+	assert.Equal(t, []models.ContinentStats{
+		{Continent: "EU", Invokes: 1},
+		{Continent: "SA", Invokes: 8},
+		{Continent: "unknown", Invokes: 1},
+	}, summary.Continents)
+}
+
+func TestStatsService_Distribution_SingleRequest(t *testing.T) {
+	service := &StatsService{}
+	service.StatsRecord = []models.Stats{{Country: "A", Distance: 100, Invokes: 1}}
+	service.SetHistogramBuckets(nil)
+
+	summary := service.GetStats()
+
+	assert.Equal(t, models.DistanceDistribution{Median: 100, P90: 100, P95: 100, P99: 100}, summary.Distribution)
+	assert.Len(t, summary.Histogram, len(models.DefaultHistogramBuckets())+1)
+}
+
+func TestStatsService_Windows(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 30, 0, time.UTC)
+	service := &StatsService{clock: func() time.Time { return now }}
+	service.Combine(models.StatsRequest{Country: "Argentina", Lat: -34.61, Lon: -58.38, Time: now.Add(-2 * time.Minute)})
+	service.Combine(models.StatsRequest{Country: "Spain", Lat: 40.41, Lon: -3.70, Time: now.Add(-30 * time.Minute)})
+	service.Combine(models.StatsRequest{Country: "Spain", Lat: 40.41, Lon: -3.70, Time: now.Add(-3 * time.Hour)})
+	// The requests older than the retention only count in the totals.
+	service.Combine(models.StatsRequest{Country: "Japan", Lat: 35.68, Lon: 139.69, Time: now.Add(-30 * time.Hour)})
+
+	summary := service.GetStats()
+
+	assert.Equal(t, 4, summary.TotalInvokes)
+	require.Len(t, summary.Windows, 3)
+	assert.Equal(t, "5m", summary.Windows[0].Window)
+	assert.Equal(t, 1, summary.Windows[0].TotalInvokes)
+	assert.InDelta(t, 0, summary.Windows[0].AverageDistance, 1)
+	assert.Equal(t, "1h", summary.Windows[1].Window)
+	assert.Equal(t, 2, summary.Windows[1].TotalInvokes)
+	assert.Equal(t, "24h", summary.Windows[2].Window)
+	assert.Equal(t, 3, summary.Windows[2].TotalInvokes)
+	assert.Len(t, service.buckets, 3)
+
+	summary, err := service.GetStatsWindow(now.Add(-4*time.Hour), now.Add(-time.Hour))
+	require.NoError(t, err)
+	require.Len(t, summary.Records, 1)
+	assert.Equal(t, "Spain", summary.Records[0].Country)
+	assert.Equal(t, 1, summary.TotalInvokes)
+	assert.Equal(t, &models.StatsWindow{From: now.Add(-4 * time.Hour), To: now.Add(-time.Hour)}, summary.Window)
+	assert.Empty(t, summary.Windows)
+
+	_, err = service.GetStatsWindow(now.Add(-48*time.Hour), now)
+	assert.Error(t, err)
+}
+
+func TestStatsService_SetWindows(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 30, 0, time.UTC)
+	service := &StatsService{clock: func() time.Time { return now }}
+	service.Combine(models.StatsRequest{Country: "Argentina", Lat: -34.61, Lon: -58.38, Time: now.Add(-10 * time.Minute)})
+	service.Combine(models.StatsRequest{Country: "Argentina", Lat: -34.61, Lon: -58.38, Time: now.Add(-20 * time.Minute)})
+
+	service.SetWindows(time.Hour, 2*time.Hour, []time.Duration{time.Hour})
+
+	// Both requests fall in the bucket that starts at 11:00.
+	assert.Len(t, service.buckets, 1)
+	summary := service.GetStats()
+	require.Len(t, summary.Windows, 1)
+	assert.Equal(t, "1h", summary.Windows[0].Window)
+	assert.Equal(t, 2, summary.Windows[0].TotalInvokes)
+	_, err := service.GetStatsWindow(now.Add(-3*time.Hour), now)
+	assert.Error(t, err)
+}
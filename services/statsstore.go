@@ -0,0 +1,294 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"service_fraud/models"
+	"service_fraud/utils"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FileStatsStore persists the stats records in an append-only file of JSON lines, one line per
+// processed request with the invokes to add to the record of its country and time bucket. When
+// the lines appended since the last compaction exceed compactAfter, the file is rewritten with
+// one line per country and time bucket. The time buckets older than the retention are merged
+// into a line per country without time.
+type FileStatsStore struct {
+	lock         sync.Mutex
+	path         string
+	compactAfter int
+	retention    time.Duration
+	file         *os.File
+	loaded       bool
+	records      map[string]models.Stats
+	appended     int
+}
+
+// NewFileStatsStore creates a FileStatsStore for the given file, which is created on the first
+// append. A compactAfter of 0 or less uses the default.
+func NewFileStatsStore(path string, compactAfter int) *FileStatsStore {
+	if compactAfter <= 0 {
+		compactAfter = utils.STATS_DEFAULT_COMPACT_AFTER
+	}
+	return &FileStatsStore{
+		path:         path,
+		compactAfter: compactAfter,
+		retention:    utils.STATS_DEFAULT_RETENTION_HOURS * time.Hour,
+		records:      make(map[string]models.Stats),
+	}
+}
+
+// SetRetention sets how long the time buckets are kept before they are merged into the record
+// of their country. A retention of 0 or less uses the default.
+func (f *FileStatsStore) SetRetention(retention time.Duration) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if retention <= 0 {
+		retention = utils.STATS_DEFAULT_RETENTION_HOURS * time.Hour
+	}
+	f.retention = retention
+}
+
+// Load returns the stats records persisted in the file, sorted by country and time. The invalid
+// lines, for example one left half written by a crash, are discarded. When the file holds more
+// lines than records it is compacted.
+func (f *FileStatsStore) Load() ([]models.Stats, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	return f.snapshot(), nil
+}
+
+// Append adds the invokes of the stats to the record of its country and time bucket and writes
+// them to the file.
+func (f *FileStatsStore) Append(stats models.Stats) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if !f.loaded {
+		// The records are needed to compact the file without losing the previous lines.
+		if err := f.load(); err != nil {
+			return err
+		}
+	}
+
+	if f.file == nil {
+		file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		f.file = file
+	}
+	line, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	if _, err := f.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	f.add(f.records, stats)
+	f.appended++
+	if f.appended > f.compactAfter {
+		return f.compact()
+	}
+	return nil
+}
+
+// Compact rewrites the file with one line per country and time bucket.
+func (f *FileStatsStore) Compact() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if !f.loaded {
+		if err := f.load(); err != nil {
+			return err
+		}
+	}
+	return f.compact()
+}
+
+// Close closes the file, the next append opens it again.
+func (f *FileStatsStore) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.closeFile()
+}
+
+// load reads the records from the file, a missing file has no records.
+func (f *FileStatsStore) load() error {
+	records := make(map[string]models.Stats)
+	file, err := os.Open(f.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		f.records, f.appended, f.loaded = records, 0, true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		lines++
+		stats, err := decodeStatsLine(scanner.Bytes())
+		if err != nil || stats.Country == "" {
+			slog.Warn(utils.ERR_MESSAGE_STATS_ENTRY, "path", f.path, "line", line, "entry", scanner.Text())
+			continue
+		}
+		f.add(records, stats)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	f.records, f.appended, f.loaded = records, lines, true
+	if lines > len(records) {
+		return f.compact()
+	}
+	return nil
+}
+
+// compact writes the records to a temporary file that replaces the current one, so a crash
+// during the compaction keeps the previous file.
+func (f *FileStatsStore) compact() error {
+	f.expire()
+	tmp := f.path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	enc := json.NewEncoder(writer)
+	for _, stats := range f.snapshot() {
+		if err := enc.Encode(stats); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if err := f.closeFile(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, f.path); err != nil {
+		return err
+	}
+	f.appended = 0
+	slog.Info(utils.LOG_MESSAGE_STATS_COMPACTED, "path", f.path, "records", len(f.records))
+	return nil
+}
+
+// closeFile closes the file opened to append, if any.
+func (f *FileStatsStore) closeFile() error {
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// decodeStatsLine decodes a line of the file. The lines written before the distances were
+// numeric hold them as strings, so both forms are accepted.
+func decodeStatsLine(data []byte) (models.Stats, error) {
+	var line struct {
+		models.Stats
+		Distance   json.Number     `json:"distance_kms"`
+		References json.RawMessage `json:"references"`
+	}
+	if err := json.Unmarshal(data, &line); err != nil {
+		return models.Stats{}, err
+	}
+	stats := line.Stats
+	if line.Distance != "" {
+		distance, err := line.Distance.Float64()
+		if err != nil {
+			return models.Stats{}, err
+		}
+		stats.Distance = distance
+	}
+	// The distances to the reference locations are measured again from the coordinates.
+	if len(line.References) > 0 && json.Unmarshal(line.References, &stats.References) != nil {
+		stats.References = nil
+	}
+	return stats, nil
+}
+
+// add adds the stats to the records, the ones of a time bucket older than the retention to the
+// record of their country.
+func (f *FileStatsStore) add(records map[string]models.Stats, stats models.Stats) {
+	if stats.Time != nil && f.expired(*stats.Time) {
+		stats.Time = nil
+	}
+	addStats(records, stats)
+}
+
+// expire merges the records of the time buckets older than the retention into the record of
+// their country.
+func (f *FileStatsStore) expire() {
+	for key, stats := range f.records {
+		if stats.Time != nil && f.expired(*stats.Time) {
+			delete(f.records, key)
+			stats.Time = nil
+			addStats(f.records, stats)
+		}
+	}
+}
+
+// expired reports whether the time bucket starting at the given time is older than the retention.
+func (f *FileStatsStore) expired(start time.Time) bool {
+	return start.Before(time.Now().Add(-f.retention))
+}
+
+// addStats adds the invokes of the stats to the record of its country and time bucket, whose
+// other fields are replaced with the ones of the stats.
+func addStats(records map[string]models.Stats, stats models.Stats) {
+	key := statsKey(stats)
+	stats.Invokes += records[key].Invokes
+	records[key] = stats
+}
+
+// statsKey returns the key of the record of the country and time bucket of the stats.
+func statsKey(stats models.Stats) string {
+	if stats.Time == nil {
+		return stats.Country
+	}
+	return stats.Country + "@" + stats.Time.UTC().Format(time.RFC3339)
+}
+
+// snapshot returns a copy of the records sorted by country and time, the record without time of
+// each country first.
+func (f *FileStatsStore) snapshot() []models.Stats {
+	records := make([]models.Stats, 0, len(f.records))
+	for _, stats := range f.records {
+		records = append(records, stats)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Country != records[j].Country {
+			return records[i].Country < records[j].Country
+		}
+		if records[i].Time == nil || records[j].Time == nil {
+			return records[j].Time != nil
+		}
+		return records[i].Time.Before(*records[j].Time)
+	})
+	return records
+}
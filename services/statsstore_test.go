@@ -0,0 +1,208 @@
+package services
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"service_fraud/models"
+	"service_fraud/render"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var storeRequests = []models.StatsRequest{
+	{Country: "Argentina", Lat: -34.61, Lon: -58.38},
+	{Country: "Spain", Lat: 40.41, Lon: -3.70},
+	{Country: "Argentina", Lat: -34.61, Lon: -58.38},
+	{Country: "Japan", Lat: 35.68, Lon: 139.69},
+	{Country: "Spain", Lat: 40.41, Lon: -3.70},
+	{Country: "Argentina", Lat: -34.61, Lon: -58.38},
+}
+
+// storeNow is the time of the requests of the tests, fixed so all of them fall in the same bucket.
+var storeNow = time.Now()
+
+// startStatsService creates a StatsService, outside of the shared instance, that persists its
+// stats in the given file, as the application does when it starts.
+func startStatsService(t *testing.T, path string, compactAfter int) (*StatsService, *FileStatsStore) {
+	store := NewFileStatsStore(path, compactAfter)
+	t.Cleanup(func() { store.Close() })
+	service := &StatsService{clock: func() time.Time { return storeNow }}
+	require.NoError(t, service.SetStore(store))
+	return service, store
+}
+
+// renderRecord returns the output of the 'record' flow for the stats of the service.
+func renderRecord(t *testing.T, service *StatsService) string {
+	var buf bytes.Buffer
+	require.NoError(t, render.NewTextRenderer().RenderStats(&buf, service.GetStats()))
+	return buf.String()
+}
+
+// countLines returns the number of lines of the file.
+func countLines(t *testing.T, path string) int {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return strings.Count(string(data), "\n")
+}
+
+func TestStatsService_Restart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.jsonl")
+	service, store := startStatsService(t, path, 100)
+	for _, req := range storeRequests {
+		service.Combine(req)
+	}
+	expected := renderRecord(t, service)
+	require.NoError(t, store.Close())
+
+	restarted, _ := startStatsService(t, path, 100)
+
+	assert.Equal(t, service.GetStats(), restarted.GetStats())
+	assert.Equal(t, expected, renderRecord(t, restarted))
+	assert.Equal(t, 6, restarted.GetStats().TotalInvokes)
+	// The time buckets are restored too.
+	assert.Equal(t, 6, restarted.GetStats().Windows[0].TotalInvokes)
+
+	// The requests after the restart are added to the loaded ones.
+	restarted.Combine(storeRequests[0])
+	assert.Equal(t, 4, restarted.GetStats().Records[0].Invokes)
+}
+
+func TestStatsService_NoStore(t *testing.T) {
+	service := &StatsService{}
+	for _, req := range storeRequests {
+		service.Combine(req)
+	}
+
+	assert.Equal(t, 6, service.GetStats().TotalInvokes)
+}
+
+func TestFileStatsStore_Compact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.jsonl")
+	service, store := startStatsService(t, path, 4)
+	for _, req := range storeRequests {
+		service.Combine(req)
+	}
+	expected := renderRecord(t, service)
+
+	// The fifth line triggers the compaction to one line per country, then one more is appended.
+	assert.Equal(t, 4, countLines(t, path))
+	require.NoError(t, store.Compact())
+	assert.Equal(t, 3, countLines(t, path))
+	require.NoError(t, store.Close())
+
+	restarted, _ := startStatsService(t, path, 4)
+	assert.Equal(t, expected, renderRecord(t, restarted))
+}
+
+func TestFileStatsStore_Load(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.jsonl")
+	// The distances of the first lines are strings, as they were written before they were numeric.
+	content := `{"country":"Argentina","distance_kms":"0","invokes":2,"references":[{"name":"Buenos Aires","distance_kms":"0"}]}
+{"country":"Spain","distance_kms":"10038","invokes":1}
+not json
+{"country":"Argentina","continent":"SA","distance_kms":0.4,"invokes":1}
+{"country":"Spa`
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	store := NewFileStatsStore(path, 0)
+
+	records, err := store.Load()
+
+	require.NoError(t, err)
+	assert.Equal(t, []models.Stats{
+		{Country: "Argentina", Continent: "SA", Distance: 0.4, Invokes: 3},
+		{Country: "Spain", Distance: 10038, Invokes: 1},
+	}, records)
+	// The invalid lines are discarded by compacting the file on load.
+	assert.Equal(t, 2, countLines(t, path))
+	_, err = os.Stat(path + ".tmp")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestFileStatsStore_Retention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.jsonl")
+	recent := time.Now().UTC().Truncate(time.Minute)
+	old := recent.Add(-48 * time.Hour)
+	content := `{"country":"Argentina","distance_kms":0,"invokes":2}
+{"country":"Argentina","distance_kms":0,"invokes":1,"time":"` + old.Format(time.RFC3339) + `"}
+{"country":"Argentina","distance_kms":0,"invokes":1,"time":"` + recent.Format(time.RFC3339) + `"}
+{"country":"Argentina","distance_kms":0,"invokes":1,"time":"` + recent.Format(time.RFC3339) + `"}
+`
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	store := NewFileStatsStore(path, 0)
+
+	records, err := store.Load()
+
+	// The bucket older than the retention is merged into the record without time.
+	require.NoError(t, err)
+	assert.Equal(t, []models.Stats{
+		{Country: "Argentina", Invokes: 3},
+		{Country: "Argentina", Invokes: 2, Time: &recent},
+	}, records)
+	assert.Equal(t, 2, countLines(t, path))
+
+	// A shorter retention merges the recent bucket on the next compaction.
+	store.SetRetention(time.Nanosecond)
+	require.NoError(t, store.Compact())
+	records, err = store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, []models.Stats{{Country: "Argentina", Invokes: 5}}, records)
+}
+
+func TestStatsService_SetStore_Windows(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.jsonl")
+	service, store := startStatsService(t, path, 100)
+	service.Combine(models.StatsRequest{Country: "Argentina", Lat: -34.61, Lon: -58.38, Time: storeNow.Add(-2 * time.Hour)})
+	service.Combine(models.StatsRequest{Country: "Spain", Lat: 40.41, Lon: -3.70})
+	require.NoError(t, store.Close())
+
+	restarted, _ := startStatsService(t, path, 100)
+	summary, err := restarted.GetStatsWindow(storeNow.Add(-time.Hour), storeNow)
+
+	require.NoError(t, err)
+	require.Len(t, summary.Records, 1)
+	assert.Equal(t, "Spain", summary.Records[0].Country)
+	assert.Equal(t, 2, restarted.GetStats().TotalInvokes)
+}
+
+func TestFileStatsStore_Load_MissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.jsonl")
+	store := NewFileStatsStore(path, 0)
+
+	records, err := store.Load()
+
+	require.NoError(t, err)
+	assert.Empty(t, records)
+	_, err = os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestStatsService_SetStore_Error(t *testing.T) {
+	// A directory cannot be read as the stats file.
+	store := NewFileStatsStore(t.TempDir(), 0)
+	service := &StatsService{}
+	service.Combine(storeRequests[0])
+
+	err := service.SetStore(store)
+
+	assert.Error(t, err)
+	assert.Equal(t, 1, service.GetStats().TotalInvokes)
+	assert.Nil(t, service.store)
+}
+
+func TestStatsService_Metrics(t *testing.T) {
+	metrics := NewMetrics()
+	service := &StatsService{metrics: metrics}
+	service.Combine(storeRequests[0])
+	// A directory cannot be read as the stats file, so the request is not persisted.
+	service.store = NewFileStatsStore(t.TempDir(), 0)
+	service.Combine(storeRequests[1])
+
+	assert.Equal(t, 2.0, metrics.statsRequests.Value())
+	assert.Equal(t, uint64(2), metrics.statsDuration.Count())
+	assert.Equal(t, 1.0, metrics.statsStoreErrors.Value())
+}
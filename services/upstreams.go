@@ -0,0 +1,326 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"service_fraud/models"
+	"service_fraud/utils"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// errCircuitOpen is returned, without calling the upstream, while its circuit breaker is open.
+var errCircuitOpen = errors.New("the circuit breaker of the upstream is open")
+
+// RetryPolicy defines how the calls to the external APIs are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the number of calls made before giving up, 1 disables the retries.
+	MaxAttempts int
+	// BaseDelay is the wait before the first retry, doubled on each of the next ones.
+	BaseDelay time.Duration
+	// MaxDelay caps the wait between two calls, including the one asked by a Retry-After header.
+	MaxDelay time.Duration
+	// AttemptTimeout is how long each call can take, 0 leaves it to the trace timeout.
+	AttemptTimeout time.Duration
+}
+
+// BreakerPolicy defines when the circuit breaker of an upstream opens.
+type BreakerPolicy struct {
+	// FailureThreshold is the number of consecutive failed calls that opens the breaker,
+	// 0 disables it.
+	FailureThreshold int
+	// OpenDuration is how long the breaker rejects the calls before letting one through to
+	// probe the upstream.
+	OpenDuration time.Duration
+}
+
+// DefaultRetryPolicy returns the retry policy used when none is configured.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    utils.UPSTREAM_DEFAULT_MAX_ATTEMPTS,
+		BaseDelay:      utils.UPSTREAM_DEFAULT_BASE_DELAY_MS * time.Millisecond,
+		MaxDelay:       utils.UPSTREAM_DEFAULT_MAX_DELAY_MS * time.Millisecond,
+		AttemptTimeout: utils.UPSTREAM_DEFAULT_TIMEOUT_SECONDS * time.Second,
+	}
+}
+
+// DefaultBreakerPolicy returns the circuit breaker policy used when none is configured.
+func DefaultBreakerPolicy() BreakerPolicy {
+	return BreakerPolicy{
+		FailureThreshold: utils.UPSTREAM_DEFAULT_FAILURE_THRESHOLD,
+		OpenDuration:     utils.UPSTREAM_DEFAULT_OPEN_SECONDS * time.Second,
+	}
+}
+
+// Backoff returns the wait before the retry that follows the given attempt, starting at 1: the
+// base delay doubled on each attempt and capped by the maximum delay. Half of the delay is
+// random, so the traces that failed together do not retry together.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	half := delay / 2
+	return half + rand.N(delay-half+1)
+}
+
+// Upstreams sends the requests to the external APIs, retrying the timeouts, the 5xx responses
+// and the 429 responses, and failing fast while the circuit breaker of an upstream is open. A
+// nil Upstreams sends each request once.
+type Upstreams struct {
+	retry    RetryPolicy
+	breaker  BreakerPolicy
+	client   *http.Client
+	lock     sync.Mutex
+	breakers map[string]*circuitBreaker
+	metrics  *Metrics
+	clock    func() time.Time
+}
+
+// NewUpstreams creates the upstreams with the given retry and circuit breaker policies.
+func NewUpstreams(retry RetryPolicy, breaker BreakerPolicy) *Upstreams {
+	if retry.MaxAttempts < 1 {
+		retry.MaxAttempts = 1
+	}
+	return &Upstreams{
+		retry:    retry,
+		breaker:  breaker,
+		client:   &http.Client{Timeout: retry.AttemptTimeout},
+		breakers: make(map[string]*circuitBreaker),
+		metrics:  DefaultMetrics(),
+	}
+}
+
+// SetMetrics sets the metrics the retries and the state changes of the breakers are recorded
+// in, nil disables them.
+func (u *Upstreams) SetMetrics(metrics *Metrics) {
+	u.metrics = metrics
+}
+
+// Do sends the request to the upstream. It returns the last response when the retries are
+// exhausted, so the caller handles it like a single one, and errCircuitOpen while the breaker
+// of the upstream rejects the calls.
+func (u *Upstreams) Do(upstream string, req *http.Request) (*http.Response, error) {
+	if u == nil {
+		return http.DefaultClient.Do(req)
+	}
+	ctx := req.Context()
+	breaker := u.circuitBreaker(upstream)
+	for attempt := 1; ; attempt++ {
+		if !breaker.allow(u.now()) {
+			u.metrics.observeCircuitRejection(upstream)
+			return nil, fmt.Errorf("%s: %w", upstream, errCircuitOpen)
+		}
+		resp, err := u.client.Do(req)
+		if err != nil && ctx.Err() != nil {
+			// The trace was stopped, which says nothing about the health of the upstream.
+			breaker.release()
+			return nil, err
+		}
+		u.record(ctx, upstream, breaker, err != nil || isRetryableStatus(resp.StatusCode))
+
+		wait, reason, ok := u.retryDelay(ctx, attempt, resp, err)
+		if !ok || breaker.isOpen() {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		utils.Logger(ctx).Warn(utils.LOG_MESSAGE_UPSTREAM_RETRY, "upstream", upstream, "attempt", attempt, "reason", reason, "wait_seconds", wait.Seconds())
+		u.metrics.observeRetry(upstream, reason)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Status returns the state of the circuit breaker of the upstream, closed when it was never called.
+func (u *Upstreams) Status(upstream string) models.UpstreamHealth {
+	if u == nil {
+		return models.UpstreamHealth{Name: upstream, State: utils.CIRCUIT_STATE_CLOSED}
+	}
+	return u.circuitBreaker(upstream).status(upstream, u.now())
+}
+
+// retryDelay returns how long to wait before retrying the call and the reason of the retry,
+// reporting false when the call must not be retried: it succeeded, failed for good, was the
+// last attempt or the wait would not end before the deadline of the trace.
+func (u *Upstreams) retryDelay(ctx context.Context, attempt int, resp *http.Response, err error) (time.Duration, string, bool) {
+	if attempt >= u.retry.MaxAttempts {
+		return 0, "", false
+	}
+	var wait time.Duration
+	var reason string
+	switch {
+	case err != nil:
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			return 0, "", false
+		}
+		reason = utils.METRICS_RETRY_TIMEOUT
+	case resp.StatusCode == http.StatusTooManyRequests:
+		reason = strconv.Itoa(resp.StatusCode)
+		if after, ok := retryAfter(resp.Header.Get("Retry-After"), u.now()); ok {
+			if u.retry.MaxDelay > 0 && after > u.retry.MaxDelay {
+				// The upstream asks to wait longer than the traces are willing to.
+				return 0, "", false
+			}
+			wait = after
+		}
+	case isRetryableStatus(resp.StatusCode):
+		reason = strconv.Itoa(resp.StatusCode)
+	default:
+		return 0, "", false
+	}
+	if wait == 0 {
+		wait = u.retry.Backoff(attempt)
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+		return 0, "", false
+	}
+	return wait, reason, true
+}
+
+// record updates the breaker of the upstream with the outcome of a call and logs its state changes.
+func (u *Upstreams) record(ctx context.Context, upstream string, breaker *circuitBreaker, failed bool) {
+	previous, current := breaker.record(failed, u.now())
+	if previous != current {
+		utils.Logger(ctx).Warn(utils.LOG_MESSAGE_CIRCUIT_CHANGED, "upstream", upstream, "from", previous, "to", current)
+		u.metrics.observeCircuitChange(upstream, current)
+	}
+}
+
+// circuitBreaker returns the breaker of the upstream, creating it on its first call.
+func (u *Upstreams) circuitBreaker(upstream string) *circuitBreaker {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	breaker, ok := u.breakers[upstream]
+	if !ok {
+		breaker = &circuitBreaker{policy: u.breaker, state: utils.CIRCUIT_STATE_CLOSED}
+		u.breakers[upstream] = breaker
+	}
+	return breaker
+}
+
+// now returns the current time, the one of the clock when it is set.
+func (u *Upstreams) now() time.Time {
+	if u.clock != nil {
+		return u.clock()
+	}
+	return time.Now()
+}
+
+// isRetryableStatus reports whether the HTTP status is a transient failure of the upstream.
+func isRetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// retryAfter parses the Retry-After header, given in seconds or as an HTTP date.
+func retryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// circuitBreaker counts the consecutive failed calls to an upstream. It opens when they reach
+// the threshold, rejecting the calls until the open duration passes, and then lets a single
+// call through, half open, which closes it when it succeeds or opens it again when it fails.
+type circuitBreaker struct {
+	lock     sync.Mutex
+	policy   BreakerPolicy
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// allow reports whether a call can be made at the given time.
+func (b *circuitBreaker) allow(now time.Time) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	switch b.state {
+	case utils.CIRCUIT_STATE_OPEN:
+		if now.Sub(b.openedAt) < b.policy.OpenDuration {
+			return false
+		}
+		b.state = utils.CIRCUIT_STATE_HALF_OPEN
+	case utils.CIRCUIT_STATE_HALF_OPEN:
+		if b.probing {
+			return false
+		}
+	default:
+		return true
+	}
+	b.probing = true
+	return true
+}
+
+// record updates the breaker with the outcome of a call and returns its state before and after.
+func (b *circuitBreaker) record(failed bool, now time.Time) (string, string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	previous := b.state
+	b.probing = false
+	if !failed {
+		b.failures = 0
+		b.state = utils.CIRCUIT_STATE_CLOSED
+		return previous, b.state
+	}
+	b.failures++
+	if b.state == utils.CIRCUIT_STATE_HALF_OPEN || (b.policy.FailureThreshold > 0 && b.failures >= b.policy.FailureThreshold) {
+		b.state = utils.CIRCUIT_STATE_OPEN
+		b.openedAt = now
+	}
+	return previous, b.state
+}
+
+// release lets another call probe the upstream when the one in flight ended without an outcome.
+func (b *circuitBreaker) release() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.probing = false
+}
+
+// isOpen reports whether the breaker is rejecting the calls.
+func (b *circuitBreaker) isOpen() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.state == utils.CIRCUIT_STATE_OPEN
+}
+
+// status returns the state of the breaker at the given time.
+func (b *circuitBreaker) status(upstream string, now time.Time) models.UpstreamHealth {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	health := models.UpstreamHealth{Name: upstream, State: b.state, ConsecutiveFailures: b.failures}
+	if b.state != utils.CIRCUIT_STATE_CLOSED {
+		openedAt := b.openedAt
+		health.OpenedAt = &openedAt
+	}
+	if b.state == utils.CIRCUIT_STATE_OPEN {
+		retryAt := b.openedAt.Add(b.policy.OpenDuration)
+		health.RetryAt = &retryAt
+	}
+	return health
+}
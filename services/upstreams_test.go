@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"service_fraud/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFlakyUpstream starts a server that answers the given statuses in order, 200 once they are
+// exhausted, and returns it along with the number of requests it received.
+func newFlakyUpstream(t *testing.T, header http.Header, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := int(calls.Add(1))
+		for key, values := range header {
+			w.Header()[key] = values
+		}
+		if call <= len(statuses) {
+			w.WriteHeader(statuses[call-1])
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+// fastRetries returns a retry policy with short waits for the tests.
+func fastRetries(maxAttempts int) RetryPolicy {
+	return RetryPolicy{MaxAttempts: maxAttempts, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+}
+
+// get sends a GET request to the URL through the upstreams and returns the status, 0 on error.
+func get(t *testing.T, upstreams *Upstreams, url string) (int, error) {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+	require.NoError(t, err)
+	resp, err := upstreams.Do(utils.METRICS_UPSTREAM_IPAPI, req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	tests := []struct {
+		attempt int
+		delay   time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{5, time.Second},
+		{100, time.Second},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			wait := policy.Backoff(tt.attempt)
+			assert.GreaterOrEqual(t, wait, tt.delay/2)
+			assert.LessOrEqual(t, wait, tt.delay)
+		}
+	}
+}
+
+func TestUpstreams_Retry(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   http.Header
+		statuses []int
+		status   int
+		calls    int32
+	}{
+		{"server errors", nil, []int{http.StatusServiceUnavailable, http.StatusBadGateway}, http.StatusOK, 3},
+		{"exhausted attempts", nil, []int{500, 500, 500, 500}, http.StatusInternalServerError, 3},
+		{"client error", nil, []int{http.StatusNotFound}, http.StatusNotFound, 1},
+		{"too many requests", http.Header{"Retry-After": {"0"}}, []int{http.StatusTooManyRequests}, http.StatusOK, 2},
+		{"retry after too long", http.Header{"Retry-After": {"60"}}, []int{http.StatusTooManyRequests}, http.StatusTooManyRequests, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, calls := newFlakyUpstream(t, tt.header, tt.statuses...)
+			upstreams := NewUpstreams(fastRetries(3), BreakerPolicy{})
+
+			status, err := get(t, upstreams, srv.URL)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.status, status)
+			assert.Equal(t, tt.calls, calls.Load())
+		})
+	}
+}
+
+func TestUpstreams_RetryTimeout(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(srv.Close)
+	retry := fastRetries(2)
+	retry.AttemptTimeout = 50 * time.Millisecond
+	upstreams := NewUpstreams(retry, BreakerPolicy{})
+	upstreams.SetMetrics(NewMetrics())
+
+	status, err := get(t, upstreams, srv.URL)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 1.0, upstreams.metrics.upstreamRetries.Value(utils.METRICS_UPSTREAM_IPAPI, utils.METRICS_RETRY_TIMEOUT))
+}
+
+func TestUpstreams_RetryCanceled(t *testing.T) {
+	srv, calls := newFlakyUpstream(t, nil, 500, 500, 500)
+	upstreams := NewUpstreams(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Minute}, BreakerPolicy{})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	require.NoError(t, err)
+
+	// The wait before the retry would outlive the deadline, so the failed response is returned.
+	resp, err := upstreams.Do(utils.METRICS_UPSTREAM_IPAPI, req)
+
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.EqualValues(t, 1, calls.Load())
+}
+
+func TestUpstreams_CircuitBreaker(t *testing.T) {
+	srv, calls := newFlakyUpstream(t, nil, 500, 500, 500)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	upstreams := NewUpstreams(fastRetries(1), BreakerPolicy{FailureThreshold: 2, OpenDuration: time.Minute})
+	upstreams.clock = func() time.Time { return now }
+	upstreams.SetMetrics(NewMetrics())
+
+	for i := 0; i < 2; i++ {
+		status, err := get(t, upstreams, srv.URL)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusInternalServerError, status)
+	}
+	health := upstreams.Status(utils.METRICS_UPSTREAM_IPAPI)
+	assert.Equal(t, utils.CIRCUIT_STATE_OPEN, health.State)
+	assert.Equal(t, 2, health.ConsecutiveFailures)
+	require.NotNil(t, health.RetryAt)
+	assert.Equal(t, now.Add(time.Minute), *health.RetryAt)
+
+	// While open the calls fail without reaching the upstream.
+	_, err := get(t, upstreams, srv.URL)
+	assert.True(t, errors.Is(err, errCircuitOpen))
+	assert.EqualValues(t, 2, calls.Load())
+	assert.Equal(t, 1.0, upstreams.metrics.circuitRejected.Value(utils.METRICS_UPSTREAM_IPAPI))
+
+	// After the open duration a failed probe opens it again.
+	now = now.Add(time.Minute)
+	status, err := get(t, upstreams, srv.URL)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, status)
+	assert.Equal(t, utils.CIRCUIT_STATE_OPEN, upstreams.Status(utils.METRICS_UPSTREAM_IPAPI).State)
+
+	// And a successful one closes it.
+	now = now.Add(time.Minute)
+	status, err = get(t, upstreams, srv.URL)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	health = upstreams.Status(utils.METRICS_UPSTREAM_IPAPI)
+	assert.Equal(t, utils.CIRCUIT_STATE_CLOSED, health.State)
+	assert.Zero(t, health.ConsecutiveFailures)
+	assert.Nil(t, health.OpenedAt)
+	assert.Equal(t, 2.0, upstreams.metrics.circuitChanges.Value(utils.METRICS_UPSTREAM_IPAPI, utils.CIRCUIT_STATE_OPEN))
+	assert.Equal(t, 1.0, upstreams.metrics.circuitChanges.Value(utils.METRICS_UPSTREAM_IPAPI, utils.CIRCUIT_STATE_CLOSED))
+}
+
+func TestUpstreams_HalfOpenAllowsOneProbe(t *testing.T) {
+	breaker := &circuitBreaker{policy: BreakerPolicy{FailureThreshold: 1, OpenDuration: time.Minute}, state: utils.CIRCUIT_STATE_CLOSED}
+	now := time.Now()
+	breaker.record(true, now)
+
+	assert.False(t, breaker.allow(now))
+	assert.True(t, breaker.allow(now.Add(time.Minute)))
+	assert.False(t, breaker.allow(now.Add(time.Minute)))
+	breaker.release()
+	assert.True(t, breaker.allow(now.Add(time.Minute)))
+}
+
+func TestUpstreams_Nil(t *testing.T) {
+	srv, calls := newFlakyUpstream(t, nil, 500)
+	var upstreams *Upstreams
+
+	status, err := get(t, upstreams, srv.URL)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, status)
+	assert.EqualValues(t, 1, calls.Load())
+	assert.Equal(t, utils.CIRCUIT_STATE_CLOSED, upstreams.Status(utils.METRICS_UPSTREAM_IPAPI).State)
+}
@@ -0,0 +1,75 @@
+package utils
+
+import "net/netip"
+
+// Categories of the non-routable IP ranges.
+const (
+	IP_CATEGORY_PRIVATE       = "private"
+	IP_CATEGORY_LOOPBACK      = "loopback"
+	IP_CATEGORY_LINK_LOCAL    = "link-local"
+	IP_CATEGORY_CGNAT         = "cgnat"
+	IP_CATEGORY_MULTICAST     = "multicast"
+	IP_CATEGORY_DOCUMENTATION = "documentation"
+	IP_CATEGORY_BOGON         = "bogon"
+)
+
+// nonRoutableRange associates a special-purpose prefix with its category.
+type nonRoutableRange struct {
+	prefix   netip.Prefix
+	category string
+}
+
+// nonRoutableRanges holds the IPv4 and IPv6 ranges that can not be geolocated.
+var nonRoutableRanges = []nonRoutableRange{
+	{netip.MustParsePrefix("0.0.0.0/8"), IP_CATEGORY_BOGON},
+	{netip.MustParsePrefix("10.0.0.0/8"), IP_CATEGORY_PRIVATE},
+	{netip.MustParsePrefix("100.64.0.0/10"), IP_CATEGORY_CGNAT},
+	{netip.MustParsePrefix("127.0.0.0/8"), IP_CATEGORY_LOOPBACK},
+	{netip.MustParsePrefix("169.254.0.0/16"), IP_CATEGORY_LINK_LOCAL},
+	{netip.MustParsePrefix("172.16.0.0/12"), IP_CATEGORY_PRIVATE},
+	{netip.MustParsePrefix("192.0.0.0/24"), IP_CATEGORY_BOGON},
+	{netip.MustParsePrefix("192.0.2.0/24"), IP_CATEGORY_DOCUMENTATION},
+	{netip.MustParsePrefix("192.88.99.0/24"), IP_CATEGORY_BOGON},
+	{netip.MustParsePrefix("192.168.0.0/16"), IP_CATEGORY_PRIVATE},
+	{netip.MustParsePrefix("198.18.0.0/15"), IP_CATEGORY_BOGON},
+	{netip.MustParsePrefix("198.51.100.0/24"), IP_CATEGORY_DOCUMENTATION},
+	{netip.MustParsePrefix("203.0.113.0/24"), IP_CATEGORY_DOCUMENTATION},
+	{netip.MustParsePrefix("224.0.0.0/4"), IP_CATEGORY_MULTICAST},
+	{netip.MustParsePrefix("240.0.0.0/4"), IP_CATEGORY_BOGON},
+	{netip.MustParsePrefix("::/128"), IP_CATEGORY_BOGON},
+	{netip.MustParsePrefix("::1/128"), IP_CATEGORY_LOOPBACK},
+	{netip.MustParsePrefix("64:ff9b::/96"), IP_CATEGORY_BOGON},
+	{netip.MustParsePrefix("64:ff9b:1::/48"), IP_CATEGORY_BOGON},
+	{netip.MustParsePrefix("100::/64"), IP_CATEGORY_BOGON},
+	{netip.MustParsePrefix("2001:db8::/32"), IP_CATEGORY_DOCUMENTATION},
+	{netip.MustParsePrefix("2001::/23"), IP_CATEGORY_BOGON},
+	{netip.MustParsePrefix("3fff::/20"), IP_CATEGORY_DOCUMENTATION},
+	{netip.MustParsePrefix("fc00::/7"), IP_CATEGORY_PRIVATE},
+	{netip.MustParsePrefix("fe80::/10"), IP_CATEGORY_LINK_LOCAL},
+	{netip.MustParsePrefix("fec0::/10"), IP_CATEGORY_BOGON},
+	{netip.MustParsePrefix("ff00::/8"), IP_CATEGORY_MULTICAST},
+}
+
+// ipv6GlobalUnicast is the only IPv6 range allocated to global addresses, the addresses outside
+// of it and of the ranges above are bogons.
+var ipv6GlobalUnicast = netip.MustParsePrefix("2000::/3")
+
+// ClassifyIp returns the category of the range the IP belongs to when it is a private,
+// reserved or special-purpose address that can not be geolocated. It reports false for
+// routable or invalid addresses.
+func ClassifyIp(ipStr string) (string, bool) {
+	addr, err := netip.ParseAddr(ipStr)
+	if err != nil {
+		return "", false
+	}
+	addr = addr.WithZone("").Unmap()
+	for _, r := range nonRoutableRanges {
+		if r.prefix.Contains(addr) {
+			return r.category, true
+		}
+	}
+	if addr.Is6() && !ipv6GlobalUnicast.Contains(addr) {
+		return IP_CATEGORY_BOGON, true
+	}
+	return "", false
+}
@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyIp(t *testing.T) {
+	tests := []struct {
+		ip       string
+		category string
+		matched  bool
+	}{
+		{"10.0.0.1", IP_CATEGORY_PRIVATE, true},
+		{"172.31.255.255", IP_CATEGORY_PRIVATE, true},
+		{"192.168.1.1", IP_CATEGORY_PRIVATE, true},
+		{"127.0.0.1", IP_CATEGORY_LOOPBACK, true},
+		{"169.254.10.1", IP_CATEGORY_LINK_LOCAL, true},
+		{"100.64.0.1", IP_CATEGORY_CGNAT, true},
+		{"100.127.255.255", IP_CATEGORY_CGNAT, true},
+		{"224.0.0.251", IP_CATEGORY_MULTICAST, true},
+		{"192.0.2.10", IP_CATEGORY_DOCUMENTATION, true},
+		{"198.51.100.10", IP_CATEGORY_DOCUMENTATION, true},
+		{"203.0.113.10", IP_CATEGORY_DOCUMENTATION, true},
+		{"0.1.2.3", IP_CATEGORY_BOGON, true},
+		{"255.255.255.255", IP_CATEGORY_BOGON, true},
+		{"::ffff:10.0.0.1", IP_CATEGORY_PRIVATE, true},
+		{"::1", IP_CATEGORY_LOOPBACK, true},
+		{"::", IP_CATEGORY_BOGON, true},
+		{"fe80::1%eth0", IP_CATEGORY_LINK_LOCAL, true},
+		{"fd12:3456::1", IP_CATEGORY_PRIVATE, true},
+		{"ff02::1", IP_CATEGORY_MULTICAST, true},
+		{"2001:db8::1", IP_CATEGORY_DOCUMENTATION, true},
+		{"2001::1", IP_CATEGORY_BOGON, true},
+		{"2001:1ff::1", IP_CATEGORY_BOGON, true},
+		{"64:ff9b::8.8.8.8", IP_CATEGORY_BOGON, true},
+		{"::2", IP_CATEGORY_BOGON, true},
+		{"4000::1", IP_CATEGORY_BOGON, true},
+		{"e000::1", IP_CATEGORY_BOGON, true},
+		{"1.1.1.1", "", false},
+		{"100.128.0.1", "", false},
+		{"172.32.0.1", "", false},
+		{"2800:810:400::1", "", false},
+		{"2001:200::1", "", false},
+		{"2a00:1450:4001::1", "", false},
+		{"invalid_ip", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			category, matched := ClassifyIp(tt.ip)
+			assert.Equal(t, tt.matched, matched)
+			assert.Equal(t, tt.category, category)
+		})
+	}
+}
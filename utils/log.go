@@ -1,18 +1,60 @@
-package utils
-
-import (
-	"fmt"
-	"log"
-	"os"
-)
-
-// init sets up logging for the application by creating or opening
-// a file named "app.log". Log messages will be appended to this file.
-func init() {
-	out, err := os.OpenFile("app.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return
-	}
-	log.SetOutput(out)
-	fmt.Print("Log setup")
-}
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// traceIdKey is the key of the trace ID in a context.
+type traceIdKey struct{}
+
+// NewLogger creates a logger that writes to out with the 'json' or 'text' format, discarding
+// the messages below the level, 'debug', 'info', 'warn' or 'error'.
+func NewLogger(out io.Writer, format, level string) (*slog.Logger, error) {
+	var logLevel slog.Level
+	if err := logLevel.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("the log level %q is not valid", level)
+	}
+	options := &slog.HandlerOptions{Level: logLevel}
+	switch strings.ToLower(format) {
+	case LOG_FORMAT_JSON:
+		return slog.New(slog.NewJSONHandler(out, options)), nil
+	case LOG_FORMAT_TEXT:
+		return slog.New(slog.NewTextHandler(out, options)), nil
+	default:
+		return nil, fmt.Errorf("the log format %q is not valid", format)
+	}
+}
+
+// NewTraceId returns a random ID that correlates the messages logged during a trace.
+func NewTraceId() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(id)
+}
+
+// WithTraceId returns a copy of the context that carries the trace ID.
+func WithTraceId(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, traceIdKey{}, id)
+}
+
+// TraceId returns the trace ID carried by the context, empty when there is none.
+func TraceId(ctx context.Context) string {
+	id, _ := ctx.Value(traceIdKey{}).(string)
+	return id
+}
+
+// Logger returns the default logger with the trace ID of the context, if it carries one.
+func Logger(ctx context.Context) *slog.Logger {
+	if id := TraceId(ctx); id != "" {
+		return slog.Default().With(LOG_KEY_TRACE_ID, id)
+	}
+	return slog.Default()
+}
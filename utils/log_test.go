@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := NewLogger(&buf, "json", "warn")
+	require.NoError(t, err)
+
+	logger.Info("discarded")
+	logger.Warn("kept", "ip", "1.1.1.1")
+
+	var line map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	assert.Equal(t, "kept", line["msg"])
+	assert.Equal(t, "WARN", line["level"])
+	assert.Equal(t, "1.1.1.1", line["ip"])
+
+	buf.Reset()
+	logger, err = NewLogger(&buf, "TEXT", "debug")
+	require.NoError(t, err)
+	logger.Debug("text line", "ip", "1.1.1.1")
+	assert.Contains(t, buf.String(), `level=DEBUG msg="text line" ip=1.1.1.1`)
+}
+
+func TestNewLogger_Invalid(t *testing.T) {
+	_, err := NewLogger(&bytes.Buffer{}, "xml", "info")
+	assert.Error(t, err)
+
+	_, err = NewLogger(&bytes.Buffer{}, "json", "verbose")
+	assert.Error(t, err)
+}
+
+func TestLogger_TraceId(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := NewLogger(&buf, "json", "info")
+	require.NoError(t, err)
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	id := NewTraceId()
+	ctx := WithTraceId(context.Background(), id)
+	Logger(ctx).Info("traced")
+
+	var line map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	assert.Equal(t, id, line[LOG_KEY_TRACE_ID])
+	assert.Len(t, id, 16)
+	assert.NotEqual(t, id, NewTraceId())
+	assert.Equal(t, id, TraceId(ctx))
+	assert.Empty(t, TraceId(context.Background()))
+	assert.Same(t, slog.Default(), Logger(context.Background()))
+}
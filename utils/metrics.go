@@ -0,0 +1,258 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MetricsRegistry holds counters and histograms and writes them in the Prometheus text format,
+// so they can be scraped without depending on the Prometheus client.
+type MetricsRegistry struct {
+	lock    sync.Mutex
+	metrics []metricFamily
+}
+
+// metricFamily is a counter or histogram registered in a MetricsRegistry.
+type metricFamily interface {
+	writeText(w io.Writer) error
+}
+
+// NewMetricsRegistry creates an empty MetricsRegistry.
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{}
+}
+
+// Counter registers a counter with the given label names.
+func (r *MetricsRegistry) Counter(name, help string, labels ...string) *CounterVec {
+	counter := &CounterVec{metricVec: newMetricVec(name, help, labels), values: make(map[string]float64)}
+	r.register(counter)
+	return counter
+}
+
+// Histogram registers a histogram with the given upper bounds, in ascending order, and label
+// names. The +Inf bucket is added to the bounds.
+func (r *MetricsRegistry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	histogram := &HistogramVec{metricVec: newMetricVec(name, help, labels), buckets: buckets, values: make(map[string]*histogramValue)}
+	r.register(histogram)
+	return histogram
+}
+
+// WriteText writes the registered metrics in the Prometheus text format, in registration order
+// and with the series of each metric sorted by their labels.
+func (r *MetricsRegistry) WriteText(w io.Writer) error {
+	r.lock.Lock()
+	metrics := r.metrics
+	r.lock.Unlock()
+	for _, metric := range metrics {
+		if err := metric.writeText(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// register adds the metric to the registry.
+func (r *MetricsRegistry) register(metric metricFamily) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.metrics = append(r.metrics, metric)
+}
+
+// metricVec holds the name, help and label names shared by the series of a metric.
+type metricVec struct {
+	lock   sync.Mutex
+	name   string
+	help   string
+	labels []string
+	series map[string][]string
+}
+
+// newMetricVec creates a metricVec without series.
+func newMetricVec(name, help string, labels []string) metricVec {
+	return metricVec{name: name, help: help, labels: labels, series: make(map[string][]string)}
+}
+
+// key returns the key of the series with the given label values, which must be as many as the
+// label names.
+func (m *metricVec) key(values []string) string {
+	if len(values) != len(m.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", m.name, len(m.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	if _, ok := m.series[key]; !ok {
+		m.series[key] = append([]string(nil), values...)
+	}
+	return key
+}
+
+// sortedKeys returns the keys of the series sorted by their label values.
+func (m *metricVec) sortedKeys() []string {
+	keys := make([]string, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writeHeader writes the HELP and TYPE lines of the metric.
+func (m *metricVec) writeHeader(w io.Writer, kind string) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, escapeHelp(m.help), m.name, kind)
+	return err
+}
+
+// labelText formats the label names and values of a series, adding the extra pairs at the end.
+func (m *metricVec) labelText(values []string, extra ...string) string {
+	pairs := make([]string, 0, len(values)+len(extra)/2)
+	for i, value := range values {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", m.labels[i], escapeLabelValue(value)))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", extra[i], escapeLabelValue(extra[i+1])))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// CounterVec is a counter with a series per combination of label values.
+type CounterVec struct {
+	metricVec
+	values map[string]float64
+}
+
+// Inc adds 1 to the series with the given label values.
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds the delta, which must not be negative, to the series with the given label values.
+func (c *CounterVec) Add(delta float64, values ...string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.values[c.key(values)] += delta
+}
+
+// Value returns the value of the series with the given label values.
+func (c *CounterVec) Value(values ...string) float64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.values[strings.Join(values, "\xff")]
+}
+
+// writeText writes the counter in the Prometheus text format.
+func (c *CounterVec) writeText(w io.Writer) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err := c.writeHeader(w, "counter"); err != nil {
+		return err
+	}
+	for _, key := range c.sortedKeys() {
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", c.name, c.labelText(c.series[key]), formatMetricValue(c.values[key])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HistogramVec is a histogram with a series per combination of label values.
+type HistogramVec struct {
+	metricVec
+	buckets []float64
+	values  map[string]*histogramValue
+}
+
+// histogramValue holds the observations of a series of a histogram, counts[i] being the
+// observations less than or equal to buckets[i].
+type histogramValue struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Observe adds the value to the series with the given label values.
+func (h *HistogramVec) Observe(value float64, values ...string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	key := h.key(values)
+	series, ok := h.values[key]
+	if !ok {
+		series = &histogramValue{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = series
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			series.counts[i]++
+		}
+	}
+	series.count++
+	series.sum += value
+}
+
+// Count returns the number of observations of the series with the given label values.
+func (h *HistogramVec) Count(values ...string) uint64 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if series, ok := h.values[strings.Join(values, "\xff")]; ok {
+		return series.count
+	}
+	return 0
+}
+
+// writeText writes the histogram in the Prometheus text format, with cumulative buckets.
+func (h *HistogramVec) writeText(w io.Writer) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if err := h.writeHeader(w, "histogram"); err != nil {
+		return err
+	}
+	for _, key := range h.sortedKeys() {
+		labels, series := h.series[key], h.values[key]
+		for i, bound := range h.buckets {
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelText(labels, "le", formatMetricValue(bound)), series.counts[i]); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+			h.name, h.labelText(labels, "le", "+Inf"), series.count,
+			h.name, h.labelText(labels), formatMetricValue(series.sum),
+			h.name, h.labelText(labels), series.count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DefaultLatencyBuckets returns the upper bounds, in seconds, of the latency histograms.
+func DefaultLatencyBuckets() []float64 {
+	return []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+}
+
+// formatMetricValue formats a sample value as Prometheus expects it.
+func formatMetricValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// escapeHelp escapes the backslashes and line feeds of a HELP text.
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+// escapeLabelValue escapes the backslashes, double quotes and line feeds of a label value.
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
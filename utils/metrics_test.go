@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsRegistry_WriteText(t *testing.T) {
+	registry := NewMetricsRegistry()
+	requests := registry.Counter("requests_total", "Requests by upstream and status.", "upstream", "status")
+	duration := registry.Histogram("duration_seconds", "Duration of the requests.", []float64{0.1, 1}, "upstream")
+	empty := registry.Counter("empty_total", "A counter without labels.")
+
+	requests.Inc("fixer", "200")
+	requests.Add(2, "ipapi", "200")
+	requests.Inc("ipapi", "none")
+	duration.Observe(0.05, "ipapi")
+	duration.Observe(0.5, "ipapi")
+	duration.Observe(3, "ipapi")
+	empty.Add(0)
+
+	var buf bytes.Buffer
+	require.NoError(t, registry.WriteText(&buf))
+
+	assert.Equal(t, `# HELP requests_total Requests by upstream and status.
+# TYPE requests_total counter
+requests_total{upstream="fixer",status="200"} 1
+requests_total{upstream="ipapi",status="200"} 2
+requests_total{upstream="ipapi",status="none"} 1
+# HELP duration_seconds Duration of the requests.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{upstream="ipapi",le="0.1"} 1
+duration_seconds_bucket{upstream="ipapi",le="1"} 2
+duration_seconds_bucket{upstream="ipapi",le="+Inf"} 3
+duration_seconds_sum{upstream="ipapi"} 3.55
+duration_seconds_count{upstream="ipapi"} 3
+# HELP empty_total A counter without labels.
+# TYPE empty_total counter
+empty_total 0
+`, buf.String())
+	assert.Equal(t, 2.0, requests.Value("ipapi", "200"))
+	assert.Equal(t, uint64(3), duration.Count("ipapi"))
+	assert.Equal(t, uint64(0), duration.Count("fixer"))
+}
+
+func TestMetricsRegistry_Escaping(t *testing.T) {
+	registry := NewMetricsRegistry()
+	counter := registry.Counter("errors_total", "Errors\nwith a \\ in the help.", "message")
+	counter.Inc("a \"quoted\"\nvalue \\")
+
+	var buf bytes.Buffer
+	require.NoError(t, registry.WriteText(&buf))
+
+	assert.Equal(t, `# HELP errors_total Errors\nwith a \\ in the help.
+# TYPE errors_total counter
+errors_total{message="a \"quoted\"\nvalue \\"} 1
+`, buf.String())
+}
+
+func TestCounterVec_LabelMismatch(t *testing.T) {
+	counter := NewMetricsRegistry().Counter("requests_total", "Requests.", "upstream")
+
+	assert.Panics(t, func() { counter.Inc() })
+	assert.Panics(t, func() { counter.Inc("ipapi", "200") })
+}
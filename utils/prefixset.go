@@ -0,0 +1,79 @@
+package utils
+
+import "net/netip"
+
+// PrefixSet holds IP prefixes in a binary trie per address family, so looking up an address
+// takes at most 32 or 128 steps regardless of the number of prefixes in the set.
+type PrefixSet struct {
+	v4    *prefixNode
+	v6    *prefixNode
+	count int
+}
+
+// prefixNode is a node of the trie, terminal when a prefix ends on it.
+type prefixNode struct {
+	children [2]*prefixNode
+	prefix   netip.Prefix
+	terminal bool
+}
+
+// NewPrefixSet creates an empty PrefixSet.
+func NewPrefixSet() *PrefixSet {
+	return &PrefixSet{v4: &prefixNode{}, v6: &prefixNode{}}
+}
+
+// Add inserts the prefix into the set. IPv4-mapped IPv6 prefixes are stored as IPv4.
+func (p *PrefixSet) Add(prefix netip.Prefix) {
+	if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+	}
+	prefix = prefix.Masked()
+
+	node := p.root(prefix.Addr())
+	ip := prefix.Addr().AsSlice()
+	for i := 0; i < prefix.Bits(); i++ {
+		bit := (ip[i/8] >> (7 - i%8)) & 1
+		if node.children[bit] == nil {
+			node.children[bit] = &prefixNode{}
+		}
+		node = node.children[bit]
+	}
+	if !node.terminal {
+		p.count++
+	}
+	node.terminal = true
+	node.prefix = prefix
+}
+
+// Lookup returns the most specific prefix of the set that contains the address.
+func (p *PrefixSet) Lookup(addr netip.Addr) (netip.Prefix, bool) {
+	addr = addr.WithZone("").Unmap()
+	var match netip.Prefix
+	found := false
+
+	node := p.root(addr)
+	ip := addr.AsSlice()
+	for i := 0; node != nil; i++ {
+		if node.terminal {
+			match, found = node.prefix, true
+		}
+		if i == len(ip)*8 {
+			break
+		}
+		node = node.children[(ip[i/8]>>(7-i%8))&1]
+	}
+	return match, found
+}
+
+// Len returns the number of prefixes in the set.
+func (p *PrefixSet) Len() int {
+	return p.count
+}
+
+// root returns the trie of the address family of the address.
+func (p *PrefixSet) root(addr netip.Addr) *prefixNode {
+	if addr.Is4() {
+		return p.v4
+	}
+	return p.v6
+}
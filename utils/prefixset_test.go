@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixSet_Lookup(t *testing.T) {
+	set := NewPrefixSet()
+	for _, prefix := range []string{"10.0.0.0/8", "10.1.0.0/16", "203.0.113.7/32", "::ffff:198.51.100.0/120", "2800:810::/32", "0.0.0.0/0"} {
+		set.Add(netip.MustParsePrefix(prefix))
+	}
+	set.Add(netip.MustParsePrefix("10.1.2.3/16"))
+
+	tests := []struct {
+		ip       string
+		expected string
+		found    bool
+	}{
+		{"10.2.3.4", "10.0.0.0/8", true},
+		{"10.1.2.3", "10.1.0.0/16", true},
+		{"::ffff:10.1.2.3", "10.1.0.0/16", true},
+		{"203.0.113.7", "203.0.113.7/32", true},
+		{"203.0.113.8", "0.0.0.0/0", true},
+		{"198.51.100.25", "198.51.100.0/24", true},
+		{"2800:810:400::1", "2800:810::/32", true},
+		{"2800:811::1", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			prefix, found := set.Lookup(netip.MustParseAddr(tt.ip))
+
+			assert.Equal(t, tt.found, found)
+			if tt.found {
+				assert.Equal(t, tt.expected, prefix.String())
+			}
+		})
+	}
+	assert.Equal(t, 6, set.Len())
+}
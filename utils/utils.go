@@ -1,78 +1,288 @@
-package utils
-
-import (
-	"math"
-	"strconv"
-)
-
-// Constants for user messages, error messages, and API URLs used in the application.
-const (
-	INFO_USER_MESSAGE_SELECT_OPTION     = "Ingrese su opcion: "
-	NO_RECORD_INFORMATION_AVAILABLE_YET = "Aun no hay informacion disponible para visualizar"
-	ERR_USER_MESSAGE_INVALID_OPTION     = "Opcion invalida, por favor revise la informacion ingresada"
-	ERR_MESSAGE_INVALID_OPTION          = "Invalid option. Input: %s"
-	ERR_CODE_INVALID_OPTION             = 101
-	ERR_USER_MESSAGE_INVALID_IP         = "La ip ingresada no es valida, revise los datos ingresados e intente nuevamente"
-	ERR_MESSAGE_INVALID_IP              = "The IP is not valid: %s"
-	ERR_CODE_INVALID_IP                 = 102
-	ERR_USER_MESSAGE_IP_SERVICE         = "Error durante la ejecucion de la obtencion de la ip"
-	ERR_MESSAGE_IP_SERVICE              = "Error during the execution of the IP service: %s"
-	ERR_CODE_IP_SERVICE                 = 103
-	ERR_USER_MESSAGE_COUNTRY_SERVICE    = "Error durante la ejecucion de la obtencion de la informacion de la region"
-	ERR_MESSAGE_COUNTRY_SERVICE         = "Error during the execution of the country service: %s"
-	ERR_CODE_COUNTRY_SERVICE            = 104
-	ERR_USER_MESSAGE_CURRENCY_SERVICE   = "Error durante la ejecucion de la obtencion de la informacion de la moneda"
-	ERR_MESSAGE_CURRENCY_SERVICE        = "Error during the execution of the currency service: %s"
-	ERR_CODE_CURRENCY_SERVICE           = 105
-	ERR_USER_MESSAGE_GET_SECRETS        = "Error durante la ejecucion de la obtencion de los secretos"
-	ERR_MESSAGE_GET_SECRETS             = "Error getting the secrets: %s"
-	ERR_CODE_GET_SECRETS                = 106
-	ERR_USER_MESSAGE_IP_RESP_EMPTY      = "La ip solicitada no devuelve informacion para mostrar"
-	ERR_MESSAGE_IP_RESP_EMPTY           = "The requested IP returned an empty response: %s"
-	ERR_CODE_IP_RESP_EMPTY              = 107
-	ERR_USER_MESSAGE_LIMIT_REACHED      = "El servicio alcanzo su limite permitido es necesario generar una nueva clase"
-	ERR_MESSAGE_LIMIT_REACHED           = "It is necessary to create a new api key: %s"
-	ERR_CODE_LIMIT_REACHED              = 108
-
-	LOG_MESSAGE_VALID_PARAMETER = "Opcion valida iniciando el proceso para: %s"
-	LOG_MESSAGE_ELAPSED_TIME    = "Tiempo transcurrido para el flujo %s: %f (segundos)"
-
-	API_IP_URL       = "http://api.ipapi.com/api/%s?access_key=%s"
-	API_COUNTRY_URL  = "https://restcountries.com/v3.1/name/%s?fullText=true"
-	API_CURRENCY_URL = "https://data.fixer.io/api/latest?access_key=%s"
-
-	SECRET_VAULT            = "service_fraud_api_secrets"
-	SECRET_API_IP_KEY       = "ipapi_key"
-	SECRET_API_CURRENCY_KEY = "currency_key"
-
-	BA_LATITUDE  float64 = -34.61315
-	BA_LONGITUDE float64 = -58.37723
-	EARTH_RADIUS float64 = 6371.0
-
-	TTL_IN_MINUTES = 30
-)
-
-// ToRadians converts degrees to radians.
-func ToRadians(degrees float64) float64 {
-	return degrees * math.Pi / 180
-}
-
-// GetEstimatedDistance calculates the distance between two geographic points
-// (given in latitude and longitude) using the Haversine formula and returns it as a string.
-func GetEstimatedDistance(lat1, lon1, lat2, lon2 float64) string {
-	lat1 = ToRadians(lat1)
-	lon1 = ToRadians(lon1)
-	lat2 = ToRadians(lat2)
-	lon2 = ToRadians(lon2)
-
-	dLat := lat2 - lat1
-	dLon := lon2 - lon1
-
-	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
-		math.Cos(lat1)*math.Cos(lat2)*
-			math.Sin(dLon/2)*math.Sin(dLon/2)
-	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
-
-	distance := EARTH_RADIUS * c
-	return strconv.Itoa(int(distance))
-}
+package utils
+
+import (
+	"math"
+	"net/netip"
+	"strconv"
+)
+
+// Constants for user messages, error messages, and API URLs used in the application.
+const (
+	INFO_USER_MESSAGE_SELECT_OPTION     = "Ingrese su opcion: "
+	NO_RECORD_INFORMATION_AVAILABLE_YET = "Aun no hay informacion disponible para visualizar"
+	INFO_USER_MESSAGE_COUNTRY_REFRESH   = "Se actualizo el snapshot con %d paises en %s"
+	ERR_USER_MESSAGE_INVALID_OPTION     = "Opcion invalida, por favor revise la informacion ingresada"
+	ERR_MESSAGE_INVALID_OPTION          = "Invalid option. Input: %s"
+	ERR_CODE_INVALID_OPTION             = 101
+	ERR_USER_MESSAGE_INVALID_IP         = "La ip ingresada no es valida, revise los datos ingresados e intente nuevamente"
+	ERR_MESSAGE_INVALID_IP              = "The IP is not valid: %s"
+	ERR_CODE_INVALID_IP                 = 102
+	ERR_USER_MESSAGE_IP_SERVICE         = "Error durante la ejecucion de la obtencion de la ip"
+	ERR_MESSAGE_IP_SERVICE              = "Error during the execution of the IP service"
+	ERR_CODE_IP_SERVICE                 = 103
+	ERR_USER_MESSAGE_COUNTRY_SERVICE    = "Error durante la ejecucion de la obtencion de la informacion de la region"
+	ERR_MESSAGE_COUNTRY_SERVICE         = "Error during the execution of the country service"
+	ERR_CODE_COUNTRY_SERVICE            = 104
+	ERR_USER_MESSAGE_CURRENCY_SERVICE   = "Error durante la ejecucion de la obtencion de la informacion de la moneda"
+	ERR_MESSAGE_CURRENCY_SERVICE        = "Error during the execution of the currency service"
+	ERR_CODE_CURRENCY_SERVICE           = 105
+	ERR_USER_MESSAGE_GET_SECRETS        = "Error durante la ejecucion de la obtencion de los secretos"
+	ERR_MESSAGE_GET_SECRETS             = "Error getting the secrets"
+	ERR_CODE_GET_SECRETS                = 106
+	ERR_USER_MESSAGE_IP_RESP_EMPTY      = "La ip solicitada no devuelve informacion para mostrar"
+	ERR_MESSAGE_IP_RESP_EMPTY           = "The requested IP returned an empty response"
+	ERR_CODE_IP_RESP_EMPTY              = 107
+	ERR_USER_MESSAGE_LIMIT_REACHED      = "El servicio alcanzo su limite permitido es necesario generar una nueva clase"
+	ERR_MESSAGE_LIMIT_REACHED           = "It is necessary to create a new api key: %s"
+	ERR_CODE_LIMIT_REACHED              = 108
+	ERR_USER_MESSAGE_INVALID_FORMAT     = "El formato solicitado no es valido, los formatos disponibles son: text, json, yaml, csv, table"
+	ERR_MESSAGE_INVALID_FORMAT          = "The output format is not valid: %s"
+	ERR_CODE_INVALID_FORMAT             = 109
+	ERR_USER_MESSAGE_NON_ROUTABLE_IP    = "La ip solicitada pertenece a un rango no enrutable (%s) y no puede ser geolocalizada"
+	ERR_MESSAGE_NON_ROUTABLE_IP         = "The requested IP belongs to a non-routable range"
+	ERR_CODE_NON_ROUTABLE_IP            = 110
+	ERR_USER_MESSAGE_INVALID_RANGE      = "El rango de tiempo solicitado no es valido: %s"
+	ERR_CODE_INVALID_RANGE              = 111
+	ERR_USER_MESSAGE_TRACE_TIMEOUT      = "La consulta supero el tiempo maximo permitido, intente nuevamente"
+	ERR_CODE_TRACE_TIMEOUT              = 112
+	ERR_USER_MESSAGE_TRACE_CANCELED     = "La consulta fue cancelada"
+	ERR_CODE_TRACE_CANCELED             = 113
+	ERR_USER_MESSAGE_INVALID_API_KEY    = "La clave de acceso del servicio externo no es valida o esta inactiva"
+	ERR_CODE_INVALID_API_KEY            = 114
+	ERR_USER_MESSAGE_RATE_LIMITED       = "El servicio externo recibio demasiadas consultas, intente nuevamente en unos minutos"
+	ERR_CODE_RATE_LIMITED               = 115
+	ERR_USER_MESSAGE_INVALID_DATE       = "La fecha de las cotizaciones no es valida: %s"
+	ERR_CODE_INVALID_DATE               = 116
+	ERR_USER_MESSAGE_RATES_HISTORY      = "No hay cotizaciones historicas para la fecha solicitada"
+	ERR_CODE_RATES_HISTORY              = 117
+	ERR_USER_MESSAGE_INVALID_AMOUNT     = "El monto no es valido: %s"
+	ERR_CODE_INVALID_AMOUNT             = 118
+	ERR_USER_MESSAGE_CURRENCY_RATE      = "No hay cotizacion para convertir el monto: %s"
+	ERR_CODE_CURRENCY_RATE              = 119
+	ERR_MESSAGE_BATCH_FILE              = "Error opening the batch file: %s"
+	ERR_MESSAGE_LOAD_CONFIG             = "Error loading the configuration, using the default values"
+	ERR_MESSAGE_MMDB_OPEN               = "Error opening the MMDB database, it will not be used"
+	ERR_MESSAGE_GEO_PROVIDER            = "Unknown geolocation provider, it will not be used"
+	ERR_MESSAGE_COUNTRY_PROVIDER        = "Unknown country provider, it will not be used"
+	ERR_MESSAGE_COUNTRY_SNAPSHOT        = "Error loading the country snapshot, it will not be used"
+	ERR_MESSAGE_COUNTRY_SNAPSHOT_MISS   = "Country not found in the snapshot"
+	ERR_MESSAGE_COUNTRY_REFRESH         = "Error refreshing the country snapshot: %s"
+	ERR_MESSAGE_RISK_POLICY             = "Error in the risk policy, using the default policy"
+	ERR_MESSAGE_LISTS                   = "Error loading the lists, they are loaded again when their files change"
+	ERR_MESSAGE_LIST_LOAD               = "Error loading the list, the previous entries are kept"
+	ERR_MESSAGE_MMDB_LOOKUP             = "Error looking up the IP in the MMDB database"
+	ERR_MESSAGE_REFERENCES              = "Error in the reference locations, using Buenos Aires"
+	ERR_MESSAGE_CURRENCY_TARGET         = "Error in the target currency, using USD"
+	ERR_MESSAGE_RATES_REFRESH           = "Error refreshing the exchange rates, serving the last snapshot"
+	ERR_MESSAGE_RATES_PROVIDER          = "Unknown rates provider, it will not be used"
+	ERR_MESSAGE_RATES_JSON              = "Error in the JSON rates provider, it will not be used"
+	ERR_MESSAGE_RATES_SERVICE           = "Error retrieving the exchange rates from the provider"
+	ERR_MESSAGE_RATES_HISTORY           = "Error persisting the historical exchange rates"
+	ERR_MESSAGE_HISTOGRAM_BUCKETS       = "Error in the histogram buckets, using the default buckets"
+	ERR_MESSAGE_STATS_LOAD              = "Error loading the persisted stats, they are kept only in memory"
+	ERR_MESSAGE_STATS_STORE             = "Error persisting the stats"
+	ERR_MESSAGE_STATS_ENTRY             = "Invalid entry in the stats file, it is discarded"
+	ERR_MESSAGE_STATS_WINDOWS           = "Error in the stats windows, using the default windows"
+	ERR_MESSAGE_LOG_CONFIG              = "Error in the log configuration, using the default log"
+	ERR_MESSAGE_UPSTREAM_STATUS         = "Unexpected HTTP status from the external API"
+	ERR_MESSAGE_DECODE_RESPONSE         = "Error decoding the response of the external API"
+	ERR_MESSAGE_ENCODE_RESPONSE         = "Error encoding the response"
+	ERR_MESSAGE_WRITE_METRICS           = "Error writing the metrics"
+	ERR_MESSAGE_SECRET_NAME             = "The requested secret is not valid"
+	ERR_MESSAGE_OPTION_FAILED           = "The option finished with an error"
+	ERR_MESSAGE_PROVIDER_ERROR          = "The external API rejected the request"
+
+	LOG_MESSAGE_VALID_PARAMETER  = "Valid option, starting the process"
+	LOG_MESSAGE_ELAPSED_TIME     = "Process finished"
+	LOG_MESSAGE_SERVER_LISTENING = "HTTP server listening"
+	LOG_MESSAGE_LIST_MATCH       = "The IP or country matches a list"
+	LOG_MESSAGE_LIST_RELOADED    = "List loaded"
+	LOG_MESSAGE_STATS_COMPACTED  = "Stats file compacted"
+	LOG_MESSAGE_STATS_STARTED    = "Stats processing started"
+	LOG_MESSAGE_STATS_CLOSED     = "Stats channel closed, stats processing finished"
+	LOG_MESSAGE_STATS_STOPPED    = "Stats service stopped"
+	LOG_MESSAGE_SECRETS_LOADED   = "Secrets loaded"
+	LOG_MESSAGE_TRACE_FINISHED   = "Trace finished"
+	LOG_MESSAGE_UPSTREAM_RETRY   = "Retrying the call to the external API"
+	LOG_MESSAGE_CIRCUIT_CHANGED  = "Circuit breaker state changed"
+
+	LOG_FORMAT_TEXT    = "text"
+	LOG_FORMAT_JSON    = "json"
+	LOG_LEVEL_INFO     = "info"
+	LOG_OUTPUT_STDOUT  = "stdout"
+	LOG_OUTPUT_STDERR  = "stderr"
+	LOG_DEFAULT_OUTPUT = "app.log"
+	LOG_KEY_TRACE_ID   = "trace_id"
+
+	API_IP_URL       = "http://api.ipapi.com/api/%s?access_key=%s"
+	API_COUNTRY_URL  = "https://restcountries.com/v3.1/name/%s?fullText=true"
+	API_CURRENCY_URL = "https://data.fixer.io/api/latest?access_key=%s"
+	API_ECB_URL      = "https://www.ecb.europa.eu/stats/eurofxref/eurofxref-daily.xml"
+
+	API_CURRENCY_HISTORY_URL = "https://data.fixer.io/api/%s?access_key=%s"
+	API_ECB_HISTORY_URL      = "https://www.ecb.europa.eu/stats/eurofxref/eurofxref-hist-90d.xml"
+
+	SECRET_VAULT            = "service_fraud_api_secrets"
+	SECRET_API_IP_KEY       = "ipapi_key"
+	SECRET_API_CURRENCY_KEY = "currency_key"
+
+	BA_REFERENCE_NAME         = "Buenos Aires"
+	BA_LATITUDE       float64 = -34.61315
+	BA_LONGITUDE      float64 = -58.37723
+	EARTH_RADIUS      float64 = 6371.0
+
+	TTL_IN_MINUTES = 30
+
+	TRACE_DEFAULT_TIMEOUT_SECONDS = 30
+
+	CURRENCY_USD              = "USD"
+	CURRENCY_DEFAULT_TARGET   = CURRENCY_USD
+	CURRENCY_DEFAULT_DECIMALS = 2
+	CURRENCY_RATE_DECIMALS    = 6
+	CURRENCY_AMOUNT_MAX_LEN   = 30
+
+	RATES_DEFAULT_TTL_SECONDS       = TTL_IN_MINUTES * 60
+	RATES_DEFAULT_MAX_STALE_SECONDS = 24 * 60 * 60
+	RATES_DEFAULT_REFRESH_SECONDS   = 60
+	RATES_HISTORY_DEFAULT_PATH      = "rates_history"
+
+	UPSTREAM_DEFAULT_MAX_ATTEMPTS      = 3
+	UPSTREAM_DEFAULT_BASE_DELAY_MS     = 200
+	UPSTREAM_DEFAULT_MAX_DELAY_MS      = 5000
+	UPSTREAM_DEFAULT_TIMEOUT_SECONDS   = 10
+	UPSTREAM_DEFAULT_FAILURE_THRESHOLD = 5
+	UPSTREAM_DEFAULT_OPEN_SECONDS      = 30
+
+	PROVIDER_ERROR_INVALID_KEY   = "invalid_access_key"
+	PROVIDER_ERROR_MISSING_KEY   = "missing_access_key"
+	PROVIDER_ERROR_INACTIVE_USER = "inactive_user"
+	PROVIDER_ERROR_USAGE_LIMIT   = "usage_limit_reached"
+	PROVIDER_ERROR_RATE_LIMIT    = "rate_limit_reached"
+	PROVIDER_ERROR_INVALID_IP    = "invalid_ip_address"
+
+	CIRCUIT_STATE_CLOSED    = "closed"
+	CIRCUIT_STATE_OPEN      = "open"
+	CIRCUIT_STATE_HALF_OPEN = "half_open"
+
+	HEALTH_STATUS_OK       = "ok"
+	HEALTH_STATUS_DEGRADED = "degraded"
+
+	REFERENCE_DISTANCES_ALL     = "all"
+	REFERENCE_DISTANCES_NEAREST = "nearest"
+
+	STATS_UNKNOWN_CONTINENT       = "unknown"
+	STATS_DEFAULT_PATH            = "stats.jsonl"
+	STATS_DEFAULT_COMPACT_AFTER   = 1000
+	STATS_DEFAULT_BUCKET_SECONDS  = 60
+	STATS_DEFAULT_RETENTION_HOURS = 24
+
+	SERVER_DEFAULT_ADDR = ":8080"
+
+	CONFIG_PATH_ENV     = "SERVICE_FRAUD_CONFIG"
+	CONFIG_DEFAULT_PATH = "config.json"
+
+	FORMAT_TEXT   = "text"
+	FORMAT_JSON   = "json"
+	FORMAT_YAML   = "yaml"
+	FORMAT_CSV    = "csv"
+	FORMAT_TABLE  = "table"
+	FORMAT_NDJSON = "ndjson"
+
+	JSON_SCHEMA_VERSION = "2"
+
+	GEO_PROVIDER_IPAPI = "ipapi"
+	GEO_PROVIDER_MMDB  = "mmdb"
+
+	RISK_RULE_DISTANCE_OVER     = "distance_over"
+	RISK_RULE_COUNTRY           = "country"
+	RISK_RULE_CONTINENT         = "continent"
+	RISK_RULE_CONNECTION_TYPE   = "connection_type"
+	RISK_RULE_EU                = "eu"
+	RISK_RULE_CURRENCY_MISMATCH = "currency_mismatch"
+	RISK_RULE_AMOUNT_OVER       = "amount_over"
+
+	RISK_DECISION_ALLOW  = "allow"
+	RISK_DECISION_REVIEW = "review"
+	RISK_DECISION_DENY   = "deny"
+
+	RISK_MAX_SCORE = 100
+	RISK_RULE_LIST = "list"
+
+	LIST_TYPE_CIDR              = "cidr"
+	LIST_TYPE_COUNTRY           = "country"
+	LIST_ACTION_ALLOW           = "allow"
+	LIST_ACTION_BLOCK           = "block"
+	LIST_DEFAULT_RELOAD_SECONDS = 30
+
+	COUNTRY_PROVIDER_RESTCOUNTRIES = "restcountries"
+	COUNTRY_PROVIDER_SNAPSHOT      = "snapshot"
+	COUNTRY_SNAPSHOT_SOURCE_PATH   = "services/data/countries.json"
+
+	RATES_PROVIDER_FIXER = "fixer"
+	RATES_PROVIDER_ECB   = "ecb"
+	RATES_PROVIDER_JSON  = "json"
+
+	EXIT_CODE_OK             = 0
+	EXIT_CODE_ERROR          = 1
+	EXIT_CODE_USAGE          = 2
+	EXIT_CODE_BATCH_FAILURES = 3
+
+	BATCH_DEFAULT_WORKERS = 4
+	BATCH_MAX_WORKERS     = 32
+
+	METRICS_UPSTREAM_IPAPI         = "ipapi"
+	METRICS_UPSTREAM_RESTCOUNTRIES = "restcountries"
+	METRICS_UPSTREAM_FIXER         = "fixer"
+	METRICS_CODE_OK                = "ok"
+	METRICS_STATUS_NO_RESPONSE     = "none"
+	METRICS_CACHE_HIT              = "hit"
+	METRICS_CACHE_MISS             = "miss"
+	METRICS_CACHE_EXPIRED          = "expired"
+	METRICS_CACHE_IP               = "ip"
+	METRICS_CACHE_COUNTRY          = "country"
+	METRICS_CACHE_CURRENCY         = "currency"
+	METRICS_CACHE_RATES_HISTORY    = "rates_history"
+	METRICS_CONTENT_TYPE           = "text/plain; version=0.0.4; charset=utf-8"
+	METRICS_RETRY_TIMEOUT          = "timeout"
+)
+
+// ToRadians converts degrees to radians.
+func ToRadians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+// GetEstimatedDistance calculates the distance between two geographic points
+// (given in latitude and longitude) using the Haversine formula and returns it as a string.
+func GetEstimatedDistance(lat1, lon1, lat2, lon2 float64) string {
+	return strconv.Itoa(int(EstimatedDistance(lat1, lon1, lat2, lon2)))
+}
+
+// EstimatedDistance calculates the distance in kms between two geographic points (given in
+// latitude and longitude) using the Haversine formula.
+func EstimatedDistance(lat1, lon1, lat2, lon2 float64) float64 {
+	lat1 = ToRadians(lat1)
+	lon1 = ToRadians(lon1)
+	lat2 = ToRadians(lat2)
+	lon2 = ToRadians(lon2)
+
+	dLat := lat2 - lat1
+	dLon := lon2 - lon1
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*
+			math.Sin(dLon/2)*math.Sin(dLon/2)
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+
+	return EARTH_RADIUS * c
+}
+
+// CanonicalIp parses an IPv4 or IPv6 address and returns its canonical notation, so the
+// same address written in different forms (compressed, expanded, IPv4-mapped) results in
+// the same string. It reports false when the address is not valid.
+func CanonicalIp(ipStr string) (string, bool) {
+	addr, err := netip.ParseAddr(ipStr)
+	if err != nil {
+		return "", false
+	}
+	return addr.WithZone("").Unmap().String(), true
+}
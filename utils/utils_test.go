@@ -1,41 +1,68 @@
-package utils
-
-import (
-	"math"
-	"strconv"
-	"testing"
-
-	"github.com/stretchr/testify/require"
-)
-
-func TestGetEstimatedDistance(t *testing.T) {
-	lat1, lon1 := 34.6037, -58.3816
-	lat2, lon2 := 40.4168, -3.7038
-
-	distance := GetEstimatedDistance(lat1, lon1, lat2, lon2)
-	distanceNumber, err := strconv.ParseInt(distance, 0, 64)
-	require.NoError(t, err)
-	if int(distanceNumber) >= 6700 && distanceNumber < 6900 {
-		t.Error("expected distance to be greater than 6700 and lower than 6900")
-	}
-}
-
-func TestToRadians(t *testing.T) {
-	tests := []struct {
-		degrees float64
-		radians float64
-	}{
-		{0, 0},
-		{180, math.Pi},
-		{90, math.Pi / 2},
-		{360, 2 * math.Pi},
-		{45, math.Pi / 4},
-	}
-
-	for _, value := range tests {
-		result := ToRadians(value.degrees)
-		if math.Abs(result-value.radians) > 1e-9 {
-			t.Errorf("ToRadians(%f) = %f; want %f", value.degrees, result, value.radians)
-		}
-	}
-}
+package utils
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetEstimatedDistance(t *testing.T) {
+	lat1, lon1 := 34.6037, -58.3816
+	lat2, lon2 := 40.4168, -3.7038
+
+	distance := GetEstimatedDistance(lat1, lon1, lat2, lon2)
+	distanceNumber, err := strconv.ParseInt(distance, 0, 64)
+	require.NoError(t, err)
+	if int(distanceNumber) >= 6700 && distanceNumber < 6900 {
+		t.Error("expected distance to be greater than 6700 and lower than 6900")
+	}
+}
+
+func TestToRadians(t *testing.T) {
+	tests := []struct {
+		degrees float64
+		radians float64
+	}{
+		{0, 0},
+		{180, math.Pi},
+		{90, math.Pi / 2},
+		{360, 2 * math.Pi},
+		{45, math.Pi / 4},
+	}
+
+	for _, value := range tests {
+		result := ToRadians(value.degrees)
+		if math.Abs(result-value.radians) > 1e-9 {
+			t.Errorf("ToRadians(%f) = %f; want %f", value.degrees, result, value.radians)
+		}
+	}
+}
+
+func TestCanonicalIp(t *testing.T) {
+	tests := []struct {
+		ip       string
+		expected string
+		valid    bool
+	}{
+		{"1.1.1.1", "1.1.1.1", true},
+		{"::ffff:1.1.1.1", "1.1.1.1", true},
+		{"::FFFF:101:101", "1.1.1.1", true},
+		{"2800:810:400::1", "2800:810:400::1", true},
+		{"2800:0810:0400:0000:0000:0000:0000:0001", "2800:810:400::1", true},
+		{"2800:810:400:0:0::1", "2800:810:400::1", true},
+		{"2800:810:400::1%eth0", "2800:810:400::1", true},
+		{"256.256.256.256", "", false},
+		{"2800:810:400::1::1", "", false},
+		{"invalid_ip", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			result, valid := CanonicalIp(tt.ip)
+			require.Equal(t, tt.valid, valid)
+			require.Equal(t, tt.expected, result)
+		})
+	}
+}